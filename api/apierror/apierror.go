@@ -0,0 +1,265 @@
+// Package apierror is the error model of the API. Every error response is an
+// RFC 7807 problem (application/problem+json) with a code from the catalogue
+// below. Clients switch on the code; the detail is written for people and
+// may change.
+//
+//	{
+//	  "type": "/problems/validation_failed",
+//	  "title": "The request has invalid fields",
+//	  "status": 422,
+//	  "detail": "Required Email",
+//	  "code": "validation_failed",
+//	  "errors": [{"field": "email", "code": "required", "message": "Required Email"}]
+//	}
+package apierror
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/task/api/dberror"
+)
+
+// The codes of the catalogue.
+const (
+	BadRequest           = "bad_request"
+	InvalidRequest       = "invalid_request"
+	ValidationFailed     = "validation_failed"
+	Unauthorized         = "unauthorized"
+	InvalidCredentials   = "invalid_credentials"
+	Forbidden            = "forbidden"
+	NotFound             = "not_found"
+	UserNotFound         = "user_not_found"
+	SellerNotFound       = "seller_not_found"
+	ProductNotFound      = "product_not_found"
+	VariantNotFound      = "variant_not_found"
+	CategoryNotFound     = "category_not_found"
+	ImageNotFound        = "image_not_found"
+	NotificationNotFound = "notification_not_found"
+	SubscriptionNotFound = "subscription_not_found"
+	WebhookNotFound      = "webhook_not_found"
+	DeliveryNotFound     = "delivery_not_found"
+	MethodNotAllowed     = "method_not_allowed"
+	Conflict             = "conflict"
+	UsernameTaken        = "username_taken"
+	EmailTaken           = "email_taken"
+	ProductNameTaken     = "product_name_taken"
+	CategoryNameTaken    = "category_name_taken"
+	SKUTaken             = "sku_taken"
+	VariantExists        = "variant_exists"
+	VariantsExist        = "variants_exist"
+	InvalidReference     = "invalid_reference"
+	SellerDeleted        = "seller_deleted"
+	InsufficientStock    = "insufficient_stock"
+	InsufficientBalance  = "insufficient_balance"
+	VariantRequired      = "variant_required"
+	IdempotencyKeyReused = "idempotency_key_reused"
+	IdempotencyKeyInUse  = "idempotency_key_in_use"
+	PayloadTooLarge      = "payload_too_large"
+	UnsupportedMediaType = "unsupported_media_type"
+	RateLimited          = "rate_limited"
+	Internal             = "internal_error"
+	Unavailable          = "unavailable"
+)
+
+// Entry is a code of the catalogue with its status and title.
+type Entry struct {
+	Code   string `json:"code"`
+	Status int    `json:"status"`
+	Title  string `json:"title"`
+}
+
+// Catalogue lists every code the API answers with.
+var Catalogue = []Entry{
+	{BadRequest, http.StatusBadRequest, "The request is malformed"},
+	{InvalidRequest, http.StatusUnprocessableEntity, "The request can not be processed"},
+	{ValidationFailed, http.StatusUnprocessableEntity, "The request has invalid fields"},
+	{Unauthorized, http.StatusUnauthorized, "A valid token is required"},
+	{InvalidCredentials, http.StatusUnauthorized, "The email or password is wrong"},
+	{Forbidden, http.StatusForbidden, "The token does not allow this"},
+	{NotFound, http.StatusNotFound, "Not found"},
+	{UserNotFound, http.StatusNotFound, "User not found"},
+	{SellerNotFound, http.StatusNotFound, "Seller not found"},
+	{ProductNotFound, http.StatusNotFound, "Product not found"},
+	{VariantNotFound, http.StatusNotFound, "Variant not found"},
+	{CategoryNotFound, http.StatusNotFound, "Category not found"},
+	{ImageNotFound, http.StatusNotFound, "Image not found"},
+	{NotificationNotFound, http.StatusNotFound, "Notification not found"},
+	{SubscriptionNotFound, http.StatusNotFound, "Restock subscription not found"},
+	{WebhookNotFound, http.StatusNotFound, "Webhook not found"},
+	{DeliveryNotFound, http.StatusNotFound, "Webhook delivery not found"},
+	{MethodNotAllowed, http.StatusMethodNotAllowed, "The method is not allowed"},
+	{Conflict, http.StatusConflict, "The request conflicts with the current state"},
+	{UsernameTaken, http.StatusConflict, "The username is taken"},
+	{EmailTaken, http.StatusConflict, "The email is taken"},
+	{ProductNameTaken, http.StatusConflict, "The product name is taken"},
+	{CategoryNameTaken, http.StatusConflict, "The category name is taken"},
+	{SKUTaken, http.StatusConflict, "The SKU is taken"},
+	{VariantExists, http.StatusConflict, "A variant with these options exists"},
+	{VariantsExist, http.StatusConflict, "The product has variants"},
+	{InvalidReference, http.StatusConflict, "A referenced resource is missing or still in use"},
+	{SellerDeleted, http.StatusConflict, "The seller is deleted"},
+	{InsufficientStock, http.StatusConflict, "Not enough stock"},
+	{InsufficientBalance, http.StatusConflict, "Not enough deposit"},
+	{VariantRequired, http.StatusUnprocessableEntity, "A variant must be chosen"},
+	{IdempotencyKeyReused, http.StatusUnprocessableEntity, "The idempotency key was used for another request"},
+	{IdempotencyKeyInUse, http.StatusConflict, "A request with the idempotency key is in progress"},
+	{PayloadTooLarge, http.StatusRequestEntityTooLarge, "The request is too large"},
+	{UnsupportedMediaType, http.StatusUnsupportedMediaType, "The media type is not supported"},
+	{RateLimited, http.StatusTooManyRequests, "Too many requests"},
+	{Internal, http.StatusInternalServerError, "Internal server error"},
+	{Unavailable, http.StatusServiceUnavailable, "The service is unavailable"},
+}
+
+var entries = map[string]Entry{}
+
+func init() {
+	for _, entry := range Catalogue {
+		entries[entry.Code] = entry
+	}
+}
+
+// Lookup returns the entry of a code.
+func Lookup(code string) (Entry, bool) {
+	entry, ok := entries[code]
+	return entry, ok
+}
+
+// FieldError is a problem with one field of the request.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Error is an error with its code. Status is the status of the code unless
+// set.
+type Error struct {
+	Code   string
+	Status int
+	Detail string
+	Fields []FieldError
+}
+
+func (e *Error) Error() string { return e.Detail }
+
+// New returns an error with a code of the catalogue.
+func New(code, detail string) *Error {
+	return &Error{Code: code, Status: entries[code].Status, Detail: detail}
+}
+
+// Validation returns a validation_failed error of the fields.
+func Validation(fields ...FieldError) *Error {
+	e := New(ValidationFailed, "")
+	e.Fields = fields
+	if len(fields) > 0 {
+		e.Detail = fields[0].Message
+	}
+	return e
+}
+
+// Required returns the validation error of a missing field, named by its
+// JSON name.
+func Required(field, message string) *Error {
+	return Validation(FieldError{Field: field, Code: "required", Message: message})
+}
+
+// Invalid returns the validation error of an invalid field, named by its
+// JSON name.
+func Invalid(field, message string) *Error {
+	return Validation(FieldError{Field: field, Code: "invalid", Message: message})
+}
+
+// statuses are the codes of the statuses handlers answer with when the
+// error has no code of its own.
+var statuses = map[int]string{
+	http.StatusBadRequest:            BadRequest,
+	http.StatusUnauthorized:          Unauthorized,
+	http.StatusForbidden:             Forbidden,
+	http.StatusNotFound:              NotFound,
+	http.StatusMethodNotAllowed:      MethodNotAllowed,
+	http.StatusConflict:              Conflict,
+	http.StatusRequestEntityTooLarge: PayloadTooLarge,
+	http.StatusUnsupportedMediaType:  UnsupportedMediaType,
+	http.StatusUnprocessableEntity:   InvalidRequest,
+	http.StatusTooManyRequests:       RateLimited,
+	http.StatusServiceUnavailable:    Unavailable,
+}
+
+// unique are the codes of the unique constraints by table and columns. The
+// table only has to match when the driver tells it.
+var unique = []struct {
+	table, columns, code, detail string
+}{
+	{"users", "username", UsernameTaken, "Username Already Taken"},
+	{"users", "email", EmailTaken, "Email Already Taken"},
+	{"products", "product_name", ProductNameTaken, "Product Name Already Taken"},
+	{"categories", "name", CategoryNameTaken, "Category Name Already Taken"},
+	{"product_variants", "sku", SKUTaken, "SKU Already Taken"},
+	{"product_variants", "product_id,option_key", VariantExists, "Variant Already Exists"},
+}
+
+// constraint returns the coded error of a constraint violation, whatever
+// status the handler answers with.
+func constraint(violation *dberror.Error) *Error {
+	columns := strings.Join(violation.Columns, ",")
+	switch violation.Kind {
+	case dberror.Unique:
+		for _, u := range unique {
+			if u.columns == columns && (violation.Table == "" || violation.Table == u.table) {
+				e := New(u.code, u.detail)
+				if len(violation.Columns) == 1 {
+					e.Fields = []FieldError{{Field: columns, Code: "taken", Message: u.detail}}
+				}
+				return e
+			}
+		}
+		if columns == "" {
+			return New(Conflict, "Already Taken")
+		}
+		return New(Conflict, strings.Join(violation.Columns, ", ")+" Already Taken")
+	case dberror.ForeignKey:
+		e := New(InvalidReference, "Invalid Reference")
+		if len(violation.Columns) == 1 {
+			e.Detail = "Invalid Reference " + columns
+			e.Fields = []FieldError{{Field: columns, Code: "invalid_reference", Message: e.Detail}}
+		}
+		return e
+	}
+	if columns == "" {
+		return New(ValidationFailed, "Required Field")
+	}
+	return Validation(FieldError{Field: columns, Code: "required", Message: "Required " + columns})
+}
+
+// From returns the coded error of err, which a handler answers with status.
+// The models and the handlers return coded errors, which keep their own
+// status; constraint violations of the database are known by their driver
+// error codes. Other errors get the code of status, and the detail of
+// internal errors is not given away.
+func From(status int, err error) *Error {
+	var coded *Error
+	if errors.As(err, &coded) {
+		// the models return shared errors, answer a copy
+		e := *coded
+		if e.Status == 0 {
+			e.Status = entries[e.Code].Status
+		}
+		return &e
+	}
+	if err == nil {
+		return New(statuses[status], http.StatusText(status))
+	}
+	if violation, ok := dberror.Classify(err); ok {
+		return constraint(violation)
+	}
+	code, ok := statuses[status]
+	if !ok {
+		if status >= 500 {
+			return New(Internal, "The server could not complete the request")
+		}
+		code = BadRequest
+	}
+	return &Error{Code: code, Status: status, Detail: err.Error()}
+}
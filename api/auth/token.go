@@ -1,11 +1,8 @@
 package auth
 
 import (
-	"encoding/json"
 	"fmt"
-	"log"
 	"net/http"
-	"os"
 	"strconv"
 	"strings"
 	"time"
@@ -13,32 +10,39 @@ import (
 	jwt "github.com/dgrijalva/jwt-go"
 )
 
+// secret signs and verifies the tokens, see SetSecret.
+var secret []byte
+
+// SetSecret sets the key tokens are signed with, API_SECRET.
+func SetSecret(key string) {
+	secret = []byte(key)
+}
+
 func CreateToken(user_id uint32, role string) (string, error) {
+	return CreateTokenTTL(user_id, role, time.Hour*1) //Token expires after 1 hour
+}
+
+// CreateTokenTTL creates a token that expires after ttl.
+func CreateTokenTTL(user_id uint32, role string, ttl time.Duration) (string, error) {
 	claims := jwt.MapClaims{}
 	claims["authorized"] = true
 	claims["user_id"] = user_id
 	claims["role"] = role
-	claims["exp"] = time.Now().Add(time.Hour * 1).Unix() //Token expires after 1 hour
+	claims["exp"] = time.Now().Add(ttl).Unix()
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(os.Getenv("API_SECRET")))
+	return token.SignedString(secret)
 
 }
 
 func TokenValid(r *http.Request) error {
 	tokenString := ExtractToken(r)
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+	_, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
 		}
-		return []byte(os.Getenv("API_SECRET")), nil
+		return secret, nil
 	})
-	if err != nil {
-		return err
-	}
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		Pretty(claims)
-	}
-	return nil
+	return err
 }
 
 func ExtractToken(r *http.Request) string {
@@ -61,7 +65,7 @@ func ExtractTokenID(r *http.Request) (uint32, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
 		}
-		return []byte(os.Getenv("API_SECRET")), nil
+		return secret, nil
 	})
 	if err != nil {
 		return 0, err
@@ -77,16 +81,6 @@ func ExtractTokenID(r *http.Request) (uint32, error) {
 	return 0, nil
 }
 
-//Pretty display the claims licely in the terminal
-func Pretty(data interface{}) {
-	b, err := json.MarshalIndent(data, "", " ")
-	if err != nil {
-		log.Println(err)
-		return
-	}
-
-	fmt.Println(string(b))
-}
 func ExtractRole(r *http.Request) (string, error) {
 
 	tokenString := ExtractToken(r)
@@ -94,7 +88,7 @@ func ExtractRole(r *http.Request) (string, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
 		}
-		return []byte(os.Getenv("API_SECRET")), nil
+		return secret, nil
 	})
 	if err != nil {
 		return "", err
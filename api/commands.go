@@ -0,0 +1,254 @@
+package api
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/task/api/auth"
+	"github.com/task/api/config"
+	"github.com/task/api/models"
+	"github.com/task/api/seed"
+)
+
+const usage = `Usage: main [--config=<file>] [--<setting>=<value>...] <command> [arguments]
+
+Settings are read from the config file, .env by default, then the
+environment, then the flags: --db-host overrides DB_HOST and so on.
+
+Commands:
+  serve                                   run the API, the default
+  migrate up|down [steps]|status          apply, revert or list schema migrations
+  seed [--fixture=<file>]                 load the sample data or a fixture file
+  user create --username --email --password --role [--deposit]
+  user set-role --email --role            change the role of a user, admin included
+  user reset-password --email --password  set a new password
+  token mint --email [--ttl=1h]           print a JWT for debugging
+`
+
+// Main runs the command named by args, serving the API when there is none.
+// Every command shares the configuration and database setup of
+// Server.Initialize.
+func Main(args []string) {
+
+	if len(args) > 0 && (args[0] == "help" || args[0] == "-h" || args[0] == "--help") {
+		fmt.Print(usage)
+		return
+	}
+	cfg, args, err := config.Load(args)
+	if err != nil {
+		log.Fatal(err)
+	}
+	auth.SetSecret(cfg.APISecret.Value())
+
+	if len(args) == 0 {
+		args = []string{"serve"}
+	}
+	switch args[0] {
+	case "serve":
+		if err := Run(cfg); err != nil {
+			log.Fatal(err)
+		}
+	case "migrate":
+		migrate(cfg, args[1:])
+	case "seed":
+		seedCommand(cfg, args[1:])
+	case "user":
+		userCommand(cfg, args[1:])
+	case "token":
+		tokenCommand(cfg, args[1:])
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		log.Fatalf("Unknown command %q", args[0])
+	}
+}
+
+// connect opens the database for the commands, which must not start the
+// background workers Initialize sets up. The SQL log goes to stderr so the
+// output of a command like token mint can be piped.
+func connect(cfg *config.Config) {
+	err := server.Connect(cfg.DB)
+	if err != nil {
+		log.Fatalf("Cannot connect to the database: %v", err)
+	}
+	server.DB.SetLogger(gorm.Logger{LogWriter: log.New(os.Stderr, "\r\n", 0)})
+}
+
+func migrate(cfg *config.Config, args []string) {
+
+	connect(cfg)
+	migrator, err := server.Migrator()
+	if err != nil {
+		log.Fatal(err)
+	}
+	ctx := context.Background()
+	command := "up"
+	if len(args) > 0 {
+		command = args[0]
+	}
+	switch command {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		if err != nil {
+			log.Fatalf("Cannot migrate: %v", err)
+		}
+		for _, m := range applied {
+			fmt.Printf("applied %04d_%s\n", m.Version, m.Name)
+		}
+		fmt.Printf("%d migrations applied\n", len(applied))
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				log.Fatalf("Invalid number of steps %q", args[1])
+			}
+		}
+		reverted, err := migrator.Down(ctx, steps)
+		if err != nil {
+			log.Fatalf("Cannot migrate: %v", err)
+		}
+		for _, m := range reverted {
+			fmt.Printf("reverted %04d_%s\n", m.Version, m.Name)
+		}
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			log.Fatalf("Cannot read migration status: %v", err)
+		}
+		for _, s := range statuses {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = "applied " + s.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%04d_%s\t%s\n", s.Version, s.Name, applied)
+		}
+	default:
+		log.Fatalf("Unknown migrate command %q, use up, down [steps] or status", command)
+	}
+}
+
+// migrateUp brings the schema up to date before a command writes to it.
+func migrateUp() {
+	migrator, err := server.Migrator()
+	if err == nil {
+		_, err = migrator.Up(context.Background())
+	}
+	if err != nil {
+		log.Fatalf("Cannot migrate: %v", err)
+	}
+}
+
+func seedCommand(cfg *config.Config, args []string) {
+
+	flags := flag.NewFlagSet("seed", flag.ExitOnError)
+	fixture := flags.String("fixture", "", "JSON fixture file, the built-in sample data when empty")
+	flags.Parse(args)
+
+	connect(cfg)
+	migrateUp()
+	if *fixture == "" {
+		seed.Load(server.DB)
+		return
+	}
+	err := seed.LoadFixture(server.DB, *fixture)
+	if err != nil {
+		log.Fatalf("Cannot load fixture: %v", err)
+	}
+	fmt.Printf("loaded %s\n", *fixture)
+}
+
+func userCommand(cfg *config.Config, args []string) {
+
+	if len(args) == 0 {
+		log.Fatal("Missing user command, use create, set-role or reset-password")
+	}
+	flags := flag.NewFlagSet("user "+args[0], flag.ExitOnError)
+	username := flags.String("username", "", "username of the new user")
+	email := flags.String("email", "", "email of the user")
+	password := flags.String("password", "", "password of the user")
+	role := flags.String("role", "", "buyer, seller or admin")
+	deposit := flags.Float64("deposit", 0, "deposit of the new user")
+	flags.Parse(args[1:])
+
+	connect(cfg)
+	user := models.User{}
+	switch args[0] {
+	case "create":
+		user.Username = *username
+		user.Email = *email
+		user.Password = *password
+		user.Role = *role
+		user.Deposit = float32(*deposit)
+		user.Prepare()
+		err := user.Validate("manage")
+		if err != nil {
+			log.Fatal(err)
+		}
+		var userCreated *models.User
+		err = models.Transaction(server.DB, func(tx *gorm.DB) error {
+			userCreated, err = user.SaveUser(tx)
+			if err != nil {
+				return err
+			}
+			_, err = models.RecordEvent(tx, models.EventUserCreated, 0, userCreated)
+			return err
+		})
+		if err != nil {
+			log.Fatalf("Cannot create user: %v", err)
+		}
+		fmt.Printf("created %s user %d\n", userCreated.Role, userCreated.ID)
+	case "set-role":
+		found := findUser(*email)
+		userUpdated, err := user.UpdateAUserRole(server.DB, found.ID, *role)
+		if err != nil {
+			log.Fatalf("Cannot set role: %v", err)
+		}
+		fmt.Printf("user %d is now %s\n", userUpdated.ID, userUpdated.Role)
+	case "reset-password":
+		found := findUser(*email)
+		_, err := user.UpdateAUserPassword(server.DB, found.ID, *password)
+		if err != nil {
+			log.Fatalf("Cannot reset password: %v", err)
+		}
+		fmt.Printf("password of user %d reset\n", found.ID)
+	default:
+		log.Fatalf("Unknown user command %q, use create, set-role or reset-password", args[0])
+	}
+}
+
+func tokenCommand(cfg *config.Config, args []string) {
+
+	if len(args) == 0 || args[0] != "mint" {
+		log.Fatal("Unknown token command, use mint")
+	}
+	flags := flag.NewFlagSet("token mint", flag.ExitOnError)
+	email := flags.String("email", "", "email of the user the token is for")
+	ttl := flags.Duration("ttl", time.Hour, "how long the token is valid")
+	flags.Parse(args[1:])
+
+	connect(cfg)
+	user := findUser(*email)
+	token, err := auth.CreateTokenTTL(user.ID, user.Role, *ttl)
+	if err != nil {
+		log.Fatalf("Cannot mint token: %v", err)
+	}
+	fmt.Println(token)
+}
+
+func findUser(email string) *models.User {
+	if email == "" {
+		log.Fatal("Required Email")
+	}
+	user := models.User{}
+	found, err := user.FindUserByEmail(server.DB, email)
+	if err != nil {
+		log.Fatalf("Cannot find user %s: %v", email, err)
+	}
+	return found
+}
@@ -0,0 +1,427 @@
+// Package config loads the server configuration. Every setting has an
+// environment variable name; values come from the defaults, then the config
+// file (.env format), then the environment, then command line flags, each
+// overriding the one before. A NAME_FILE variable reads the value of NAME
+// from a file, which is how secrets are mounted in containers.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+// Secret is a value that is redacted whenever it is printed.
+type Secret string
+
+const redacted = "[redacted]"
+
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return redacted
+}
+
+func (s Secret) GoString() string { return strconv.Quote(s.String()) }
+
+func (s Secret) MarshalJSON() ([]byte, error) { return []byte(strconv.Quote(s.String())), nil }
+
+// Value returns the secret itself.
+func (s Secret) Value() string { return string(s) }
+
+// DB is the database to connect to. For sqlite DB_NAME is the path of the
+// database file, or :memory: for a database that lives as long as the process.
+type DB struct {
+	Driver   string `env:"DB_DRIVER" required:"true"`
+	Host     string `env:"DB_HOST"`
+	Port     string `env:"DB_PORT"`
+	User     string `env:"DB_USER"`
+	Password Secret `env:"DB_PASSWORD"`
+	Name     string `env:"DB_NAME" required:"true"`
+}
+
+// URL is the connection string of the database, password included.
+func (db DB) URL() string {
+	switch db.Driver {
+	case "mysql":
+		return fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8&parseTime=True&loc=Local", db.User, db.Password.Value(), db.Host, db.Port, db.Name)
+	case "postgres":
+		return fmt.Sprintf("host=%s port=%s user=%s dbname=%s sslmode=disable password=%s", db.Host, db.Port, db.User, db.Name, db.Password.Value())
+	case "sqlite":
+		// SQLite only enforces foreign keys when asked to, per connection
+		return fmt.Sprintf("file:%s?_foreign_keys=1&_busy_timeout=5000", db.Name)
+	}
+	return ""
+}
+
+type Storage struct {
+	Driver    string `env:"STORAGE_DRIVER" default:"local"`
+	LocalRoot string `env:"STORAGE_LOCAL_ROOT" default:"uploads"`
+	// BaseURL is where the local store serves images, /images when empty,
+	// or the public URL of the S3 bucket.
+	BaseURL     string `env:"STORAGE_BASE_URL"`
+	S3Endpoint  string `env:"S3_ENDPOINT"`
+	S3Region    string `env:"S3_REGION" default:"us-east-1"`
+	S3Bucket    string `env:"S3_BUCKET"`
+	S3AccessKey string `env:"S3_ACCESS_KEY"`
+	S3SecretKey Secret `env:"S3_SECRET_KEY"`
+}
+
+type Notify struct {
+	Channels     []string `env:"NOTIFY_CHANNELS" default:"inbox"`
+	SMTPAddr     string   `env:"SMTP_ADDR"`
+	SMTPFrom     string   `env:"SMTP_FROM"`
+	SMTPUsername string   `env:"SMTP_USERNAME"`
+	SMTPPassword Secret   `env:"SMTP_PASSWORD"`
+	WebhookURL   string   `env:"NOTIFY_WEBHOOK_URL"`
+}
+
+type Webhooks struct {
+	PollInterval time.Duration `env:"WEBHOOK_POLL_INTERVAL" default:"5s"`
+	Backoff      time.Duration `env:"WEBHOOK_BACKOFF" default:"30s"`
+	MaxAttempts  int           `env:"WEBHOOK_MAX_ATTEMPTS" default:"8"`
+	AllowPrivate bool          `env:"WEBHOOK_ALLOW_PRIVATE" default:"false"`
+}
+
+// Events are published from the outbox every PollInterval. Published events
+// are kept for Retention, zero keeps them forever, and purged every
+// PurgeInterval.
+type Events struct {
+	PollInterval  time.Duration `env:"EVENT_POLL_INTERVAL" default:"1s"`
+	Brokers       []string      `env:"EVENT_BROKERS"`
+	Retention     time.Duration `env:"EVENT_RETENTION" default:"720h"`
+	PurgeInterval time.Duration `env:"EVENT_PURGE_INTERVAL" default:"1h"`
+}
+
+// HTTP has the timeouts of the server. WriteTimeout does not apply to the
+// product streams, which stay open until the client or the server leaves.
+type HTTP struct {
+	ReadHeaderTimeout time.Duration `env:"HTTP_READ_HEADER_TIMEOUT" default:"10s"`
+	ReadTimeout       time.Duration `env:"HTTP_READ_TIMEOUT" default:"30s"`
+	WriteTimeout      time.Duration `env:"HTTP_WRITE_TIMEOUT" default:"30s"`
+	IdleTimeout       time.Duration `env:"HTTP_IDLE_TIMEOUT" default:"120s"`
+	// ShutdownTimeout is how long in-flight requests get to finish on
+	// SIGTERM before their connections are closed.
+	ShutdownTimeout time.Duration `env:"SHUTDOWN_TIMEOUT" default:"30s"`
+}
+
+// Log sets how much is logged and how. SQL statements are only logged at
+// the debug level.
+type Log struct {
+	Level  string `env:"LOG_LEVEL" default:"info"`
+	Format string `env:"LOG_FORMAT" default:"json"`
+}
+
+// Tracing sends OpenTelemetry traces: otlp posts them to TRACING_ENDPOINT,
+// stdout prints them, none turns tracing off.
+type Tracing struct {
+	Exporter    string `env:"TRACING_EXPORTER" default:"none"`
+	Endpoint    string `env:"TRACING_ENDPOINT" default:"http://localhost:4318/v1/traces"`
+	ServiceName string `env:"TRACING_SERVICE_NAME" default:"task"`
+}
+
+// RateLimit has the limits of the route groups written requests/period, e.g.
+// 5/1m, or off. Default applies to every route, the others on top of it.
+type RateLimit struct {
+	Default string `env:"RATE_LIMIT_DEFAULT" default:"600/1m"`
+	Login   string `env:"RATE_LIMIT_LOGIN" default:"10/1m"`
+	Signup  string `env:"RATE_LIMIT_SIGNUP" default:"10/1h"`
+	Buy     string `env:"RATE_LIMIT_BUY" default:"60/1m"`
+	// TrustedProxies are the addresses or CIDRs of the proxies whose
+	// X-Forwarded-For and X-Real-IP headers are believed.
+	TrustedProxies []string `env:"TRUSTED_PROXIES"`
+}
+
+// OpenAPI checks the requests, and the responses, against the OpenAPI
+// document. Checking the responses buffers them, it is meant for tests.
+type OpenAPI struct {
+	ValidateRequests  bool `env:"OPENAPI_VALIDATE_REQUESTS" default:"false"`
+	ValidateResponses bool `env:"OPENAPI_VALIDATE_RESPONSES" default:"false"`
+}
+
+type Config struct {
+	Addr           string `env:"HTTP_ADDR" default:":8080"`
+	HTTP           HTTP
+	Log            Log
+	Tracing        Tracing
+	RateLimit      RateLimit
+	APISecret      Secret `env:"API_SECRET" required:"true"`
+	DB             DB
+	MigrateOnStart bool `env:"MIGRATE_ON_START" default:"true"`
+	Storage        Storage
+	ImageMaxBytes  int64 `env:"IMAGE_MAX_BYTES" default:"5242880"`
+	// BodyMaxBytes limits the JSON bodies of requests.
+	BodyMaxBytes int64 `env:"BODY_MAX_BYTES" default:"1048576"`
+	// Soft deleted users and products are purged after SoftDeleteRetention,
+	// zero keeps them forever.
+	SoftDeleteRetention time.Duration `env:"SOFT_DELETE_RETENTION" default:"720h"`
+	PurgeInterval       time.Duration `env:"PURGE_INTERVAL" default:"1h"`
+	Notify              Notify
+	Webhooks            Webhooks
+	Events              Events
+	StreamHeartbeat     time.Duration `env:"STREAM_HEARTBEAT" default:"15s"`
+	// StreamOrigins are the origins of the pages allowed to open the product
+	// WebSocket besides the API's own, * allows any.
+	StreamOrigins []string `env:"STREAM_ALLOWED_ORIGINS"`
+	// MetricsToken, when set, is the bearer token GET /metrics requires.
+	MetricsToken Secret `env:"METRICS_TOKEN"`
+	OpenAPI      OpenAPI
+	// Idempotency keys expire after a day and are purged every
+	// IdempotencyKeyPurgeInterval.
+	IdempotencyKeyPurgeInterval time.Duration `env:"IDEMPOTENCY_KEY_PURGE_INTERVAL" default:"1h"`
+}
+
+// field is a setting of Config found by walking its struct tags.
+type field struct {
+	name     string
+	required bool
+	value    reflect.Value
+	def      string
+}
+
+func fields(cfg *Config) []field {
+	all := []field{}
+	var walk func(v reflect.Value)
+	walk = func(v reflect.Value) {
+		for i := 0; i < v.NumField(); i++ {
+			sf := v.Type().Field(i)
+			name, ok := sf.Tag.Lookup("env")
+			if !ok {
+				if sf.Type.Kind() == reflect.Struct {
+					walk(v.Field(i))
+				}
+				continue
+			}
+			all = append(all, field{
+				name:     name,
+				required: sf.Tag.Get("required") == "true",
+				value:    v.Field(i),
+				def:      sf.Tag.Get("default"),
+			})
+		}
+	}
+	walk(reflect.ValueOf(cfg).Elem())
+	return all
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+func (f field) set(raw string) error {
+	v := f.value
+	switch {
+	case v.Type() == durationType:
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("invalid %s %q: %v", f.name, raw, err)
+		}
+		v.SetInt(int64(d))
+	case v.Kind() == reflect.String:
+		v.SetString(raw)
+	case v.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("invalid %s %q: %v", f.name, raw, err)
+		}
+		v.SetBool(b)
+	case v.Kind() == reflect.Int || v.Kind() == reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid %s %q: %v", f.name, raw, err)
+		}
+		v.SetInt(n)
+	case v.Kind() == reflect.Slice:
+		list := []string{}
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		v.Set(reflect.ValueOf(list))
+	default:
+		return fmt.Errorf("%s has an unsupported type %s", f.name, v.Type())
+	}
+	return nil
+}
+
+func (f field) String() string {
+	v := f.value
+	switch {
+	case v.Type() == durationType:
+		return time.Duration(v.Int()).String()
+	case v.Kind() == reflect.Slice:
+		return strings.Join(v.Interface().([]string), ",")
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+// lookup returns the value of name in a source, reading NAME_FILE when only
+// that is set. An empty value is unset, as it was with os.Getenv, so it does
+// not reset what an earlier source set.
+func lookup(source func(string) (string, bool), name string) (string, bool, error) {
+	if value, ok := source(name); ok && value != "" {
+		return value, true, nil
+	}
+	path, ok := source(name + "_FILE")
+	if !ok || path == "" {
+		return "", false, nil
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", false, fmt.Errorf("cannot read %s_FILE: %v", name, err)
+	}
+	return strings.TrimRight(string(b), "\r\n"), true, nil
+}
+
+// FlagName is the command line flag of a setting, DB_HOST is --db-host.
+func FlagName(name string) string {
+	return strings.ToLower(strings.Replace(name, "_", "-", -1))
+}
+
+// Load reads the configuration, parsing the flags at the start of args and
+// returning the arguments after them. The config file is .env unless
+// --config or CONFIG_FILE names another; only a file named explicitly has
+// to exist.
+func Load(args []string) (*Config, []string, error) {
+
+	cfg := &Config{}
+	all := fields(cfg)
+
+	flags := flag.NewFlagSet("main", flag.ContinueOnError)
+	configFile := flags.String("config", "", "config file in .env format, .env by default")
+	names := map[string]string{}
+	for _, f := range all {
+		flags.String(FlagName(f.name), "", "overrides "+f.name)
+		names[FlagName(f.name)] = f.name
+	}
+	if err := flags.Parse(args); err != nil {
+		return nil, nil, err
+	}
+	setFlags := map[string]string{}
+	flags.Visit(func(fl *flag.Flag) {
+		if name, ok := names[fl.Name]; ok {
+			setFlags[name] = fl.Value.String()
+		}
+	})
+
+	path, explicit := *configFile, true
+	if path == "" {
+		path, explicit = os.Getenv("CONFIG_FILE"), os.Getenv("CONFIG_FILE") != ""
+	}
+	if path == "" {
+		path = ".env"
+	}
+	file, err := godotenv.Read(path)
+	if err != nil {
+		if explicit || !os.IsNotExist(err) {
+			return nil, nil, fmt.Errorf("cannot read config file %s: %v", path, err)
+		}
+		file = map[string]string{}
+	}
+
+	sources := []func(string) (string, bool){
+		func(name string) (string, bool) { value, ok := file[name]; return value, ok },
+		os.LookupEnv,
+		func(name string) (string, bool) { value, ok := setFlags[name]; return value, ok },
+	}
+	for _, f := range all {
+		raw := f.def
+		for _, source := range sources {
+			value, ok, err := lookup(source, f.name)
+			if err != nil {
+				return nil, nil, err
+			}
+			if ok {
+				raw = value
+			}
+		}
+		if raw == "" {
+			continue
+		}
+		if err := f.set(raw); err != nil {
+			return nil, nil, err
+		}
+	}
+	return cfg, flags.Args(), cfg.Validate()
+}
+
+// Validate checks the required settings and the ones that must be one of a
+// few values, reporting every problem at once.
+func (cfg *Config) Validate() error {
+	problems := []string{}
+	for _, f := range fields(cfg) {
+		if f.required && f.value.IsZero() {
+			problems = append(problems, f.name+" is required")
+		}
+	}
+	switch cfg.DB.Driver {
+	case "postgres", "mysql", "sqlite", "":
+	default:
+		problems = append(problems, fmt.Sprintf("DB_DRIVER %q is not supported, use postgres, mysql or sqlite", cfg.DB.Driver))
+	}
+	switch cfg.Log.Level {
+	case "trace", "debug", "info", "warn", "warning", "error", "fatal", "panic":
+	default:
+		problems = append(problems, fmt.Sprintf("LOG_LEVEL %q is not supported, use debug, info, warn or error", cfg.Log.Level))
+	}
+	switch cfg.Log.Format {
+	case "json", "text":
+	default:
+		problems = append(problems, fmt.Sprintf("LOG_FORMAT %q is not supported, use json or text", cfg.Log.Format))
+	}
+	switch cfg.Tracing.Exporter {
+	case "none", "otlp", "stdout", "":
+	default:
+		problems = append(problems, fmt.Sprintf("TRACING_EXPORTER %q is not supported, use otlp, stdout or none", cfg.Tracing.Exporter))
+	}
+	switch cfg.Storage.Driver {
+	case "local":
+	case "s3":
+		if cfg.Storage.S3Bucket == "" {
+			problems = append(problems, "S3_BUCKET is required for the s3 storage driver")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("STORAGE_DRIVER %q is not supported, use local or s3", cfg.Storage.Driver))
+	}
+	for _, channel := range cfg.Notify.Channels {
+		switch channel {
+		case "inbox":
+		case "email":
+			if cfg.Notify.SMTPAddr == "" || cfg.Notify.SMTPFrom == "" {
+				problems = append(problems, "SMTP_ADDR and SMTP_FROM are required for the email channel")
+			}
+		case "webhook":
+			if cfg.Notify.WebhookURL == "" {
+				problems = append(problems, "NOTIFY_WEBHOOK_URL is required for the webhook channel")
+			}
+		default:
+			problems = append(problems, fmt.Sprintf("unknown notification channel %q", channel))
+		}
+	}
+	for _, broker := range cfg.Events.Brokers {
+		if broker != "log" {
+			problems = append(problems, fmt.Sprintf("unknown event broker %q", broker))
+		}
+	}
+	if len(problems) > 0 {
+		return errors.New("invalid configuration: " + strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// String lists every setting as NAME=value with the secrets redacted.
+func (cfg *Config) String() string {
+	lines := []string{}
+	for _, f := range fields(cfg) {
+		lines = append(lines, f.name+"="+f.String())
+	}
+	return strings.Join(lines, "\n")
+}
@@ -1,58 +1,306 @@
 package controllers
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
+	"net"
 	"net/http"
+	"os"
+	"sync/atomic"
+	"time"
 
+	"github.com/getkin/kin-openapi/openapi3"
 	"github.com/gorilla/mux"
 	"github.com/jinzhu/gorm"
+	"github.com/sirupsen/logrus"
 
 	_ "github.com/jinzhu/gorm/dialects/mysql"    //mysql database driver
 	_ "github.com/jinzhu/gorm/dialects/postgres" //postgres database driver
+	_ "github.com/jinzhu/gorm/dialects/sqlite"   //sqlite database driver
 
+	"github.com/task/api/auth"
+	"github.com/task/api/config"
+	"github.com/task/api/events"
+	"github.com/task/api/logging"
+	"github.com/task/api/metrics"
+	"github.com/task/api/migrations"
 	"github.com/task/api/models"
+	"github.com/task/api/notify"
+	"github.com/task/api/ratelimit"
+	"github.com/task/api/realtime"
+	"github.com/task/api/repository"
+	"github.com/task/api/responses"
+	"github.com/task/api/storage"
+	"github.com/task/api/tracing"
+	"github.com/task/api/validation"
+	"github.com/task/api/webhooks"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Server struct {
-	DB     *gorm.DB
-	Router *mux.Router
+	DB *gorm.DB
+	// Log is the logger of the server, the standard logger when nil.
+	Log *logrus.Logger
+	// Metrics counts requests and sales, nothing is counted when nil.
+	Metrics *metrics.Metrics
+	// Tracing traces requests and their queries, nothing is traced when nil.
+	Tracing trace.TracerProvider
+	// Limiter rate limits the clients, nothing is limited when nil.
+	Limiter *ratelimit.Limiter
+	// Users and Products store the users and products, on DB when nil.
+	// Without a DB only the handlers that read through them work, the
+	// writes that record an event answer 503, see hasDatabase.
+	Users    repository.UserRepository
+	Products repository.ProductRepository
+	Router   *mux.Router
+	Store    storage.BlobStore
+	// Notifier delivers stock notifications, the in-app inbox when nil.
+	Notifier notify.Notifier
+	// Bus has the in-process subscribers of the domain events, Outbox
+	// publishes the recorded events to it.
+	Bus    *events.Bus
+	Outbox *events.Dispatcher
+	// Hub streams product updates to SSE and WebSocket clients.
+	Hub *realtime.Hub
+	// StreamHeartbeat is the keep-alive interval of the streams, 15s when zero.
+	StreamHeartbeat time.Duration
+	// StreamOrigins are the other origins allowed to open the WebSocket.
+	StreamOrigins []string
+	// ImageMaxBytes limits product image uploads, 5MB when zero.
+	ImageMaxBytes int64
+	// BodyMaxBytes limits JSON request bodies, 1MB when zero.
+	BodyMaxBytes int64
+	// WebhookAllowPrivate lets webhooks point at private addresses.
+	WebhookAllowPrivate bool
+	// draining is set once shutdown starts, /readyz fails from then on.
+	draining int32
+	// metricsToken protects GET /metrics when set.
+	metricsToken string
+	// OpenAPI documents the routes, requests and responses are checked
+	// against it as openAPIValidation says.
+	OpenAPI           *openapi3.T
+	openAPIValidation config.OpenAPI
 }
 
-func (server *Server) Initialize(Dbdriver, DbUser, DbPassword, DbPort, DbHost, DbName string) {
+// Initialize connects to the database, migrates it unless MIGRATE_ON_START
+// is false, and sets up the components and routes.
+func (server *Server) Initialize(cfg *config.Config) error {
 
 	var err error
+	if server.Log == nil {
+		server.Log, err = logging.New(cfg.Log, os.Stdout)
+		if err != nil {
+			return fmt.Errorf("cannot initialize logging: %v", err)
+		}
+	}
 
-	if Dbdriver == "mysql" {
-		DBURL := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8&parseTime=True&loc=Local", DbUser, DbPassword, DbHost, DbPort, DbName)
-		server.DB, err = gorm.Open(Dbdriver, DBURL)
+	err = server.Connect(cfg.DB)
+	if err != nil {
+		return fmt.Errorf("cannot connect to %s database: %v", cfg.DB.Driver, err)
+	}
+	server.DB.SetLogger(logging.Gorm{Log: server.Log})
+	if server.Log.IsLevelEnabled(logrus.DebugLevel) {
+		server.DB.LogMode(true)
+	}
+	tracing.RegisterCallbacks(server.DB, tracing.Tracer(server.Tracing))
+	server.Log.Infof("We are connected to the %s database", cfg.DB.Driver)
+
+	// MIGRATE_ON_START=false leaves the schema to the migrate command
+	if cfg.MigrateOnStart {
+		migrator, err := server.Migrator()
+		if err == nil {
+			_, err = migrator.Up(context.Background())
+		}
 		if err != nil {
-			fmt.Printf("Cannot connect to %s database", Dbdriver)
-			log.Fatal("This is the error:", err)
-		} else {
-			fmt.Printf("We are connected to the %s database", Dbdriver)
+			return fmt.Errorf("cannot migrate the database: %v", err)
 		}
 	}
-	if Dbdriver == "postgres" {
-		DBURL := fmt.Sprintf("host=%s port=%s user=%s dbname=%s sslmode=disable password=%s", DbHost, DbPort, DbUser, DbName, DbPassword)
-		server.DB, err = gorm.Open(Dbdriver, DBURL)
-		log.Println(DBURL)
+
+	auth.SetSecret(cfg.APISecret.Value())
+
+	server.Store, err = storage.New(cfg.Storage)
+	if err != nil {
+		return fmt.Errorf("cannot initialize storage: %v", err)
+	}
+	server.ImageMaxBytes = cfg.ImageMaxBytes
+	server.BodyMaxBytes = cfg.BodyMaxBytes
+	server.WebhookAllowPrivate = cfg.Webhooks.AllowPrivate
+
+	server.Notifier, err = notify.New(cfg.Notify, &notify.InboxNotifier{DB: server.DB})
+	if err != nil {
+		return fmt.Errorf("cannot initialize notifications: %v", err)
+	}
+
+	server.Bus = events.NewBus()
+	server.Bus.Subscribe(events.All, webhooks.Enqueue(server.DB))
+	server.Bus.Subscribe(models.EventStockChanged, server.onStockChanged)
+	server.Hub = realtime.NewHub()
+	for _, eventType := range realtime.Types {
+		server.Bus.Subscribe(eventType, server.Hub.Handle)
+	}
+	server.StreamHeartbeat = cfg.StreamHeartbeat
+	server.StreamOrigins = cfg.StreamOrigins
+	brokers, err := events.NewBrokers(cfg.Events.Brokers)
+	if err != nil {
+		return fmt.Errorf("cannot initialize event brokers: %v", err)
+	}
+	server.Outbox = &events.Dispatcher{DB: server.DB, Bus: server.Bus, Brokers: brokers, Log: server.Log}
+
+	if server.Limiter == nil {
+		server.Limiter, err = ratelimit.New(cfg.RateLimit, ratelimit.NewMemory())
 		if err != nil {
-			fmt.Printf("Cannot connect to %s database", Dbdriver)
-			log.Fatal("This is the error:", err)
-		} else {
-			fmt.Printf("We are connected to the %s database", Dbdriver)
+			return fmt.Errorf("cannot initialize rate limiting: %v", err)
 		}
 	}
 
-	server.DB.Debug().AutoMigrate(&models.User{}, &models.Product{}) //database migration
+	server.Metrics = metrics.New(server.DB.DB())
+	server.metricsToken = cfg.MetricsToken.Value()
+
+	server.openAPIValidation = cfg.OpenAPI
 
 	server.Router = mux.NewRouter()
 
-	server.initializeRoutes()
+	err = server.initializeRoutes()
+	if err != nil {
+		return fmt.Errorf("cannot build the OpenAPI document: %v", err)
+	}
+	return nil
+}
+
+// Connect opens the database without touching its schema.
+func (server *Server) Connect(cfg config.DB) error {
+
+	dialect := cfg.Driver
+	switch cfg.Driver {
+	case "mysql", "postgres":
+	case "sqlite":
+		dialect = "sqlite3"
+	default:
+		return fmt.Errorf("unsupported database driver %q, use postgres, mysql or sqlite", cfg.Driver)
+	}
+	db, err := gorm.Open(dialect, cfg.URL())
+	if err != nil {
+		return err
+	}
+	if cfg.Driver == "sqlite" {
+		// SQLite has one writer at a time, and every connection to :memory:
+		// would get a database of its own
+		db.DB().SetMaxOpenConns(1)
+	}
+	server.DB = db
+	return nil
+}
+
+// Migrator migrates the schema of the connected database.
+func (server *Server) Migrator() (*migrations.Migrator, error) {
+	return migrations.New(server.DB.DB(), server.DB.Dialect().GetName())
+}
+
+func (server *Server) logger() *logrus.Logger {
+	if server.Log != nil {
+		return server.Log
+	}
+	return logrus.StandardLogger()
+}
+
+// log is the logger of a request, carrying its request_id.
+func (server *Server) log(r *http.Request) logrus.FieldLogger {
+	if log, ok := logging.FromContext(r.Context()); ok {
+		return log
+	}
+	return server.logger()
+}
+
+// db is the database for the handler of r, its queries are traced as part
+// of the request.
+func (server *Server) db(r *http.Request) *gorm.DB {
+	return tracing.WithContext(server.DB, r.Context())
+}
+
+// hasDatabase answers 503 unless the server has a database. The writes that
+// record an outbox event commit in a *gorm.DB transaction, which a server on
+// the repositories alone, like the in-memory one, does not have.
+func (server *Server) hasDatabase(w http.ResponseWriter) bool {
+	if server.DB == nil {
+		responses.ERROR(w, http.StatusServiceUnavailable, errors.New("Database Unavailable"))
+		return false
+	}
+	return true
+}
+
+// decode reads the JSON body of r into v and validates it, see
+// validation.Decode.
+func (server *Server) decode(r *http.Request, v interface{}) error {
+	return validation.Decode(r, server.BodyMaxBytes, v)
+}
+
+func (server *Server) users(ctx context.Context) repository.UserRepository {
+	if server.Users != nil {
+		return server.Users
+	}
+	return &repository.GormUsers{DB: tracing.WithContext(server.DB, ctx)}
 }
 
-func (server *Server) Run(addr string) {
-	fmt.Println("Listening to port " + addr)
-	log.Fatal(http.ListenAndServe(addr, server.Router))
+func (server *Server) products(ctx context.Context) repository.ProductRepository {
+	if server.Products != nil {
+		return server.Products
+	}
+	return &repository.GormProducts{DB: tracing.WithContext(server.DB, ctx)}
+}
+
+// wakeOutbox publishes the events a request just committed without waiting
+// for the next poll.
+func (server *Server) wakeOutbox() {
+	server.Outbox.Wake()
+}
+
+// connKey is the request context key of the connection, for the handlers
+// that change its deadlines.
+type connKey struct{}
+
+// HTTPServer is the http.Server of the API with the timeouts of cfg.
+func (server *Server) HTTPServer(addr string, cfg config.HTTP) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           server.Router,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		ConnContext: func(ctx context.Context, c net.Conn) context.Context {
+			return context.WithValue(ctx, connKey{}, c)
+		},
+	}
+}
+
+// Serve listens on addr until ctx is done, then stops accepting connections
+// and gives the requests in flight, purchases included, up to
+// cfg.ShutdownTimeout to finish. Open product streams are ended right away.
+func (server *Server) Serve(ctx context.Context, addr string, cfg config.HTTP) error {
+
+	httpServer := server.HTTPServer(addr, cfg)
+	if server.Hub != nil {
+		httpServer.RegisterOnShutdown(server.Hub.Close)
+	}
+	errs := make(chan error, 1)
+	go func() {
+		server.logger().Info("Listening to port " + addr)
+		errs <- httpServer.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+	atomic.StoreInt32(&server.draining, 1)
+	server.logger().Infof("Shutting down, waiting up to %s for requests in flight", cfg.ShutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		httpServer.Close()
+		return fmt.Errorf("cannot shut down gracefully: %v", err)
+	}
+	return nil
 }
@@ -0,0 +1,139 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/task/api/models"
+	"github.com/task/api/requests"
+	"github.com/task/api/responses"
+)
+
+func (server *Server) CreateCategory(w http.ResponseWriter, r *http.Request) {
+
+	payload := requests.Category{}
+	err := server.decode(r, &payload)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	category := models.Category{Name: payload.Name, ParentID: payload.ParentID}
+	category.Prepare()
+	categoryCreated, err := category.SaveCategory(server.db(r))
+	if err != nil {
+		if errors.Is(err, models.ErrParentCategoryNotFound) {
+			responses.ERROR(w, http.StatusUnprocessableEntity, err)
+			return
+		}
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Location", location(r, fmt.Sprintf("%s/%d", r.URL.Path, categoryCreated.ID)))
+	responses.JSON(w, http.StatusCreated, categoryCreated)
+}
+
+func (server *Server) GetCategories(w http.ResponseWriter, r *http.Request) {
+
+	category := models.Category{}
+
+	categories, err := category.FindAllCategories(server.db(r))
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, categories)
+}
+
+func (server *Server) GetCategory(w http.ResponseWriter, r *http.Request) {
+
+	vars := mux.Vars(r)
+	cid, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+	category := models.Category{}
+	categoryReceived, err := category.FindCategoryByID(server.db(r), uint32(cid))
+	if err != nil {
+		responses.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, categoryReceived)
+}
+
+func (server *Server) UpdateCategory(w http.ResponseWriter, r *http.Request) {
+
+	vars := mux.Vars(r)
+	cid, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+	payload := requests.Category{}
+	err = server.decode(r, &payload)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	category := models.Category{Name: payload.Name, ParentID: payload.ParentID}
+	category.Prepare()
+	categoryUpdated, err := category.UpdateACategory(server.db(r), uint32(cid))
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrCategoryNotFound):
+			responses.ERROR(w, http.StatusNotFound, err)
+		case errors.Is(err, models.ErrParentCategoryNotFound), errors.Is(err, models.ErrInvalidParentCategory):
+			responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		default:
+			responses.ERROR(w, http.StatusInternalServerError, err)
+		}
+		return
+	}
+	responses.JSON(w, http.StatusOK, categoryUpdated)
+}
+
+func (server *Server) DeleteCategory(w http.ResponseWriter, r *http.Request) {
+
+	vars := mux.Vars(r)
+	cid, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+	category := models.Category{}
+	_, err = category.DeleteACategory(server.db(r), uint32(cid))
+	if err != nil {
+		if errors.Is(err, models.ErrCategoryNotFound) {
+			responses.ERROR(w, http.StatusNotFound, err)
+			return
+		}
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Entity", fmt.Sprintf("%d", cid))
+	responses.JSON(w, http.StatusNoContent, "")
+}
+
+func (server *Server) GetCategoryProducts(w http.ResponseWriter, r *http.Request) {
+
+	vars := mux.Vars(r)
+	cid, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+	Product := models.Product{}
+	Products, err := Product.FindProductsByCategory(server.db(r), uint32(cid))
+	if err != nil {
+		if errors.Is(err, models.ErrCategoryNotFound) {
+			responses.ERROR(w, http.StatusNotFound, err)
+			return
+		}
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeProducts(w, r, http.StatusOK, *Products)
+}
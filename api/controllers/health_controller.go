@@ -0,0 +1,68 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/task/api/responses"
+)
+
+// readyTimeout bounds the checks of /readyz, a database that takes longer
+// to answer is not ready.
+const readyTimeout = 2 * time.Second
+
+type readiness struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+// Healthz tells the orchestrator the process is alive. It checks nothing
+// else, a database outage should not get the server restarted.
+func (server *Server) Healthz(w http.ResponseWriter, r *http.Request) {
+	responses.JSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// Readyz tells the load balancer whether to send traffic: the database
+// answers, every migration is applied and the server is not shutting down.
+func (server *Server) Readyz(w http.ResponseWriter, r *http.Request) {
+
+	ctx, cancel := context.WithTimeout(r.Context(), readyTimeout)
+	defer cancel()
+
+	result := readiness{Status: "ready", Checks: map[string]string{}}
+	fail := func(check, problem string) {
+		result.Status = "not ready"
+		result.Checks[check] = problem
+	}
+
+	if atomic.LoadInt32(&server.draining) == 1 {
+		fail("server", "shutting down")
+	}
+	if err := server.DB.DB().PingContext(ctx); err != nil {
+		fail("database", err.Error())
+	} else {
+		result.Checks["database"] = "ok"
+		migrator, err := server.Migrator()
+		var pending int
+		if err == nil {
+			pending, err = migrator.Pending(ctx)
+		}
+		switch {
+		case err != nil:
+			fail("migrations", err.Error())
+		case pending > 0:
+			fail("migrations", fmt.Sprintf("%d pending", pending))
+		default:
+			result.Checks["migrations"] = "ok"
+		}
+	}
+
+	if result.Status != "ready" {
+		responses.JSON(w, http.StatusServiceUnavailable, result)
+		return
+	}
+	responses.JSON(w, http.StatusOK, result)
+}
@@ -0,0 +1,166 @@
+package controllers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/task/api/apierror"
+	"github.com/task/api/auth"
+	"github.com/task/api/models"
+	"github.com/task/api/responses"
+	"github.com/task/api/validation"
+)
+
+// replayedHeaders are the headers of a response answered again to the
+// retries of its request.
+var replayedHeaders = []string{"Content-Type", "Location", "Lacation"}
+
+// idempotent lets clients retry next safely: a request sent with an
+// Idempotency-Key header is run once per user and key, its retries get the
+// same response with Idempotent-Replayed: true. A key sent with another
+// request is refused, and so are retries while the first request runs.
+// Responses of 5xx are not kept, those requests can be retried.
+func (server *Server) idempotent(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		key := r.Header.Get("Idempotency-Key")
+		if key == "" {
+			next(w, r)
+			return
+		}
+		if len(key) > 255 {
+			responses.ERROR(w, http.StatusBadRequest, apierror.Invalid("idempotency_key", "Invalid Idempotency-Key, Expected at most 255 characters"))
+			return
+		}
+		uid, err := auth.ExtractTokenID(r)
+		if err != nil {
+			responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+			return
+		}
+
+		limit := server.BodyMaxBytes
+		if limit <= 0 {
+			limit = validation.DefaultMaxBytes
+		}
+		body, err := ioutil.ReadAll(io.LimitReader(r.Body, limit+1))
+		if err != nil {
+			responses.ERROR(w, http.StatusBadRequest, errors.New("Cannot Read Body"))
+			return
+		}
+		r.Body = ioutil.NopCloser(io.MultiReader(bytes.NewReader(body), r.Body))
+		hash := sha256.New()
+		io.WriteString(hash, r.Method+" "+r.URL.Path+"\n")
+		hash.Write(body)
+		requestHash := hex.EncodeToString(hash.Sum(nil))
+
+		record, reserved, err := models.ReserveIdempotencyKey(server.db(r), uid, key, requestHash)
+		if err != nil {
+			responses.ERROR(w, http.StatusInternalServerError, err)
+			return
+		}
+		if !reserved {
+			replay(w, record, requestHash)
+			return
+		}
+
+		completed := false
+		defer func() {
+			// a panicking handler answers nothing worth keeping
+			if !completed {
+				record.Release(server.db(r))
+			}
+		}()
+		done := make(chan struct{})
+		defer close(done)
+		go server.renewLease(r, record, done)
+		recorder := &responseRecorder{ResponseWriter: w}
+		next(recorder, r)
+		if recorder.status == 0 {
+			recorder.status = http.StatusOK
+		}
+		completed = true
+		if recorder.status >= http.StatusInternalServerError {
+			err = record.Release(server.db(r))
+		} else {
+			headers := http.Header{}
+			for _, name := range replayedHeaders {
+				if values := w.Header().Values(name); len(values) > 0 {
+					headers[name] = values
+				}
+			}
+			saved, _ := json.Marshal(headers)
+			err = record.Complete(server.db(r), recorder.status, string(saved), recorder.body.String())
+		}
+		if err != nil {
+			server.log(r).Errorf("cannot record the response to idempotency key %q: %v", key, err)
+		}
+		w.WriteHeader(recorder.status)
+		w.Write(recorder.body.Bytes())
+	}
+}
+
+// renewLease keeps the key of a request leased while it runs, until done is
+// closed, so a retry does not take it over from a slow handler.
+func (server *Server) renewLease(r *http.Request, record *models.IdempotencyKey, done <-chan struct{}) {
+	ticker := time.NewTicker(models.IdempotencyKeyLease / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case now := <-ticker.C:
+			if err := record.Renew(server.db(r), now.Add(models.IdempotencyKeyLease)); err != nil {
+				server.log(r).Errorf("cannot renew the lease of idempotency key %q: %v", record.Key, err)
+			}
+		}
+	}
+}
+
+// replay answers the response recorded for the request of a key again.
+func replay(w http.ResponseWriter, record *models.IdempotencyKey, requestHash string) {
+	if record.RequestHash != requestHash {
+		responses.ERROR(w, http.StatusUnprocessableEntity, apierror.New(apierror.IdempotencyKeyReused, "Idempotency-Key Was Used For Another Request"))
+		return
+	}
+	if record.Status == 0 {
+		w.Header().Set("Retry-After", "1")
+		responses.ERROR(w, http.StatusConflict, apierror.New(apierror.IdempotencyKeyInUse, "A Request With This Idempotency-Key Is In Progress"))
+		return
+	}
+	headers := http.Header{}
+	json.Unmarshal([]byte(record.Headers), &headers)
+	for name, values := range headers {
+		w.Header()[name] = values
+	}
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(record.Status)
+	io.WriteString(w, record.Body)
+}
+
+// responseRecorder holds a response back until it is recorded. The headers
+// are the ones of the ResponseWriter.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rr *responseRecorder) WriteHeader(status int) {
+	if rr.status == 0 {
+		rr.status = status
+	}
+}
+
+func (rr *responseRecorder) Write(p []byte) (int, error) {
+	if rr.status == 0 {
+		rr.status = http.StatusOK
+	}
+	return rr.body.Write(p)
+}
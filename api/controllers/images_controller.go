@@ -0,0 +1,276 @@
+package controllers
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"github.com/task/api/apierror"
+	"github.com/task/api/auth"
+	"github.com/task/api/models"
+	"github.com/task/api/requests"
+	"github.com/task/api/responses"
+	"github.com/task/api/storage"
+	"github.com/task/api/utils/imageutil"
+)
+
+const (
+	defaultImageMaxBytes = 5 << 20
+	maxImagesPerProduct  = 10
+	thumbnailSize        = 256
+)
+
+func (server *Server) imageMaxBytes() int64 {
+	if server.ImageMaxBytes > 0 {
+		return server.ImageMaxBytes
+	}
+	return defaultImageMaxBytes
+}
+
+// ownedProduct loads the product named in the url and makes sure it belongs
+// to the authenticated seller. It writes the error response itself.
+func (server *Server) ownedProduct(w http.ResponseWriter, r *http.Request) (*models.Product, bool) {
+	vars := mux.Vars(r)
+	pid, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return nil, false
+	}
+	uid, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return nil, false
+	}
+	Product := models.Product{}
+	err = server.db(r).Model(models.Product{}).Where("id = ?", pid).Take(&Product).Error
+	if err != nil {
+		responses.ERROR(w, http.StatusNotFound, models.ErrProductNotFound)
+		return nil, false
+	}
+	if Product.SellerID != uid {
+		responses.ERROR(w, http.StatusForbidden, errors.New(http.StatusText(http.StatusForbidden)))
+		return nil, false
+	}
+	return &Product, true
+}
+
+func (server *Server) UploadProductImage(w http.ResponseWriter, r *http.Request) {
+
+	Product, ok := server.ownedProduct(w, r)
+	if !ok {
+		return
+	}
+	maxBytes := server.imageMaxBytes()
+
+	// leave some room for the multipart framing around the file itself
+	r.Body = http.MaxBytesReader(w, r.Body, maxBytes+64<<10)
+	err := r.ParseMultipartForm(maxBytes)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		switch {
+		case errors.As(err, &tooLarge):
+			responses.ERROR(w, http.StatusRequestEntityTooLarge, errors.New("Image Too Large"))
+		case errors.Is(err, http.ErrNotMultipart):
+			responses.ERROR(w, http.StatusUnsupportedMediaType, errors.New("Body Must Be multipart/form-data"))
+		default:
+			responses.ERROR(w, http.StatusBadRequest, errors.New("Malformed Multipart Body"))
+		}
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+	file, _, err := r.FormFile("image")
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, apierror.Required("image", "Required image"))
+		return
+	}
+	defer file.Close()
+	data, err := ioutil.ReadAll(io.LimitReader(file, maxBytes+1))
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if int64(len(data)) > maxBytes {
+		responses.ERROR(w, http.StatusRequestEntityTooLarge, errors.New("Image Too Large"))
+		return
+	}
+
+	contentType, ext, err := imageutil.Sniff(data)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnsupportedMediaType, err)
+		return
+	}
+	width, height, err := imageutil.Dimensions(data)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	image := models.ProductImage{}
+	images, err := image.FindProductImages(server.db(r), Product.ID)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	if len(*images) >= maxImagesPerProduct {
+		responses.ERROR(w, http.StatusUnprocessableEntity, errors.New("Too Many Images"))
+		return
+	}
+	thumbnail, thumbnailType, err := imageutil.Thumbnail(data, thumbnailSize)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	thumbnailExt := "png"
+	if thumbnailType == "image/jpeg" {
+		thumbnailExt = "jpg"
+	}
+
+	name, err := randomName()
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	image.ProductID = Product.ID
+	image.Key = fmt.Sprintf("products/%d/%s.%s", Product.ID, name, ext)
+	image.ThumbnailKey = fmt.Sprintf("products/%d/%s_thumb.%s", Product.ID, name, thumbnailExt)
+	image.URL = server.Store.URL(image.Key)
+	image.ThumbnailURL = server.Store.URL(image.ThumbnailKey)
+	image.ContentType = contentType
+	image.Size = int64(len(data))
+	image.Width = width
+	image.Height = height
+
+	err = server.Store.Put(image.Key, bytes.NewReader(data), contentType)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	err = server.Store.Put(image.ThumbnailKey, bytes.NewReader(thumbnail), thumbnailType)
+	if err != nil {
+		server.deleteBlobs(server.log(r), image.Key)
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	imageCreated, err := image.SaveProductImage(server.db(r))
+	if err != nil {
+		server.deleteBlobs(server.log(r), image.Key, image.ThumbnailKey)
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Location", location(r, fmt.Sprintf("%s/%d", r.URL.Path, imageCreated.ID)))
+	responses.JSON(w, http.StatusCreated, imageCreated)
+}
+
+func (server *Server) GetProductImages(w http.ResponseWriter, r *http.Request) {
+
+	vars := mux.Vars(r)
+	pid, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+	image := models.ProductImage{}
+	images, err := image.FindProductImages(server.db(r), pid)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, images)
+}
+
+func (server *Server) ReorderProductImages(w http.ResponseWriter, r *http.Request) {
+
+	Product, ok := server.ownedProduct(w, r)
+	if !ok {
+		return
+	}
+	order := requests.ImageOrder{}
+	err := server.decode(r, &order)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	err = models.ReorderProductImages(server.db(r), Product.ID, order.ImageIDs)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	image := models.ProductImage{}
+	images, err := image.FindProductImages(server.db(r), Product.ID)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, images)
+}
+
+func (server *Server) DeleteProductImage(w http.ResponseWriter, r *http.Request) {
+
+	Product, ok := server.ownedProduct(w, r)
+	if !ok {
+		return
+	}
+	vars := mux.Vars(r)
+	iid, err := strconv.ParseUint(vars["image_id"], 10, 64)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+	image := models.ProductImage{}
+	imageDeleted, err := image.DeleteAProductImage(server.db(r), Product.ID, iid)
+	if err != nil {
+		responses.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+	server.deleteBlobs(server.log(r), imageDeleted.Key, imageDeleted.ThumbnailKey)
+	w.Header().Set("Entity", fmt.Sprintf("%d", iid))
+	responses.JSON(w, http.StatusNoContent, "")
+}
+
+// ServeImage streams a stored blob, mainly for the local storage backend.
+func (server *Server) ServeImage(w http.ResponseWriter, r *http.Request) {
+
+	key := mux.Vars(r)["key"]
+	blob, err := server.Store.Get(key)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) || errors.Is(err, storage.ErrInvalidKey) {
+			responses.ERROR(w, http.StatusNotFound, apierror.New(apierror.ImageNotFound, storage.ErrNotFound.Error()))
+			return
+		}
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	defer blob.Close()
+	w.Header().Set("Content-Type", mime.TypeByExtension(path.Ext(key)))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	io.Copy(w, blob)
+}
+
+// deleteBlobs is best effort: a leftover file is better than failing a
+// request whose database change already happened.
+func (server *Server) deleteBlobs(log logrus.FieldLogger, keys ...string) {
+	for _, key := range keys {
+		if err := server.Store.Delete(key); err != nil {
+			log.Errorf("cannot delete blob %s: %v", key, err)
+		}
+	}
+}
+
+func randomName() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,75 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/task/api/models"
+	"github.com/task/api/requests"
+	"github.com/task/api/responses"
+)
+
+func (server *Server) CreateStockAdjustment(w http.ResponseWriter, r *http.Request) {
+
+	Product, ok := server.ownedProduct(w, r)
+	if !ok {
+		return
+	}
+	adjustment := requests.StockAdjustment{}
+	err := server.decode(r, &adjustment)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	movement := models.InventoryMovement{
+		VariantID: adjustment.VariantID,
+		Reason:    adjustment.Reason,
+		Quantity:  adjustment.Quantity,
+		Note:      adjustment.Note,
+	}
+	movement.Prepare()
+	movement.ProductID = Product.ID
+	movement.ActorID = Product.SellerID
+
+	movementCreated, err := movement.AdjustStock(server.db(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrVariantNotFound):
+			responses.ERROR(w, http.StatusNotFound, err)
+		case errors.Is(err, models.ErrInsufficientStock), errors.Is(err, models.ErrVariantRequired):
+			responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		default:
+			responses.ERROR(w, http.StatusInternalServerError, err)
+		}
+		return
+	}
+	server.wakeOutbox()
+	w.Header().Set("Location", location(r, fmt.Sprintf("%s/products/%d/stock-history", versionPrefix(r), Product.ID)))
+	responses.JSON(w, http.StatusCreated, movementCreated)
+}
+
+func (server *Server) GetStockHistory(w http.ResponseWriter, r *http.Request) {
+
+	Product, ok := server.ownedProduct(w, r)
+	if !ok {
+		return
+	}
+	var vid *uint64
+	if value := r.URL.Query().Get("variant_id"); value != "" {
+		id, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			responses.ERROR(w, http.StatusBadRequest, err)
+			return
+		}
+		vid = &id
+	}
+	movement := models.InventoryMovement{}
+	movements, err := movement.FindStockHistory(server.db(r), Product.ID, vid)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, movements)
+}
@@ -1,63 +1,91 @@
 package controllers
 
 import (
-	"encoding/json"
-	"io/ioutil"
+	"context"
+	"errors"
 	"net/http"
 
+	"github.com/task/api/apierror"
 	"github.com/task/api/auth"
+	"github.com/task/api/metrics"
 	"github.com/task/api/models"
+	"github.com/task/api/repository"
+	"github.com/task/api/requests"
 	"github.com/task/api/responses"
-	"github.com/task/api/utils/formaterror"
 	"golang.org/x/crypto/bcrypt"
 )
 
+// loginResponse is the body of POST /login.
+type loginResponse struct {
+	Jwt string `json:"jwt"`
+}
+
 func (server *Server) Login(w http.ResponseWriter, r *http.Request) {
-	body, err := ioutil.ReadAll(r.Body)
+	credentials := requests.Login{}
+	err := server.decode(r, &credentials)
 	if err != nil {
+		server.Metrics.Login(metrics.LoginInvalid)
 		responses.ERROR(w, http.StatusUnprocessableEntity, err)
 		return
 	}
-	type Userlogin struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
-	}
-	userlogin := Userlogin{}
-	err = json.Unmarshal(body, &userlogin)
+	user := models.User{}
+	user.Email = credentials.Email
+	user.Password = credentials.Password
+	user.Prepare()
+	token, err := server.signIn(r.Context(), user.Email, user.Password)
 	if err != nil {
-		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		switch err {
+		case repository.ErrUserNotFound:
+			server.Metrics.Login(metrics.LoginUnknownUser)
+			responses.ERROR(w, http.StatusUnauthorized, apierror.New(apierror.InvalidCredentials, "Incorrect Details"))
+		case bcrypt.ErrMismatchedHashAndPassword:
+			server.Metrics.Login(metrics.LoginWrongPassword)
+			responses.ERROR(w, http.StatusUnauthorized, apierror.New(apierror.InvalidCredentials, "Incorrect Password"))
+		default:
+			server.Metrics.Login(metrics.LoginError)
+			responses.ERROR(w, http.StatusInternalServerError, err)
+		}
 		return
 	}
-	user := models.User{}
-	user.Email = userlogin.Email
-	user.Password = userlogin.Password
-	user.Prepare()
-	err = user.Validate("login")
+	login := new(loginResponse)
+	login.Jwt = token
+	server.Metrics.Login(metrics.LoginSuccess)
+	responses.JSON(w, http.StatusOK, login)
+}
+
+// RefreshToken answers a new token for the user of a valid one, so clients
+// need not sign in again before their token expires. The role is the one
+// the user has now, deleted users get none.
+func (server *Server) RefreshToken(w http.ResponseWriter, r *http.Request) {
+	uid, err := auth.ExtractTokenID(r)
 	if err != nil {
-		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+	user, err := server.users(r.Context()).FindByID(uid)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
 		return
 	}
-	token, err := server.SignIn(user.Email, user.Password)
 	if err != nil {
-		formattedError := formaterror.FormatError(err.Error())
-		responses.ERROR(w, http.StatusUnprocessableEntity, formattedError)
+		responses.ERROR(w, http.StatusInternalServerError, err)
 		return
 	}
-	type Loginresp struct {
-		Jwt string `json:"jwt"`
+	token, err := auth.CreateToken(user.ID, user.Role)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
 	}
-	login := new(Loginresp)
-	login.Jwt = token
-	responses.JSON(w, http.StatusOK, login)
+	responses.JSON(w, http.StatusOK, loginResponse{Jwt: token})
 }
 
 func (server *Server) SignIn(email, password string) (string, error) {
+	return server.signIn(context.Background(), email, password)
+}
 
-	var err error
-
-	user := models.User{}
+func (server *Server) signIn(ctx context.Context, email, password string) (string, error) {
 
-	err = server.DB.Debug().Model(models.User{}).Where("email = ?", email).Take(&user).Error
+	user, err := server.users(ctx).FindByEmail(email)
 	if err != nil {
 		return "", err
 	}
@@ -0,0 +1,252 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/task/api/apierror"
+	"github.com/task/api/auth"
+	"github.com/task/api/events"
+	"github.com/task/api/models"
+	"github.com/task/api/notify"
+	"github.com/task/api/requests"
+	"github.com/task/api/responses"
+)
+
+func (server *Server) GetNotifications(w http.ResponseWriter, r *http.Request) {
+
+	uid, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+	notification := models.Notification{}
+	notifications, err := notification.FindUserNotifications(server.db(r), uid, r.URL.Query().Get("unread") == "true")
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, notifications)
+}
+
+func (server *Server) ReadNotification(w http.ResponseWriter, r *http.Request) {
+
+	vars := mux.Vars(r)
+	nid, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+	uid, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+	notification := models.Notification{}
+	notificationRead, err := notification.MarkRead(server.db(r), nid, uid)
+	if err != nil {
+		responses.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, notificationRead)
+}
+
+// restockSubscription reads the product id from the url and the optional
+// variant_id from the query string or body.
+func (server *Server) restockSubscription(r *http.Request) (models.RestockSubscription, error) {
+	subscription := models.RestockSubscription{}
+	vars := mux.Vars(r)
+	pid, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		return subscription, err
+	}
+	uid, err := auth.ExtractTokenID(r)
+	if err != nil {
+		return subscription, apierror.New(apierror.Unauthorized, "Unauthorized")
+	}
+	payload := requests.RestockSubscription{}
+	err = server.decode(r, &payload)
+	if err != nil {
+		return subscription, err
+	}
+	subscription.VariantID = payload.VariantID
+	if value := r.URL.Query().Get("variant_id"); value != "" {
+		vid, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return subscription, err
+		}
+		subscription.VariantID = &vid
+	}
+	subscription.ID = 0
+	subscription.NotifiedAt = nil
+	subscription.UserID = uid
+	subscription.ProductID = pid
+	return subscription, nil
+}
+
+func (server *Server) SubscribeRestock(w http.ResponseWriter, r *http.Request) {
+
+	subscription, err := server.restockSubscription(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	subscriptionCreated, err := subscription.SaveSubscription(server.db(r))
+	if err != nil {
+		if errors.Is(err, models.ErrProductNotFound) || errors.Is(err, models.ErrVariantNotFound) {
+			responses.ERROR(w, http.StatusNotFound, err)
+			return
+		}
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusCreated, subscriptionCreated)
+}
+
+func (server *Server) UnsubscribeRestock(w http.ResponseWriter, r *http.Request) {
+
+	subscription, err := server.restockSubscription(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	_, err = subscription.DeleteSubscription(server.db(r), subscription.UserID, subscription.ProductID, subscription.VariantID)
+	if err != nil {
+		if errors.Is(err, models.ErrSubscriptionNotFound) {
+			responses.ERROR(w, http.StatusNotFound, err)
+			return
+		}
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusNoContent, "")
+}
+
+func (server *Server) notifier() notify.Notifier {
+	if server.Notifier != nil {
+		return server.Notifier
+	}
+	return &notify.InboxNotifier{DB: server.DB}
+}
+
+// onStockChanged is the stock.changed subscriber that sends the stock
+// notifications.
+func (server *Server) onStockChanged(e events.Event) error {
+	movement := models.InventoryMovement{}
+	if err := e.Decode(&movement); err != nil {
+		return err
+	}
+	server.stockChanged(e.ID, &movement)
+	return nil
+}
+
+// stockChanged sends the stock notifications a movement calls for: low_stock
+// or out_of_stock to the seller when stock goes down past the threshold or to
+// zero, back_in_stock to waiting buyers when it comes back from zero. The
+// balances come from the movement, the product may have changed since.
+// Failures are logged, the stock change itself already happened.
+func (server *Server) stockChanged(eid uint64, m *models.InventoryMovement) {
+
+	if m.Quantity == 0 {
+		return
+	}
+	product := models.Product{}
+	err := server.DB.Model(&models.Product{}).Where("id = ?", m.ProductID).Take(&product).Error
+	if err != nil {
+		server.logger().Errorf("cannot load product %d for stock notifications: %v", m.ProductID, err)
+		return
+	}
+	previous := m.Balance - m.Quantity
+
+	if m.Quantity < 0 {
+		kind, title := "", ""
+		switch {
+		case previous > 0 && m.Balance <= 0:
+			kind, title = notify.OutOfStock, fmt.Sprintf("%s is out of stock", product.ProductName)
+		case product.LowStockThreshold > 0 && previous > product.LowStockThreshold && m.Balance <= product.LowStockThreshold:
+			kind, title = notify.LowStock, fmt.Sprintf("%s is running low on stock", product.ProductName)
+		}
+		if kind != "" {
+			seller := models.User{}
+			_, err = seller.FindUserByID(server.DB, product.SellerID)
+			if err != nil {
+				server.logger().Errorf("cannot load seller %d for stock notifications: %v", product.SellerID, err)
+				return
+			}
+			server.deliver(notify.Notification{
+				UserID:    seller.ID,
+				Email:     seller.Email,
+				Type:      kind,
+				ProductID: product.ID,
+				VariantID: m.VariantID,
+				Title:     title,
+				Message:   fmt.Sprintf("%s: %g left in stock (threshold %g).", product.ProductName, m.Balance, product.LowStockThreshold),
+				CreatedAt: time.Now(),
+				EventID:   &eid,
+			})
+		}
+		return
+	}
+
+	// variant subscribers follow the variant, product subscribers the total
+	if m.VariantID != nil && previous <= 0 && m.Balance > 0 {
+		server.notifySubscribers(eid, &product, m.VariantID)
+	}
+	if m.ProductBalance-m.Quantity <= 0 && m.ProductBalance > 0 {
+		server.notifySubscribers(eid, &product, nil)
+	}
+}
+
+func (server *Server) notifySubscribers(eid uint64, product *models.Product, vid *uint64) {
+
+	subscription := models.RestockSubscription{}
+	subscriptions, err := subscription.FindPendingSubscriptions(server.DB, product.ID, vid)
+	if err != nil {
+		server.logger().Errorf("cannot load restock subscriptions of product %d: %v", product.ID, err)
+		return
+	}
+	for i := range *subscriptions {
+		s := &(*subscriptions)[i]
+		buyer := models.User{}
+		_, err = buyer.FindUserByID(server.DB, s.UserID)
+		if err != nil {
+			continue
+		}
+		server.deliver(notify.Notification{
+			UserID:    buyer.ID,
+			Email:     buyer.Email,
+			Type:      notify.BackInStock,
+			ProductID: product.ID,
+			VariantID: vid,
+			Title:     fmt.Sprintf("%s is back in stock", product.ProductName),
+			Message:   fmt.Sprintf("%s is available to buy again.", product.ProductName),
+			CreatedAt: time.Now(),
+			EventID:   &eid,
+		})
+		if err = s.MarkNotified(server.DB); err != nil {
+			server.logger().Errorf("cannot mark restock subscription %d notified: %v", s.ID, err)
+		}
+	}
+}
+
+// deliver sends n unless the user's inbox already has it for its event, which
+// happens when the outbox redelivers an event one of its subscribers failed.
+func (server *Server) deliver(n notify.Notification) {
+	if n.EventID != nil {
+		sent, err := models.NotificationSent(server.DB, n.UserID, n.Type, *n.EventID)
+		if err != nil {
+			server.logger().Errorf("cannot check the %s notifications of user %d: %v", n.Type, n.UserID, err)
+			return
+		}
+		if sent {
+			return
+		}
+	}
+	if err := server.notifier().Notify(n); err != nil {
+		server.logger().Errorf("cannot deliver %s notification to user %d: %v", n.Type, n.UserID, err)
+	}
+}
@@ -0,0 +1,173 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/task/api/apierror"
+	"github.com/task/api/models"
+	"github.com/task/api/openapi"
+	"github.com/task/api/requests"
+	"github.com/task/api/resources"
+	"github.com/task/api/responses"
+)
+
+// GetOpenAPI answers the OpenAPI document of the API.
+func (server *Server) GetOpenAPI(w http.ResponseWriter, r *http.Request) {
+	responses.JSON(w, http.StatusOK, server.OpenAPI)
+}
+
+// info is the Info of the OpenAPI document.
+var info = openapi3.Info{
+	Title:   "Task API",
+	Version: "2",
+	Description: "Buyers buy the products sellers sell. The routes are under /v1 and /v2, " +
+		"the ones without a prefix are /v1 and deprecated. Errors are RFC 7807 problems, see /problems.",
+}
+
+// uploadedImage is the multipart body of POST /products/{id}/images.
+type uploadedImage struct {
+	Image openapi.File `json:"image"`
+}
+
+// streamQuery are the filters of the product streams.
+var streamQuery = []openapi.Param{
+	{Name: "product_id", Description: "Only these products, comma separated or repeated", Value: []string{}},
+	{Name: "seller_id", Description: "Only the products of these sellers, comma separated or repeated", Value: []string{}},
+	{Name: "last_event_id", Description: "Resume after this event", Value: ""},
+}
+
+var (
+	includeDeletedParam = openapi.Param{Name: "include_deleted", Description: "Soft deleted rows too, for admins", Value: false}
+	variantParam        = openapi.Param{Name: "variant_id", Description: "The variant", Value: uint64(0)}
+	// pageQuery pages the products, the Link header of a full page has the
+	// url of the next one
+	pageQuery = []openapi.Param{
+		{Name: "after", Description: "Only the products after this id", Value: uint64(0)},
+		{Name: "limit", Description: "At most this many products, 1 to 100", Value: 0},
+	}
+	idempotencyKeyHeader = openapi.Param{Name: "Idempotency-Key", Description: "Retries with the same key and body get the response of the first request", Value: ""}
+)
+
+// operations document the routes added by initializeRoutes, by method and
+// path.
+var operations = map[string]openapi.Operation{
+	"GET /":                {ID: "home", Tag: "Health", Summary: "Welcome message", Status: http.StatusOK, Response: ""},
+	"GET /healthz":         {ID: "healthz", Tag: "Health", Summary: "Whether the process is alive", Status: http.StatusOK, Response: map[string]string{}},
+	"GET /readyz":          {ID: "readyz", Tag: "Health", Summary: "Whether the server takes traffic", Status: http.StatusOK, Response: readiness{}, Others: map[int]interface{}{http.StatusServiceUnavailable: readiness{}}},
+	"GET /metrics":         {ID: "metrics", Tag: "Health", Summary: "Prometheus metrics", Description: "Needs METRICS_TOKEN as a bearer token when it is set.", Status: http.StatusOK, Response: "", ResponseType: "text/plain"},
+	"GET /problems":        {ID: "listProblems", Tag: "Problems", Summary: "The error codes", Status: http.StatusOK, Response: []apierror.Entry{}},
+	"GET /problems/{code}": {ID: "getProblem", Tag: "Problems", Summary: "An error code", Status: http.StatusOK, Response: apierror.Entry{}},
+	"GET /images/{key:.+}": {ID: "getImage", Tag: "Images", Summary: "A product image or thumbnail", Status: http.StatusOK, Response: openapi.File{}, ResponseType: "image/*"},
+	"GET /openapi.json":    {ID: "getOpenAPI", Tag: "Docs", Summary: "This document", Status: http.StatusOK, Response: map[string]interface{}{}},
+	"GET /docs":            {ID: "docs", Tag: "Docs", Summary: "The documentation page", Status: http.StatusOK, Response: "", ResponseType: "text/html"},
+}
+
+// apiOperations document the routes added by apiRoutes, by method and path
+// without the version prefix. v2Operations are the ones that differ in v2.
+var apiOperations = map[string]openapi.Operation{
+	"POST /login":         {ID: "login", Tag: "Auth", Summary: "Sign in", Request: requests.Login{}, Status: http.StatusOK, Response: loginResponse{}},
+	"POST /login/refresh": {ID: "refreshToken", Tag: "Auth", Summary: "A new token for the user of a valid one", Auth: true, Status: http.StatusOK, Response: loginResponse{}},
+
+	"POST /users":              {ID: "createUser", Tag: "Users", Summary: "Sign up", Request: requests.NewUser{}, Status: http.StatusCreated, Response: models.User{}},
+	"GET /users":               {ID: "listUsers", Tag: "Users", Summary: "List users", Auth: true, Query: []openapi.Param{includeDeletedParam}, Status: http.StatusOK, Response: []models.User{}},
+	"GET /users/{id}":          {ID: "getUser", Tag: "Users", Summary: "Get a user", Auth: true, Status: http.StatusOK, Response: models.User{}},
+	"PUT /users/{id}":          {ID: "updateUser", Tag: "Users", Summary: "Update a user or their deposit", Auth: true, Request: requests.UserUpdate{}, Status: http.StatusOK, Response: models.User{}},
+	"DELETE /users/{id}":       {ID: "deleteUser", Tag: "Users", Summary: "Delete a user", Auth: true, Status: http.StatusNoContent},
+	"POST /users/{id}/restore": {ID: "restoreUser", Tag: "Users", Summary: "Restore a deleted user, for admins", Auth: true, Status: http.StatusOK, Response: models.User{}},
+
+	"GET /products":                               {ID: "listProducts", Tag: "Products", Summary: "List products", Auth: true, Query: append([]openapi.Param{{Name: "tag", Description: "Only the products with every tag", Value: []string{}}, includeDeletedParam}, pageQuery...), Status: http.StatusOK, Response: []models.Product{}},
+	"GET /products/stream":                        {ID: "streamProducts", Tag: "Products", Summary: "Product updates as Server-Sent Events", Auth: true, Query: streamQuery, Status: http.StatusOK, Response: "", ResponseType: "text/event-stream"},
+	"GET /products/ws":                            {ID: "productsWebSocket", Tag: "Products", Summary: "Product updates over a WebSocket", Auth: true, Query: streamQuery, Status: http.StatusSwitchingProtocols},
+	"GET /products/{id}":                          {ID: "getProduct", Tag: "Products", Summary: "Get a product", Auth: true, Status: http.StatusOK, Response: models.Product{}},
+	"POST /products":                              {ID: "createProduct", Tag: "Products", Summary: "Create a product, for sellers", Auth: true, Request: requests.NewProduct{}, Status: http.StatusCreated, Response: models.Product{}},
+	"PUT /products/{id}":                          {ID: "updateProduct", Tag: "Products", Summary: "Update a product of the seller", Auth: true, Request: requests.ProductUpdate{}, Status: http.StatusOK, Response: models.Product{}},
+	"DELETE /products/{id}":                       {ID: "deleteProduct", Tag: "Products", Summary: "Delete a product", Auth: true, Status: http.StatusNoContent},
+	"POST /products/{id}/restore":                 {ID: "restoreProduct", Tag: "Products", Summary: "Restore a deleted product of the seller", Auth: true, Status: http.StatusOK, Response: models.Product{}},
+	"GET /products/{id}/images":                   {ID: "listProductImages", Tag: "Images", Summary: "List the images of a product", Auth: true, Status: http.StatusOK, Response: []models.ProductImage{}},
+	"POST /products/{id}/images":                  {ID: "uploadProductImage", Tag: "Images", Summary: "Upload a JPEG, PNG or WebP image", Auth: true, Request: uploadedImage{}, RequestType: "multipart/form-data", Status: http.StatusCreated, Response: models.ProductImage{}},
+	"PUT /products/{id}/images":                   {ID: "reorderProductImages", Tag: "Images", Summary: "Reorder the images of a product", Auth: true, Request: requests.ImageOrder{}, Status: http.StatusOK, Response: []models.ProductImage{}},
+	"DELETE /products/{id}/images/{image_id}":     {ID: "deleteProductImage", Tag: "Images", Summary: "Delete an image", Auth: true, Status: http.StatusNoContent},
+	"PUT /products/{id}/options":                  {ID: "setProductOptions", Tag: "Variants", Summary: "Set the options variants differ in", Auth: true, Request: []requests.ProductOption{}, Status: http.StatusOK, Response: []models.ProductOption{}},
+	"GET /products/{id}/variants":                 {ID: "listProductVariants", Tag: "Variants", Summary: "List the variants of a product", Auth: true, Status: http.StatusOK, Response: []models.ProductVariant{}},
+	"POST /products/{id}/variants":                {ID: "createProductVariant", Tag: "Variants", Summary: "Create a variant", Auth: true, Request: requests.Variant{}, Status: http.StatusCreated, Response: models.ProductVariant{}},
+	"PUT /products/{id}/variants/{variant_id}":    {ID: "updateProductVariant", Tag: "Variants", Summary: "Update a variant", Auth: true, Request: requests.Variant{}, Status: http.StatusOK, Response: models.ProductVariant{}},
+	"DELETE /products/{id}/variants/{variant_id}": {ID: "deleteProductVariant", Tag: "Variants", Summary: "Delete a variant", Auth: true, Status: http.StatusNoContent},
+	"POST /products/{id}/stock-adjustments":       {ID: "adjustStock", Tag: "Inventory", Summary: "Adjust the stock of a product or variant", Auth: true, Request: requests.StockAdjustment{}, Status: http.StatusCreated, Response: models.InventoryMovement{}},
+	"GET /products/{id}/stock-history":            {ID: "getStockHistory", Tag: "Inventory", Summary: "The stock movements of a product", Auth: true, Query: []openapi.Param{variantParam}, Status: http.StatusOK, Response: []models.InventoryMovement{}},
+	"POST /products/{id}/restock-subscriptions":   {ID: "subscribeRestock", Tag: "Notifications", Summary: "Be notified when a product is back in stock", Auth: true, Query: []openapi.Param{variantParam}, Request: requests.RestockSubscription{}, OptionalBody: true, Status: http.StatusCreated, Response: models.RestockSubscription{}},
+	"DELETE /products/{id}/restock-subscriptions": {ID: "unsubscribeRestock", Tag: "Notifications", Summary: "Stop a restock subscription", Auth: true, Query: []openapi.Param{variantParam}, Request: requests.RestockSubscription{}, OptionalBody: true, Status: http.StatusNoContent},
+	"POST /buy": {ID: "buy", Tag: "Products", Summary: "Buy a product, for buyers", Auth: true, Headers: []openapi.Param{idempotencyKeyHeader}, Request: requests.Buy{}, Status: http.StatusCreated, Response: models.Product{}},
+
+	"GET /categories":               {ID: "listCategories", Tag: "Categories", Summary: "The category tree", Auth: true, Status: http.StatusOK, Response: []models.Category{}},
+	"GET /categories/{id}":          {ID: "getCategory", Tag: "Categories", Summary: "Get a category", Auth: true, Status: http.StatusOK, Response: models.Category{}},
+	"GET /categories/{id}/products": {ID: "listCategoryProducts", Tag: "Categories", Summary: "The products of a category and its children", Auth: true, Status: http.StatusOK, Response: []models.Product{}},
+	"POST /categories":              {ID: "createCategory", Tag: "Categories", Summary: "Create a category, for admins", Auth: true, Request: requests.Category{}, Status: http.StatusCreated, Response: models.Category{}},
+	"PUT /categories/{id}":          {ID: "updateCategory", Tag: "Categories", Summary: "Update a category, for admins", Auth: true, Request: requests.Category{}, Status: http.StatusOK, Response: models.Category{}},
+	"DELETE /categories/{id}":       {ID: "deleteCategory", Tag: "Categories", Summary: "Delete a category, for admins", Auth: true, Status: http.StatusNoContent},
+
+	"GET /tags": {ID: "listTags", Tag: "Tags", Summary: "List tags", Auth: true, Status: http.StatusOK, Response: []models.Tag{}},
+
+	"GET /notifications":            {ID: "listNotifications", Tag: "Notifications", Summary: "The notifications of the user", Auth: true, Query: []openapi.Param{{Name: "unread", Description: "Only the unread ones", Value: false}}, Status: http.StatusOK, Response: []models.Notification{}},
+	"POST /notifications/{id}/read": {ID: "readNotification", Tag: "Notifications", Summary: "Mark a notification read", Auth: true, Status: http.StatusOK, Response: models.Notification{}},
+
+	"GET /webhooks":                 {ID: "listWebhooks", Tag: "Webhooks", Summary: "List webhooks, every one for admins", Auth: true, Status: http.StatusOK, Response: []models.Webhook{}},
+	"POST /webhooks":                {ID: "createWebhook", Tag: "Webhooks", Summary: "Create a webhook", Auth: true, Request: requests.NewWebhook{}, Status: http.StatusCreated, Response: createdWebhook{}},
+	"GET /webhooks/{id}":            {ID: "getWebhook", Tag: "Webhooks", Summary: "Get a webhook", Auth: true, Status: http.StatusOK, Response: models.Webhook{}},
+	"PUT /webhooks/{id}":            {ID: "updateWebhook", Tag: "Webhooks", Summary: "Update a webhook", Auth: true, Request: requests.WebhookUpdate{}, Status: http.StatusOK, Response: models.Webhook{}},
+	"DELETE /webhooks/{id}":         {ID: "deleteWebhook", Tag: "Webhooks", Summary: "Delete a webhook", Auth: true, Status: http.StatusNoContent},
+	"GET /webhooks/{id}/deliveries": {ID: "listWebhookDeliveries", Tag: "Webhooks", Summary: "The deliveries of a webhook", Auth: true, Status: http.StatusOK, Response: []models.WebhookDelivery{}},
+	"POST /webhooks/{id}/deliveries/{delivery_id}/redeliver": {ID: "redeliverWebhook", Tag: "Webhooks", Summary: "Send a delivery again", Auth: true, Status: http.StatusAccepted, Response: models.WebhookDelivery{}},
+}
+
+var v2Operations = map[string]openapi.Operation{
+	"GET /products":                 {Response: []resources.Product{}},
+	"GET /products/{id}":            {Response: resources.Product{}},
+	"POST /products":                {Request: requests.NewProductV2{}, Response: resources.Product{}, Description: "The seller is the one signed in."},
+	"PUT /products/{id}":            {Request: requests.ProductUpdateV2{}, Response: resources.Product{}},
+	"POST /products/{id}/restore":   {Response: resources.Product{}},
+	"POST /buy":                     {Request: requests.BuyV2{}, Status: http.StatusOK, Response: resources.Purchase{}, Description: "Answers the purchase instead of the product."},
+	"GET /categories/{id}/products": {Response: []resources.Product{}},
+}
+
+// versionPath splits the version prefix off a path template.
+var versionPath = regexp.MustCompile(`^/v([0-9]+)(/.*)$`)
+
+// describe returns the operation of a route of initializeRoutes. The routes
+// of apiRoutes are documented once per version, with the version in their
+// id, and the ones without a prefix as deprecated.
+func describe(method, path string) (openapi.Operation, bool) {
+	if operation, ok := operations[method+" "+path]; ok {
+		return operation, true
+	}
+	version := 0
+	if match := versionPath.FindStringSubmatch(path); match != nil {
+		version, _ = strconv.Atoi(match[1])
+		path = match[2]
+	}
+	operation, ok := apiOperations[method+" "+path]
+	if !ok {
+		return operation, false
+	}
+	if version == 0 {
+		operation.Deprecated = true
+		return operation, true
+	}
+	if override, ok := v2Operations[method+" "+path]; ok && version >= 2 {
+		if override.Request != nil {
+			operation.Request = override.Request
+		}
+		if override.Status != 0 {
+			operation.Status = override.Status
+		}
+		if override.Description != "" {
+			operation.Description = override.Description
+		}
+		operation.Response = override.Response
+	}
+	operation.ID = fmt.Sprintf("%sV%d", operation.ID, version)
+	return operation, true
+}
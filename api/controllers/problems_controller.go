@@ -0,0 +1,34 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/task/api/apierror"
+	"github.com/task/api/responses"
+)
+
+// GetProblems lists the error codes, the type of a problem links to its
+// entry.
+func (server *Server) GetProblems(w http.ResponseWriter, r *http.Request) {
+	responses.JSON(w, http.StatusOK, apierror.Catalogue)
+}
+
+func (server *Server) GetProblem(w http.ResponseWriter, r *http.Request) {
+	entry, ok := apierror.Lookup(mux.Vars(r)["code"])
+	if !ok {
+		responses.ERROR(w, http.StatusNotFound, errors.New("Unknown Error Code"))
+		return
+	}
+	responses.JSON(w, http.StatusOK, entry)
+}
+
+// NotFound and MethodNotAllowed answer requests no route matches.
+func (server *Server) NotFound(w http.ResponseWriter, r *http.Request) {
+	responses.ERROR(w, http.StatusNotFound, errors.New(http.StatusText(http.StatusNotFound)))
+}
+
+func (server *Server) MethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	responses.ERROR(w, http.StatusMethodNotAllowed, errors.New(http.StatusText(http.StatusMethodNotAllowed)))
+}
@@ -1,35 +1,27 @@
 package controllers
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
 	"net/http"
 	"strconv"
 
 	"github.com/gorilla/mux"
+	"github.com/jinzhu/gorm"
+	"github.com/task/api/apierror"
 	"github.com/task/api/auth"
+	"github.com/task/api/metrics"
 	"github.com/task/api/models"
+	"github.com/task/api/repository"
+	"github.com/task/api/requests"
+	"github.com/task/api/resources"
 	"github.com/task/api/responses"
-	"github.com/task/api/utils/formaterror"
 )
 
 func (server *Server) CreateProduct(w http.ResponseWriter, r *http.Request) {
 
-	body, err := ioutil.ReadAll(r.Body)
-	if err != nil {
-		responses.ERROR(w, http.StatusUnprocessableEntity, err)
-		return
-	}
-	Product := models.Product{}
-	err = json.Unmarshal(body, &Product)
-	if err != nil {
-		responses.ERROR(w, http.StatusUnprocessableEntity, err)
-		return
-	}
-	Product.Prepare()
-	err = Product.Validate()
+	newProduct := requests.NewProduct{}
+	err := server.decode(r, &newProduct)
 	if err != nil {
 		responses.ERROR(w, http.StatusUnprocessableEntity, err)
 		return
@@ -39,30 +31,135 @@ func (server *Server) CreateProduct(w http.ResponseWriter, r *http.Request) {
 		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
 		return
 	}
-	if uid != Product.SellerID {
-		responses.ERROR(w, http.StatusUnauthorized, errors.New(http.StatusText(http.StatusUnauthorized)))
+	if uid != newProduct.SellerID {
+		responses.ERROR(w, http.StatusForbidden, errors.New(http.StatusText(http.StatusForbidden)))
 		return
 	}
-	ProductCreated, err := Product.SaveProduct(server.DB)
-	if err != nil {
-		formattedError := formaterror.FormatError(err.Error())
-		responses.ERROR(w, http.StatusInternalServerError, formattedError)
+	ProductCreated, ok := server.saveProduct(w, r, models.Product{
+		ProductName:       newProduct.ProductName,
+		AmountAvailable:   newProduct.AmountAvailable,
+		SellerID:          uid,
+		Price:             newProduct.Price,
+		LowStockThreshold: newProduct.LowStockThreshold,
+		CategoryIDs:       newProduct.CategoryIDs,
+		TagNames:          newProduct.TagNames,
+	})
+	if !ok {
 		return
 	}
 	w.Header().Set("Lacation", fmt.Sprintf("%s%s/%d", r.Host, r.URL.Path, ProductCreated.ID))
 	responses.JSON(w, http.StatusCreated, ProductCreated)
 }
 
+// saveProduct creates Product with its initial stock movement, answering
+// the error if it cannot.
+func (server *Server) saveProduct(w http.ResponseWriter, r *http.Request, Product models.Product) (*models.Product, bool) {
+
+	if !server.hasDatabase(w) {
+		return nil, false
+	}
+	Product.Prepare()
+	var ProductCreated *models.Product
+	err := models.Transaction(server.db(r), func(tx *gorm.DB) error {
+		var err error
+		ProductCreated, err = Product.SaveProduct(tx)
+		if err != nil {
+			return err
+		}
+		_, err = models.RecordEvent(tx, models.EventProductCreated, ProductCreated.SellerID, ProductCreated)
+		if err != nil {
+			return err
+		}
+		movement := models.InventoryMovement{
+			ProductID: ProductCreated.ID,
+			Reason:    models.MovementRestock,
+			Quantity:  ProductCreated.AmountAvailable,
+			Balance:   ProductCreated.AmountAvailable,
+			ActorID:   ProductCreated.SellerID,
+			Note:      "initial stock",
+		}
+		_, err = movement.RecordMovement(tx)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, models.ErrCategoryNotFound) {
+			responses.ERROR(w, http.StatusUnprocessableEntity, err)
+			return nil, false
+		}
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return nil, false
+	}
+	server.wakeOutbox()
+	return ProductCreated, true
+}
+
 func (server *Server) GetProducts(w http.ResponseWriter, r *http.Request) {
 
 	Product := models.Product{}
 
-	Products, err := Product.FindAllProducts(server.DB)
+	var Products *[]models.Product
+	var err error
+	page, err := productPage(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+	// ?tag=a&tag=b only lists products carrying both tags
+	if tags, ok := r.URL.Query()["tag"]; ok {
+		if !server.hasDatabase(w) {
+			return
+		}
+		db := server.db(r)
+		if includeDeleted(r) {
+			db = db.Unscoped()
+		}
+		Products, err = Product.FindProductsByTagsPage(db, tags, page)
+	} else {
+		var all []models.Product
+		all, err = server.products(r.Context()).ListPage(page, includeDeleted(r))
+		Products = &all
+	}
 	if err != nil {
 		responses.ERROR(w, http.StatusInternalServerError, err)
 		return
 	}
-	responses.JSON(w, http.StatusOK, Products)
+	linkNextPage(w, r, page, *Products)
+	writeProducts(w, r, http.StatusOK, *Products)
+}
+
+// productPage is the page of products ?after=id&limit=n asks for, the first
+// 100 products by default.
+func productPage(r *http.Request) (models.Page, error) {
+	page := models.FirstPage
+	query := r.URL.Query()
+	if after := query.Get("after"); after != "" {
+		id, err := strconv.ParseUint(after, 10, 64)
+		if err != nil {
+			return page, apierror.Invalid("after", "Invalid after")
+		}
+		page.After = id
+	}
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > models.PageSize {
+			return page, apierror.Invalid("limit", fmt.Sprintf("Invalid limit, Expected 1 to %d", models.PageSize))
+		}
+		page.Limit = n
+	}
+	return page, nil
+}
+
+// linkNextPage links the page after products when it is full. The last page
+// has no next link, which may be empty when the products end with a page.
+func linkNextPage(w http.ResponseWriter, r *http.Request, page models.Page, products []models.Product) {
+	if len(products) == 0 || len(products) < page.Limit {
+		return
+	}
+	query := r.URL.Query()
+	query.Del("token")
+	query.Set("after", strconv.FormatUint(products[len(products)-1].ID, 10))
+	query.Set("limit", strconv.Itoa(page.Limit))
+	w.Header().Add("Link", fmt.Sprintf(`<%s?%s>; rel="next"`, r.URL.Path, query.Encode()))
 }
 
 func (server *Server) GetProduct(w http.ResponseWriter, r *http.Request) {
@@ -73,71 +170,126 @@ func (server *Server) GetProduct(w http.ResponseWriter, r *http.Request) {
 		responses.ERROR(w, http.StatusBadRequest, err)
 		return
 	}
-	Product := models.Product{}
-
-	ProductReceived, err := Product.FindProductByID(server.DB, pid)
+	ProductReceived, err := server.products(r.Context()).FindByID(pid)
 	if err != nil {
 		responses.ERROR(w, http.StatusInternalServerError, err)
 		return
 	}
-	responses.JSON(w, http.StatusOK, ProductReceived)
+	writeProduct(w, r, http.StatusOK, ProductReceived)
 }
 
 func (server *Server) UpdateProduct(w http.ResponseWriter, r *http.Request) {
 
+	update := requests.ProductUpdate{}
+	err := server.decode(r, &update)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	ProductUpdated, ok := server.updateProduct(w, r, models.Product{
+		ProductName:       update.ProductName,
+		AmountAvailable:   update.AmountAvailable,
+		LowStockThreshold: update.LowStockThreshold,
+		CategoryIDs:       update.CategoryIDs,
+		TagNames:          update.TagNames,
+	})
+	if !ok {
+		return
+	}
+	responses.JSON(w, http.StatusOK, ProductUpdated)
+}
+
+// updateProduct changes the product of the url to ProductUpdate, answering
+// the error if it cannot.
+func (server *Server) updateProduct(w http.ResponseWriter, r *http.Request, ProductUpdate models.Product) (*models.Product, bool) {
+
+	if !server.hasDatabase(w) {
+		return nil, false
+	}
 	vars := mux.Vars(r)
 
 	// Check if the Product id is valid
 	pid, err := strconv.ParseUint(vars["id"], 10, 64)
 	if err != nil {
 		responses.ERROR(w, http.StatusBadRequest, err)
-		return
+		return nil, false
 	}
 
 	// Check if the Product exist
 	Product := models.Product{}
-	err = server.DB.Debug().Model(models.Product{}).Where("id = ?", pid).Take(&Product).Error
+	err = server.db(r).Model(models.Product{}).Where("id = ?", pid).Take(&Product).Error
 	if err != nil {
-		responses.ERROR(w, http.StatusNotFound, errors.New("Product not found"))
-		return
+		responses.ERROR(w, http.StatusNotFound, models.ErrProductNotFound)
+		return nil, false
 	}
 
-	// Read the data Producted
-	body, err := ioutil.ReadAll(r.Body)
+	// Only the seller may change the product, the stock history records who did
+	uid, err := auth.ExtractTokenID(r)
 	if err != nil {
-		responses.ERROR(w, http.StatusUnprocessableEntity, err)
-		return
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return nil, false
 	}
-
-	// Start processing the request data
-	ProductUpdate := models.Product{}
-	err = json.Unmarshal(body, &ProductUpdate)
-	if err != nil {
-		responses.ERROR(w, http.StatusUnprocessableEntity, err)
-		return
+	if uid != Product.SellerID {
+		responses.ERROR(w, http.StatusForbidden, errors.New(http.StatusText(http.StatusForbidden)))
+		return nil, false
 	}
 
+	// The seller and price of a product do not change
+	ProductUpdate.SellerID = Product.SellerID
+	ProductUpdate.Price = Product.Price
 	ProductUpdate.Prepare()
-	err = ProductUpdate.Validate()
-	if err != nil {
-		responses.ERROR(w, http.StatusUnprocessableEntity, err)
-		return
-	}
 
 	ProductUpdate.ID = Product.ID //this is important to tell the model the Product id to update, the other update field are set above
 
-	ProductUpdated, err := ProductUpdate.UpdateAProduct(server.DB)
+	// The stock of a product with variants is the sum of its variants
+	var variants int
+	err = server.db(r).Model(models.ProductVariant{}).Where("product_id = ?", Product.ID).Count(&variants).Error
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return nil, false
+	}
+	if variants > 0 {
+		ProductUpdate.AmountAvailable = Product.AmountAvailable
+	}
 
+	var ProductUpdated *models.Product
+	err = models.Transaction(server.db(r), func(tx *gorm.DB) error {
+		ProductUpdated, err = ProductUpdate.UpdateAProduct(tx)
+		if err != nil {
+			return err
+		}
+		movement := models.InventoryMovement{
+			ProductID: Product.ID,
+			Reason:    models.MovementCorrection,
+			Quantity:  ProductUpdated.AmountAvailable - Product.AmountAvailable,
+			Balance:   ProductUpdated.AmountAvailable,
+			ActorID:   uid,
+			Note:      "product update",
+		}
+		_, err = movement.RecordMovement(tx)
+		if err != nil {
+			return err
+		}
+		_, err = models.RecordEvent(tx, models.EventProductUpdated, ProductUpdated.SellerID, ProductUpdated)
+		return err
+	})
 	if err != nil {
-		formattedError := formaterror.FormatError(err.Error())
-		responses.ERROR(w, http.StatusInternalServerError, formattedError)
-		return
+		if errors.Is(err, models.ErrCategoryNotFound) {
+			responses.ERROR(w, http.StatusUnprocessableEntity, err)
+			return nil, false
+		}
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return nil, false
 	}
-	responses.JSON(w, http.StatusOK, ProductUpdated)
+	server.wakeOutbox()
+	return ProductUpdated, true
 }
 
 func (server *Server) DeleteProduct(w http.ResponseWriter, r *http.Request) {
 
+	if !server.hasDatabase(w) {
+		return
+	}
 	vars := mux.Vars(r)
 
 	// Is a valid Product id given to us?
@@ -156,58 +308,120 @@ func (server *Server) DeleteProduct(w http.ResponseWriter, r *http.Request) {
 
 	// Check if the Product exist
 	Product := models.Product{}
-	err = server.DB.Debug().Model(models.Product{}).Where("id = ?", pid).Take(&Product).Error
+	err = server.db(r).Model(models.Product{}).Where("id = ?", pid).Take(&Product).Error
 	if err != nil {
-		responses.ERROR(w, http.StatusNotFound, errors.New("Unauthorized"))
+		responses.ERROR(w, http.StatusNotFound, models.ErrProductNotFound)
 		return
 	}
 
-	_, err = Product.DeleteAProduct(server.DB, pid, uid)
+	// images stay in the store until the product is purged, see Server.PurgeDeleted
+	err = models.Transaction(server.db(r), func(tx *gorm.DB) error {
+		_, err := Product.DeleteAProduct(tx, pid, uid)
+		if err != nil {
+			return err
+		}
+		_, err = models.RecordEvent(tx, models.EventProductDeleted, Product.SellerID, map[string]interface{}{"id": pid})
+		return err
+	})
 	if err != nil {
 		responses.ERROR(w, http.StatusBadRequest, err)
 		return
 	}
+	server.wakeOutbox()
 	w.Header().Set("Entity", fmt.Sprintf("%d", pid))
 	responses.JSON(w, http.StatusNoContent, "")
 }
-func (server *Server) BuyProduct(w http.ResponseWriter, r *http.Request) {
 
-	type Buy struct {
-		ID  uint64  `json:"id"`
-		Qty float32 `json:"qty"`
-	}
+func (server *Server) RestoreProduct(w http.ResponseWriter, r *http.Request) {
 
-	body, err := ioutil.ReadAll(r.Body)
+	vars := mux.Vars(r)
+	pid, err := strconv.ParseUint(vars["id"], 10, 64)
 	if err != nil {
-		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+	uid, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
 		return
 	}
-	buy := Buy{}
+	ProductRestored, err := server.products(r.Context()).Restore(pid, uid)
+	if err != nil {
+		switch err {
+		case repository.ErrProductNotFound:
+			responses.ERROR(w, http.StatusNotFound, err)
+		case repository.ErrSellerDeleted:
+			responses.ERROR(w, http.StatusConflict, err)
+		default:
+			responses.ERROR(w, http.StatusInternalServerError, err)
+		}
+		return
+	}
+	writeProduct(w, r, http.StatusOK, ProductRestored)
+}
+func (server *Server) BuyProduct(w http.ResponseWriter, r *http.Request) {
 
-	err = json.Unmarshal(body, &buy)
+	buy := requests.Buy{}
+	err := server.decode(r, &buy)
 	if err != nil {
+		server.Metrics.FailedPurchase(metrics.ReasonInvalidRequest)
 		responses.ERROR(w, http.StatusUnprocessableEntity, err)
 		return
 	}
-	if buy.ID < 1 {
-		responses.ERROR(w, http.StatusUnprocessableEntity, errors.New("Required Product id"))
+	purchase, ok := server.buyProduct(w, r, buy)
+	if !ok {
 		return
 	}
-	if buy.Qty < 1 {
-		responses.ERROR(w, http.StatusUnprocessableEntity, errors.New("Required qty"))
+	Product := models.Product{}
+	ProductCreated, err := Product.FindProductByID(server.db(r), purchase.ProductID)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
 		return
 	}
+
+	w.Header().Set("Lacation", fmt.Sprintf("%s%s/%d", r.Host, r.URL.Path, ProductCreated.ID))
+	responses.JSON(w, http.StatusCreated, ProductCreated)
+}
+
+// buyProduct sells buy.Qty of the product or variant to the buyer signed in,
+// answering the error if it cannot.
+func (server *Server) buyProduct(w http.ResponseWriter, r *http.Request, buy requests.Buy) (*resources.Purchase, bool) {
+
+	if !server.hasDatabase(w) {
+		return nil, false
+	}
 	//CHeck if the auth token is valid and  get the user id from it
 	uid, err := auth.ExtractTokenID(r)
 	if err != nil {
 		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
-		return
+		return nil, false
 	}
-	user := models.User{}
-	userGotten, err := user.FindUserByID(server.DB, uint32(uid))
+	userGotten, err := server.users(r.Context()).FindByID(uid)
 	if err != nil {
 		responses.ERROR(w, http.StatusBadRequest, err)
-		return
+		return nil, false
+	}
+
+	// Resolve the variant first, it tells us the product
+	var variant *models.ProductVariant
+	if buy.VariantID > 0 || buy.SKU != "" {
+		v := models.ProductVariant{}
+		if buy.VariantID > 0 {
+			variant, err = v.FindVariantByID(server.db(r), buy.VariantID)
+		} else {
+			variant, err = v.FindVariantBySKU(server.db(r), buy.SKU)
+		}
+		if err != nil {
+			server.Metrics.FailedPurchase(metrics.ReasonVariantNotFound)
+			responses.ERROR(w, http.StatusNotFound, err)
+			return nil, false
+		}
+		if buy.ID > 0 && buy.ID != variant.ProductID {
+			server.Metrics.FailedPurchase(metrics.ReasonInvalidRequest)
+			responses.ERROR(w, http.StatusUnprocessableEntity, errors.New("Variant does not belong to product"))
+			return nil, false
+		}
+		buy.ID = variant.ProductID
 	}
 
 	Product := models.Product{}
@@ -216,42 +430,113 @@ func (server *Server) BuyProduct(w http.ResponseWriter, r *http.Request) {
 
 	// Check if the Product exist
 
-	err = server.DB.Debug().Model(models.Product{}).Where("id = ?", buy.ID).Take(&Product).Error
+	err = server.db(r).Model(models.Product{}).Where("id = ?", buy.ID).Take(&Product).Error
 	if err != nil {
-		responses.ERROR(w, http.StatusNotFound, errors.New("Product not found"))
-		return
+		server.Metrics.FailedPurchase(metrics.ReasonProductNotFound)
+		responses.ERROR(w, http.StatusNotFound, models.ErrProductNotFound)
+		return nil, false
 	}
+	if variant == nil {
+		var variants int
+		err = server.db(r).Model(models.ProductVariant{}).Where("product_id = ?", Product.ID).Count(&variants).Error
+		if err != nil {
+			server.Metrics.FailedPurchase(metrics.ReasonError)
+			responses.ERROR(w, http.StatusInternalServerError, err)
+			return nil, false
+		}
+		if variants > 0 {
+			server.Metrics.FailedPurchase(metrics.ReasonVariantRequired)
+			responses.ERROR(w, http.StatusUnprocessableEntity, models.ErrVariantRequired)
+			return nil, false
+		}
+	}
+
 	// Check if the qty balance
-	if Product.AmountAvailable < buy.Qty {
-		responses.ERROR(w, http.StatusBadRequest, errors.New("not enough qty on stock"))
-		return
+	available, price := Product.AmountAvailable, Product.Price
+	if variant != nil {
+		available, price = variant.AmountAvailable, variant.UnitPrice(&Product)
+	}
+	if available < buy.Qty {
+		server.Metrics.FailedPurchase(metrics.ReasonInsufficientStock)
+		responses.ERROR(w, http.StatusBadRequest, models.ErrInsufficientStock)
+		return nil, false
 	}
 
 	// Check if the user balance
 
-	totaprice := Product.Price * buy.Qty
+	totaprice := price * buy.Qty
 	if userGotten.Deposit < totaprice {
-		responses.ERROR(w, http.StatusBadRequest, errors.New("there is not enough balance to buy"))
-		return
+		server.Metrics.FailedPurchase(metrics.ReasonInsufficientBalance)
+		responses.ERROR(w, http.StatusBadRequest, models.ErrInsufficientBalance)
+		return nil, false
 	}
-	Product.AmountAvailable = Product.AmountAvailable - buy.Qty
-	// update proudct
 
-	ProductCreated, err := Product.UpdateAProduct(server.DB)
-	if err != nil {
-		formattedError := formaterror.FormatError(err.Error())
-		responses.ERROR(w, http.StatusInternalServerError, formattedError)
-		return
+	// update proudct
+	movement := models.InventoryMovement{
+		ProductID: Product.ID,
+		Reason:    models.MovementSale,
+		Quantity:  -buy.Qty,
+		ActorID:   uid,
 	}
-	// update user deposit
-	user.Deposit = user.Deposit - totaprice
-	_, errbal := user.UpdateAUserBal(server.DB, uint32(uid))
-	if errbal != nil {
-		formattedError := formaterror.FormatError(err.Error())
-		responses.ERROR(w, http.StatusInternalServerError, formattedError)
-		return
+	if variant != nil {
+		movement.VariantID = &variant.ID
 	}
-
-	w.Header().Set("Lacation", fmt.Sprintf("%s%s/%d", r.Host, r.URL.Path, ProductCreated.ID))
-	responses.JSON(w, http.StatusCreated, ProductCreated)
+	purchase := map[string]interface{}{
+		"buyer_id":   uid,
+		"product_id": Product.ID,
+		"variant_id": movement.VariantID,
+		"qty":        buy.Qty,
+		"unit_price": price,
+		"total":      totaprice,
+	}
+	// stock, deposit and their events commit together or not at all, the
+	// deposit is checked again as it is taken
+	var left float32
+	err = models.Transaction(server.db(r), func(tx *gorm.DB) error {
+		_, err := movement.AdjustStock(tx)
+		if err != nil {
+			return err
+		}
+		buyer, err := models.WithdrawDeposit(tx, uint32(uid), totaprice)
+		if err != nil {
+			return err
+		}
+		left = buyer.Deposit
+		_, err = models.RecordEvent(tx, models.EventPurchaseCompleted, Product.SellerID, purchase)
+		if err != nil {
+			return err
+		}
+		_, err = models.RecordEvent(tx, models.EventDepositChanged, 0, map[string]interface{}{
+			"user_id":  uid,
+			"previous": buyer.Deposit + totaprice,
+			"deposit":  buyer.Deposit,
+			"reason":   "purchase",
+		})
+		return err
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrInsufficientStock):
+			server.Metrics.FailedPurchase(metrics.ReasonInsufficientStock)
+			responses.ERROR(w, http.StatusBadRequest, err)
+			return nil, false
+		case errors.Is(err, models.ErrInsufficientBalance):
+			server.Metrics.FailedPurchase(metrics.ReasonInsufficientBalance)
+			responses.ERROR(w, http.StatusBadRequest, err)
+			return nil, false
+		}
+		server.Metrics.FailedPurchase(metrics.ReasonError)
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return nil, false
+	}
+	server.Metrics.Purchase(buy.Qty, totaprice)
+	server.wakeOutbox()
+	return &resources.Purchase{
+		ProductID: Product.ID,
+		VariantID: movement.VariantID,
+		Qty:       buy.Qty,
+		UnitPrice: price,
+		Total:     totaprice,
+		Deposit:   left,
+	}, true
 }
@@ -0,0 +1,123 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/task/api/auth"
+	"github.com/task/api/metrics"
+	"github.com/task/api/middlewares"
+	"github.com/task/api/models"
+	"github.com/task/api/requests"
+	"github.com/task/api/resources"
+	"github.com/task/api/responses"
+)
+
+// writeProduct answers p in the shape of the API version r was sent to.
+func writeProduct(w http.ResponseWriter, r *http.Request, status int, p *models.Product) {
+	if middlewares.Version(r) >= 2 {
+		responses.JSON(w, status, resources.NewProduct(p))
+		return
+	}
+	responses.JSON(w, status, p)
+}
+
+// writeProducts answers ps in the shape of the API version r was sent to.
+func writeProducts(w http.ResponseWriter, r *http.Request, status int, ps []models.Product) {
+	if middlewares.Version(r) >= 2 {
+		responses.JSON(w, status, resources.NewProducts(ps))
+		return
+	}
+	responses.JSON(w, status, ps)
+}
+
+// location is the Location of a resource created by r at path. From v2 on it
+// is the path, before it was the host and path without a scheme.
+func location(r *http.Request, path string) string {
+	if middlewares.Version(r) >= 2 {
+		return path
+	}
+	return r.Host + path
+}
+
+// versionPrefix is the path prefix of the API version r was sent to.
+func versionPrefix(r *http.Request) string {
+	if version := middlewares.Version(r); version > 0 {
+		return fmt.Sprintf("/v%d", version)
+	}
+	return ""
+}
+
+func (server *Server) CreateProductV2(w http.ResponseWriter, r *http.Request) {
+
+	newProduct := requests.NewProductV2{}
+	err := server.decode(r, &newProduct)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	uid, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+	ProductCreated, ok := server.saveProduct(w, r, models.Product{
+		ProductName:       newProduct.ProductName,
+		AmountAvailable:   newProduct.AmountAvailable,
+		SellerID:          uid,
+		Price:             newProduct.Price,
+		LowStockThreshold: newProduct.LowStockThreshold,
+		CategoryIDs:       newProduct.CategoryIDs,
+		TagNames:          newProduct.TagNames,
+	})
+	if !ok {
+		return
+	}
+	w.Header().Set("Location", location(r, fmt.Sprintf("%s/%d", r.URL.Path, ProductCreated.ID)))
+	writeProduct(w, r, http.StatusCreated, ProductCreated)
+}
+
+func (server *Server) UpdateProductV2(w http.ResponseWriter, r *http.Request) {
+
+	update := requests.ProductUpdateV2{}
+	err := server.decode(r, &update)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	ProductUpdated, ok := server.updateProduct(w, r, models.Product{
+		ProductName:       update.ProductName,
+		AmountAvailable:   update.AmountAvailable,
+		LowStockThreshold: update.LowStockThreshold,
+		CategoryIDs:       update.CategoryIDs,
+		TagNames:          update.TagNames,
+	})
+	if !ok {
+		return
+	}
+	writeProduct(w, r, http.StatusOK, ProductUpdated)
+}
+
+// BuyProductV2 answers the purchase instead of the product bought. Nothing
+// addressable is created, so there is no Location.
+func (server *Server) BuyProductV2(w http.ResponseWriter, r *http.Request) {
+
+	buy := requests.BuyV2{}
+	err := server.decode(r, &buy)
+	if err != nil {
+		server.Metrics.FailedPurchase(metrics.ReasonInvalidRequest)
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	purchase, ok := server.buyProduct(w, r, requests.Buy{
+		ID:        buy.ProductID,
+		VariantID: buy.VariantID,
+		SKU:       buy.SKU,
+		Qty:       buy.Qty,
+	})
+	if !ok {
+		return
+	}
+	responses.JSON(w, http.StatusOK, purchase)
+}
@@ -0,0 +1,100 @@
+package controllers
+
+import (
+	"time"
+
+	"github.com/task/api/models"
+)
+
+// PurgeDeleted permanently removes products and users that have been soft
+// deleted for longer than retention, including the stored product images.
+func (server *Server) PurgeDeleted(retention time.Duration) error {
+
+	before := time.Now().Add(-retention)
+
+	images, products, err := models.PurgeDeletedProducts(server.DB, before)
+	if err != nil {
+		return err
+	}
+	if server.Store != nil {
+		for _, img := range images {
+			server.deleteBlobs(server.logger(), img.Key, img.ThumbnailKey)
+		}
+	}
+	users, err := models.PurgeDeletedUsers(server.DB, before)
+	if err != nil {
+		return err
+	}
+	if products > 0 || users > 0 {
+		server.logger().Infof("purged %d products and %d users deleted before %s", products, users, before.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// PurgeOutbox removes the outbox events published longer ago than retention.
+func (server *Server) PurgeOutbox(retention time.Duration) error {
+
+	before := time.Now().Add(-retention)
+
+	events, err := models.PurgePublishedEvents(server.DB, before)
+	if err != nil {
+		return err
+	}
+	if events > 0 {
+		server.logger().Infof("purged %d events published before %s", events, before.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// PurgeIdempotencyKeys removes the idempotency keys that expired.
+func (server *Server) PurgeIdempotencyKeys() error {
+
+	keys, err := models.PurgeIdempotencyKeys(server.DB, time.Now().Add(-models.IdempotencyKeyTTL))
+	if err != nil {
+		return err
+	}
+	if keys > 0 {
+		server.logger().Infof("purged %d expired idempotency keys", keys)
+	}
+	return nil
+}
+
+// StartPurger runs PurgeDeleted every interval until the returned function
+// is called, which waits for a purge in progress.
+func (server *Server) StartPurger(retention, interval time.Duration) (stop func()) {
+	return server.every(interval, "deleted rows", func() error { return server.PurgeDeleted(retention) })
+}
+
+// StartOutboxPurger runs PurgeOutbox every interval, like StartPurger.
+func (server *Server) StartOutboxPurger(retention, interval time.Duration) (stop func()) {
+	return server.every(interval, "published events", func() error { return server.PurgeOutbox(retention) })
+}
+
+// StartIdempotencyKeyPurger runs PurgeIdempotencyKeys every interval, like
+// StartPurger.
+func (server *Server) StartIdempotencyKeyPurger(interval time.Duration) (stop func()) {
+	return server.every(interval, "idempotency keys", server.PurgeIdempotencyKeys)
+}
+
+// every runs purge right away and then every interval until the returned
+// function is called, which waits for a purge in progress.
+func (server *Server) every(interval time.Duration, what string, purge func() error) (stop func()) {
+
+	done, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if err := purge(); err != nil {
+				server.logger().Errorf("cannot purge %s: %v", what, err)
+			}
+			select {
+			case <-ticker.C:
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() { close(done); <-stopped }
+}
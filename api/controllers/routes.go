@@ -1,28 +1,156 @@
 package controllers
 
-import "github.com/task/api/middlewares"
+import (
+	"fmt"
+	"net/http"
+	"time"
 
-func (s *Server) initializeRoutes() {
+	"github.com/gorilla/mux"
+	"github.com/task/api/middlewares"
+	"github.com/task/api/openapi"
+	"github.com/task/api/ratelimit"
+	"github.com/task/api/tracing"
+)
+
+// initializeRoutes adds the routes and the OpenAPI document of them, which
+// must document every route.
+func (s *Server) initializeRoutes() error {
+
+	tracer := tracing.Tracer(s.Tracing)
+	s.Router.Use(middlewares.SetMiddlewareTracing(tracer), middlewares.SetMiddlewareRequestLog(s.logger()), middlewares.SetMiddlewareMetrics(s.Metrics), s.rateLimit(ratelimit.Default))
+	unmatched := func(h http.HandlerFunc) http.Handler {
+		return middlewares.SetMiddlewareTracing(tracer)(middlewares.SetMiddlewareRequestLog(s.logger())(middlewares.SetMiddlewareMetrics(s.Metrics)(s.rateLimit(ratelimit.Default)(h))))
+	}
+	s.Router.NotFoundHandler = unmatched(s.NotFound)
+	s.Router.MethodNotAllowedHandler = unmatched(s.MethodNotAllowed)
 
 	// Home Route
 	s.Router.HandleFunc("/", middlewares.SetMiddlewareJSON(s.Home)).Methods("GET")
 
+	// Health Routes
+	s.Router.HandleFunc("/healthz", middlewares.SetMiddlewareJSON(s.Healthz)).Methods("GET")
+	s.Router.HandleFunc("/readyz", middlewares.SetMiddlewareJSON(s.Readyz)).Methods("GET")
+	if s.Metrics != nil {
+		s.Router.Handle("/metrics", middlewares.SetMiddlewareMetricsToken(s.metricsToken, s.Metrics.Handler())).Methods("GET")
+	}
+
+	// Error codes
+	s.Router.HandleFunc("/problems", middlewares.SetMiddlewareJSON(s.GetProblems)).Methods("GET")
+	s.Router.HandleFunc("/problems/{code}", middlewares.SetMiddlewareJSON(s.GetProblem)).Methods("GET")
+
+	// Product images, their urls are stored with the products
+	s.Router.HandleFunc("/images/{key:.+}", s.ServeImage).Methods("GET")
+
+	// Documentation
+	s.Router.HandleFunc("/openapi.json", middlewares.SetMiddlewareJSON(s.GetOpenAPI)).Methods("GET")
+	s.Router.HandleFunc("/docs", openapi.Docs).Methods("GET")
+
+	// The API under /v1 and /v2, and without a prefix as it was before
+	// versions, which is /v1 and deprecated
+	for _, version := range []int{1, 2} {
+		router := s.Router.PathPrefix(fmt.Sprintf("/v%d", version)).Subrouter()
+		router.Use(middlewares.SetMiddlewareVersion(version))
+		s.apiRoutes(router, version)
+	}
+	unversioned := s.Router.NewRoute().Subrouter()
+	unversioned.Use(middlewares.SetMiddlewareDeprecated(unversionedDeprecation, "/v1"))
+	s.apiRoutes(unversioned, 0)
+
+	var err error
+	s.OpenAPI, err = openapi.Build(info, s.Router, describe)
+	if err != nil {
+		return err
+	}
+	// the middlewares of the router run once a route matched, whenever they
+	// were added
+	validation := s.openAPIValidation
+	if validation.ValidateRequests || validation.ValidateResponses {
+		s.Router.Use(openapi.Validate(s.OpenAPI, openapi.Options{
+			Requests:     validation.ValidateRequests,
+			Responses:    validation.ValidateResponses,
+			BodyMaxBytes: s.BodyMaxBytes,
+			Log:          s.logger(),
+		}))
+	}
+	return nil
+}
+
+// unversionedDeprecation is when the routes without a version prefix were
+// deprecated.
+var unversionedDeprecation = time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC)
+
+// apiRoutes adds the routes of the API to router. Version 2 has its own
+// product payloads, the other routes are the same in every version.
+func (s *Server) apiRoutes(router *mux.Router, version int) {
+
+	createProduct, updateProduct, buyProduct := s.CreateProduct, s.UpdateProduct, s.BuyProduct
+	if version >= 2 {
+		createProduct, updateProduct, buyProduct = s.CreateProductV2, s.UpdateProductV2, s.BuyProductV2
+	}
+
 	// Login Route
-	s.Router.HandleFunc("/login", middlewares.SetMiddlewareJSON(s.Login)).Methods("POST")
+	router.Handle("/login", s.rateLimit(ratelimit.Login)(middlewares.SetMiddlewareJSON(s.Login))).Methods("POST")
+	router.HandleFunc("/login/refresh", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.RefreshToken))).Methods("POST")
 
 	//Users routes
-	s.Router.HandleFunc("/users", middlewares.SetMiddlewareJSON(s.CreateUser)).Methods("POST")
-	s.Router.HandleFunc("/users", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.GetUsers))).Methods("GET")
-	s.Router.HandleFunc("/users/{id}", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.GetUser))).Methods("GET")
-	s.Router.HandleFunc("/users/{id}", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.UpdateUser))).Methods("PUT")
-	s.Router.HandleFunc("/users/{id}", middlewares.SetMiddlewareAuthentication(s.DeleteUser)).Methods("DELETE")
+	router.Handle("/users", s.rateLimit(ratelimit.Signup)(middlewares.SetMiddlewareJSON(s.CreateUser))).Methods("POST")
+	router.HandleFunc("/users", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.GetUsers))).Methods("GET")
+	router.HandleFunc("/users/{id}", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.GetUser))).Methods("GET")
+	router.HandleFunc("/users/{id}", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.UpdateUser))).Methods("PUT")
+	router.HandleFunc("/users/{id}", middlewares.SetMiddlewareAuthentication(s.DeleteUser)).Methods("DELETE")
+	router.HandleFunc("/users/{id}/restore", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthAdmin(s.RestoreUser))).Methods("POST")
 
 	//Products routes
-	s.Router.HandleFunc("/products", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.GetProducts))).Methods("GET")
-	s.Router.HandleFunc("/products/{id}", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.GetProduct))).Methods("GET")
-	s.Router.HandleFunc("/products", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthseller(s.CreateProduct))).Methods("POST")
-	s.Router.HandleFunc("/products/{id}", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthseller(s.UpdateProduct))).Methods("PUT")
-	s.Router.HandleFunc("/products/{id}", middlewares.SetMiddlewareAuthentication(s.DeleteProduct)).Methods("DELETE")
-	s.Router.HandleFunc("/buy", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthBuyer((s.BuyProduct)))).Methods("POST")
+	router.HandleFunc("/products", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.GetProducts))).Methods("GET")
+	router.HandleFunc("/products/stream", middlewares.SetMiddlewareAuthentication(s.StreamProducts)).Methods("GET")
+	router.HandleFunc("/products/ws", middlewares.SetMiddlewareAuthentication(s.ProductsWebSocket)).Methods("GET")
+	router.HandleFunc("/products/{id}", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.GetProduct))).Methods("GET")
+	router.HandleFunc("/products", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthseller(createProduct))).Methods("POST")
+	router.HandleFunc("/products/{id}", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthseller(updateProduct))).Methods("PUT")
+	router.HandleFunc("/products/{id}", middlewares.SetMiddlewareAuthentication(s.DeleteProduct)).Methods("DELETE")
+	router.HandleFunc("/products/{id}/restore", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthseller(s.RestoreProduct))).Methods("POST")
+	router.HandleFunc("/products/{id}/images", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.GetProductImages))).Methods("GET")
+	router.HandleFunc("/products/{id}/images", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthseller(s.UploadProductImage))).Methods("POST")
+	router.HandleFunc("/products/{id}/images", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthseller(s.ReorderProductImages))).Methods("PUT")
+	router.HandleFunc("/products/{id}/images/{image_id}", middlewares.SetMiddlewareAuthseller(s.DeleteProductImage)).Methods("DELETE")
+	router.HandleFunc("/products/{id}/options", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthseller(s.SetProductOptions))).Methods("PUT")
+	router.HandleFunc("/products/{id}/variants", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.GetProductVariants))).Methods("GET")
+	router.HandleFunc("/products/{id}/variants", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthseller(s.CreateProductVariant))).Methods("POST")
+	router.HandleFunc("/products/{id}/variants/{variant_id}", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthseller(s.UpdateProductVariant))).Methods("PUT")
+	router.HandleFunc("/products/{id}/variants/{variant_id}", middlewares.SetMiddlewareAuthseller(s.DeleteProductVariant)).Methods("DELETE")
+	router.HandleFunc("/products/{id}/stock-adjustments", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthseller(s.CreateStockAdjustment))).Methods("POST")
+	router.HandleFunc("/products/{id}/stock-history", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthseller(s.GetStockHistory))).Methods("GET")
+	router.HandleFunc("/products/{id}/restock-subscriptions", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthBuyer(s.SubscribeRestock))).Methods("POST")
+	router.HandleFunc("/products/{id}/restock-subscriptions", middlewares.SetMiddlewareAuthBuyer(s.UnsubscribeRestock)).Methods("DELETE")
+	router.Handle("/buy", s.rateLimit(ratelimit.Buy)(middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthBuyer(s.idempotent(buyProduct))))).Methods("POST")
+
+	//Categories routes
+	router.HandleFunc("/categories", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.GetCategories))).Methods("GET")
+	router.HandleFunc("/categories/{id}", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.GetCategory))).Methods("GET")
+	router.HandleFunc("/categories/{id}/products", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.GetCategoryProducts))).Methods("GET")
+	router.HandleFunc("/categories", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthAdmin(s.CreateCategory))).Methods("POST")
+	router.HandleFunc("/categories/{id}", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthAdmin(s.UpdateCategory))).Methods("PUT")
+	router.HandleFunc("/categories/{id}", middlewares.SetMiddlewareAuthAdmin(s.DeleteCategory)).Methods("DELETE")
+
+	//Tags routes
+	router.HandleFunc("/tags", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.GetTags))).Methods("GET")
+
+	//Notifications routes
+	router.HandleFunc("/notifications", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.GetNotifications))).Methods("GET")
+	router.HandleFunc("/notifications/{id}/read", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.ReadNotification))).Methods("POST")
+
+	//Webhooks routes
+	router.HandleFunc("/webhooks", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthSellerOrAdmin(s.GetWebhooks))).Methods("GET")
+	router.HandleFunc("/webhooks", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthSellerOrAdmin(s.CreateWebhook))).Methods("POST")
+	router.HandleFunc("/webhooks/{id}", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthSellerOrAdmin(s.GetWebhook))).Methods("GET")
+	router.HandleFunc("/webhooks/{id}", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthSellerOrAdmin(s.UpdateWebhook))).Methods("PUT")
+	router.HandleFunc("/webhooks/{id}", middlewares.SetMiddlewareAuthSellerOrAdmin(s.DeleteWebhook)).Methods("DELETE")
+	router.HandleFunc("/webhooks/{id}/deliveries", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthSellerOrAdmin(s.GetWebhookDeliveries))).Methods("GET")
+	router.HandleFunc("/webhooks/{id}/deliveries/{delivery_id}/redeliver", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthSellerOrAdmin(s.RedeliverWebhook))).Methods("POST")
+}
 
+// rateLimit limits the routes of group, on top of the default limit every
+// route has.
+func (s *Server) rateLimit(group string) func(http.Handler) http.Handler {
+	return middlewares.SetMiddlewareRateLimit(s.Limiter, group)
 }
@@ -0,0 +1,314 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/task/api/apierror"
+	"github.com/task/api/realtime"
+	"github.com/task/api/responses"
+)
+
+// replayLimit caps how many missed updates a resuming client gets, older
+// ones are lost and the client should reload the products.
+const replayLimit = 1000
+
+func (server *Server) heartbeat() time.Duration {
+	if server.StreamHeartbeat > 0 {
+		return server.StreamHeartbeat
+	}
+	return 15 * time.Second
+}
+
+// streamFilter reads product_id and seller_id, both repeatable and comma
+// separated.
+func streamFilter(query url.Values) (realtime.Filter, error) {
+	filter := realtime.Filter{}
+	for _, values := range query["product_id"] {
+		for _, value := range strings.Split(values, ",") {
+			pid, err := strconv.ParseUint(strings.TrimSpace(value), 10, 64)
+			if err != nil {
+				return filter, apierror.Invalid("product_id", "Invalid product_id")
+			}
+			filter.ProductIDs = append(filter.ProductIDs, pid)
+		}
+	}
+	for _, values := range query["seller_id"] {
+		for _, value := range strings.Split(values, ",") {
+			sid, err := strconv.ParseUint(strings.TrimSpace(value), 10, 32)
+			if err != nil {
+				return filter, apierror.Invalid("seller_id", "Invalid seller_id")
+			}
+			filter.SellerIDs = append(filter.SellerIDs, uint32(sid))
+		}
+	}
+	return filter, nil
+}
+
+// StreamProducts streams product updates as Server-Sent Events. Each event
+// has the outbox event id as id, so a reconnecting EventSource resumes with
+// Last-Event-ID (or ?last_event_id=) and gets the updates it missed.
+func (server *Server) StreamProducts(w http.ResponseWriter, r *http.Request) {
+
+	filter, err := streamFilter(r.URL.Query())
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if filter.Empty() {
+		message := "Required product_id or seller_id"
+		responses.ERROR(w, http.StatusUnprocessableEntity, apierror.Validation(
+			apierror.FieldError{Field: "product_id", Code: "required", Message: message},
+			apierror.FieldError{Field: "seller_id", Code: "required", Message: message},
+		))
+		return
+	}
+	lastID := r.Header.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = r.URL.Query().Get("last_event_id")
+	}
+	var last uint64
+	if lastID != "" {
+		last, err = strconv.ParseUint(lastID, 10, 64)
+		if err != nil {
+			responses.ERROR(w, http.StatusUnprocessableEntity, apierror.Invalid("last_event_id", "Invalid Last-Event-ID"))
+			return
+		}
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok || server.Hub == nil {
+		responses.ERROR(w, http.StatusServiceUnavailable, errors.New("Streaming Unavailable"))
+		return
+	}
+
+	// subscribe before replaying so nothing falls in between
+	sub := server.Hub.Subscribe(filter)
+	defer server.Hub.Unsubscribe(sub)
+
+	// the stream outlives HTTP_WRITE_TIMEOUT
+	if conn, ok := r.Context().Value(connKey{}).(net.Conn); ok {
+		conn.SetWriteDeadline(time.Time{})
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, "retry: 3000\n\n")
+
+	send := func(u realtime.Update) bool {
+		if u.ID <= last {
+			return true
+		}
+		last = u.ID
+		data, err := json.Marshal(u)
+		if err != nil {
+			return false
+		}
+		_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", u.ID, u.Type, data)
+		return err == nil
+	}
+	if last > 0 {
+		missed, err := realtime.Replay(server.db(r), last, filter, replayLimit, server.Outbox.AttemptLimit())
+		if err != nil {
+			return
+		}
+		for _, u := range missed {
+			if !send(u) {
+				return
+			}
+		}
+	}
+	flusher.Flush()
+
+	ticker := time.NewTicker(server.heartbeat())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case u, ok := <-sub.C:
+			if !ok || !send(u) {
+				return
+			}
+		case <-ticker.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+// checkOrigin lets clients without an Origin, which are not browsers, and
+// pages of the API's own host or of StreamOrigins open the WebSocket. The
+// token travels in the query string, so any page could otherwise use it.
+func (server *Server) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	for _, allowed := range server.StreamOrigins {
+		if allowed == "*" || strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// streamRequest is a message from a WebSocket client. A subscribe replaces
+// the current subscription and replays what was missed after LastEventID.
+type streamRequest struct {
+	Action      string `json:"action"`
+	LastEventID uint64 `json:"last_event_id"`
+	realtime.Filter
+}
+
+// ProductsWebSocket streams the same updates as StreamProducts over a
+// WebSocket. The filter can be given in the query string like for the SSE
+// stream or sent as {"action":"subscribe","product_ids":[1],"seller_ids":[2],
+// "last_event_id":0}.
+func (server *Server) ProductsWebSocket(w http.ResponseWriter, r *http.Request) {
+
+	filter, err := streamFilter(r.URL.Query())
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if server.Hub == nil {
+		responses.ERROR(w, http.StatusServiceUnavailable, errors.New("Streaming Unavailable"))
+		return
+	}
+	var last uint64
+	if value := r.URL.Query().Get("last_event_id"); value != "" {
+		last, err = strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			responses.ERROR(w, http.StatusUnprocessableEntity, apierror.Invalid("last_event_id", "Invalid Last-Event-ID"))
+			return
+		}
+	}
+	upgrader := websocket.Upgrader{ReadBufferSize: 1024, WriteBufferSize: 1024, CheckOrigin: server.checkOrigin}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	heartbeat := server.heartbeat()
+	requests := make(chan streamRequest)
+	done := make(chan struct{})
+	quit := make(chan struct{})
+	defer close(quit)
+	go func() {
+		defer close(done)
+		conn.SetReadLimit(64 << 10)
+		conn.SetReadDeadline(time.Now().Add(2 * heartbeat))
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(2 * heartbeat))
+		})
+		for {
+			req := streamRequest{}
+			if err := conn.ReadJSON(&req); err != nil {
+				return
+			}
+			select {
+			case requests <- req:
+			case <-quit:
+				return
+			}
+		}
+	}()
+
+	var sub *realtime.Subscription
+	updates := make(<-chan realtime.Update)
+	subscribe := func(f realtime.Filter, after uint64) bool {
+		if sub != nil {
+			server.Hub.Unsubscribe(sub)
+		}
+		sub = server.Hub.Subscribe(f)
+		updates = sub.C
+		last = after
+		if after == 0 {
+			return true
+		}
+		missed, err := realtime.Replay(server.db(r), after, f, replayLimit, server.Outbox.AttemptLimit())
+		if err != nil {
+			return false
+		}
+		for _, u := range missed {
+			last = u.ID
+			if conn.WriteJSON(u) != nil {
+				return false
+			}
+		}
+		return true
+	}
+	defer func() {
+		if sub != nil {
+			server.Hub.Unsubscribe(sub)
+		}
+	}()
+	if !filter.Empty() && !subscribe(filter, last) {
+		return
+	}
+
+	ticker := time.NewTicker(heartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case req := <-requests:
+			switch req.Action {
+			case "subscribe":
+				if req.Filter.Empty() {
+					conn.WriteJSON(map[string]string{"error": "Required product_ids or seller_ids"})
+					continue
+				}
+				if !subscribe(req.Filter, req.LastEventID) {
+					return
+				}
+			case "unsubscribe":
+				if sub != nil {
+					server.Hub.Unsubscribe(sub)
+					sub = nil
+				}
+				updates = make(<-chan realtime.Update)
+			default:
+				conn.WriteJSON(map[string]string{"error": "Unknown action " + req.Action})
+			}
+		case u, ok := <-updates:
+			if !ok {
+				conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "stream closed, resume from the last event id"))
+				return
+			}
+			if u.ID <= last {
+				continue
+			}
+			last = u.ID
+			if conn.WriteJSON(u) != nil {
+				return
+			}
+		case <-ticker.C:
+			if conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(10*time.Second)) != nil {
+				return
+			}
+		}
+	}
+}
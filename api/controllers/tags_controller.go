@@ -0,0 +1,20 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/task/api/models"
+	"github.com/task/api/responses"
+)
+
+func (server *Server) GetTags(w http.ResponseWriter, r *http.Request) {
+
+	tag := models.Tag{}
+
+	tags, err := tag.FindAllTags(server.db(r))
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, tags)
+}
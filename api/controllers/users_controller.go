@@ -1,35 +1,27 @@
 package controllers
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
 	"net/http"
 	"strconv"
 
 	"github.com/gorilla/mux"
+	"github.com/jinzhu/gorm"
 	"github.com/task/api/auth"
 	"github.com/task/api/models"
+	"github.com/task/api/repository"
+	"github.com/task/api/requests"
 	"github.com/task/api/responses"
-	"github.com/task/api/utils/formaterror"
 )
 
 func (server *Server) CreateUser(w http.ResponseWriter, r *http.Request) {
 
-	body, err := ioutil.ReadAll(r.Body)
-	if err != nil {
-		responses.ERROR(w, http.StatusUnprocessableEntity, err)
-	}
-	type NewUser struct {
-		Username string  `json:"username"`
-		Email    string  `json:"email"`
-		Password string  `json:"password"`
-		Role     string  `json:"role"`
-		Deposit  float32 `json:"deposit"`
+	if !server.hasDatabase(w) {
+		return
 	}
-	newuser := NewUser{}
-	err = json.Unmarshal(body, &newuser)
+	newuser := requests.NewUser{}
+	err := server.decode(r, &newuser)
 	if err != nil {
 		responses.ERROR(w, http.StatusUnprocessableEntity, err)
 		return
@@ -41,29 +33,29 @@ func (server *Server) CreateUser(w http.ResponseWriter, r *http.Request) {
 	user.Role = newuser.Role
 	user.Username = newuser.Username
 	user.Prepare()
-	err = user.Validate("")
-	if err != nil {
-		responses.ERROR(w, http.StatusUnprocessableEntity, err)
-		return
-	}
-	userCreated, err := user.SaveUser(server.DB)
+	var userCreated *models.User
+	err = models.Transaction(server.db(r), func(tx *gorm.DB) error {
+		userCreated, err = user.SaveUser(tx)
+		if err != nil {
+			return err
+		}
+		_, err = models.RecordEvent(tx, models.EventUserCreated, 0, userCreated)
+		return err
+	})
 
 	if err != nil {
 
-		formattedError := formaterror.FormatError(err.Error())
-
-		responses.ERROR(w, http.StatusInternalServerError, formattedError)
+		responses.ERROR(w, http.StatusInternalServerError, err)
 		return
 	}
-	w.Header().Set("Location", fmt.Sprintf("%s%s/%d", r.Host, r.RequestURI, userCreated.ID))
+	server.wakeOutbox()
+	w.Header().Set("Location", location(r, fmt.Sprintf("%s/%d", r.URL.Path, userCreated.ID)))
 	responses.JSON(w, http.StatusCreated, userCreated)
 }
 
 func (server *Server) GetUsers(w http.ResponseWriter, r *http.Request) {
 
-	user := models.User{}
-
-	users, err := user.FindAllUsers(server.DB)
+	users, err := server.users(r.Context()).List(includeDeleted(r))
 	if err != nil {
 		responses.ERROR(w, http.StatusInternalServerError, err)
 		return
@@ -79,8 +71,7 @@ func (server *Server) GetUser(w http.ResponseWriter, r *http.Request) {
 		responses.ERROR(w, http.StatusBadRequest, err)
 		return
 	}
-	user := models.User{}
-	userGotten, err := user.FindUserByID(server.DB, uint32(uid))
+	userGotten, err := server.users(r.Context()).FindByID(uint32(uid))
 	if err != nil {
 		responses.ERROR(w, http.StatusBadRequest, err)
 		return
@@ -90,19 +81,17 @@ func (server *Server) GetUser(w http.ResponseWriter, r *http.Request) {
 
 func (server *Server) UpdateUser(w http.ResponseWriter, r *http.Request) {
 
+	if !server.hasDatabase(w) {
+		return
+	}
 	vars := mux.Vars(r)
 	uid, err := strconv.ParseUint(vars["id"], 10, 32)
 	if err != nil {
 		responses.ERROR(w, http.StatusBadRequest, err)
 		return
 	}
-	body, err := ioutil.ReadAll(r.Body)
-	if err != nil {
-		responses.ERROR(w, http.StatusUnprocessableEntity, err)
-		return
-	}
-	user := models.User{}
-	err = json.Unmarshal(body, &user)
+	update := requests.UserUpdate{}
+	err = server.decode(r, &update)
 	if err != nil {
 		responses.ERROR(w, http.StatusUnprocessableEntity, err)
 		return
@@ -113,21 +102,38 @@ func (server *Server) UpdateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	if tokenID != uint32(uid) {
-		responses.ERROR(w, http.StatusUnauthorized, errors.New(http.StatusText(http.StatusUnauthorized)))
+		responses.ERROR(w, http.StatusForbidden, errors.New(http.StatusText(http.StatusForbidden)))
 		return
 	}
+	user := models.User{Username: update.Username, Deposit: update.Deposit}
 	user.Prepare()
-	err = user.Validate("update")
+	var updatedUser *models.User
+	err = models.Transaction(server.db(r), func(tx *gorm.DB) error {
+		current := models.User{}
+		_, err := current.FindUserByID(tx, uint32(uid))
+		if err != nil {
+			return err
+		}
+		updatedUser, err = user.UpdateAUser(tx, uint32(uid))
+		if err != nil {
+			return err
+		}
+		if updatedUser.Deposit == current.Deposit {
+			return nil
+		}
+		_, err = models.RecordEvent(tx, models.EventDepositChanged, 0, map[string]interface{}{
+			"user_id":  uid,
+			"previous": current.Deposit,
+			"deposit":  updatedUser.Deposit,
+			"reason":   "update",
+		})
+		return err
+	})
 	if err != nil {
-		responses.ERROR(w, http.StatusUnprocessableEntity, err)
-		return
-	}
-	updatedUser, err := user.UpdateAUser(server.DB, uint32(uid))
-	if err != nil {
-		formattedError := formaterror.FormatError(err.Error())
-		responses.ERROR(w, http.StatusInternalServerError, formattedError)
+		responses.ERROR(w, http.StatusInternalServerError, err)
 		return
 	}
+	server.wakeOutbox()
 	responses.JSON(w, http.StatusOK, updatedUser)
 }
 
@@ -135,8 +141,6 @@ func (server *Server) DeleteUser(w http.ResponseWriter, r *http.Request) {
 
 	vars := mux.Vars(r)
 
-	user := models.User{}
-
 	uid, err := strconv.ParseUint(vars["id"], 10, 32)
 	if err != nil {
 		responses.ERROR(w, http.StatusBadRequest, err)
@@ -148,10 +152,10 @@ func (server *Server) DeleteUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	if tokenID != 0 && tokenID != uint32(uid) {
-		responses.ERROR(w, http.StatusUnauthorized, errors.New(http.StatusText(http.StatusUnauthorized)))
+		responses.ERROR(w, http.StatusForbidden, errors.New(http.StatusText(http.StatusForbidden)))
 		return
 	}
-	_, err = user.DeleteAUser(server.DB, uint32(uid))
+	err = server.users(r.Context()).Delete(uint32(uid))
 	if err != nil {
 		responses.ERROR(w, http.StatusInternalServerError, err)
 		return
@@ -159,3 +163,33 @@ func (server *Server) DeleteUser(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Entity", fmt.Sprintf("%d", uid))
 	responses.JSON(w, http.StatusNoContent, "")
 }
+
+func (server *Server) RestoreUser(w http.ResponseWriter, r *http.Request) {
+
+	vars := mux.Vars(r)
+	uid, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+	userRestored, err := server.users(r.Context()).Restore(uint32(uid))
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			responses.ERROR(w, http.StatusNotFound, err)
+			return
+		}
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, userRestored)
+}
+
+// includeDeleted reports whether an admin asked for soft deleted rows with
+// ?include_deleted=true. Everybody else only ever sees live rows.
+func includeDeleted(r *http.Request) bool {
+	if r.URL.Query().Get("include_deleted") != "true" {
+		return false
+	}
+	role, err := auth.ExtractRole(r)
+	return err == nil && role == "admin"
+}
@@ -0,0 +1,196 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/jinzhu/gorm"
+	"github.com/task/api/apierror"
+	"github.com/task/api/models"
+	"github.com/task/api/requests"
+	"github.com/task/api/responses"
+)
+
+func (server *Server) SetProductOptions(w http.ResponseWriter, r *http.Request) {
+
+	Product, ok := server.ownedProduct(w, r)
+	if !ok {
+		return
+	}
+	axes := []requests.ProductOption{}
+	err := server.decode(r, &axes)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	options := make([]models.ProductOption, 0, len(axes))
+	for _, axis := range axes {
+		options = append(options, models.ProductOption{Name: axis.Name, Values: axis.Values})
+	}
+	optionsSet, err := models.SetProductOptions(server.db(r), Product.ID, options)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, optionsSet)
+}
+
+func (server *Server) GetProductVariants(w http.ResponseWriter, r *http.Request) {
+
+	vars := mux.Vars(r)
+	pid, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+	variant := models.ProductVariant{}
+	variants, err := variant.FindProductVariants(server.db(r), pid)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, variants)
+}
+
+func (server *Server) CreateProductVariant(w http.ResponseWriter, r *http.Request) {
+
+	Product, ok := server.ownedProduct(w, r)
+	if !ok {
+		return
+	}
+	payload := requests.Variant{}
+	err := server.decode(r, &payload)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	variant := models.ProductVariant{
+		SKU:             payload.SKU,
+		Options:         payload.Options,
+		AmountAvailable: payload.AmountAvailable,
+		Price:           payload.Price,
+	}
+	variant.Prepare()
+	variant.ProductID = Product.ID
+	var variantCreated *models.ProductVariant
+	err = models.Transaction(server.db(r), func(tx *gorm.DB) error {
+		variantCreated, err = variant.SaveVariant(tx)
+		if err != nil {
+			return err
+		}
+		movement := models.InventoryMovement{
+			ProductID: Product.ID,
+			VariantID: &variantCreated.ID,
+			Reason:    models.MovementRestock,
+			Quantity:  variantCreated.AmountAvailable,
+			Balance:   variantCreated.AmountAvailable,
+			ActorID:   Product.SellerID,
+			Note:      "initial stock",
+		}
+		_, err = movement.RecordMovement(tx)
+		return err
+	})
+	if err != nil {
+		server.variantError(w, err)
+		return
+	}
+	server.wakeOutbox()
+	w.Header().Set("Location", location(r, fmt.Sprintf("%s/%d", r.URL.Path, variantCreated.ID)))
+	responses.JSON(w, http.StatusCreated, variantCreated)
+}
+
+func (server *Server) UpdateProductVariant(w http.ResponseWriter, r *http.Request) {
+
+	Product, ok := server.ownedProduct(w, r)
+	if !ok {
+		return
+	}
+	vars := mux.Vars(r)
+	vid, err := strconv.ParseUint(vars["variant_id"], 10, 64)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+	payload := requests.Variant{}
+	err = server.decode(r, &payload)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	variant := models.ProductVariant{
+		SKU:             payload.SKU,
+		Options:         payload.Options,
+		AmountAvailable: payload.AmountAvailable,
+		Price:           payload.Price,
+	}
+	variant.Prepare()
+	variant.ID = vid
+	variant.ProductID = Product.ID
+	current := models.ProductVariant{}
+	_, err = current.FindVariantByID(server.db(r), vid)
+	if err != nil || current.ProductID != Product.ID {
+		responses.ERROR(w, http.StatusNotFound, models.ErrVariantNotFound)
+		return
+	}
+	var variantUpdated *models.ProductVariant
+	err = models.Transaction(server.db(r), func(tx *gorm.DB) error {
+		variantUpdated, err = variant.UpdateAVariant(tx)
+		if err != nil {
+			return err
+		}
+		movement := models.InventoryMovement{
+			ProductID: Product.ID,
+			VariantID: &variantUpdated.ID,
+			Reason:    models.MovementCorrection,
+			Quantity:  variantUpdated.AmountAvailable - current.AmountAvailable,
+			Balance:   variantUpdated.AmountAvailable,
+			ActorID:   Product.SellerID,
+			Note:      "variant update",
+		}
+		_, err = movement.RecordMovement(tx)
+		return err
+	})
+	if err != nil {
+		server.variantError(w, err)
+		return
+	}
+	server.wakeOutbox()
+	responses.JSON(w, http.StatusOK, variantUpdated)
+}
+
+func (server *Server) DeleteProductVariant(w http.ResponseWriter, r *http.Request) {
+
+	Product, ok := server.ownedProduct(w, r)
+	if !ok {
+		return
+	}
+	vars := mux.Vars(r)
+	vid, err := strconv.ParseUint(vars["variant_id"], 10, 64)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+	variant := models.ProductVariant{}
+	_, err = variant.DeleteAVariant(server.db(r), Product.ID, vid)
+	if err != nil {
+		server.variantError(w, err)
+		return
+	}
+	w.Header().Set("Entity", fmt.Sprintf("%d", vid))
+	responses.JSON(w, http.StatusNoContent, "")
+}
+
+func (server *Server) variantError(w http.ResponseWriter, err error) {
+	var coded *apierror.Error
+	switch {
+	case errors.Is(err, models.ErrVariantNotFound):
+		responses.ERROR(w, http.StatusNotFound, err)
+	case errors.As(err, &coded):
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+	default:
+		responses.ERROR(w, http.StatusInternalServerError, err)
+	}
+}
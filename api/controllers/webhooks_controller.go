@@ -0,0 +1,244 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/task/api/apierror"
+	"github.com/task/api/auth"
+	"github.com/task/api/models"
+	"github.com/task/api/requests"
+	"github.com/task/api/responses"
+	"github.com/task/api/webhooks"
+)
+
+// ownedWebhook loads the webhook of the url, answering 404 unless the caller
+// owns it or is an admin.
+func (server *Server) ownedWebhook(w http.ResponseWriter, r *http.Request) (*models.Webhook, bool) {
+
+	vars := mux.Vars(r)
+	wid, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return nil, false
+	}
+	uid, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return nil, false
+	}
+	role, _ := auth.ExtractRole(r)
+	webhook := models.Webhook{}
+	webhookReceived, err := webhook.FindWebhookByID(server.db(r), wid)
+	if err != nil {
+		if errors.Is(err, models.ErrWebhookNotFound) {
+			responses.ERROR(w, http.StatusNotFound, err)
+			return nil, false
+		}
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return nil, false
+	}
+	if role != "admin" && webhookReceived.OwnerID != uid {
+		responses.ERROR(w, http.StatusNotFound, models.ErrWebhookNotFound)
+		return nil, false
+	}
+	return webhookReceived, true
+}
+
+// createdWebhook is the body of the POST /webhooks response, the only one
+// that shows the signing secret.
+type createdWebhook struct {
+	ID        uint64    `json:"id"`
+	OwnerID   uint32    `json:"owner_id"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"secret"`
+	Events    []string  `json:"events"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// checkWebhookURL refuses webhook URLs whose host is not a public address,
+// unless WEBHOOK_ALLOW_PRIVATE is set.
+func (server *Server) checkWebhookURL(r *http.Request, rawURL string) error {
+	if server.WebhookAllowPrivate {
+		return nil
+	}
+	if err := webhooks.CheckURL(r.Context(), rawURL); err != nil {
+		return apierror.Invalid("url", "Webhook URL Must Be Public")
+	}
+	return nil
+}
+
+func (server *Server) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+
+	payload := requests.NewWebhook{}
+	err := server.decode(r, &payload)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	uid, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+	webhook := models.Webhook{
+		URL:    payload.URL,
+		Events: payload.Events,
+		Secret: payload.Secret,
+		Active: payload.Active == nil || *payload.Active,
+	}
+	webhook.Prepare()
+	webhook.OwnerID = uid
+	err = server.checkWebhookURL(r, webhook.URL)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	webhookCreated, err := webhook.SaveWebhook(server.db(r))
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Location", location(r, fmt.Sprintf("%s/%d", r.URL.Path, webhookCreated.ID)))
+	responses.JSON(w, http.StatusCreated, createdWebhook{
+		ID:        webhookCreated.ID,
+		OwnerID:   webhookCreated.OwnerID,
+		URL:       webhookCreated.URL,
+		Secret:    webhookCreated.Secret,
+		Events:    webhookCreated.Events,
+		Active:    webhookCreated.Active,
+		CreatedAt: webhookCreated.CreatedAt,
+		UpdatedAt: webhookCreated.UpdatedAt,
+	})
+}
+
+func (server *Server) GetWebhooks(w http.ResponseWriter, r *http.Request) {
+
+	uid, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+	role, _ := auth.ExtractRole(r)
+	webhook := models.Webhook{}
+	webhooks, err := webhook.FindWebhooks(server.db(r), uid, role == "admin")
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, webhooks)
+}
+
+func (server *Server) GetWebhook(w http.ResponseWriter, r *http.Request) {
+
+	webhook, ok := server.ownedWebhook(w, r)
+	if !ok {
+		return
+	}
+	responses.JSON(w, http.StatusOK, webhook)
+}
+
+func (server *Server) UpdateWebhook(w http.ResponseWriter, r *http.Request) {
+
+	webhook, ok := server.ownedWebhook(w, r)
+	if !ok {
+		return
+	}
+	payload := requests.WebhookUpdate{}
+	err := server.decode(r, &payload)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	// fields missing from the body keep their current value
+	webhookUpdate := models.Webhook{URL: webhook.URL, Events: webhook.Events, Active: webhook.Active}
+	if payload.URL != nil {
+		webhookUpdate.URL = *payload.URL
+	}
+	if payload.Events != nil {
+		webhookUpdate.Events = payload.Events
+	}
+	if payload.Active != nil {
+		webhookUpdate.Active = *payload.Active
+	}
+	webhookUpdate.Prepare()
+	err = webhookUpdate.Validate()
+	if err == nil {
+		err = server.checkWebhookURL(r, webhookUpdate.URL)
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	webhookUpdated, err := webhookUpdate.UpdateAWebhook(server.db(r), webhook.ID)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, webhookUpdated)
+}
+
+func (server *Server) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+
+	webhook, ok := server.ownedWebhook(w, r)
+	if !ok {
+		return
+	}
+	_, err := webhook.DeleteAWebhook(server.db(r), webhook.ID)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Entity", fmt.Sprintf("%d", webhook.ID))
+	responses.JSON(w, http.StatusNoContent, "")
+}
+
+func (server *Server) GetWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+
+	webhook, ok := server.ownedWebhook(w, r)
+	if !ok {
+		return
+	}
+	delivery := models.WebhookDelivery{}
+	deliveries, err := delivery.FindWebhookDeliveries(server.db(r), webhook.ID)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, deliveries)
+}
+
+func (server *Server) RedeliverWebhook(w http.ResponseWriter, r *http.Request) {
+
+	webhook, ok := server.ownedWebhook(w, r)
+	if !ok {
+		return
+	}
+	did, err := strconv.ParseUint(mux.Vars(r)["delivery_id"], 10, 64)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+	delivery := models.WebhookDelivery{}
+	_, err = delivery.FindDeliveryByID(server.db(r), webhook.ID, did)
+	if err != nil {
+		if errors.Is(err, models.ErrDeliveryNotFound) {
+			responses.ERROR(w, http.StatusNotFound, err)
+			return
+		}
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	deliveryQueued, err := delivery.Redeliver(server.db(r))
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusAccepted, deliveryQueued)
+}
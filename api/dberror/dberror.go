@@ -0,0 +1,194 @@
+// Package dberror tells constraint violations of the database drivers apart
+// by their error codes, so callers do not have to guess from the message
+// which constraint failed.
+package dberror
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+)
+
+// Kind is the kind of a constraint violation.
+type Kind int
+
+const (
+	Unique Kind = iota + 1
+	ForeignKey
+	NotNull
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Unique:
+		return "unique"
+	case ForeignKey:
+		return "foreign key"
+	case NotNull:
+		return "not null"
+	}
+	return "unknown"
+}
+
+// Error is a constraint violation. Table, Columns and Constraint are set as
+// far as the driver tells them: MySQL 5.7 names the key but not its table,
+// SQLite the columns but not the constraint, and nothing of a foreign key.
+type Error struct {
+	Kind       Kind
+	Table      string
+	Columns    []string
+	Constraint string
+	Err        error
+}
+
+func (e *Error) Error() string { return e.Err.Error() }
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// Indexes are the columns of the unique indexes named after something else
+// than their column, MySQL reports a violation by the name of the index.
+var Indexes = map[string][]string{
+	"idx_product_variant_options":   {"product_id", "option_key"},
+	"idx_idempotency_keys_user_key": {"user_id", "idempotency_key"},
+}
+
+// The codes of the violations, SQLSTATE for PostgreSQL and the server error
+// numbers for MySQL.
+const (
+	pqUniqueViolation     = "23505"
+	pqForeignKeyViolation = "23503"
+	pqNotNullViolation    = "23502"
+
+	mysqlNoReferencedRow  = 1216
+	mysqlRowIsReferenced  = 1217
+	mysqlBadNull          = 1048
+	mysqlDuplicateEntry   = 1062
+	mysqlNoDefault        = 1364
+	mysqlRowIsReferenced2 = 1451
+	mysqlNoReferencedRow2 = 1452
+)
+
+var (
+	pqKey         = regexp.MustCompile(`^Key \(([^)]+)\)=`)
+	mysqlKey      = regexp.MustCompile(`for key '([^']+)'`)
+	mysqlColumn   = regexp.MustCompile(`^(?:Column|Field) '([^']+)'`)
+	mysqlChild    = regexp.MustCompile("fails \\(`[^`]+`\\.`([^`]+)`, CONSTRAINT `([^`]+)` FOREIGN KEY \\(`([^`]+)`\\)")
+	sqliteColumns = regexp.MustCompile(`constraint failed: (.+)$`)
+)
+
+// Classify returns the constraint violation err is, of any of the drivers.
+func Classify(err error) (*Error, bool) {
+	if err == nil {
+		return nil, false
+	}
+	var classified *Error
+	if errors.As(err, &classified) {
+		return classified, true
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return fromPostgres(pqErr, err)
+	}
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return fromMySQL(mysqlErr, err)
+	}
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return fromSQLite(sqliteErr, err)
+	}
+	return nil, false
+}
+
+func fromPostgres(pqErr *pq.Error, err error) (*Error, bool) {
+	e := &Error{Table: pqErr.Table, Constraint: pqErr.Constraint, Err: err}
+	switch pqErr.Code {
+	case pqUniqueViolation:
+		e.Kind = Unique
+	case pqForeignKeyViolation:
+		e.Kind = ForeignKey
+	case pqNotNullViolation:
+		e.Kind = NotNull
+		e.Columns = []string{pqErr.Column}
+		return e, true
+	default:
+		return nil, false
+	}
+	if match := pqKey.FindStringSubmatch(pqErr.Detail); match != nil {
+		e.Columns = split(match[1], ",")
+	}
+	return e, true
+}
+
+func fromMySQL(mysqlErr *mysql.MySQLError, err error) (*Error, bool) {
+	e := &Error{Err: err}
+	switch mysqlErr.Number {
+	case mysqlDuplicateEntry:
+		e.Kind = Unique
+		match := mysqlKey.FindStringSubmatch(mysqlErr.Message)
+		if match == nil {
+			return e, true
+		}
+		// MySQL 8 qualifies the key with its table
+		key := match[1]
+		if i := strings.LastIndex(key, "."); i >= 0 {
+			e.Table, key = key[:i], key[i+1:]
+		}
+		e.Constraint = key
+		if columns, ok := Indexes[key]; ok {
+			e.Columns = columns
+		} else if key != "PRIMARY" {
+			e.Columns = []string{key}
+		}
+	case mysqlBadNull, mysqlNoDefault:
+		e.Kind = NotNull
+		if match := mysqlColumn.FindStringSubmatch(mysqlErr.Message); match != nil {
+			e.Columns = []string{match[1]}
+		}
+	case mysqlRowIsReferenced, mysqlNoReferencedRow, mysqlRowIsReferenced2, mysqlNoReferencedRow2:
+		e.Kind = ForeignKey
+		if match := mysqlChild.FindStringSubmatch(mysqlErr.Message); match != nil {
+			e.Table, e.Constraint, e.Columns = match[1], match[2], []string{match[3]}
+		}
+	default:
+		return nil, false
+	}
+	return e, true
+}
+
+func fromSQLite(sqliteErr sqlite3.Error, err error) (*Error, bool) {
+	e := &Error{Err: err}
+	switch sqliteErr.ExtendedCode {
+	case sqlite3.ErrConstraintUnique, sqlite3.ErrConstraintPrimaryKey:
+		e.Kind = Unique
+	case sqlite3.ErrConstraintForeignKey:
+		e.Kind = ForeignKey
+		return e, true
+	case sqlite3.ErrConstraintNotNull:
+		e.Kind = NotNull
+	default:
+		return nil, false
+	}
+	// UNIQUE constraint failed: product_variants.product_id, product_variants.option_key
+	if match := sqliteColumns.FindStringSubmatch(sqliteErr.Error()); match != nil {
+		for _, column := range split(match[1], ",") {
+			if i := strings.Index(column, "."); i >= 0 {
+				e.Table, column = column[:i], column[i+1:]
+			}
+			e.Columns = append(e.Columns, column)
+		}
+	}
+	return e, true
+}
+
+func split(s, sep string) []string {
+	parts := strings.Split(s, sep)
+	for i := range parts {
+		parts[i] = strings.TrimSpace(parts[i])
+	}
+	return parts
+}
@@ -0,0 +1,119 @@
+package events
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/sirupsen/logrus"
+	"github.com/task/api/models"
+)
+
+// Dispatcher publishes the unpublished outbox events in the order they were
+// recorded.
+type Dispatcher struct {
+	DB      *gorm.DB
+	Bus     *Bus
+	Brokers []Broker
+	// MaxAttempts is how often a failing event is tried, 10 when zero.
+	MaxAttempts int
+	BatchSize   int
+	// Log is where publishing failures go, the standard logger when nil.
+	Log logrus.FieldLogger
+
+	wake chan struct{}
+}
+
+func (d *Dispatcher) logger() logrus.FieldLogger {
+	if d.Log != nil {
+		return d.Log
+	}
+	return logrus.StandardLogger()
+}
+
+// AttemptLimit is how often an event is tried before it is given up,
+// MaxAttempts or 10.
+func (d *Dispatcher) AttemptLimit() int {
+	if d == nil || d.MaxAttempts <= 0 {
+		return 10
+	}
+	return d.MaxAttempts
+}
+
+// DispatchPending claims one batch of events, publishes them and returns how
+// many were published.
+func (d *Dispatcher) DispatchPending() (int, error) {
+	maxAttempts := d.AttemptLimit()
+	limit := d.BatchSize
+	if limit <= 0 {
+		limit = 100
+	}
+	pending, err := models.ClaimUnpublishedEvents(d.DB, time.Now(), maxAttempts, limit)
+	if err != nil {
+		return 0, err
+	}
+	published := 0
+	for i := range *pending {
+		o := &(*pending)[i]
+		if err = d.publish(fromOutbox(o)); err != nil {
+			d.logger().Errorf("cannot publish event %d (%s): %v", o.ID, o.Type, err)
+			if err = o.RecordFailure(d.DB, err); err != nil {
+				return published, err
+			}
+			continue
+		}
+		if err = o.MarkPublished(d.DB); err != nil {
+			return published, err
+		}
+		published++
+	}
+	return published, nil
+}
+
+func (d *Dispatcher) publish(e Event) error {
+	var first error
+	if d.Bus != nil {
+		first = d.Bus.Publish(e)
+	}
+	for _, b := range d.Brokers {
+		if err := b.Publish(e); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// Wake makes a started dispatcher run now instead of at the next tick, so
+// events go out right after the transaction that recorded them commits.
+func (d *Dispatcher) Wake() {
+	if d == nil || d.wake == nil {
+		return
+	}
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Start runs DispatchPending every interval, or when woken, until the
+// returned function is called, which waits for a dispatch in progress.
+func (d *Dispatcher) Start(interval time.Duration) (stop func()) {
+	d.wake = make(chan struct{}, 1)
+	done, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if _, err := d.DispatchPending(); err != nil {
+				d.logger().Errorf("cannot dispatch events: %v", err)
+			}
+			select {
+			case <-ticker.C:
+			case <-d.wake:
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() { close(done); <-stopped }
+}
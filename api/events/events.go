@@ -0,0 +1,120 @@
+// Package events publishes the domain events recorded in the outbox table.
+//
+// Model changes write their events with models.RecordEvent in the same
+// transaction, the Dispatcher later hands every unpublished event to the
+// in-process Bus subscribers and to the configured Brokers. Delivery is at
+// least once: an event whose publishing failed is published again, to all
+// subscribers, so subscribers should tolerate duplicates (the event ID is
+// stable).
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/task/api/models"
+)
+
+// All subscribes a handler to every event type.
+const All = "*"
+
+// Event is a published domain event.
+type Event struct {
+	ID         uint64          `json:"id"`
+	Type       string          `json:"type"`
+	SellerID   uint32          `json:"seller_id,omitempty"`
+	Payload    json.RawMessage `json:"payload"`
+	OccurredAt time.Time       `json:"occurred_at"`
+}
+
+// Decode unmarshals the payload into v.
+func (e Event) Decode(v interface{}) error {
+	return json.Unmarshal(e.Payload, v)
+}
+
+func fromOutbox(o *models.OutboxEvent) Event {
+	return Event{
+		ID:         o.ID,
+		Type:       o.Type,
+		SellerID:   o.SellerID,
+		Payload:    json.RawMessage(o.Payload),
+		OccurredAt: o.CreatedAt,
+	}
+}
+
+type Handler func(Event) error
+
+// Broker forwards events out of the process, to a queue or a log.
+type Broker interface {
+	Publish(Event) error
+}
+
+// Bus calls the in-process subscribers of an event.
+type Bus struct {
+	mu       sync.RWMutex
+	handlers map[string][]Handler
+}
+
+func NewBus() *Bus {
+	return &Bus{handlers: map[string][]Handler{}}
+}
+
+// Subscribe registers h for eventType, or for every event with All.
+func (b *Bus) Subscribe(eventType string, h Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers[eventType] = append(b.handlers[eventType], h)
+}
+
+// Publish calls every subscriber of the event, even when one of them fails,
+// and returns the first error.
+func (b *Bus) Publish(e Event) error {
+	b.mu.RLock()
+	handlers := append(append([]Handler{}, b.handlers[e.Type]...), b.handlers[All]...)
+	b.mu.RUnlock()
+
+	var first error
+	for _, h := range handlers {
+		if err := h(e); err != nil && first == nil {
+			first = fmt.Errorf("%s subscriber: %v", e.Type, err)
+		}
+	}
+	return first
+}
+
+// LogBroker writes every event as a JSON line, e.g. to stdout for a log
+// shipper to pick up.
+type LogBroker struct {
+	mu  sync.Mutex
+	Out io.Writer
+}
+
+func (l *LogBroker) Publish(e Event) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, err = l.Out.Write(append(b, '\n'))
+	return err
+}
+
+// NewBrokers builds the brokers listed in EVENT_BROKERS. Only "log" is
+// built in; none are used by default.
+func NewBrokers(names []string) ([]Broker, error) {
+	brokers := []Broker{}
+	for _, name := range names {
+		switch name {
+		case "log":
+			brokers = append(brokers, &LogBroker{Out: os.Stdout})
+		default:
+			return nil, fmt.Errorf("unknown event broker %q", name)
+		}
+	}
+	return brokers, nil
+}
@@ -0,0 +1,133 @@
+// Package logging builds the structured logger of the server. Entries are
+// JSON by default; fields that hold secrets are redacted and email
+// addresses masked before they are written, whatever logs them.
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/task/api/config"
+)
+
+// New builds the logger described by LOG_LEVEL and LOG_FORMAT, info and
+// json when they are empty.
+func New(cfg config.Log, out io.Writer) (*logrus.Logger, error) {
+	if cfg.Level == "" {
+		cfg.Level = "info"
+	}
+	if cfg.Format == "" {
+		cfg.Format = "json"
+	}
+	level, err := logrus.ParseLevel(cfg.Level)
+	if err != nil {
+		return nil, err
+	}
+	logger := logrus.New()
+	logger.SetOutput(out)
+	logger.SetLevel(level)
+	switch cfg.Format {
+	case "json":
+		logger.SetFormatter(&logrus.JSONFormatter{TimestampFormat: time.RFC3339Nano})
+	case "text":
+		logger.SetFormatter(&logrus.TextFormatter{FullTimestamp: true})
+	default:
+		return nil, fmt.Errorf("unknown log format %q", cfg.Format)
+	}
+	logger.AddHook(Redact{})
+	return logger, nil
+}
+
+// sensitive are the field names whose values are never logged.
+var sensitive = []string{"password", "secret", "token", "authorization", "cookie"}
+
+// Redact is a hook replacing the values of sensitive fields and masking
+// email addresses.
+type Redact struct{}
+
+func (Redact) Levels() []logrus.Level { return logrus.AllLevels }
+
+func (Redact) Fire(entry *logrus.Entry) error {
+	for key, value := range entry.Data {
+		name := strings.ToLower(key)
+		for _, s := range sensitive {
+			if strings.Contains(name, s) {
+				entry.Data[key] = config.Secret(fmt.Sprint(value)).String()
+			}
+		}
+		if name == "email" || strings.HasSuffix(name, "_email") {
+			entry.Data[key] = MaskEmail(fmt.Sprint(value))
+		}
+	}
+	return nil
+}
+
+// MaskEmail keeps the first letter and the domain of an address,
+// pet@gmail.com is p***@gmail.com.
+func MaskEmail(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at < 1 {
+		return "***"
+	}
+	return email[:1] + "***" + email[at:]
+}
+
+type contextKey struct{}
+
+// WithLogger returns a context carrying the logger of a request.
+func WithLogger(ctx context.Context, log logrus.FieldLogger) context.Context {
+	return context.WithValue(ctx, contextKey{}, log)
+}
+
+// FromContext returns the logger of the request, with its request_id, and
+// false outside of a request.
+func FromContext(ctx context.Context) (logrus.FieldLogger, bool) {
+	log, ok := ctx.Value(contextKey{}).(logrus.FieldLogger)
+	return log, ok
+}
+
+// NewRequestID returns a random request id.
+func NewRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// Gorm adapts a logger to GORM. Queries are logged at debug level, and only
+// when the database is in log mode, without their bound values which carry
+// password hashes and personal data. Database errors are warnings, the
+// handlers decide whether they are failures.
+type Gorm struct {
+	Log logrus.FieldLogger
+}
+
+func (g Gorm) Print(values ...interface{}) {
+	if len(values) < 2 {
+		g.Log.Debug(values...)
+		return
+	}
+	log := g.Log.WithField("source", values[1])
+	switch values[0] {
+	case "sql":
+		if len(values) < 6 {
+			return
+		}
+		duration, _ := values[2].(time.Duration)
+		log.WithFields(logrus.Fields{
+			"duration_ms": float64(duration.Microseconds()) / 1000,
+			"rows":        values[5],
+		}).Debug(values[3])
+	case "error":
+		log.Warn(values[2:]...)
+	default:
+		log.Debug(values[2:]...)
+	}
+}
@@ -0,0 +1,61 @@
+package metrics
+
+import (
+	"database/sql"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// dbStats reports sql.DB.Stats of the connection pool on every scrape.
+type dbStats struct {
+	db *sql.DB
+
+	maxOpen           *prometheus.Desc
+	open              *prometheus.Desc
+	inUse             *prometheus.Desc
+	idle              *prometheus.Desc
+	waitCount         *prometheus.Desc
+	waitDuration      *prometheus.Desc
+	maxIdleClosed     *prometheus.Desc
+	maxLifetimeClosed *prometheus.Desc
+}
+
+func newDBStats(db *sql.DB) *dbStats {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "db", name), help, nil, nil)
+	}
+	return &dbStats{
+		db:                db,
+		maxOpen:           desc("max_open_connections", "Maximum number of open connections, 0 is unlimited."),
+		open:              desc("open_connections", "Open connections, in use and idle."),
+		inUse:             desc("in_use_connections", "Connections in use."),
+		idle:              desc("idle_connections", "Idle connections."),
+		waitCount:         desc("wait_count_total", "Times a query waited for a free connection."),
+		waitDuration:      desc("wait_duration_seconds_total", "Time spent waiting for a free connection."),
+		maxIdleClosed:     desc("max_idle_closed_total", "Connections closed because of the idle limit."),
+		maxLifetimeClosed: desc("max_lifetime_closed_total", "Connections closed because of their maximum lifetime."),
+	}
+}
+
+func (c *dbStats) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.maxOpen
+	ch <- c.open
+	ch <- c.inUse
+	ch <- c.idle
+	ch <- c.waitCount
+	ch <- c.waitDuration
+	ch <- c.maxIdleClosed
+	ch <- c.maxLifetimeClosed
+}
+
+func (c *dbStats) Collect(ch chan<- prometheus.Metric) {
+	stats := c.db.Stats()
+	ch <- prometheus.MustNewConstMetric(c.maxOpen, prometheus.GaugeValue, float64(stats.MaxOpenConnections))
+	ch <- prometheus.MustNewConstMetric(c.open, prometheus.GaugeValue, float64(stats.OpenConnections))
+	ch <- prometheus.MustNewConstMetric(c.inUse, prometheus.GaugeValue, float64(stats.InUse))
+	ch <- prometheus.MustNewConstMetric(c.idle, prometheus.GaugeValue, float64(stats.Idle))
+	ch <- prometheus.MustNewConstMetric(c.waitCount, prometheus.CounterValue, float64(stats.WaitCount))
+	ch <- prometheus.MustNewConstMetric(c.waitDuration, prometheus.CounterValue, stats.WaitDuration.Seconds())
+	ch <- prometheus.MustNewConstMetric(c.maxIdleClosed, prometheus.CounterValue, float64(stats.MaxIdleClosed))
+	ch <- prometheus.MustNewConstMetric(c.maxLifetimeClosed, prometheus.CounterValue, float64(stats.MaxLifetimeClosed))
+}
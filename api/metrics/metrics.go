@@ -0,0 +1,143 @@
+// Package metrics exposes the Prometheus metrics of the server: requests by
+// route, the database connection pool and the sales. Every method is a no-op
+// on a nil *Metrics, so handlers work without them.
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "task"
+
+// The reasons a purchase fails, the values of the reason label.
+const (
+	ReasonInvalidRequest      = "invalid_request"
+	ReasonProductNotFound     = "product_not_found"
+	ReasonVariantNotFound     = "variant_not_found"
+	ReasonVariantRequired     = "variant_required"
+	ReasonInsufficientStock   = "insufficient_stock"
+	ReasonInsufficientBalance = "insufficient_balance"
+	ReasonError               = "error"
+)
+
+// The outcomes of a login, the values of the outcome label.
+const (
+	LoginSuccess       = "success"
+	LoginInvalid       = "invalid_request"
+	LoginUnknownUser   = "unknown_user"
+	LoginWrongPassword = "wrong_password"
+	LoginError         = "error"
+)
+
+type Metrics struct {
+	Registry *prometheus.Registry
+
+	requests   *prometheus.CounterVec
+	duration   *prometheus.HistogramVec
+	purchases  prometheus.Counter
+	unitsSold  prometheus.Counter
+	revenue    prometheus.Counter
+	failedBuys *prometheus.CounterVec
+	logins     *prometheus.CounterVec
+}
+
+// New registers the metrics, with the pool statistics of db when it is not
+// nil, on a registry of their own.
+func New(db *sql.DB) *Metrics {
+	m := &Metrics{
+		Registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests by method, route template and status.",
+		}, []string{"method", "route", "status"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "HTTP request latency by method and route template.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route"}),
+		purchases: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "purchases_total",
+			Help:      "Completed purchases.",
+		}),
+		unitsSold: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "units_sold_total",
+			Help:      "Units sold by completed purchases.",
+		}),
+		revenue: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "revenue_total",
+			Help:      "Sum of the totals of completed purchases.",
+		}),
+		failedBuys: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "failed_purchases_total",
+			Help:      "Purchases refused or failed, by reason.",
+		}, []string{"reason"}),
+		logins: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "logins_total",
+			Help:      "Login attempts by outcome.",
+		}, []string{"outcome"}),
+	}
+	m.Registry.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		m.requests, m.duration, m.purchases, m.unitsSold, m.revenue, m.failedBuys, m.logins,
+	)
+	if db != nil {
+		m.Registry.MustRegister(newDBStats(db))
+	}
+	return m
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.Registry, promhttp.HandlerOpts{})
+}
+
+// ObserveRequest counts a served request. route is the mux route template,
+// raw paths would make a series per product id.
+func (m *Metrics) ObserveRequest(method, route string, status int, elapsed time.Duration) {
+	if m == nil {
+		return
+	}
+	m.requests.WithLabelValues(method, route, strconv.Itoa(status)).Inc()
+	m.duration.WithLabelValues(method, route).Observe(elapsed.Seconds())
+}
+
+// Purchase counts a completed purchase of qty units for total.
+func (m *Metrics) Purchase(qty, total float32) {
+	if m == nil {
+		return
+	}
+	m.purchases.Inc()
+	m.unitsSold.Add(float64(qty))
+	m.revenue.Add(float64(total))
+}
+
+// FailedPurchase counts a purchase that did not happen, reason is one of the
+// Reason constants.
+func (m *Metrics) FailedPurchase(reason string) {
+	if m == nil {
+		return
+	}
+	m.failedBuys.WithLabelValues(reason).Inc()
+}
+
+// Login counts a login attempt, outcome is one of the Login constants.
+func (m *Metrics) Login(outcome string) {
+	if m == nil {
+		return
+	}
+	m.logins.WithLabelValues(outcome).Inc()
+}
@@ -0,0 +1,127 @@
+package middlewares
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"github.com/task/api/auth"
+	"github.com/task/api/logging"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RequestIDHeader carries the id that ties the log entries of a request
+// together, taken from the client or the proxy in front when it has one.
+const RequestIDHeader = "X-Request-ID"
+
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
+// quiet are the routes probed or scraped every few seconds, logged at debug
+// level only.
+var quiet = map[string]bool{"/healthz": true, "/readyz": true, "/metrics": true}
+
+// statusRecorder remembers the status and size of a response. It passes
+// Flush and Hijack through for the SSE and WebSocket streams.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if s.status == 0 {
+		s.status = status
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	n, err := s.ResponseWriter.Write(b)
+	s.bytes += n
+	return n, err
+}
+
+func (s *statusRecorder) Flush() {
+	if flusher, ok := s.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (s *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := s.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("the response can not be hijacked")
+	}
+	s.status = http.StatusSwitchingProtocols
+	return hijacker.Hijack()
+}
+
+// routeTemplate is the template of the mux route serving r, "unmatched"
+// when none does.
+func routeTemplate(r *http.Request) string {
+	if current := mux.CurrentRoute(r); current != nil {
+		if template, err := current.GetPathTemplate(); err == nil {
+			return template
+		}
+	}
+	return "unmatched"
+}
+
+// SetMiddlewareRequestLog gives every request an X-Request-ID, a logger
+// carrying it and the trace id in the request context, and an access log
+// entry once it is served. The query string is left out of the log, it may hold a token.
+func SetMiddlewareRequestLog(log logrus.FieldLogger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			id := r.Header.Get(RequestIDHeader)
+			if !validRequestID.MatchString(id) {
+				id = logging.NewRequestID()
+			}
+			w.Header().Set(RequestIDHeader, id)
+			requestLog := log.WithField("request_id", id)
+			if span := trace.SpanContextFromContext(r.Context()); span.IsValid() {
+				requestLog = requestLog.WithField("trace_id", span.TraceID().String())
+			}
+			r = r.WithContext(logging.WithLogger(r.Context(), requestLog))
+
+			recorder := &statusRecorder{ResponseWriter: w}
+			next.ServeHTTP(recorder, r)
+
+			route := routeTemplate(r)
+			if recorder.status == 0 {
+				recorder.status = http.StatusOK
+			}
+			fields := logrus.Fields{
+				"method":     r.Method,
+				"route":      route,
+				"path":       r.URL.Path,
+				"status":     recorder.status,
+				"bytes":      recorder.bytes,
+				"latency_ms": float64(time.Since(start).Microseconds()) / 1000,
+			}
+			if auth.ExtractToken(r) != "" {
+				if uid, err := auth.ExtractTokenID(r); err == nil && uid != 0 {
+					fields["user_id"] = uid
+				}
+			}
+			entry := requestLog.WithFields(fields)
+			switch {
+			case recorder.status >= 500:
+				entry.Error("request failed")
+			case quiet[route]:
+				entry.Debug("request served")
+			default:
+				entry.Info("request served")
+			}
+		})
+	}
+}
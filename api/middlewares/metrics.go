@@ -0,0 +1,38 @@
+package middlewares
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/task/api/metrics"
+	"github.com/task/api/responses"
+)
+
+// SetMiddlewareMetrics counts every request by its route template.
+func SetMiddlewareMetrics(m *metrics.Metrics) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			recorder := &statusRecorder{ResponseWriter: w}
+			next.ServeHTTP(recorder, r)
+			if recorder.status == 0 {
+				recorder.status = http.StatusOK
+			}
+			m.ObserveRequest(r.Method, routeTemplate(r), recorder.status, time.Since(start))
+		})
+	}
+}
+
+// SetMiddlewareMetricsToken lets only scrapers sending the bearer token
+// through, or everyone when token is empty.
+func SetMiddlewareMetricsToken(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+token)) != 1 {
+			responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
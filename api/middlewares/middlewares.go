@@ -38,7 +38,7 @@ func SetMiddlewareAuthBuyer(next http.HandlerFunc) http.HandlerFunc {
 			return
 		}
 		if role != "buyer" {
-			responses.ERROR(w, http.StatusUnauthorized, errors.New("buyer area"))
+			responses.ERROR(w, http.StatusForbidden, errors.New("buyer area"))
 			return
 
 		}
@@ -58,7 +58,47 @@ func SetMiddlewareAuthseller(next http.HandlerFunc) http.HandlerFunc {
 			return
 		}
 		if role != "seller" {
-			responses.ERROR(w, http.StatusUnauthorized, errors.New("seller area"))
+			responses.ERROR(w, http.StatusForbidden, errors.New("seller area"))
+			return
+
+		}
+		next(w, r)
+	}
+}
+func SetMiddlewareAuthAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := auth.TokenValid(r)
+		if err != nil {
+			responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+			return
+		}
+		role, err := auth.ExtractRole(r)
+		if err != nil {
+			responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+			return
+		}
+		if role != "admin" {
+			responses.ERROR(w, http.StatusForbidden, errors.New("admin area"))
+			return
+
+		}
+		next(w, r)
+	}
+}
+func SetMiddlewareAuthSellerOrAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := auth.TokenValid(r)
+		if err != nil {
+			responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+			return
+		}
+		role, err := auth.ExtractRole(r)
+		if err != nil {
+			responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+			return
+		}
+		if role != "seller" && role != "admin" {
+			responses.ERROR(w, http.StatusForbidden, errors.New("seller or admin area"))
 			return
 
 		}
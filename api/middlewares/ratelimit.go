@@ -0,0 +1,53 @@
+package middlewares
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/task/api/logging"
+	"github.com/task/api/ratelimit"
+	"github.com/task/api/responses"
+)
+
+// SetMiddlewareRateLimit limits the requests of every client to the limit of
+// group, answering 429 with Retry-After once it is used up. The RateLimit-*
+// headers tell clients how much is left. Requests go through when the store
+// fails, and everything does with a nil limiter. Probes and scrapes are never
+// limited.
+func SetMiddlewareRateLimit(limiter *ratelimit.Limiter, group string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if limiter == nil || quiet[routeTemplate(r)] {
+				next.ServeHTTP(w, r)
+				return
+			}
+			result, err := limiter.Allow(group, r)
+			if err != nil {
+				if log, ok := logging.FromContext(r.Context()); ok {
+					log.Errorf("cannot rate limit %s: %v", group, err)
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+			if result.Limit > 0 {
+				w.Header().Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+				w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+				w.Header().Set("RateLimit-Reset", seconds(result.Reset))
+			}
+			if !result.Allowed {
+				w.Header().Set("Retry-After", seconds(result.RetryAfter))
+				responses.ERROR(w, http.StatusTooManyRequests, errors.New("Too Many Requests"))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// seconds rounds d up to whole seconds, clients must not come back early.
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
@@ -0,0 +1,46 @@
+package middlewares
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/task/api/auth"
+	"github.com/task/api/tracing"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// SetMiddlewareTracing starts a span for every request, continuing the trace
+// of its traceparent header. The handlers get the span in the request
+// context.
+func SetMiddlewareTracing(tracer trace.Tracer) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route := routeTemplate(r)
+			ctx, span := tracer.Start(tracing.Extract(r.Context(), r), r.Method+" "+route,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(
+					semconv.HTTPRequestMethodKey.String(r.Method),
+					semconv.HTTPRoute(route),
+					semconv.URLPath(r.URL.Path),
+				))
+			defer span.End()
+			if auth.ExtractToken(r) != "" {
+				if uid, err := auth.ExtractTokenID(r); err == nil && uid != 0 {
+					span.SetAttributes(semconv.EnduserID(strconv.FormatUint(uint64(uid), 10)))
+				}
+			}
+
+			recorder := &statusRecorder{ResponseWriter: w}
+			next.ServeHTTP(recorder, r.WithContext(ctx))
+			if recorder.status == 0 {
+				recorder.status = http.StatusOK
+			}
+			span.SetAttributes(semconv.HTTPResponseStatusCode(recorder.status))
+			if recorder.status >= 500 {
+				span.SetStatus(codes.Error, http.StatusText(recorder.status))
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package middlewares
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+type versionKey struct{}
+
+// SetMiddlewareVersion tells the handlers which version of the API the
+// request was sent to, see Version.
+func SetMiddlewareVersion(version int) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), versionKey{}, version)))
+		})
+	}
+}
+
+// Version is the version of the API r was sent to, 0 for the routes without
+// a version prefix.
+func Version(r *http.Request) int {
+	version, _ := r.Context().Value(versionKey{}).(int)
+	return version
+}
+
+// SetMiddlewareDeprecated marks the responses of deprecated routes with the
+// Deprecation header (RFC 9745), the date they were deprecated on, and a
+// Link to the same route under successor, e.g. /v1.
+func SetMiddlewareDeprecated(since time.Time, successor string) func(http.Handler) http.Handler {
+	deprecation := fmt.Sprintf("@%d", since.Unix())
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Deprecation", deprecation)
+			w.Header().Add("Link", fmt.Sprintf(`<%s%s>; rel="successor-version"`, successor, r.URL.EscapedPath()))
+			next.ServeHTTP(w, r)
+		})
+	}
+}
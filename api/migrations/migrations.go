@@ -0,0 +1,383 @@
+// Package migrations applies the versioned SQL migrations embedded in the
+// binary. Every driver has its own directory of NNNN_name.up.sql and
+// NNNN_name.down.sql files; applied versions are recorded in the
+// schema_migrations table together with the checksum of their up file, and
+// an advisory lock keeps concurrently starting instances from racing.
+//
+// On MySQL DDL statements commit implicitly, so a migration that fails
+// halfway is left partially applied and has to be repaired by hand.
+package migrations
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed postgres/*.sql mysql/*.sql sqlite/*.sql
+var files embed.FS
+
+// lockName identifies the migration lock, pg_advisory_lock takes a number.
+const (
+	lockName = "task_schema_migrations"
+	lockKey  = 7214509265
+)
+
+var fileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+type Migration struct {
+	Version  int64
+	Name     string
+	Up       string
+	Down     string
+	Checksum string
+}
+
+// Status is a migration and when it was applied, nil when pending.
+type Status struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// Load returns the migrations of the driver ordered by version.
+func Load(driver string) ([]Migration, error) {
+	entries, err := files.ReadDir(driver)
+	if err != nil {
+		return nil, fmt.Errorf("no migrations for driver %q", driver)
+	}
+	byVersion := map[int64]*Migration{}
+	for _, entry := range entries {
+		match := fileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("unexpected migration file %s/%s", driver, entry.Name())
+		}
+		version, _ := strconv.ParseInt(match[1], 10, 64)
+		body, err := files.ReadFile(path.Join(driver, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has two names, %s and %s", version, m.Name, match[2])
+		}
+		if match[3] == "up" {
+			m.Up = string(body)
+			sum := sha256.Sum256(body)
+			m.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			m.Down = string(body)
+		}
+	}
+	migrations := []Migration{}
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// statements splits a migration file on the semicolons ending a line.
+func statements(script string) []string {
+	stmts := []string{}
+	current := []string{}
+	for _, line := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		current = append(current, line)
+		if strings.HasSuffix(trimmed, ";") {
+			stmt := strings.TrimSuffix(strings.TrimSpace(strings.Join(current, "\n")), ";")
+			if stmt != "" {
+				stmts = append(stmts, stmt)
+			}
+			current = current[:0]
+		}
+	}
+	if stmt := strings.TrimSpace(strings.Join(current, "\n")); stmt != "" {
+		stmts = append(stmts, stmt)
+	}
+	return stmts
+}
+
+type dialect struct {
+	createTable string
+	insert      string
+	delete      string
+	lock        func(ctx context.Context, conn *sql.Conn) error
+	unlock      func(ctx context.Context, conn *sql.Conn) error
+	// hasTable counts the schema_migrations tables, 0 or 1.
+	hasTable string
+}
+
+var dialects = map[string]dialect{
+	"postgres": {
+		createTable: `CREATE TABLE IF NOT EXISTS schema_migrations (
+			version bigint PRIMARY KEY,
+			name varchar(255) NOT NULL,
+			checksum varchar(64) NOT NULL,
+			applied_at timestamp with time zone NOT NULL
+		)`,
+		insert: "INSERT INTO schema_migrations (version, name, checksum, applied_at) VALUES ($1, $2, $3, $4)",
+		delete: "DELETE FROM schema_migrations WHERE version = $1",
+		lock: func(ctx context.Context, conn *sql.Conn) error {
+			_, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", lockKey)
+			return err
+		},
+		unlock: func(ctx context.Context, conn *sql.Conn) error {
+			_, err := conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", lockKey)
+			return err
+		},
+		hasTable: "SELECT count(*) FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = 'schema_migrations'",
+	},
+	"mysql": {
+		createTable: `CREATE TABLE IF NOT EXISTS schema_migrations (
+			version bigint PRIMARY KEY,
+			name varchar(255) NOT NULL,
+			checksum varchar(64) NOT NULL,
+			applied_at DATETIME NOT NULL
+		)`,
+		insert: "INSERT INTO schema_migrations (version, name, checksum, applied_at) VALUES (?, ?, ?, ?)",
+		delete: "DELETE FROM schema_migrations WHERE version = ?",
+		lock: func(ctx context.Context, conn *sql.Conn) error {
+			var got sql.NullInt64
+			err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, 600)", lockName).Scan(&got)
+			if err == nil && got.Int64 != 1 {
+				err = errors.New("timed out waiting for the migration lock")
+			}
+			return err
+		},
+		unlock: func(ctx context.Context, conn *sql.Conn) error {
+			_, err := conn.ExecContext(ctx, "SELECT RELEASE_LOCK(?)", lockName)
+			return err
+		},
+		hasTable: "SELECT count(*) FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = 'schema_migrations'",
+	},
+	// SQLite has no advisory locks, the database file is locked by whoever
+	// writes to it and the server keeps a single connection.
+	"sqlite": {
+		createTable: `CREATE TABLE IF NOT EXISTS schema_migrations (
+			version bigint PRIMARY KEY,
+			name varchar(255) NOT NULL,
+			checksum varchar(64) NOT NULL,
+			applied_at datetime NOT NULL
+		)`,
+		insert:   "INSERT INTO schema_migrations (version, name, checksum, applied_at) VALUES (?, ?, ?, ?)",
+		delete:   "DELETE FROM schema_migrations WHERE version = ?",
+		lock:     func(ctx context.Context, conn *sql.Conn) error { return nil },
+		unlock:   func(ctx context.Context, conn *sql.Conn) error { return nil },
+		hasTable: "SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations'",
+	},
+}
+
+type Migrator struct {
+	db         *sql.DB
+	dialect    dialect
+	migrations []Migration
+}
+
+func New(db *sql.DB, driver string) (*Migrator, error) {
+	// gorm calls the SQLite dialect sqlite3
+	if driver == "sqlite3" {
+		driver = "sqlite"
+	}
+	d, ok := dialects[driver]
+	if !ok {
+		return nil, fmt.Errorf("migrations do not support driver %q", driver)
+	}
+	migrations, err := Load(driver)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, dialect: d, migrations: migrations}, nil
+}
+
+// locked runs fc on one connection holding the migration lock.
+func (m *Migrator) locked(ctx context.Context, fc func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err = m.dialect.lock(ctx, conn); err != nil {
+		return fmt.Errorf("cannot take the migration lock: %v", err)
+	}
+	defer m.dialect.unlock(context.Background(), conn)
+	if _, err = conn.ExecContext(ctx, m.dialect.createTable); err != nil {
+		return err
+	}
+	return fc(conn)
+}
+
+// querier is a connection or the pool.
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// applied returns the applied versions, checking that none of their up files
+// changed since.
+func (m *Migrator) applied(ctx context.Context, conn querier) (map[int64]time.Time, error) {
+	rows, err := conn.QueryContext(ctx, "SELECT version, checksum, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	known := map[int64]Migration{}
+	for _, migration := range m.migrations {
+		known[migration.Version] = migration
+	}
+	applied := map[int64]time.Time{}
+	for rows.Next() {
+		var version int64
+		var checksum string
+		var at time.Time
+		if err = rows.Scan(&version, &checksum, &at); err != nil {
+			return nil, err
+		}
+		migration, ok := known[version]
+		if !ok {
+			return nil, fmt.Errorf("database has migration %d which this binary does not know, it is older than the schema", version)
+		}
+		if migration.Checksum != checksum {
+			return nil, fmt.Errorf("migration %d_%s changed after it was applied: checksum %s, applied %s", version, migration.Name, migration.Checksum, checksum)
+		}
+		applied[version] = at
+	}
+	return applied, rows.Err()
+}
+
+func (m *Migrator) run(ctx context.Context, conn *sql.Conn, script string, record func(tx *sql.Tx) error) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	for _, stmt := range statements(script) {
+		if _, err = tx.ExecContext(ctx, stmt); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if err = record(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// Up applies every pending migration in order and returns the ones applied.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	done := []Migration{}
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, migration := range m.migrations {
+			if _, ok := applied[migration.Version]; ok {
+				continue
+			}
+			err = m.run(ctx, conn, migration.Up, func(tx *sql.Tx) error {
+				_, err := tx.ExecContext(ctx, m.dialect.insert, migration.Version, migration.Name, migration.Checksum, time.Now().UTC())
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("migration %d_%s: %v", migration.Version, migration.Name, err)
+			}
+			done = append(done, migration)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Down reverts the last steps applied migrations, newest first.
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	done := []Migration{}
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for i := len(m.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+			migration := m.migrations[i]
+			if _, ok := applied[migration.Version]; !ok {
+				continue
+			}
+			if migration.Down == "" {
+				return fmt.Errorf("migration %d_%s cannot be reverted, it has no down file", migration.Version, migration.Name)
+			}
+			err = m.run(ctx, conn, migration.Down, func(tx *sql.Tx) error {
+				_, err := tx.ExecContext(ctx, m.dialect.delete, migration.Version)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("reverting migration %d_%s: %v", migration.Version, migration.Name, err)
+			}
+			done = append(done, migration)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Status lists every known migration and when it was applied.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	statuses := []Status{}
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, migration := range m.migrations {
+			status := Status{Migration: migration}
+			if at, ok := applied[migration.Version]; ok {
+				status.AppliedAt = &at
+			}
+			statuses = append(statuses, status)
+		}
+		return nil
+	})
+	return statuses, err
+}
+
+// Pending returns how many migrations are not applied yet. It only reads
+// schema_migrations, without taking the lock or creating the table, so the
+// readiness probe can call it while another instance migrates; a database
+// without the table has every migration pending.
+func (m *Migrator) Pending(ctx context.Context) (int, error) {
+	var tables int
+	if err := m.db.QueryRowContext(ctx, m.dialect.hasTable).Scan(&tables); err != nil {
+		return 0, err
+	}
+	if tables == 0 {
+		return len(m.migrations), nil
+	}
+	applied, err := m.applied(ctx, m.db)
+	if err != nil {
+		return 0, err
+	}
+	pending := 0
+	for _, migration := range m.migrations {
+		if _, ok := applied[migration.Version]; !ok {
+			pending++
+		}
+	}
+	return pending, nil
+}
@@ -0,0 +1,15 @@
+DROP TABLE IF EXISTS outbox_events;
+DROP TABLE IF EXISTS webhook_deliveries;
+DROP TABLE IF EXISTS webhooks;
+DROP TABLE IF EXISTS restock_subscriptions;
+DROP TABLE IF EXISTS notifications;
+DROP TABLE IF EXISTS inventory_movements;
+DROP TABLE IF EXISTS product_variants;
+DROP TABLE IF EXISTS product_options;
+DROP TABLE IF EXISTS product_images;
+DROP TABLE IF EXISTS product_tags;
+DROP TABLE IF EXISTS product_categories;
+DROP TABLE IF EXISTS tags;
+DROP TABLE IF EXISTS categories;
+DROP TABLE IF EXISTS products;
+DROP TABLE IF EXISTS users;
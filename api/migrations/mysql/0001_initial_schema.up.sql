@@ -0,0 +1,198 @@
+-- The schema as AutoMigrate created it, IF NOT EXISTS so databases that
+-- were set up by AutoMigrate adopt it unchanged. Indexes are declared
+-- inline as MySQL has no CREATE INDEX IF NOT EXISTS.
+-- Every reference is a foreign key that restricts deletes: the purgers remove
+-- the rows of a product or user themselves, children first, so nothing
+-- disappears behind their back (like the blobs of product images).
+
+CREATE TABLE IF NOT EXISTS users (
+    id int unsigned AUTO_INCREMENT PRIMARY KEY,
+    username varchar(255) NOT NULL UNIQUE,
+    email varchar(100) NOT NULL UNIQUE,
+    password varchar(100) NOT NULL,
+    role varchar(100) NOT NULL,
+    deposit double NOT NULL,
+    created_at DATETIME NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME NULL DEFAULT CURRENT_TIMESTAMP,
+    deleted_at DATETIME NULL,
+    KEY idx_users_deleted_at (deleted_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS products (
+    id bigint unsigned AUTO_INCREMENT PRIMARY KEY,
+    product_name varchar(255) NOT NULL UNIQUE,
+    amount_available double NOT NULL,
+    seller_id int unsigned NOT NULL,
+    price double NOT NULL,
+    low_stock_threshold double NOT NULL DEFAULT 0,
+    created_at DATETIME NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME NULL DEFAULT CURRENT_TIMESTAMP,
+    deleted_at DATETIME NULL,
+    KEY idx_products_deleted_at (deleted_at),
+    FOREIGN KEY (seller_id) REFERENCES users (id) ON DELETE RESTRICT
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS categories (
+    id int unsigned AUTO_INCREMENT PRIMARY KEY,
+    name varchar(255) NOT NULL UNIQUE,
+    parent_id int unsigned,
+    created_at DATETIME NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (parent_id) REFERENCES categories (id) ON DELETE RESTRICT
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS tags (
+    id int unsigned AUTO_INCREMENT PRIMARY KEY,
+    name varchar(100) NOT NULL UNIQUE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS product_categories (
+    product_id bigint unsigned NOT NULL,
+    category_id int unsigned NOT NULL,
+    PRIMARY KEY (product_id, category_id),
+    FOREIGN KEY (product_id) REFERENCES products (id) ON DELETE RESTRICT,
+    FOREIGN KEY (category_id) REFERENCES categories (id) ON DELETE RESTRICT
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS product_tags (
+    product_id bigint unsigned NOT NULL,
+    tag_id int unsigned NOT NULL,
+    PRIMARY KEY (product_id, tag_id),
+    FOREIGN KEY (product_id) REFERENCES products (id) ON DELETE RESTRICT,
+    FOREIGN KEY (tag_id) REFERENCES tags (id) ON DELETE RESTRICT
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS product_images (
+    id bigint unsigned AUTO_INCREMENT PRIMARY KEY,
+    product_id bigint unsigned NOT NULL,
+    position integer NOT NULL,
+    `key` varchar(255) NOT NULL,
+    thumbnail_key varchar(255) NOT NULL,
+    url varchar(512) NOT NULL,
+    thumbnail_url varchar(512) NOT NULL,
+    content_type varchar(100) NOT NULL,
+    size bigint unsigned NOT NULL,
+    width integer,
+    height integer,
+    created_at DATETIME NULL DEFAULT CURRENT_TIMESTAMP,
+    KEY idx_product_images_product_id (product_id),
+    FOREIGN KEY (product_id) REFERENCES products (id) ON DELETE RESTRICT
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS product_options (
+    id bigint unsigned AUTO_INCREMENT PRIMARY KEY,
+    product_id bigint unsigned NOT NULL,
+    name varchar(100) NOT NULL,
+    position integer NOT NULL,
+    value_list varchar(2000) NOT NULL,
+    KEY idx_product_options_product_id (product_id),
+    FOREIGN KEY (product_id) REFERENCES products (id) ON DELETE RESTRICT
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS product_variants (
+    id bigint unsigned AUTO_INCREMENT PRIMARY KEY,
+    product_id bigint unsigned NOT NULL,
+    sku varchar(100) NOT NULL UNIQUE,
+    option_key varchar(1000) NOT NULL,
+    amount_available double NOT NULL,
+    price double,
+    created_at DATETIME NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY idx_product_variant_options (product_id, option_key(700)),
+    FOREIGN KEY (product_id) REFERENCES products (id) ON DELETE RESTRICT
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS inventory_movements (
+    id bigint unsigned AUTO_INCREMENT PRIMARY KEY,
+    product_id bigint unsigned NOT NULL,
+    variant_id bigint unsigned,
+    reason varchar(50) NOT NULL,
+    quantity double NOT NULL,
+    balance double NOT NULL,
+    product_balance double NOT NULL DEFAULT 0,
+    actor_id int unsigned NOT NULL,
+    note varchar(255),
+    created_at DATETIME NULL DEFAULT CURRENT_TIMESTAMP,
+    KEY idx_inventory_movements_product_id (product_id),
+    KEY idx_inventory_movements_variant_id (variant_id),
+    FOREIGN KEY (product_id) REFERENCES products (id) ON DELETE RESTRICT,
+    FOREIGN KEY (variant_id) REFERENCES product_variants (id) ON DELETE SET NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS notifications (
+    id bigint unsigned AUTO_INCREMENT PRIMARY KEY,
+    user_id int unsigned NOT NULL,
+    type varchar(50) NOT NULL,
+    product_id bigint unsigned NOT NULL,
+    variant_id bigint unsigned,
+    title varchar(255) NOT NULL,
+    message varchar(1000) NOT NULL,
+    read_at DATETIME NULL,
+    created_at DATETIME NULL DEFAULT CURRENT_TIMESTAMP,
+    event_id bigint unsigned,
+    KEY idx_notifications_user_id (user_id),
+    UNIQUE KEY idx_notifications_event (user_id, type, event_id),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE RESTRICT,
+    FOREIGN KEY (product_id) REFERENCES products (id) ON DELETE RESTRICT,
+    FOREIGN KEY (variant_id) REFERENCES product_variants (id) ON DELETE RESTRICT
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS restock_subscriptions (
+    id bigint unsigned AUTO_INCREMENT PRIMARY KEY,
+    user_id int unsigned NOT NULL,
+    product_id bigint unsigned NOT NULL,
+    variant_id bigint unsigned,
+    notified_at DATETIME NULL,
+    created_at DATETIME NULL DEFAULT CURRENT_TIMESTAMP,
+    KEY idx_restock_subscriptions_user_id (user_id),
+    KEY idx_restock_subscriptions_product_id (product_id),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE RESTRICT,
+    FOREIGN KEY (product_id) REFERENCES products (id) ON DELETE RESTRICT,
+    FOREIGN KEY (variant_id) REFERENCES product_variants (id) ON DELETE RESTRICT
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS webhooks (
+    id bigint unsigned AUTO_INCREMENT PRIMARY KEY,
+    owner_id int unsigned NOT NULL,
+    url varchar(2000) NOT NULL,
+    secret varchar(100) NOT NULL,
+    event_list varchar(1000) NOT NULL,
+    active boolean NOT NULL DEFAULT true,
+    created_at DATETIME NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME NULL DEFAULT CURRENT_TIMESTAMP,
+    KEY idx_webhooks_owner_id (owner_id),
+    FOREIGN KEY (owner_id) REFERENCES users (id) ON DELETE RESTRICT
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id bigint unsigned AUTO_INCREMENT PRIMARY KEY,
+    webhook_id bigint unsigned NOT NULL,
+    event varchar(100) NOT NULL,
+    payload text NOT NULL,
+    status varchar(20) NOT NULL,
+    attempts integer NOT NULL DEFAULT 0,
+    next_attempt_at DATETIME NULL,
+    last_status_code integer,
+    last_error varchar(1000),
+    delivered_at DATETIME NULL,
+    created_at DATETIME NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME NULL DEFAULT CURRENT_TIMESTAMP,
+    KEY idx_webhook_deliveries_webhook_id (webhook_id),
+    KEY idx_webhook_deliveries_status (status),
+    KEY idx_webhook_deliveries_next_attempt_at (next_attempt_at),
+    FOREIGN KEY (webhook_id) REFERENCES webhooks (id) ON DELETE RESTRICT
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS outbox_events (
+    id bigint unsigned AUTO_INCREMENT PRIMARY KEY,
+    type varchar(100) NOT NULL,
+    seller_id int unsigned NOT NULL,
+    payload text NOT NULL,
+    attempts integer NOT NULL DEFAULT 0,
+    last_error varchar(1000),
+    published_at DATETIME NULL,
+    created_at DATETIME NULL DEFAULT CURRENT_TIMESTAMP,
+    locked_until DATETIME NULL,
+    KEY idx_outbox_events_type (type),
+    KEY idx_outbox_events_published_at (published_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    id bigint unsigned AUTO_INCREMENT PRIMARY KEY,
+    user_id int unsigned NOT NULL,
+    idempotency_key varchar(255) NOT NULL,
+    request_hash varchar(64) NOT NULL,
+    status integer NOT NULL DEFAULT 0,
+    headers text,
+    body text,
+    locked_until DATETIME NULL,
+    created_at DATETIME NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY idx_idempotency_keys_user_key (user_id, idempotency_key),
+    KEY idx_idempotency_keys_created_at (created_at),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE RESTRICT
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,178 @@
+-- The schema as AutoMigrate created it on SQLite. Foreign keys are only
+-- enforced when the connection enables them, which Server.Connect does.
+-- Every reference is a foreign key that restricts deletes: the purgers remove
+-- the rows of a product or user themselves, children first, so nothing
+-- disappears behind their back (like the blobs of product images).
+
+CREATE TABLE IF NOT EXISTS users (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    username varchar(255) NOT NULL UNIQUE,
+    email varchar(100) NOT NULL UNIQUE,
+    password varchar(100) NOT NULL,
+    role varchar(100) NOT NULL,
+    deposit real NOT NULL,
+    created_at datetime DEFAULT CURRENT_TIMESTAMP,
+    updated_at datetime DEFAULT CURRENT_TIMESTAMP,
+    deleted_at datetime
+);
+CREATE INDEX IF NOT EXISTS idx_users_deleted_at ON users (deleted_at);
+
+CREATE TABLE IF NOT EXISTS products (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    product_name varchar(255) NOT NULL UNIQUE,
+    amount_available real NOT NULL,
+    seller_id bigint NOT NULL REFERENCES users (id) ON DELETE RESTRICT,
+    price real NOT NULL,
+    low_stock_threshold real NOT NULL DEFAULT 0,
+    created_at datetime DEFAULT CURRENT_TIMESTAMP,
+    updated_at datetime DEFAULT CURRENT_TIMESTAMP,
+    deleted_at datetime
+);
+CREATE INDEX IF NOT EXISTS idx_products_deleted_at ON products (deleted_at);
+
+CREATE TABLE IF NOT EXISTS categories (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    name varchar(255) NOT NULL UNIQUE,
+    parent_id bigint REFERENCES categories (id) ON DELETE RESTRICT,
+    created_at datetime DEFAULT CURRENT_TIMESTAMP,
+    updated_at datetime DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS tags (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    name varchar(100) NOT NULL UNIQUE
+);
+
+CREATE TABLE IF NOT EXISTS product_categories (
+    product_id bigint NOT NULL REFERENCES products (id) ON DELETE RESTRICT,
+    category_id bigint NOT NULL REFERENCES categories (id) ON DELETE RESTRICT,
+    PRIMARY KEY (product_id, category_id)
+);
+
+CREATE TABLE IF NOT EXISTS product_tags (
+    product_id bigint NOT NULL REFERENCES products (id) ON DELETE RESTRICT,
+    tag_id bigint NOT NULL REFERENCES tags (id) ON DELETE RESTRICT,
+    PRIMARY KEY (product_id, tag_id)
+);
+
+CREATE TABLE IF NOT EXISTS product_images (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    product_id bigint NOT NULL REFERENCES products (id) ON DELETE RESTRICT,
+    position integer NOT NULL,
+    "key" varchar(255) NOT NULL,
+    thumbnail_key varchar(255) NOT NULL,
+    url varchar(512) NOT NULL,
+    thumbnail_url varchar(512) NOT NULL,
+    content_type varchar(100) NOT NULL,
+    size bigint NOT NULL,
+    width integer,
+    height integer,
+    created_at datetime DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_product_images_product_id ON product_images (product_id);
+
+CREATE TABLE IF NOT EXISTS product_options (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    product_id bigint NOT NULL REFERENCES products (id) ON DELETE RESTRICT,
+    name varchar(100) NOT NULL,
+    position integer NOT NULL,
+    value_list varchar(2000) NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_product_options_product_id ON product_options (product_id);
+
+CREATE TABLE IF NOT EXISTS product_variants (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    product_id bigint NOT NULL REFERENCES products (id) ON DELETE RESTRICT,
+    sku varchar(100) NOT NULL UNIQUE,
+    option_key varchar(1000) NOT NULL,
+    amount_available real NOT NULL,
+    price real,
+    created_at datetime DEFAULT CURRENT_TIMESTAMP,
+    updated_at datetime DEFAULT CURRENT_TIMESTAMP
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_product_variant_options ON product_variants (product_id, option_key);
+
+CREATE TABLE IF NOT EXISTS inventory_movements (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    product_id bigint NOT NULL REFERENCES products (id) ON DELETE RESTRICT,
+    variant_id bigint REFERENCES product_variants (id) ON DELETE SET NULL,
+    reason varchar(50) NOT NULL,
+    quantity real NOT NULL,
+    balance real NOT NULL,
+    product_balance real NOT NULL DEFAULT 0,
+    actor_id bigint NOT NULL,
+    note varchar(255),
+    created_at datetime DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_inventory_movements_product_id ON inventory_movements (product_id);
+CREATE INDEX IF NOT EXISTS idx_inventory_movements_variant_id ON inventory_movements (variant_id);
+
+CREATE TABLE IF NOT EXISTS notifications (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    user_id bigint NOT NULL REFERENCES users (id) ON DELETE RESTRICT,
+    type varchar(50) NOT NULL,
+    product_id bigint NOT NULL REFERENCES products (id) ON DELETE RESTRICT,
+    variant_id bigint REFERENCES product_variants (id) ON DELETE RESTRICT,
+    title varchar(255) NOT NULL,
+    message varchar(1000) NOT NULL,
+    read_at datetime,
+    created_at datetime DEFAULT CURRENT_TIMESTAMP,
+    event_id bigint
+);
+CREATE INDEX IF NOT EXISTS idx_notifications_user_id ON notifications (user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_notifications_event ON notifications (user_id, type, event_id);
+
+CREATE TABLE IF NOT EXISTS restock_subscriptions (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    user_id bigint NOT NULL REFERENCES users (id) ON DELETE RESTRICT,
+    product_id bigint NOT NULL REFERENCES products (id) ON DELETE RESTRICT,
+    variant_id bigint REFERENCES product_variants (id) ON DELETE RESTRICT,
+    notified_at datetime,
+    created_at datetime DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_restock_subscriptions_user_id ON restock_subscriptions (user_id);
+CREATE INDEX IF NOT EXISTS idx_restock_subscriptions_product_id ON restock_subscriptions (product_id);
+
+CREATE TABLE IF NOT EXISTS webhooks (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    owner_id bigint NOT NULL REFERENCES users (id) ON DELETE RESTRICT,
+    url varchar(2000) NOT NULL,
+    secret varchar(100) NOT NULL,
+    event_list varchar(1000) NOT NULL,
+    active boolean NOT NULL DEFAULT true,
+    created_at datetime DEFAULT CURRENT_TIMESTAMP,
+    updated_at datetime DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_webhooks_owner_id ON webhooks (owner_id);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    webhook_id bigint NOT NULL REFERENCES webhooks (id) ON DELETE RESTRICT,
+    event varchar(100) NOT NULL,
+    payload text NOT NULL,
+    status varchar(20) NOT NULL,
+    attempts integer NOT NULL DEFAULT 0,
+    next_attempt_at datetime,
+    last_status_code integer,
+    last_error varchar(1000),
+    delivered_at datetime,
+    created_at datetime DEFAULT CURRENT_TIMESTAMP,
+    updated_at datetime DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook_id ON webhook_deliveries (webhook_id);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_status ON webhook_deliveries (status);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_next_attempt_at ON webhook_deliveries (next_attempt_at);
+
+CREATE TABLE IF NOT EXISTS outbox_events (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    type varchar(100) NOT NULL,
+    seller_id bigint NOT NULL,
+    payload text NOT NULL,
+    attempts integer NOT NULL DEFAULT 0,
+    last_error varchar(1000),
+    published_at datetime,
+    created_at datetime DEFAULT CURRENT_TIMESTAMP,
+    locked_until datetime
+);
+CREATE INDEX IF NOT EXISTS idx_outbox_events_type ON outbox_events (type);
+CREATE INDEX IF NOT EXISTS idx_outbox_events_published_at ON outbox_events (published_at);
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    user_id bigint NOT NULL REFERENCES users (id) ON DELETE RESTRICT,
+    idempotency_key varchar(255) NOT NULL,
+    request_hash varchar(64) NOT NULL,
+    status integer NOT NULL DEFAULT 0,
+    headers text,
+    body text,
+    locked_until datetime,
+    created_at datetime DEFAULT CURRENT_TIMESTAMP
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_idempotency_keys_user_key ON idempotency_keys (user_id, idempotency_key);
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_created_at ON idempotency_keys (created_at);
@@ -0,0 +1,166 @@
+package models
+
+import (
+	"html"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/task/api/apierror"
+)
+
+type Category struct {
+	ID        uint32     `gorm:"primary_key;auto_increment" json:"id"`
+	Name      string     `gorm:"size:255;not null;unique" json:"name"`
+	ParentID  *uint32    `json:"parent_id"`
+	Children  []Category `gorm:"-" json:"children,omitempty"`
+	CreatedAt time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+}
+
+func (c *Category) Prepare() {
+	c.ID = 0
+	c.Name = html.EscapeString(strings.TrimSpace(c.Name))
+	c.Children = nil
+	c.CreatedAt = time.Now()
+	c.UpdatedAt = time.Now()
+}
+
+func (c *Category) Validate() error {
+	if c.Name == "" {
+		return apierror.Required("name", "Required Name")
+	}
+	if c.ParentID != nil && *c.ParentID == 0 {
+		c.ParentID = nil
+	}
+	return nil
+}
+
+func (c *Category) SaveCategory(db *gorm.DB) (*Category, error) {
+	var err error
+	if c.ParentID != nil {
+		err = db.Model(&Category{}).Where("id = ?", *c.ParentID).Take(&Category{}).Error
+		if err != nil {
+			if gorm.IsRecordNotFoundError(err) {
+				return &Category{}, ErrParentCategoryNotFound
+			}
+			return &Category{}, err
+		}
+	}
+	err = db.Model(&Category{}).Create(&c).Error
+	if err != nil {
+		return &Category{}, err
+	}
+	return c, nil
+}
+
+func (c *Category) FindAllCategories(db *gorm.DB) (*[]Category, error) {
+	var err error
+	categories := []Category{}
+	err = db.Model(&Category{}).Order("id").Find(&categories).Error
+	if err != nil {
+		return &[]Category{}, err
+	}
+	return &categories, nil
+}
+
+// FindCategoryByID loads the category together with its direct children.
+func (c *Category) FindCategoryByID(db *gorm.DB, cid uint32) (*Category, error) {
+	var err error
+	err = db.Model(&Category{}).Where("id = ?", cid).Take(&c).Error
+	if err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return &Category{}, ErrCategoryNotFound
+		}
+		return &Category{}, err
+	}
+	c.Children = []Category{}
+	err = db.Model(&Category{}).Where("parent_id = ?", cid).Order("id").Find(&c.Children).Error
+	if err != nil {
+		return &Category{}, err
+	}
+	return c, nil
+}
+
+func (c *Category) UpdateACategory(db *gorm.DB, cid uint32) (*Category, error) {
+	var err error
+	if c.ParentID != nil {
+		// A category can not be moved under itself or one of its descendants
+		descendants, err := DescendantCategoryIDs(db, cid)
+		if err != nil {
+			return &Category{}, err
+		}
+		for _, id := range descendants {
+			if id == *c.ParentID {
+				return &Category{}, ErrInvalidParentCategory
+			}
+		}
+		err = db.Model(&Category{}).Where("id = ?", *c.ParentID).Take(&Category{}).Error
+		if err != nil {
+			if gorm.IsRecordNotFoundError(err) {
+				return &Category{}, ErrParentCategoryNotFound
+			}
+			return &Category{}, err
+		}
+	}
+	err = db.Model(&Category{}).Where("id = ?", cid).Take(&Category{}).UpdateColumns(
+		map[string]interface{}{
+			"name":       c.Name,
+			"parent_id":  c.ParentID,
+			"updated_at": time.Now(),
+		},
+	).Error
+	if err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return &Category{}, ErrCategoryNotFound
+		}
+		return &Category{}, err
+	}
+	return c.FindCategoryByID(db, cid)
+}
+
+// DeleteACategory removes the category, moves its children up to its parent
+// and detaches it from every product.
+func (c *Category) DeleteACategory(db *gorm.DB, cid uint32) (int64, error) {
+	category := Category{}
+	err := db.Model(&Category{}).Where("id = ?", cid).Take(&category).Error
+	if err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return 0, ErrCategoryNotFound
+		}
+		return 0, err
+	}
+	tx := db.Begin()
+	err = tx.Model(&Category{}).Where("parent_id = ?", cid).UpdateColumn("parent_id", category.ParentID).Error
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	err = tx.Table("product_categories").Where("category_id = ?", cid).Delete(nil).Error
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	deleted := tx.Model(&Category{}).Where("id = ?", cid).Delete(&Category{})
+	if deleted.Error != nil {
+		tx.Rollback()
+		return 0, deleted.Error
+	}
+	return deleted.RowsAffected, tx.Commit().Error
+}
+
+// DescendantCategoryIDs returns cid followed by the ids of all categories below it.
+func DescendantCategoryIDs(db *gorm.DB, cid uint32) ([]uint32, error) {
+	ids := []uint32{cid}
+	level := []uint32{cid}
+	for len(level) > 0 {
+		next := []uint32{}
+		err := db.Model(&Category{}).Where("parent_id IN (?)", level).Pluck("id", &next).Error
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, next...)
+		level = next
+	}
+	return ids, nil
+}
@@ -0,0 +1,111 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/task/api/dberror"
+)
+
+// IdempotencyKeyTTL is how long a response is kept for the retries of its
+// request. A key older than that is free to be used again.
+const IdempotencyKeyTTL = 24 * time.Hour
+
+// IdempotencyKeyLease is how long a request holds its key without renewing
+// it, which it does while it runs. A retry takes over a key whose lease ran
+// out without a response, left by a server that stopped in the middle of the
+// request.
+const IdempotencyKeyLease = time.Minute
+
+// IdempotencyKey is a request a user sent with an Idempotency-Key header,
+// and the response it got once it is done. Status is 0 while the request is
+// running, until LockedUntil.
+type IdempotencyKey struct {
+	ID          uint64     `gorm:"primary_key;auto_increment" json:"id"`
+	UserID      uint32     `gorm:"not null" json:"user_id"`
+	Key         string     `gorm:"column:idempotency_key;size:255;not null" json:"key"`
+	RequestHash string     `gorm:"size:64;not null" json:"request_hash"`
+	Status      int        `gorm:"not null;default:0" json:"status"`
+	Headers     string     `gorm:"type:text" json:"headers"`
+	Body        string     `gorm:"type:text" json:"body"`
+	LockedUntil *time.Time `json:"locked_until"`
+	CreatedAt   time.Time  `gorm:"default:CURRENT_TIMESTAMP;index" json:"created_at"`
+}
+
+// ReserveIdempotencyKey records the request of the user with key unless the
+// key is taken, in which case it returns the request that took it and false.
+// Expired keys are taken over, and so are the keys of the same request whose
+// lease ran out before it got a response.
+func ReserveIdempotencyKey(db *gorm.DB, userID uint32, key, requestHash string) (*IdempotencyKey, bool, error) {
+
+	now := time.Now()
+	err := db.Where("user_id = ? AND idempotency_key = ? AND created_at < ?", userID, key, now.Add(-IdempotencyKeyTTL)).Delete(&IdempotencyKey{}).Error
+	if err != nil {
+		return &IdempotencyKey{}, false, err
+	}
+	lease := now.Add(IdempotencyKeyLease)
+	record := IdempotencyKey{
+		UserID:      userID,
+		Key:         key,
+		RequestHash: requestHash,
+		LockedUntil: &lease,
+		CreatedAt:   now,
+	}
+	err = db.Model(&IdempotencyKey{}).Create(&record).Error
+	if err == nil {
+		return &record, true, nil
+	}
+	if violation, ok := dberror.Classify(err); !ok || violation.Kind != dberror.Unique {
+		return &IdempotencyKey{}, false, err
+	}
+	taken := IdempotencyKey{}
+	err = db.Model(&IdempotencyKey{}).Where("user_id = ? AND idempotency_key = ?", userID, key).Take(&taken).Error
+	if err != nil {
+		return &IdempotencyKey{}, false, err
+	}
+	if taken.Status == 0 && taken.RequestHash == requestHash && (taken.LockedUntil == nil || taken.LockedUntil.Before(now)) {
+		// only one retry wins the lease
+		takeover := db.Model(&IdempotencyKey{}).Where("id = ? AND status = 0 AND (locked_until IS NULL OR locked_until < ?)", taken.ID, now).UpdateColumn("locked_until", lease)
+		if takeover.Error != nil {
+			return &IdempotencyKey{}, false, takeover.Error
+		}
+		if takeover.RowsAffected == 1 {
+			taken.LockedUntil = &lease
+			return &taken, true, nil
+		}
+	}
+	return &taken, false, nil
+}
+
+// Complete records the response of the request, answered again to its
+// retries. The first response recorded for a key is the one kept.
+func (k *IdempotencyKey) Complete(db *gorm.DB, status int, headers, body string) error {
+	k.Status, k.Headers, k.Body = status, headers, body
+	return db.Model(&IdempotencyKey{}).Where("id = ? AND status = 0", k.ID).UpdateColumns(
+		map[string]interface{}{
+			"status":  status,
+			"headers": headers,
+			"body":    body,
+		},
+	).Error
+}
+
+// Renew extends the lease of the key of a running request until the given
+// time. The key of a request that got its response is left as it is.
+func (k *IdempotencyKey) Renew(db *gorm.DB, until time.Time) error {
+	return db.Model(&IdempotencyKey{}).Where("id = ? AND status = 0", k.ID).UpdateColumn("locked_until", until).Error
+}
+
+// Release frees the key of a request that failed, so it can be retried.
+func (k *IdempotencyKey) Release(db *gorm.DB) error {
+	return db.Where("id = ? AND status = 0", k.ID).Delete(&IdempotencyKey{}).Error
+}
+
+// PurgeIdempotencyKeys removes the keys recorded before the cutoff.
+func PurgeIdempotencyKeys(db *gorm.DB, before time.Time) (int64, error) {
+	purged := db.Where("created_at < ?", before).Delete(&IdempotencyKey{})
+	if purged.Error != nil {
+		return 0, purged.Error
+	}
+	return purged.RowsAffected, nil
+}
@@ -0,0 +1,184 @@
+package models
+
+import (
+	"html"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/task/api/apierror"
+)
+
+// Reasons a product's stock can change for.
+const (
+	MovementSale          = "sale"
+	MovementRestock       = "restock"
+	MovementCorrection    = "correction"
+	MovementRefundRestock = "refund_restock"
+	MovementReservation   = "reservation"
+)
+
+// InventoryMovement records one change of a product's (or variant's) stock.
+// Quantity is signed, Balance is the stock right after the change and
+// ProductBalance the product's total stock at that point, which differs from
+// Balance for variants.
+type InventoryMovement struct {
+	ID             uint64    `gorm:"primary_key;auto_increment" json:"id"`
+	ProductID      uint64    `gorm:"not null;index" json:"product_id"`
+	VariantID      *uint64   `gorm:"index" json:"variant_id"`
+	Reason         string    `gorm:"size:50;not null" json:"reason"`
+	Quantity       float32   `gorm:"not null" json:"quantity"`
+	Balance        float32   `gorm:"not null" json:"balance"`
+	ProductBalance float32   `gorm:"not null" json:"product_balance"`
+	ActorID        uint32    `gorm:"not null" json:"actor_id"`
+	Note           string    `gorm:"size:255" json:"note"`
+	CreatedAt      time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+// IsManualReason reports whether a seller may record the reason through the
+// stock adjustments endpoint. Sales only happen through /buy.
+func IsManualReason(reason string) bool {
+	switch reason {
+	case
+		MovementRestock,
+		MovementCorrection,
+		MovementRefundRestock,
+		MovementReservation:
+		return true
+	}
+	return false
+}
+
+func (m *InventoryMovement) Prepare() {
+	m.ID = 0
+	m.Reason = strings.ToLower(strings.TrimSpace(m.Reason))
+	m.Note = html.EscapeString(strings.TrimSpace(m.Note))
+	m.CreatedAt = time.Now()
+}
+
+func (m *InventoryMovement) Validate() error {
+	if m.Quantity == 0 {
+		return apierror.Required("quantity", "Required Quantity")
+	}
+	if !IsManualReason(m.Reason) {
+		return apierror.Invalid("reason", "Invalid Reason")
+	}
+	return nil
+}
+
+// AdjustStock applies m.Quantity to the stock of the product, or of the
+// variant when m.VariantID is set, and records the movement in the same
+// transaction. Stock never goes below zero.
+func (m *InventoryMovement) AdjustStock(db *gorm.DB) (*InventoryMovement, error) {
+
+	now := time.Now()
+	err := Transaction(db, func(tx *gorm.DB) error {
+		if m.VariantID != nil {
+			adjusted := tx.Model(&ProductVariant{}).
+				Where("id = ? AND product_id = ? AND amount_available + ? >= 0", *m.VariantID, m.ProductID, m.Quantity).
+				UpdateColumns(map[string]interface{}{
+					"amount_available": gorm.Expr("amount_available + ?", m.Quantity),
+					"updated_at":       now,
+				})
+			if adjusted.Error != nil {
+				return adjusted.Error
+			}
+			variant := ProductVariant{}
+			err := tx.Model(&ProductVariant{}).Where("id = ? AND product_id = ?", *m.VariantID, m.ProductID).Take(&variant).Error
+			if err != nil {
+				if gorm.IsRecordNotFoundError(err) {
+					return ErrVariantNotFound
+				}
+				return err
+			}
+			if adjusted.RowsAffected == 0 {
+				return ErrInsufficientStock
+			}
+			m.Balance = variant.AmountAvailable
+			err = SyncProductStock(tx, m.ProductID)
+			if err != nil {
+				return err
+			}
+			_, err = m.RecordMovement(tx)
+			return err
+		}
+		var variants int
+		err := tx.Model(&ProductVariant{}).Where("product_id = ?", m.ProductID).Count(&variants).Error
+		if err != nil {
+			return err
+		}
+		if variants > 0 {
+			return ErrVariantRequired
+		}
+		adjusted := tx.Model(&Product{}).
+			Where("id = ? AND amount_available + ? >= 0", m.ProductID, m.Quantity).
+			UpdateColumns(map[string]interface{}{
+				"amount_available": gorm.Expr("amount_available + ?", m.Quantity),
+				"updated_at":       now,
+			})
+		if adjusted.Error != nil {
+			return adjusted.Error
+		}
+		product := Product{}
+		err = tx.Model(&Product{}).Where("id = ?", m.ProductID).Take(&product).Error
+		if err != nil {
+			if gorm.IsRecordNotFoundError(err) {
+				return ErrProductNotFound
+			}
+			return err
+		}
+		if adjusted.RowsAffected == 0 {
+			return ErrInsufficientStock
+		}
+		m.Balance = product.AmountAvailable
+		_, err = m.RecordMovement(tx)
+		return err
+	})
+	if err != nil {
+		return &InventoryMovement{}, err
+	}
+	return m, nil
+}
+
+// RecordMovement writes the log entry and its stock.changed event. Callers
+// that store the new stock themselves (product and variant create/update)
+// use it directly, with the balance already set. The product's balance is
+// read here, once its stock is stored.
+func (m *InventoryMovement) RecordMovement(db *gorm.DB) (*InventoryMovement, error) {
+	if m.Quantity == 0 {
+		return m, nil
+	}
+	err := Transaction(db, func(tx *gorm.DB) error {
+		product := Product{}
+		err := tx.Unscoped().Model(&Product{}).Where("id = ?", m.ProductID).Take(&product).Error
+		if err != nil {
+			return err
+		}
+		m.ProductBalance = product.AmountAvailable
+		err = tx.Model(&InventoryMovement{}).Create(&m).Error
+		if err != nil {
+			return err
+		}
+		_, err = RecordEvent(tx, EventStockChanged, product.SellerID, m)
+		return err
+	})
+	if err != nil {
+		return &InventoryMovement{}, err
+	}
+	return m, nil
+}
+
+// FindStockHistory returns the newest movements of the product first,
+// optionally limited to one variant.
+func (m *InventoryMovement) FindStockHistory(db *gorm.DB, pid uint64, vid *uint64) (*[]InventoryMovement, error) {
+	movements := []InventoryMovement{}
+	query := db.Model(&InventoryMovement{}).Where("product_id = ?", pid)
+	if vid != nil {
+		query = query.Where("variant_id = ?", *vid)
+	}
+	err := query.Order("id desc").Limit(100).Find(&movements).Error
+	if err != nil {
+		return &[]InventoryMovement{}, err
+	}
+	return &movements, nil
+}
@@ -0,0 +1,75 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Notification is an entry of a user's in-app inbox. EventID is the event
+// that caused it, a user gets one notification of a type per event.
+type Notification struct {
+	ID        uint64     `gorm:"primary_key;auto_increment" json:"id"`
+	UserID    uint32     `gorm:"not null;index;unique_index:idx_notifications_event" json:"user_id"`
+	Type      string     `gorm:"size:50;not null;unique_index:idx_notifications_event" json:"type"`
+	ProductID uint64     `gorm:"not null" json:"product_id"`
+	VariantID *uint64    `json:"variant_id"`
+	Title     string     `gorm:"size:255;not null" json:"title"`
+	Message   string     `gorm:"size:1000;not null" json:"message"`
+	ReadAt    *time.Time `json:"read_at"`
+	CreatedAt time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	EventID   *uint64    `gorm:"unique_index:idx_notifications_event" json:"-"`
+}
+
+func (n *Notification) SaveNotification(db *gorm.DB) (*Notification, error) {
+	err := db.Model(&Notification{}).Create(&n).Error
+	if err != nil {
+		return &Notification{}, err
+	}
+	return n, nil
+}
+
+// NotificationSent reports whether the user already has the notification of
+// kind for the event, so a redelivered event does not notify twice.
+func NotificationSent(db *gorm.DB, uid uint32, kind string, eid uint64) (bool, error) {
+	var count int
+	err := db.Model(&Notification{}).Where("user_id = ? AND type = ? AND event_id = ?", uid, kind, eid).Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// FindUserNotifications returns the newest 100 notifications of the user,
+// only the unread ones when unread is set.
+func (n *Notification) FindUserNotifications(db *gorm.DB, uid uint32, unread bool) (*[]Notification, error) {
+	notifications := []Notification{}
+	query := db.Model(&Notification{}).Where("user_id = ?", uid)
+	if unread {
+		query = query.Where("read_at IS NULL")
+	}
+	err := query.Order("id desc").Limit(100).Find(&notifications).Error
+	if err != nil {
+		return &[]Notification{}, err
+	}
+	return &notifications, nil
+}
+
+func (n *Notification) MarkRead(db *gorm.DB, nid uint64, uid uint32) (*Notification, error) {
+	err := db.Model(&Notification{}).Where("id = ? and user_id = ?", nid, uid).Take(&n).Error
+	if err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return &Notification{}, ErrNotificationNotFound
+		}
+		return &Notification{}, err
+	}
+	if n.ReadAt == nil {
+		now := time.Now()
+		err = db.Model(&Notification{}).Where("id = ?", nid).UpdateColumn("read_at", now).Error
+		if err != nil {
+			return &Notification{}, err
+		}
+		n.ReadAt = &now
+	}
+	return n, nil
+}
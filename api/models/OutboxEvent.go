@@ -0,0 +1,151 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Domain events. They are written to the outbox in the transaction of the
+// change they describe and published from there, see package events.
+const (
+	EventUserCreated       = "user.created"
+	EventDepositChanged    = "deposit.changed"
+	EventProductCreated    = "product.created"
+	EventProductUpdated    = "product.updated"
+	EventProductDeleted    = "product.deleted"
+	EventPurchaseCompleted = "purchase.completed"
+	EventStockChanged      = "stock.changed"
+)
+
+// OutboxEvent is a domain event waiting to be, or already, published.
+type OutboxEvent struct {
+	ID   uint64 `gorm:"primary_key;auto_increment" json:"id"`
+	Type string `gorm:"size:100;not null;index" json:"type"`
+	// SellerID is the seller the event is about, 0 for events about buyers
+	// or users in general.
+	SellerID    uint32     `gorm:"not null" json:"seller_id"`
+	Payload     string     `gorm:"type:text;not null" json:"payload"`
+	Attempts    int        `gorm:"not null;default:0" json:"attempts"`
+	LastError   string     `gorm:"size:1000" json:"last_error"`
+	PublishedAt *time.Time `gorm:"index" json:"published_at"`
+	CreatedAt   time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	// LockedUntil is when the dispatcher that claimed the event gives it up.
+	LockedUntil *time.Time `json:"locked_until"`
+}
+
+// EventLease is how long a claimed event is left to its dispatcher before
+// another one may publish it, for when the instance publishing it stops.
+const EventLease = time.Minute
+
+// Transaction runs fc in a transaction, or in the one db is already in, so
+// model methods that need a transaction compose with the caller's.
+func Transaction(db *gorm.DB, fc func(tx *gorm.DB) error) error {
+	if _, ok := db.CommonDB().(*sql.Tx); ok {
+		return fc(db)
+	}
+	return db.Transaction(fc)
+}
+
+// RecordEvent writes the event with data as JSON payload to the outbox. Pass
+// the transaction of the change so the event exists exactly when it does.
+func RecordEvent(db *gorm.DB, eventType string, sellerID uint32, data interface{}) (*OutboxEvent, error) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return &OutboxEvent{}, err
+	}
+	event := OutboxEvent{
+		Type:      eventType,
+		SellerID:  sellerID,
+		Payload:   string(payload),
+		CreatedAt: time.Now(),
+	}
+	err = db.Model(&OutboxEvent{}).Create(&event).Error
+	if err != nil {
+		return &OutboxEvent{}, err
+	}
+	return &event, nil
+}
+
+// ClaimUnpublishedEvents claims up to limit events in the order they were
+// recorded, leaving out the ones that failed maxAttempts times already and
+// the ones another dispatcher holds. Only one caller wins an event, so every
+// instance can run the dispatcher.
+func ClaimUnpublishedEvents(db *gorm.DB, now time.Time, maxAttempts, limit int) (*[]OutboxEvent, error) {
+	unpublished := []OutboxEvent{}
+	err := db.Model(&OutboxEvent{}).
+		Where("published_at IS NULL AND attempts < ? AND (locked_until IS NULL OR locked_until < ?)", maxAttempts, now).
+		Order("id").Limit(limit).Find(&unpublished).Error
+	if err != nil {
+		return &[]OutboxEvent{}, err
+	}
+	lease := now.Add(EventLease)
+	events := []OutboxEvent{}
+	for _, e := range unpublished {
+		claim := db.Model(&OutboxEvent{}).
+			Where("id = ? AND published_at IS NULL AND (locked_until IS NULL OR locked_until < ?)", e.ID, now).
+			UpdateColumn("locked_until", lease)
+		if claim.Error != nil {
+			return &events, claim.Error
+		}
+		if claim.RowsAffected == 1 {
+			e.LockedUntil = &lease
+			events = append(events, e)
+		}
+	}
+	return &events, nil
+}
+
+func (e *OutboxEvent) MarkPublished(db *gorm.DB) error {
+	now := time.Now()
+	e.Attempts++
+	e.PublishedAt = &now
+	return db.Model(&OutboxEvent{}).Where("id = ?", e.ID).UpdateColumns(
+		map[string]interface{}{
+			"attempts":     e.Attempts,
+			"published_at": now,
+		},
+	).Error
+}
+
+// RecordFailure counts the failed attempt and gives up the claim, so the
+// event is tried again at the next dispatch.
+func (e *OutboxEvent) RecordFailure(db *gorm.DB, publishErr error) error {
+	e.Attempts++
+	e.LastError = publishErr.Error()
+	if len(e.LastError) > 1000 {
+		e.LastError = e.LastError[:1000]
+	}
+	e.LockedUntil = nil
+	return db.Model(&OutboxEvent{}).Where("id = ?", e.ID).UpdateColumns(
+		map[string]interface{}{
+			"attempts":     e.Attempts,
+			"last_error":   e.LastError,
+			"locked_until": nil,
+		},
+	).Error
+}
+
+// PurgePublishedEvents removes events published before the cutoff.
+func PurgePublishedEvents(db *gorm.DB, before time.Time) (int64, error) {
+	purged := db.Where("published_at IS NOT NULL AND published_at < ?", before).Delete(&OutboxEvent{})
+	if purged.Error != nil {
+		return 0, purged.Error
+	}
+	return purged.RowsAffected, nil
+}
+
+// FindEventsAfter returns up to limit events of the given types recorded
+// after the event afterID, published or not, oldest first.
+func FindEventsAfter(db *gorm.DB, afterID uint64, types []string, limit int) (*[]OutboxEvent, error) {
+	events := []OutboxEvent{}
+	err := db.Model(&OutboxEvent{}).
+		Where("id > ? AND type IN (?)", afterID, types).
+		Order("id").Limit(limit).Find(&events).Error
+	if err != nil {
+		return &[]OutboxEvent{}, err
+	}
+	return &events, nil
+}
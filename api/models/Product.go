@@ -1,28 +1,55 @@
 package models
 
 import (
-	"errors"
 	"html"
 	"strings"
 	"time"
 
 	"github.com/jinzhu/gorm"
+	"github.com/task/api/apierror"
 )
 
 type Product struct {
-	ID              uint64    `gorm:"primary_key;auto_increment" json:"id"`
-	ProductName     string    `gorm:"size:255;not null;unique" json:"proudct_name"`
-	AmountAvailable float32   `gorm:"size:100;not null;" json:"amount_available"`
-	Seller          User      `json:"seller"`
-	SellerID        uint32    `gorm:"not null" json:"seller_id"`
-	Price           float32   `gorm:"size:100;not null;" json:"price"`
-	CreatedAt       time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
-	UpdatedAt       time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+	ID              uint64  `gorm:"primary_key;auto_increment" json:"id"`
+	ProductName     string  `gorm:"size:255;not null;unique" json:"proudct_name"`
+	AmountAvailable float32 `gorm:"size:100;not null;" json:"amount_available"`
+	Seller          User    `json:"seller"`
+	SellerID        uint32  `gorm:"not null" json:"seller_id"`
+	Price           float32 `gorm:"size:100;not null;" json:"price"`
+	// LowStockThreshold makes the seller get a low_stock notification once a
+	// purchase brings the stock down to it. Zero only alerts when sold out.
+	LowStockThreshold float32          `gorm:"not null;default:0" json:"low_stock_threshold"`
+	Categories        []Category       `gorm:"many2many:product_categories;save_associations:false" json:"categories"`
+	Tags              []Tag            `gorm:"many2many:product_tags;save_associations:false" json:"tags"`
+	Images            []ProductImage   `gorm:"foreignkey:ProductID;save_associations:false" json:"images"`
+	Options           []ProductOption  `gorm:"foreignkey:ProductID;save_associations:false" json:"options"`
+	Variants          []ProductVariant `gorm:"foreignkey:ProductID;save_associations:false" json:"variants"`
+	CategoryIDs       []uint32         `gorm:"-" json:"category_ids,omitempty"`
+	TagNames          []string         `gorm:"-" json:"tag_names,omitempty"`
+	CreatedAt         time.Time        `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt         time.Time        `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+	// DeletedAt turns Delete into a soft delete, see PurgeDeletedProducts.
+	DeletedAt *time.Time `gorm:"index" json:"deleted_at,omitempty"`
+}
+
+// preloadProduct loads everything shown alongside a product except the seller.
+func preloadProduct(db *gorm.DB) *gorm.DB {
+	return db.Preload("Categories").
+		Preload("Tags").
+		Preload("Images", orderImages).
+		Preload("Options", func(db *gorm.DB) *gorm.DB { return db.Order("position") }).
+		Preload("Variants", func(db *gorm.DB) *gorm.DB { return db.Order("id") })
 }
 
 func (p *Product) Prepare() {
 	p.ID = 0
 	p.ProductName = html.EscapeString(strings.TrimSpace(p.ProductName))
+	// categories and tags are assigned through CategoryIDs and TagNames only
+	p.Categories = nil
+	p.Tags = nil
+	p.Images = nil
+	p.Options = nil
+	p.Variants = nil
 	p.CreatedAt = time.Now()
 	p.UpdatedAt = time.Now()
 }
@@ -30,29 +57,40 @@ func (p *Product) Prepare() {
 func (p *Product) Validate() error {
 
 	if p.ProductName == "" {
-		return errors.New("Required ProductName")
+		return apierror.Required("product_name", "Required ProductName")
 	}
 
 	if p.AmountAvailable < 1 {
-		return errors.New("Required AmountAvailable")
+		return apierror.Required("amount_available", "Required AmountAvailable")
 	}
 	if p.SellerID < 1 {
-		return errors.New("Required Seller")
+		return apierror.Required("seller", "Required Seller")
 	}
 	if p.Price < 1 {
-		return errors.New("Required Price")
+		return apierror.Required("price", "Required Price")
+	}
+	if p.LowStockThreshold < 0 {
+		return apierror.Invalid("low_stock_threshold", "Invalid LowStockThreshold")
 	}
 	return nil
 }
 
 func (p *Product) SaveProduct(db *gorm.DB) (*Product, error) {
 	var err error
-	err = db.Debug().Model(&Product{}).Create(&p).Error
+	categories, tags, err := p.resolveCategoriesAndTags(db)
+	if err != nil {
+		return &Product{}, err
+	}
+	err = db.Model(&Product{}).Create(&p).Error
+	if err != nil {
+		return &Product{}, err
+	}
+	err = p.replaceCategoriesAndTags(db, categories, tags)
 	if err != nil {
 		return &Product{}, err
 	}
 	if p.ID != 0 {
-		err = db.Debug().Model(&User{}).Where("id = ?", p.SellerID).Take(&p.Seller).Error
+		err = db.Model(&User{}).Where("id = ?", p.SellerID).Take(&p.Seller).Error
 		if err != nil {
 			return &Product{}, err
 		}
@@ -60,16 +98,39 @@ func (p *Product) SaveProduct(db *gorm.DB) (*Product, error) {
 	return p, nil
 }
 
+// PageSize is the size of the pages of products, and the largest one a
+// client can ask for.
+const PageSize = 100
+
+// Page is the part of a list ordered by id a client asks for: up to Limit
+// rows whose id is above After.
+type Page struct {
+	After uint64
+	Limit int
+}
+
+// FirstPage is the first PageSize rows.
+var FirstPage = Page{Limit: PageSize}
+
+func (page Page) apply(db *gorm.DB) *gorm.DB {
+	return db.Where("id > ?", page.After).Order("id").Limit(page.Limit)
+}
+
 func (p *Product) FindAllProducts(db *gorm.DB) (*[]Product, error) {
+	return p.FindProductsPage(db, FirstPage)
+}
+
+// FindProductsPage returns the products of page.
+func (p *Product) FindProductsPage(db *gorm.DB, page Page) (*[]Product, error) {
 	var err error
 	Products := []Product{}
-	err = db.Debug().Model(&Product{}).Limit(100).Find(&Products).Error
+	err = page.apply(preloadProduct(db.Model(&Product{}))).Find(&Products).Error
 	if err != nil {
 		return &[]Product{}, err
 	}
 	if len(Products) > 0 {
 		for i, _ := range Products {
-			err := db.Debug().Model(&User{}).Where("id = ?", Products[i].SellerID).Take(&Products[i].Seller).Error
+			err := db.Model(&User{}).Where("id = ?", Products[i].SellerID).Take(&Products[i].Seller).Error
 			if err != nil {
 				return &[]Product{}, err
 			}
@@ -80,12 +141,12 @@ func (p *Product) FindAllProducts(db *gorm.DB) (*[]Product, error) {
 
 func (p *Product) FindProductByID(db *gorm.DB, pid uint64) (*Product, error) {
 	var err error
-	err = db.Debug().Model(&Product{}).Where("id = ?", pid).Take(&p).Error
+	err = preloadProduct(db.Model(&Product{})).Where("id = ?", pid).Take(&p).Error
 	if err != nil {
 		return &Product{}, err
 	}
 	if p.ID != 0 {
-		err = db.Debug().Model(&User{}).Where("id = ?", p.SellerID).Take(&p.Seller).Error
+		err = db.Model(&User{}).Where("id = ?", p.SellerID).Take(&p.Seller).Error
 		if err != nil {
 			return &Product{}, err
 		}
@@ -96,13 +157,43 @@ func (p *Product) FindProductByID(db *gorm.DB, pid uint64) (*Product, error) {
 func (p *Product) UpdateAProduct(db *gorm.DB) (*Product, error) {
 
 	var err error
+	categories, tags, err := p.resolveCategoriesAndTags(db)
+	if err != nil {
+		return &Product{}, err
+	}
 
-	err = db.Debug().Model(&Product{}).Where("id = ?", p.ID).Updates(Product{ProductName: p.ProductName, AmountAvailable: p.AmountAvailable, UpdatedAt: time.Now()}).Error
+	err = db.Model(&Product{}).Where("id = ?", p.ID).UpdateColumns(
+		map[string]interface{}{
+			"product_name":        p.ProductName,
+			"amount_available":    p.AmountAvailable,
+			"low_stock_threshold": p.LowStockThreshold,
+			"updated_at":          time.Now(),
+		},
+	).Error
+	if err != nil {
+		return &Product{}, err
+	}
+	err = p.replaceCategoriesAndTags(db, categories, tags)
+	if err != nil {
+		return &Product{}, err
+	}
+	p.Images = []ProductImage{}
+	err = orderImages(db.Model(&ProductImage{})).Where("product_id = ?", p.ID).Find(&p.Images).Error
+	if err != nil {
+		return &Product{}, err
+	}
+	p.Options = []ProductOption{}
+	err = db.Model(&ProductOption{}).Where("product_id = ?", p.ID).Order("position").Find(&p.Options).Error
+	if err != nil {
+		return &Product{}, err
+	}
+	p.Variants = []ProductVariant{}
+	err = db.Model(&ProductVariant{}).Where("product_id = ?", p.ID).Order("id").Find(&p.Variants).Error
 	if err != nil {
 		return &Product{}, err
 	}
 	if p.ID != 0 {
-		err = db.Debug().Model(&User{}).Where("id = ?", p.SellerID).Take(&p.Seller).Error
+		err = db.Model(&User{}).Where("id = ?", p.SellerID).Take(&p.Seller).Error
 		if err != nil {
 			return &Product{}, err
 		}
@@ -110,31 +201,232 @@ func (p *Product) UpdateAProduct(db *gorm.DB) (*Product, error) {
 	return p, nil
 }
 
+// DeleteAProduct soft deletes the product. Images, variants and options are
+// kept so RestoreAProduct can bring the product back as it was.
 func (p *Product) DeleteAProduct(db *gorm.DB, pid uint64, uid uint32) (int64, error) {
 
-	db = db.Debug().Model(&Product{}).Where("id = ? and seller_id = ?", pid, uid).Take(&Product{}).Delete(&Product{})
+	deleted := db.Model(&Product{}).Where("id = ? and seller_id = ?", pid, uid).Take(&Product{}).Delete(&Product{})
 
-	if db.Error != nil {
-		if gorm.IsRecordNotFoundError(db.Error) {
-			return 0, errors.New("Product not found")
+	if deleted.Error != nil {
+		if gorm.IsRecordNotFoundError(deleted.Error) {
+			return 0, ErrProductNotFound
 		}
-		return 0, db.Error
+		return 0, deleted.Error
 	}
-	return db.RowsAffected, nil
+	return deleted.RowsAffected, nil
 }
+
+func (p *Product) RestoreAProduct(db *gorm.DB, pid uint64, uid uint32) (*Product, error) {
+
+	err := db.Unscoped().Model(&Product{}).Where("id = ? and seller_id = ? and deleted_at IS NOT NULL", pid, uid).Take(&Product{}).Error
+	if err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return &Product{}, ErrProductNotFound
+		}
+		return &Product{}, err
+	}
+	// a product can not come back while its seller is deleted
+	err = db.Model(&User{}).Where("id = ?", uid).Take(&User{}).Error
+	if err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return &Product{}, ErrSellerDeleted
+		}
+		return &Product{}, err
+	}
+	err = db.Unscoped().Model(&Product{}).Where("id = ?", pid).UpdateColumn("deleted_at", nil).Error
+	if err != nil {
+		return &Product{}, err
+	}
+	return p.FindProductByID(db, pid)
+}
+
+// PurgeDeletedProducts permanently removes products soft deleted before the
+// cutoff together with everything hanging off them. The purged images are
+// returned so the caller can remove the stored files.
+func PurgeDeletedProducts(db *gorm.DB, before time.Time) ([]ProductImage, int64, error) {
+
+	pids := []uint64{}
+	err := db.Unscoped().Model(&Product{}).Where("deleted_at IS NOT NULL AND deleted_at < ?", before).Pluck("id", &pids).Error
+	if err != nil || len(pids) == 0 {
+		return []ProductImage{}, 0, err
+	}
+	images := []ProductImage{}
+	err = db.Model(&ProductImage{}).Where("product_id IN (?)", pids).Find(&images).Error
+	if err != nil {
+		return []ProductImage{}, 0, err
+	}
+
+	tx := db.Begin()
+	// children first, the foreign keys restrict deletes
+	for _, value := range []interface{}{&Notification{}, &RestockSubscription{}, &InventoryMovement{}, &ProductImage{}, &ProductVariant{}, &ProductOption{}} {
+		err = tx.Where("product_id IN (?)", pids).Delete(value).Error
+		if err != nil {
+			tx.Rollback()
+			return []ProductImage{}, 0, err
+		}
+	}
+	for _, table := range []string{"product_categories", "product_tags"} {
+		err = tx.Table(table).Where("product_id IN (?)", pids).Delete(nil).Error
+		if err != nil {
+			tx.Rollback()
+			return []ProductImage{}, 0, err
+		}
+	}
+	purged := tx.Unscoped().Where("id IN (?)", pids).Delete(&Product{})
+	if purged.Error != nil {
+		tx.Rollback()
+		return []ProductImage{}, 0, purged.Error
+	}
+	return images, purged.RowsAffected, tx.Commit().Error
+}
+
 func (p *Product) BuyProduct(db *gorm.DB) (*Product, error) {
 
 	var err error
 
-	err = db.Debug().Model(&Product{}).Where("id = ?", p.ID).Updates(Product{ProductName: p.ProductName, AmountAvailable: p.AmountAvailable, UpdatedAt: time.Now()}).Error
+	err = db.Model(&Product{}).Where("id = ?", p.ID).UpdateColumns(
+		map[string]interface{}{
+			"product_name":        p.ProductName,
+			"amount_available":    p.AmountAvailable,
+			"low_stock_threshold": p.LowStockThreshold,
+			"updated_at":          time.Now(),
+		},
+	).Error
 	if err != nil {
 		return &Product{}, err
 	}
 	if p.ID != 0 {
-		err = db.Debug().Model(&User{}).Where("id = ?", p.SellerID).Take(&p.Seller).Error
+		err = db.Model(&User{}).Where("id = ?", p.SellerID).Take(&p.Seller).Error
 		if err != nil {
 			return &Product{}, err
 		}
 	}
 	return p, nil
 }
+
+// FindProductsByCategory returns the products assigned to the category or to
+// any category below it.
+func (p *Product) FindProductsByCategory(db *gorm.DB, cid uint32) (*[]Product, error) {
+	var err error
+	err = db.Model(&Category{}).Where("id = ?", cid).Take(&Category{}).Error
+	if err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return &[]Product{}, ErrCategoryNotFound
+		}
+		return &[]Product{}, err
+	}
+	cids, err := DescendantCategoryIDs(db, cid)
+	if err != nil {
+		return &[]Product{}, err
+	}
+	pids := []uint64{}
+	err = db.Table("product_categories").Where("category_id IN (?)", cids).Pluck("DISTINCT product_id", &pids).Error
+	if err != nil {
+		return &[]Product{}, err
+	}
+	return findProductsByIDs(db, pids, FirstPage)
+}
+
+// FindProductsByTags returns the products carrying every one of the given tags.
+func (p *Product) FindProductsByTags(db *gorm.DB, names []string) (*[]Product, error) {
+	return p.FindProductsByTagsPage(db, names, FirstPage)
+}
+
+// FindProductsByTagsPage returns page of the products carrying every one of
+// the given tags.
+func (p *Product) FindProductsByTagsPage(db *gorm.DB, names []string, page Page) (*[]Product, error) {
+	var err error
+	tags := []string{}
+	for _, name := range names {
+		if name = NormalizeTagName(name); name != "" {
+			tags = append(tags, name)
+		}
+	}
+	if len(tags) == 0 {
+		return p.FindProductsPage(db, page)
+	}
+	pids := []uint64{}
+	err = db.Table("product_tags").
+		Joins("JOIN tags ON tags.id = product_tags.tag_id").
+		Where("tags.name IN (?)", tags).
+		Group("product_tags.product_id").
+		Having("COUNT(DISTINCT tags.id) = ?", len(tags)).
+		Pluck("product_tags.product_id", &pids).Error
+	if err != nil {
+		return &[]Product{}, err
+	}
+	return findProductsByIDs(db, pids, page)
+}
+
+func findProductsByIDs(db *gorm.DB, pids []uint64, page Page) (*[]Product, error) {
+	Products := []Product{}
+	if len(pids) == 0 {
+		return &Products, nil
+	}
+	err := page.apply(preloadProduct(db.Model(&Product{})).Where("id IN (?)", pids)).Find(&Products).Error
+	if err != nil {
+		return &[]Product{}, err
+	}
+	for i := range Products {
+		err := db.Model(&User{}).Where("id = ?", Products[i].SellerID).Take(&Products[i].Seller).Error
+		if err != nil {
+			return &[]Product{}, err
+		}
+	}
+	return &Products, nil
+}
+
+// resolveCategoriesAndTags loads the categories named by CategoryIDs and finds
+// or creates the tags named by TagNames. A nil slice means "leave unchanged".
+func (p *Product) resolveCategoriesAndTags(db *gorm.DB) ([]Category, []Tag, error) {
+	var categories []Category
+	var tags []Tag
+	if p.CategoryIDs != nil {
+		categories = []Category{}
+		if len(p.CategoryIDs) > 0 {
+			err := db.Model(&Category{}).Where("id IN (?)", p.CategoryIDs).Find(&categories).Error
+			if err != nil {
+				return nil, nil, err
+			}
+			found := map[uint32]bool{}
+			for _, c := range categories {
+				found[c.ID] = true
+			}
+			for _, id := range p.CategoryIDs {
+				if !found[id] {
+					return nil, nil, ErrCategoryNotFound
+				}
+			}
+		}
+	}
+	if p.TagNames != nil {
+		var err error
+		tags, err = FindOrCreateTags(db, p.TagNames)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return categories, tags, nil
+}
+
+func (p *Product) replaceCategoriesAndTags(db *gorm.DB, categories []Category, tags []Tag) error {
+	if categories != nil {
+		err := db.Model(p).Association("Categories").Replace(categories).Error
+		if err != nil {
+			return err
+		}
+	}
+	if tags != nil {
+		err := db.Model(p).Association("Tags").Replace(tags).Error
+		if err != nil {
+			return err
+		}
+	}
+	p.Categories = []Category{}
+	p.Tags = []Tag{}
+	err := db.Model(p).Association("Categories").Find(&p.Categories).Error
+	if err != nil {
+		return err
+	}
+	return db.Model(p).Association("Tags").Find(&p.Tags).Error
+}
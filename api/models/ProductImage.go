@@ -0,0 +1,103 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/task/api/apierror"
+)
+
+type ProductImage struct {
+	ID           uint64    `gorm:"primary_key;auto_increment" json:"id"`
+	ProductID    uint64    `gorm:"not null;index" json:"product_id"`
+	Position     int       `gorm:"not null" json:"position"`
+	Key          string    `gorm:"size:255;not null" json:"-"`
+	ThumbnailKey string    `gorm:"size:255;not null" json:"-"`
+	URL          string    `gorm:"size:512;not null" json:"url"`
+	ThumbnailURL string    `gorm:"size:512;not null" json:"thumbnail_url"`
+	ContentType  string    `gorm:"size:100;not null" json:"content_type"`
+	Size         int64     `gorm:"not null" json:"size"`
+	Width        int       `json:"width"`
+	Height       int       `json:"height"`
+	CreatedAt    time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+// orderImages is used when preloading Product.Images.
+func orderImages(db *gorm.DB) *gorm.DB {
+	return db.Order("position, id")
+}
+
+// SaveProductImage appends the image at the end of the product's image list.
+func (i *ProductImage) SaveProductImage(db *gorm.DB) (*ProductImage, error) {
+	var err error
+	var count int
+	err = db.Model(&ProductImage{}).Where("product_id = ?", i.ProductID).Count(&count).Error
+	if err != nil {
+		return &ProductImage{}, err
+	}
+	i.Position = count
+	err = db.Model(&ProductImage{}).Create(&i).Error
+	if err != nil {
+		return &ProductImage{}, err
+	}
+	return i, nil
+}
+
+func (i *ProductImage) FindProductImages(db *gorm.DB, pid uint64) (*[]ProductImage, error) {
+	images := []ProductImage{}
+	err := orderImages(db.Model(&ProductImage{})).Where("product_id = ?", pid).Find(&images).Error
+	if err != nil {
+		return &[]ProductImage{}, err
+	}
+	return &images, nil
+}
+
+// DeleteAProductImage removes the row and returns it so the caller can
+// remove the stored files as well.
+func (i *ProductImage) DeleteAProductImage(db *gorm.DB, pid, iid uint64) (*ProductImage, error) {
+	image := ProductImage{}
+	err := db.Model(&ProductImage{}).Where("id = ? and product_id = ?", iid, pid).Take(&image).Error
+	if err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return &ProductImage{}, ErrImageNotFound
+		}
+		return &ProductImage{}, err
+	}
+	err = db.Model(&ProductImage{}).Where("id = ?", iid).Delete(&ProductImage{}).Error
+	if err != nil {
+		return &ProductImage{}, err
+	}
+	return &image, nil
+}
+
+// ReorderProductImages sets the positions to the order of iids, which must
+// list every image of the product exactly once.
+func ReorderProductImages(db *gorm.DB, pid uint64, iids []uint64) error {
+	current := []uint64{}
+	err := db.Model(&ProductImage{}).Where("product_id = ?", pid).Pluck("id", &current).Error
+	if err != nil {
+		return err
+	}
+	known := map[uint64]bool{}
+	for _, id := range current {
+		known[id] = true
+	}
+	if len(iids) != len(current) {
+		return apierror.Invalid("order", "Image Order Must List Every Image")
+	}
+	for _, id := range iids {
+		if !known[id] {
+			return apierror.Invalid("order", "Image Order Must List Every Image")
+		}
+		delete(known, id)
+	}
+	tx := db.Begin()
+	for position, id := range iids {
+		err = tx.Model(&ProductImage{}).Where("id = ?", id).UpdateColumn("position", position).Error
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit().Error
+}
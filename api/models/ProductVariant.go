@@ -0,0 +1,331 @@
+package models
+
+import (
+	"encoding/json"
+	"html"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/task/api/apierror"
+)
+
+// ProductOption is one axis a product varies on, e.g. size with the values S, M and L.
+type ProductOption struct {
+	ID        uint64   `gorm:"primary_key;auto_increment" json:"id"`
+	ProductID uint64   `gorm:"not null;index" json:"product_id"`
+	Name      string   `gorm:"size:100;not null" json:"name"`
+	Position  int      `gorm:"not null" json:"position"`
+	Values    []string `gorm:"-" json:"values"`
+	ValueList string   `gorm:"size:2000;not null" json:"-"`
+}
+
+func (o *ProductOption) BeforeSave() error {
+	b, err := json.Marshal(o.Values)
+	if err != nil {
+		return err
+	}
+	o.ValueList = string(b)
+	return nil
+}
+
+func (o *ProductOption) AfterFind() error {
+	o.Values = []string{}
+	if o.ValueList == "" {
+		return nil
+	}
+	return json.Unmarshal([]byte(o.ValueList), &o.Values)
+}
+
+// ProductVariant is one sellable combination of option values with its own
+// SKU and stock. A nil Price means the product price applies.
+type ProductVariant struct {
+	ID              uint64            `gorm:"primary_key;auto_increment" json:"id"`
+	ProductID       uint64            `gorm:"not null;unique_index:idx_product_variant_options" json:"product_id"`
+	SKU             string            `gorm:"size:100;not null;unique" json:"sku"`
+	Options         map[string]string `gorm:"-" json:"options"`
+	OptionKey       string            `gorm:"size:1000;not null;unique_index:idx_product_variant_options" json:"-"`
+	AmountAvailable float32           `gorm:"not null" json:"amount_available"`
+	Price           *float32          `json:"price"`
+	CreatedAt       time.Time         `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt       time.Time         `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+}
+
+func (v *ProductVariant) AfterFind() error {
+	v.Options = map[string]string{}
+	if v.OptionKey == "" {
+		return nil
+	}
+	return json.Unmarshal([]byte(v.OptionKey), &v.Options)
+}
+
+// UnitPrice is the price a buyer pays for one unit of the variant.
+func (v *ProductVariant) UnitPrice(p *Product) float32 {
+	if v.Price != nil {
+		return *v.Price
+	}
+	return p.Price
+}
+
+func (v *ProductVariant) Prepare() {
+	v.ID = 0
+	v.SKU = html.EscapeString(strings.TrimSpace(v.SKU))
+	v.CreatedAt = time.Now()
+	v.UpdatedAt = time.Now()
+}
+
+func (v *ProductVariant) Validate() error {
+	if v.SKU == "" {
+		return apierror.Required("sku", "Required SKU")
+	}
+	if v.AmountAvailable < 0 {
+		return apierror.Invalid("amount_available", "Invalid AmountAvailable")
+	}
+	if v.Price != nil && *v.Price < 1 {
+		return apierror.Invalid("price", "Invalid Price")
+	}
+	return nil
+}
+
+// SetProductOptions replaces the option axes of a product. The axes can only
+// change while the product has no variants, otherwise existing variants
+// would no longer describe a valid combination.
+func SetProductOptions(db *gorm.DB, pid uint64, options []ProductOption) ([]ProductOption, error) {
+	var count int
+	err := db.Model(&ProductVariant{}).Where("product_id = ?", pid).Count(&count).Error
+	if err != nil {
+		return []ProductOption{}, err
+	}
+	if count > 0 {
+		return []ProductOption{}, ErrVariantsExist
+	}
+	names := map[string]bool{}
+	for i := range options {
+		options[i].ID = 0
+		options[i].ProductID = pid
+		options[i].Position = i
+		options[i].Name = html.EscapeString(strings.ToLower(strings.TrimSpace(options[i].Name)))
+		if options[i].Name == "" {
+			return []ProductOption{}, apierror.Required("option_name", "Required Option Name")
+		}
+		if names[options[i].Name] {
+			return []ProductOption{}, apierror.Invalid("option_name", "Duplicate Option Name")
+		}
+		names[options[i].Name] = true
+		if len(options[i].Values) == 0 {
+			return []ProductOption{}, apierror.Required("option_values", "Required Option Values")
+		}
+		values := map[string]bool{}
+		for j, value := range options[i].Values {
+			value = html.EscapeString(strings.TrimSpace(value))
+			if value == "" || values[value] {
+				return []ProductOption{}, apierror.Invalid("option_values", "Invalid Option Values")
+			}
+			values[value] = true
+			options[i].Values[j] = value
+		}
+	}
+
+	tx := db.Begin()
+	err = tx.Where("product_id = ?", pid).Delete(&ProductOption{}).Error
+	if err != nil {
+		tx.Rollback()
+		return []ProductOption{}, err
+	}
+	for i := range options {
+		err = tx.Create(&options[i]).Error
+		if err != nil {
+			tx.Rollback()
+			return []ProductOption{}, err
+		}
+	}
+	return options, tx.Commit().Error
+}
+
+// optionKey checks the variant names exactly one known value for every axis
+// of the product and returns the canonical form stored in OptionKey.
+func optionKey(db *gorm.DB, pid uint64, selected map[string]string) (string, error) {
+	options := []ProductOption{}
+	err := db.Model(&ProductOption{}).Where("product_id = ?", pid).Order("position").Find(&options).Error
+	if err != nil {
+		return "", err
+	}
+	if len(options) == 0 {
+		return "", ErrNoOptions
+	}
+	if len(selected) != len(options) {
+		return "", ErrIncompleteVariant
+	}
+	for _, option := range options {
+		value, ok := selected[option.Name]
+		if !ok {
+			return "", ErrIncompleteVariant
+		}
+		valid := false
+		for _, v := range option.Values {
+			if v == value {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return "", apierror.Invalid("options", "Invalid Option Value For "+option.Name)
+		}
+	}
+	// encoding/json sorts map keys, so equal selections give equal keys
+	b, err := json.Marshal(selected)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func normalizeOptions(selected map[string]string) map[string]string {
+	normalized := map[string]string{}
+	for name, value := range selected {
+		normalized[html.EscapeString(strings.ToLower(strings.TrimSpace(name)))] = html.EscapeString(strings.TrimSpace(value))
+	}
+	return normalized
+}
+
+func (v *ProductVariant) SaveVariant(db *gorm.DB) (*ProductVariant, error) {
+	var err error
+	v.Options = normalizeOptions(v.Options)
+	v.OptionKey, err = optionKey(db, v.ProductID, v.Options)
+	if err != nil {
+		return &ProductVariant{}, err
+	}
+	err = db.Model(&ProductVariant{}).Create(&v).Error
+	if err != nil {
+		return &ProductVariant{}, err
+	}
+	err = SyncProductStock(db, v.ProductID)
+	if err != nil {
+		return &ProductVariant{}, err
+	}
+	return v, nil
+}
+
+func (v *ProductVariant) FindProductVariants(db *gorm.DB, pid uint64) (*[]ProductVariant, error) {
+	variants := []ProductVariant{}
+	err := db.Model(&ProductVariant{}).Where("product_id = ?", pid).Order("id").Find(&variants).Error
+	if err != nil {
+		return &[]ProductVariant{}, err
+	}
+	return &variants, nil
+}
+
+func (v *ProductVariant) FindVariantByID(db *gorm.DB, vid uint64) (*ProductVariant, error) {
+	err := db.Model(&ProductVariant{}).Where("id = ?", vid).Take(&v).Error
+	if err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return &ProductVariant{}, ErrVariantNotFound
+		}
+		return &ProductVariant{}, err
+	}
+	return v, nil
+}
+
+func (v *ProductVariant) FindVariantBySKU(db *gorm.DB, sku string) (*ProductVariant, error) {
+	err := db.Model(&ProductVariant{}).Where("sku = ?", strings.TrimSpace(sku)).Take(&v).Error
+	if err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return &ProductVariant{}, ErrVariantNotFound
+		}
+		return &ProductVariant{}, err
+	}
+	return v, nil
+}
+
+// UpdateAVariant changes SKU, options, stock and price of the variant v.ID.
+func (v *ProductVariant) UpdateAVariant(db *gorm.DB) (*ProductVariant, error) {
+	var err error
+	v.Options = normalizeOptions(v.Options)
+	v.OptionKey, err = optionKey(db, v.ProductID, v.Options)
+	if err != nil {
+		return &ProductVariant{}, err
+	}
+	err = db.Model(&ProductVariant{}).Where("id = ? and product_id = ?", v.ID, v.ProductID).Take(&ProductVariant{}).UpdateColumns(
+		map[string]interface{}{
+			"sku":              v.SKU,
+			"option_key":       v.OptionKey,
+			"amount_available": v.AmountAvailable,
+			"price":            v.Price,
+			"updated_at":       time.Now(),
+		},
+	).Error
+	if err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return &ProductVariant{}, ErrVariantNotFound
+		}
+		return &ProductVariant{}, err
+	}
+	err = SyncProductStock(db, v.ProductID)
+	if err != nil {
+		return &ProductVariant{}, err
+	}
+	return v.FindVariantByID(db, v.ID)
+}
+
+// UpdateVariantStock stores v.AmountAvailable, used by /buy.
+func (v *ProductVariant) UpdateVariantStock(db *gorm.DB) error {
+	err := db.Model(&ProductVariant{}).Where("id = ?", v.ID).UpdateColumns(
+		map[string]interface{}{
+			"amount_available": v.AmountAvailable,
+			"updated_at":       time.Now(),
+		},
+	).Error
+	if err != nil {
+		return err
+	}
+	return SyncProductStock(db, v.ProductID)
+}
+
+// DeleteAVariant removes the variant with its restock subscriptions and
+// notifications, which the foreign keys would otherwise keep it for. Its
+// stock movements stay in the log without the variant.
+func (v *ProductVariant) DeleteAVariant(db *gorm.DB, pid, vid uint64) (int64, error) {
+	err := db.Model(&ProductVariant{}).Where("id = ? and product_id = ?", vid, pid).Take(&ProductVariant{}).Error
+	if err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return 0, ErrVariantNotFound
+		}
+		return 0, err
+	}
+	var deleted int64
+	err = Transaction(db, func(tx *gorm.DB) error {
+		for _, value := range []interface{}{&Notification{}, &RestockSubscription{}} {
+			err := tx.Where("variant_id = ?", vid).Delete(value).Error
+			if err != nil {
+				return err
+			}
+		}
+		result := tx.Where("id = ?", vid).Delete(&ProductVariant{})
+		if result.Error != nil {
+			return result.Error
+		}
+		deleted = result.RowsAffected
+		return SyncProductStock(tx, pid)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return deleted, nil
+}
+
+// SyncProductStock keeps Product.AmountAvailable equal to the stock of all
+// its variants so listings stay meaningful for products with variants. A
+// product whose last variant was deleted has nothing left to sell.
+func SyncProductStock(db *gorm.DB, pid uint64) error {
+	var total struct{ Total float32 }
+	err := db.Model(&ProductVariant{}).Select("COALESCE(SUM(amount_available), 0) AS total").Where("product_id = ?", pid).Scan(&total).Error
+	if err != nil {
+		return err
+	}
+	return db.Model(&Product{}).Where("id = ?", pid).UpdateColumns(
+		map[string]interface{}{
+			"amount_available": total.Total,
+			"updated_at":       time.Now(),
+		},
+	).Error
+}
@@ -0,0 +1,87 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// RestockSubscription is a buyer's "notify me when back in stock" request.
+// It is fulfilled once: NotifiedAt is set when the notification went out.
+type RestockSubscription struct {
+	ID         uint64     `gorm:"primary_key;auto_increment" json:"id"`
+	UserID     uint32     `gorm:"not null;index" json:"user_id"`
+	ProductID  uint64     `gorm:"not null;index" json:"product_id"`
+	VariantID  *uint64    `json:"variant_id"`
+	NotifiedAt *time.Time `json:"notified_at"`
+	CreatedAt  time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+func pendingSubscriptions(db *gorm.DB, pid uint64, vid *uint64) *gorm.DB {
+	query := db.Model(&RestockSubscription{}).Where("product_id = ? AND notified_at IS NULL", pid)
+	if vid != nil {
+		return query.Where("variant_id = ?", *vid)
+	}
+	return query.Where("variant_id IS NULL")
+}
+
+// SaveSubscription is idempotent, subscribing twice returns the pending
+// subscription.
+func (s *RestockSubscription) SaveSubscription(db *gorm.DB) (*RestockSubscription, error) {
+	err := db.Model(&Product{}).Where("id = ?", s.ProductID).Take(&Product{}).Error
+	if err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return &RestockSubscription{}, ErrProductNotFound
+		}
+		return &RestockSubscription{}, err
+	}
+	if s.VariantID != nil {
+		err = db.Model(&ProductVariant{}).Where("id = ? AND product_id = ?", *s.VariantID, s.ProductID).Take(&ProductVariant{}).Error
+		if err != nil {
+			if gorm.IsRecordNotFoundError(err) {
+				return &RestockSubscription{}, ErrVariantNotFound
+			}
+			return &RestockSubscription{}, err
+		}
+	}
+	existing := RestockSubscription{}
+	err = pendingSubscriptions(db, s.ProductID, s.VariantID).Where("user_id = ?", s.UserID).Take(&existing).Error
+	if err == nil {
+		return &existing, nil
+	}
+	if !gorm.IsRecordNotFoundError(err) {
+		return &RestockSubscription{}, err
+	}
+	err = db.Model(&RestockSubscription{}).Create(&s).Error
+	if err != nil {
+		return &RestockSubscription{}, err
+	}
+	return s, nil
+}
+
+func (s *RestockSubscription) DeleteSubscription(db *gorm.DB, uid uint32, pid uint64, vid *uint64) (int64, error) {
+	deleted := pendingSubscriptions(db, pid, vid).Where("user_id = ?", uid).Delete(&RestockSubscription{})
+	if deleted.Error != nil {
+		return 0, deleted.Error
+	}
+	if deleted.RowsAffected == 0 {
+		return 0, ErrSubscriptionNotFound
+	}
+	return deleted.RowsAffected, nil
+}
+
+// FindPendingSubscriptions lists who is waiting for the product (or variant).
+func (s *RestockSubscription) FindPendingSubscriptions(db *gorm.DB, pid uint64, vid *uint64) (*[]RestockSubscription, error) {
+	subscriptions := []RestockSubscription{}
+	err := pendingSubscriptions(db, pid, vid).Order("id").Find(&subscriptions).Error
+	if err != nil {
+		return &[]RestockSubscription{}, err
+	}
+	return &subscriptions, nil
+}
+
+func (s *RestockSubscription) MarkNotified(db *gorm.DB) error {
+	now := time.Now()
+	s.NotifiedAt = &now
+	return db.Model(&RestockSubscription{}).Where("id = ?", s.ID).UpdateColumn("notified_at", now).Error
+}
@@ -0,0 +1,49 @@
+package models
+
+import (
+	"html"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+)
+
+type Tag struct {
+	ID   uint32 `gorm:"primary_key;auto_increment" json:"id"`
+	Name string `gorm:"size:100;not null;unique" json:"name"`
+}
+
+// NormalizeTagName trims, lower-cases and escapes a tag name so that
+// "Summer " and "summer" end up as the same tag.
+func NormalizeTagName(name string) string {
+	return html.EscapeString(strings.ToLower(strings.TrimSpace(name)))
+}
+
+// FindOrCreateTags returns the tags with the given names, creating the
+// missing ones. Empty and duplicate names are ignored.
+func FindOrCreateTags(db *gorm.DB, names []string) ([]Tag, error) {
+	tags := []Tag{}
+	seen := map[string]bool{}
+	for _, name := range names {
+		name = NormalizeTagName(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		tag := Tag{}
+		err := db.Where(Tag{Name: name}).FirstOrCreate(&tag).Error
+		if err != nil {
+			return []Tag{}, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, nil
+}
+
+func (t *Tag) FindAllTags(db *gorm.DB) (*[]Tag, error) {
+	tags := []Tag{}
+	err := db.Model(&Tag{}).Order("name").Find(&tags).Error
+	if err != nil {
+		return &[]Tag{}, err
+	}
+	return &tags, nil
+}
@@ -1,14 +1,13 @@
 package models
 
 import (
-	"errors"
 	"html"
-	"log"
 	"strings"
 	"time"
 
 	"github.com/badoux/checkmail"
 	"github.com/jinzhu/gorm"
+	"github.com/task/api/apierror"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -21,6 +20,9 @@ type User struct {
 	Deposit   float32   `gorm:"size:50;not null" json:"deposit"`
 	CreatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
 	UpdatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+	// DeletedAt makes gorm soft delete users and hide them from every query
+	// that is not Unscoped. Username and email stay reserved until purged.
+	DeletedAt *time.Time `gorm:"index" json:"deleted_at,omitempty"`
 }
 
 func Hash(password string) ([]byte, error) {
@@ -53,43 +55,49 @@ func (u *User) Validate(action string) error {
 	switch strings.ToLower(action) {
 	case "update":
 		if u.Username == "" {
-			return errors.New("Required Username")
+			return apierror.Required("username", "Required Username")
 		}
 		if u.Deposit < 1 {
-			return errors.New("Required Deposit")
+			return apierror.Required("deposit", "Required Deposit")
 		}
 
 		return nil
 	case "login":
 		if u.Password == "" {
-			return errors.New("Required Password")
+			return apierror.Required("password", "Required Password")
 		}
 		if u.Email == "" {
-			return errors.New("Required Email")
+			return apierror.Required("email", "Required Email")
 		}
 		if err := checkmail.ValidateFormat(u.Email); err != nil {
-			return errors.New("Invalid Email")
+			return apierror.Invalid("email", "Invalid Email")
 		}
 		return nil
 
 	default:
 		if u.Username == "" {
-			return errors.New("Required Username")
+			return apierror.Required("username", "Required Username")
 		}
 		if u.Password == "" {
-			return errors.New("Required Password")
+			return apierror.Required("password", "Required Password")
 		}
 		if u.Role == "" {
-			return errors.New("Required Role")
+			return apierror.Required("role", "Required Role")
 		}
-		if !IsValidCategory(u.Role) {
-			return errors.New("Not Vaild Role Please Set To seller or buyer")
+		// users sign up as buyers or sellers, the management commands
+		// validate with "manage" and may create admins
+		if strings.ToLower(action) == "manage" {
+			if !IsValidRole(u.Role) {
+				return apierror.Invalid("role", "Not Vaild Role Please Set To seller, buyer or admin")
+			}
+		} else if !IsValidCategory(u.Role) {
+			return apierror.Invalid("role", "Not Vaild Role Please Set To seller or buyer")
 		}
 		if u.Email == "" {
-			return errors.New("Required Email")
+			return apierror.Required("email", "Required Email")
 		}
 		if err := checkmail.ValidateFormat(u.Email); err != nil {
-			return errors.New("Invalid Email")
+			return apierror.Invalid("email", "Invalid Email")
 		}
 		return nil
 	}
@@ -98,7 +106,7 @@ func (u *User) Validate(action string) error {
 func (u *User) SaveUser(db *gorm.DB) (*User, error) {
 
 	var err error
-	err = db.Debug().Create(&u).Error
+	err = db.Create(&u).Error
 	if err != nil {
 		return &User{}, err
 	}
@@ -108,7 +116,7 @@ func (u *User) SaveUser(db *gorm.DB) (*User, error) {
 func (u *User) FindAllUsers(db *gorm.DB) (*[]User, error) {
 	var err error
 	users := []User{}
-	err = db.Debug().Model(&User{}).Limit(100).Find(&users).Error
+	err = db.Model(&User{}).Limit(100).Find(&users).Error
 	if err != nil {
 		return &[]User{}, err
 	}
@@ -117,24 +125,35 @@ func (u *User) FindAllUsers(db *gorm.DB) (*[]User, error) {
 
 func (u *User) FindUserByID(db *gorm.DB, uid uint32) (*User, error) {
 	var err error
-	err = db.Debug().Model(User{}).Where("id = ?", uid).Take(&u).Error
+	err = db.Model(User{}).Where("id = ?", uid).Take(&u).Error
 	if err != nil {
 		return &User{}, err
 	}
 	if gorm.IsRecordNotFoundError(err) {
-		return &User{}, errors.New("User Not Found")
+		return &User{}, ErrUserNotFound
 	}
 	return u, err
 }
 
+func (u *User) FindUserByEmail(db *gorm.DB, email string) (*User, error) {
+	err := db.Model(User{}).Where("email = ?", email).Take(&u).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return &User{}, ErrUserNotFound
+	}
+	if err != nil {
+		return &User{}, err
+	}
+	return u, nil
+}
+
 func (u *User) UpdateAUser(db *gorm.DB, uid uint32) (*User, error) {
 
 	// To hash the password
 	err := u.BeforeSave()
 	if err != nil {
-		log.Fatal(err)
+		return &User{}, err
 	}
-	db = db.Debug().Model(&User{}).Where("id = ?", uid).Take(&User{}).UpdateColumns(
+	db = db.Model(&User{}).Where("id = ?", uid).Take(&User{}).UpdateColumns(
 		map[string]interface{}{
 			"username":   u.Username,
 			"deposit":    u.Deposit,
@@ -145,22 +164,152 @@ func (u *User) UpdateAUser(db *gorm.DB, uid uint32) (*User, error) {
 		return &User{}, db.Error
 	}
 	// This is the display the updated user
-	err = db.Debug().Model(&User{}).Where("id = ?", uid).Take(&u).Error
+	err = db.Model(&User{}).Where("id = ?", uid).Take(&u).Error
 	if err != nil {
 		return &User{}, err
 	}
 	return u, nil
 }
 
+// DeleteAUser soft deletes the user together with the products they sell.
+// Both get the same deleted_at so RestoreAUser brings back exactly the
+// products that went away with the user.
 func (u *User) DeleteAUser(db *gorm.DB, uid uint32) (int64, error) {
 
-	db = db.Debug().Model(&User{}).Where("id = ?", uid).Take(&User{}).Delete(&User{})
+	err := db.Model(&User{}).Where("id = ?", uid).Take(&User{}).Error
+	if err != nil {
+		return 0, err
+	}
+	// whole seconds so every driver stores and compares the same value
+	now := time.Now().Truncate(time.Second)
+
+	tx := db.Begin()
+	deleted := tx.Model(&User{}).Where("id = ?", uid).UpdateColumn("deleted_at", now)
+	if deleted.Error != nil {
+		tx.Rollback()
+		return 0, deleted.Error
+	}
+	err = tx.Model(&Product{}).Where("seller_id = ?", uid).UpdateColumn("deleted_at", now).Error
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	return deleted.RowsAffected, tx.Commit().Error
+}
+
+// RestoreAUser undoes DeleteAUser.
+func (u *User) RestoreAUser(db *gorm.DB, uid uint32) (*User, error) {
 
-	if db.Error != nil {
-		return 0, db.Error
+	user := User{}
+	err := db.Unscoped().Model(&User{}).Where("id = ? AND deleted_at IS NOT NULL", uid).Take(&user).Error
+	if err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return &User{}, ErrUserNotFound
+		}
+		return &User{}, err
+	}
+	tx := db.Begin()
+	err = tx.Unscoped().Model(&User{}).Where("id = ?", uid).UpdateColumn("deleted_at", nil).Error
+	if err != nil {
+		tx.Rollback()
+		return &User{}, err
+	}
+	err = tx.Unscoped().Model(&Product{}).Where("seller_id = ? AND deleted_at = ?", uid, user.DeletedAt).UpdateColumn("deleted_at", nil).Error
+	if err != nil {
+		tx.Rollback()
+		return &User{}, err
+	}
+	err = tx.Commit().Error
+	if err != nil {
+		return &User{}, err
+	}
+	return u.FindUserByID(db, uid)
+}
+
+// PurgeDeletedUsers permanently removes users soft deleted before the cutoff.
+// Their products were deleted at the same moment, so PurgeDeletedProducts
+// has to run first; users who still have products, restored since, are kept
+// as the products reference them.
+func PurgeDeletedUsers(db *gorm.DB, before time.Time) (int64, error) {
+
+	var purged int64
+	err := db.Transaction(func(tx *gorm.DB) error {
+		purgeable := "deleted_at IS NOT NULL AND deleted_at < ? AND NOT EXISTS (SELECT 1 FROM products WHERE products.seller_id = users.id)"
+		ids := tx.Unscoped().Model(&User{}).Select("id").Where(purgeable, before).SubQuery()
+		webhooks := tx.Model(&Webhook{}).Select("id").Where("owner_id IN ?", ids).SubQuery()
+		err := tx.Where("webhook_id IN ?", webhooks).Delete(&WebhookDelivery{}).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Where("owner_id IN ?", ids).Delete(&Webhook{}).Error
+		if err != nil {
+			return err
+		}
+		for _, owned := range []interface{}{&Notification{}, &RestockSubscription{}, &IdempotencyKey{}} {
+			err = tx.Where("user_id IN ?", ids).Delete(owned).Error
+			if err != nil {
+				return err
+			}
+		}
+		result := tx.Unscoped().Where(purgeable, before).Delete(&User{})
+		if result.Error != nil {
+			return result.Error
+		}
+		purged = result.RowsAffected
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return purged, nil
+}
+
+// UpdateAUserRole changes the role of a user, admin included.
+func (u *User) UpdateAUserRole(db *gorm.DB, uid uint32, role string) (*User, error) {
+
+	if !IsValidRole(role) {
+		return &User{}, apierror.Invalid("role", "Not Vaild Role Please Set To seller, buyer or admin")
+	}
+	err := db.Model(&User{}).Where("id = ?", uid).Take(&User{}).UpdateColumns(
+		map[string]interface{}{
+			"role":       role,
+			"updated_at": time.Now(),
+		},
+	).Error
+	if err != nil {
+		return &User{}, err
 	}
-	return db.RowsAffected, nil
+	return u.FindUserByID(db, uid)
 }
+
+// UpdateAUserPassword replaces the password of a user with a new hash.
+func (u *User) UpdateAUserPassword(db *gorm.DB, uid uint32, password string) (*User, error) {
+
+	if password == "" {
+		return &User{}, apierror.Required("password", "Required Password")
+	}
+	hashedPassword, err := Hash(password)
+	if err != nil {
+		return &User{}, err
+	}
+	err = db.Model(&User{}).Where("id = ?", uid).Take(&User{}).UpdateColumns(
+		map[string]interface{}{
+			"password":   string(hashedPassword),
+			"updated_at": time.Now(),
+		},
+	).Error
+	if err != nil {
+		return &User{}, err
+	}
+	return u.FindUserByID(db, uid)
+}
+
+// IsValidRole reports whether role is a role a user can have. Users sign up
+// as buyer or seller, admins are made by the user command.
+func IsValidRole(role string) bool {
+	return IsValidCategory(role) || role == "admin"
+}
+
 func IsValidCategory(category string) bool {
 	switch category {
 	case
@@ -172,7 +321,7 @@ func IsValidCategory(category string) bool {
 }
 func (u *User) UpdateAUserBal(db *gorm.DB, uid uint32) (*User, error) {
 
-	db = db.Debug().Model(&User{}).Where("id = ?", uid).Take(&User{}).UpdateColumns(
+	db = db.Model(&User{}).Where("id = ?", uid).Take(&User{}).UpdateColumns(
 		map[string]interface{}{
 			"deposit":    u.Deposit,
 			"updated_at": time.Now(),
@@ -184,3 +333,28 @@ func (u *User) UpdateAUserBal(db *gorm.DB, uid uint32) (*User, error) {
 
 	return u, nil
 }
+
+// WithdrawDeposit takes amount from the deposit of the user uid in a single
+// conditional update, so concurrent purchases cannot spend the same deposit
+// twice. It returns the user with the deposit left.
+func WithdrawDeposit(db *gorm.DB, uid uint32, amount float32) (*User, error) {
+
+	withdrawn := db.Model(&User{}).Where("id = ? AND deposit >= ?", uid, amount).UpdateColumns(
+		map[string]interface{}{
+			"deposit":    gorm.Expr("deposit - ?", amount),
+			"updated_at": time.Now(),
+		},
+	)
+	if withdrawn.Error != nil {
+		return &User{}, withdrawn.Error
+	}
+	if withdrawn.RowsAffected == 0 {
+		return &User{}, ErrInsufficientBalance
+	}
+	user := &User{}
+	err := db.Model(&User{}).Where("id = ?", uid).Take(user).Error
+	if err != nil {
+		return &User{}, err
+	}
+	return user, nil
+}
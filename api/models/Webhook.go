@@ -0,0 +1,189 @@
+package models
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/task/api/apierror"
+)
+
+// webhookEvents are the domain events webhooks can subscribe to.
+var webhookEvents = []string{EventUserCreated, EventDepositChanged, EventProductCreated, EventProductUpdated, EventProductDeleted, EventPurchaseCompleted, EventStockChanged}
+
+// Webhook is an endpoint a seller or admin registered to receive events.
+// Sellers only receive events about their own products, admins receive all.
+// The secret is only shown when the webhook is created.
+type Webhook struct {
+	ID        uint64    `gorm:"primary_key;auto_increment" json:"id"`
+	OwnerID   uint32    `gorm:"not null;index" json:"owner_id"`
+	URL       string    `gorm:"size:2000;not null" json:"url"`
+	Secret    string    `gorm:"size:100;not null" json:"-"`
+	Events    []string  `gorm:"-" json:"events"`
+	EventList string    `gorm:"size:1000;not null" json:"-"`
+	Active    bool      `gorm:"not null" json:"active"`
+	CreatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+}
+
+func (wh *Webhook) BeforeSave() error {
+	b, err := json.Marshal(wh.Events)
+	if err != nil {
+		return err
+	}
+	wh.EventList = string(b)
+	return nil
+}
+
+func (wh *Webhook) AfterFind() error {
+	wh.Events = []string{}
+	if wh.EventList == "" {
+		return nil
+	}
+	return json.Unmarshal([]byte(wh.EventList), &wh.Events)
+}
+
+// Subscribed reports whether the webhook wants the event.
+func (wh *Webhook) Subscribed(event string) bool {
+	for _, e := range wh.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+func (wh *Webhook) Prepare() {
+	wh.ID = 0
+	wh.URL = strings.TrimSpace(wh.URL)
+	events := []string{}
+	seen := map[string]bool{}
+	for _, e := range wh.Events {
+		e = strings.ToLower(strings.TrimSpace(e))
+		if e != "" && !seen[e] {
+			seen[e] = true
+			events = append(events, e)
+		}
+	}
+	wh.Events = events
+	wh.CreatedAt = time.Now()
+	wh.UpdatedAt = time.Now()
+}
+
+func (wh *Webhook) Validate() error {
+	u, err := url.Parse(wh.URL)
+	if wh.URL == "" || err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return apierror.Invalid("url", "Invalid Webhook URL")
+	}
+	if len(wh.Events) == 0 {
+		return apierror.Required("events", "Required Events")
+	}
+	for _, e := range wh.Events {
+		known := false
+		for _, k := range webhookEvents {
+			if e == k {
+				known = true
+			}
+		}
+		if !known {
+			return apierror.Invalid("events", "Unknown Event "+e)
+		}
+	}
+	return nil
+}
+
+// NewWebhookSecret returns a random signing secret.
+func NewWebhookSecret() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func (wh *Webhook) SaveWebhook(db *gorm.DB) (*Webhook, error) {
+	var err error
+	if wh.Secret == "" {
+		wh.Secret, err = NewWebhookSecret()
+		if err != nil {
+			return &Webhook{}, err
+		}
+	}
+	err = db.Model(&Webhook{}).Create(&wh).Error
+	if err != nil {
+		return &Webhook{}, err
+	}
+	return wh, nil
+}
+
+// FindWebhooks lists the webhooks of the owner, all of them when admin is set.
+func (wh *Webhook) FindWebhooks(db *gorm.DB, uid uint32, admin bool) (*[]Webhook, error) {
+	webhooks := []Webhook{}
+	query := db.Model(&Webhook{})
+	if !admin {
+		query = query.Where("owner_id = ?", uid)
+	}
+	err := query.Order("id").Find(&webhooks).Error
+	if err != nil {
+		return &[]Webhook{}, err
+	}
+	return &webhooks, nil
+}
+
+func (wh *Webhook) FindWebhookByID(db *gorm.DB, wid uint64) (*Webhook, error) {
+	err := db.Model(&Webhook{}).Where("id = ?", wid).Take(&wh).Error
+	if err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return &Webhook{}, ErrWebhookNotFound
+		}
+		return &Webhook{}, err
+	}
+	return wh, nil
+}
+
+func (wh *Webhook) UpdateAWebhook(db *gorm.DB, wid uint64) (*Webhook, error) {
+	b, err := json.Marshal(wh.Events)
+	if err != nil {
+		return &Webhook{}, err
+	}
+	err = db.Model(&Webhook{}).Where("id = ?", wid).UpdateColumns(
+		map[string]interface{}{
+			"url":        wh.URL,
+			"event_list": string(b),
+			"active":     wh.Active,
+			"updated_at": time.Now(),
+		},
+	).Error
+	if err != nil {
+		return &Webhook{}, err
+	}
+	return wh.FindWebhookByID(db, wid)
+}
+
+// DeleteAWebhook removes the webhook together with its delivery log.
+func (wh *Webhook) DeleteAWebhook(db *gorm.DB, wid uint64) (int64, error) {
+	var deleted int64
+	err := db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("webhook_id = ?", wid).Delete(&WebhookDelivery{}).Error
+		if err != nil {
+			return err
+		}
+		result := tx.Model(&Webhook{}).Where("id = ?", wid).Delete(&Webhook{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrWebhookNotFound
+		}
+		deleted = result.RowsAffected
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return deleted, nil
+}
@@ -0,0 +1,177 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Delivery statuses.
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+// WebhookDelivery is one event queued for one webhook. It doubles as the
+// delivery log: every attempt updates the counters and the last response.
+type WebhookDelivery struct {
+	ID             uint64     `gorm:"primary_key;auto_increment" json:"id"`
+	WebhookID      uint64     `gorm:"not null;index" json:"webhook_id"`
+	Event          string     `gorm:"size:100;not null" json:"event"`
+	Payload        string     `gorm:"type:text;not null" json:"payload"`
+	Status         string     `gorm:"size:20;not null;index" json:"status"`
+	Attempts       int        `gorm:"not null;default:0" json:"attempts"`
+	NextAttemptAt  time.Time  `gorm:"index" json:"next_attempt_at"`
+	LastStatusCode int        `json:"last_status_code"`
+	LastError      string     `gorm:"size:1000" json:"last_error"`
+	DeliveredAt    *time.Time `json:"delivered_at"`
+	CreatedAt      time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt      time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+}
+
+// EnqueueDeliveries queues the event for every active webhook subscribed to
+// it. A non zero sellerID restricts the sellers' webhooks to that seller,
+// admins' webhooks receive every event.
+func EnqueueDeliveries(db *gorm.DB, event string, sellerID uint32, payload []byte) (int, error) {
+	webhooks := []Webhook{}
+	err := db.Model(&Webhook{}).
+		Joins("JOIN users ON users.id = webhooks.owner_id").
+		Where("webhooks.active = ? AND users.deleted_at IS NULL AND (users.role = ? OR webhooks.owner_id = ?)", true, "admin", sellerID).
+		Find(&webhooks).Error
+	if err != nil {
+		return 0, err
+	}
+	queued := 0
+	now := time.Now()
+	for i := range webhooks {
+		if !webhooks[i].Subscribed(event) {
+			continue
+		}
+		delivery := WebhookDelivery{
+			WebhookID:     webhooks[i].ID,
+			Event:         event,
+			Payload:       string(payload),
+			Status:        DeliveryPending,
+			NextAttemptAt: now,
+			CreatedAt:     now,
+			UpdatedAt:     now,
+		}
+		err = db.Model(&WebhookDelivery{}).Create(&delivery).Error
+		if err != nil {
+			return queued, err
+		}
+		queued++
+	}
+	return queued, nil
+}
+
+// DeliveryLease is how long a claimed delivery is left to its attempt before
+// it is due again, for when the instance attempting it stops.
+const DeliveryLease = time.Minute
+
+// ClaimDueDeliveries claims up to limit pending deliveries whose next
+// attempt is due, oldest first, by moving their next attempt DeliveryLease
+// ahead. Only one caller wins a delivery, so every instance can run the
+// dispatcher.
+func ClaimDueDeliveries(db *gorm.DB, now time.Time, limit int) (*[]WebhookDelivery, error) {
+	due := []WebhookDelivery{}
+	err := db.Model(&WebhookDelivery{}).
+		Where("status = ? AND next_attempt_at <= ?", DeliveryPending, now).
+		Order("next_attempt_at, id").Limit(limit).Find(&due).Error
+	if err != nil {
+		return &[]WebhookDelivery{}, err
+	}
+	lease := now.Add(DeliveryLease)
+	deliveries := []WebhookDelivery{}
+	for _, d := range due {
+		claim := db.Model(&WebhookDelivery{}).
+			Where("id = ? AND status = ? AND next_attempt_at <= ?", d.ID, DeliveryPending, now).
+			UpdateColumn("next_attempt_at", lease)
+		if claim.Error != nil {
+			return &deliveries, claim.Error
+		}
+		if claim.RowsAffected == 1 {
+			d.NextAttemptAt = lease
+			deliveries = append(deliveries, d)
+		}
+	}
+	return &deliveries, nil
+}
+
+func (d *WebhookDelivery) FindWebhookDeliveries(db *gorm.DB, wid uint64) (*[]WebhookDelivery, error) {
+	deliveries := []WebhookDelivery{}
+	err := db.Model(&WebhookDelivery{}).Where("webhook_id = ?", wid).Order("id desc").Limit(100).Find(&deliveries).Error
+	if err != nil {
+		return &[]WebhookDelivery{}, err
+	}
+	return &deliveries, nil
+}
+
+func (d *WebhookDelivery) FindDeliveryByID(db *gorm.DB, wid, did uint64) (*WebhookDelivery, error) {
+	err := db.Model(&WebhookDelivery{}).Where("id = ? AND webhook_id = ?", did, wid).Take(&d).Error
+	if err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return &WebhookDelivery{}, ErrDeliveryNotFound
+		}
+		return &WebhookDelivery{}, err
+	}
+	return d, nil
+}
+
+// RecordAttempt stores the outcome of an attempt. A failed attempt is
+// retried at next, or given up on when next is zero.
+func (d *WebhookDelivery) RecordAttempt(db *gorm.DB, code int, attemptErr error, next time.Time) error {
+	now := time.Now()
+	d.Attempts++
+	d.LastStatusCode = code
+	d.LastError = ""
+	d.UpdatedAt = now
+	switch {
+	case attemptErr == nil:
+		d.Status = DeliverySucceeded
+		d.DeliveredAt = &now
+	case next.IsZero():
+		d.Status = DeliveryFailed
+	default:
+		d.Status = DeliveryPending
+		d.NextAttemptAt = next
+	}
+	if attemptErr != nil {
+		d.LastError = attemptErr.Error()
+		if len(d.LastError) > 1000 {
+			d.LastError = d.LastError[:1000]
+		}
+	}
+	return db.Model(&WebhookDelivery{}).Where("id = ?", d.ID).UpdateColumns(
+		map[string]interface{}{
+			"status":           d.Status,
+			"attempts":         d.Attempts,
+			"next_attempt_at":  d.NextAttemptAt,
+			"last_status_code": d.LastStatusCode,
+			"last_error":       d.LastError,
+			"delivered_at":     d.DeliveredAt,
+			"updated_at":       d.UpdatedAt,
+		},
+	).Error
+}
+
+// Redeliver queues the delivery's payload again as a new delivery, the
+// original stays in the log untouched.
+func (d *WebhookDelivery) Redeliver(db *gorm.DB) (*WebhookDelivery, error) {
+	now := time.Now()
+	delivery := WebhookDelivery{
+		WebhookID:     d.WebhookID,
+		Event:         d.Event,
+		Payload:       d.Payload,
+		Status:        DeliveryPending,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	err := db.Model(&WebhookDelivery{}).Create(&delivery).Error
+	if err != nil {
+		return &WebhookDelivery{}, err
+	}
+	return &delivery, nil
+}
@@ -0,0 +1,31 @@
+package models
+
+import "github.com/task/api/apierror"
+
+// The errors of the models, coded with what the API answers them with.
+// Callers tell them apart with errors.Is. Validation errors are made with
+// apierror.Required and apierror.Invalid where they happen.
+var (
+	ErrUserNotFound           = apierror.New(apierror.UserNotFound, "User Not Found")
+	ErrSellerNotFound         = apierror.New(apierror.SellerNotFound, "Seller Not Found")
+	ErrProductNotFound        = apierror.New(apierror.ProductNotFound, "Product not found")
+	ErrVariantNotFound        = apierror.New(apierror.VariantNotFound, "Variant Not Found")
+	ErrCategoryNotFound       = apierror.New(apierror.CategoryNotFound, "Category Not Found")
+	ErrParentCategoryNotFound = apierror.New(apierror.CategoryNotFound, "Parent Category Not Found")
+	ErrImageNotFound          = apierror.New(apierror.ImageNotFound, "Image Not Found")
+	ErrNotificationNotFound   = apierror.New(apierror.NotificationNotFound, "Notification Not Found")
+	ErrSubscriptionNotFound   = apierror.New(apierror.SubscriptionNotFound, "Subscription Not Found")
+	ErrWebhookNotFound        = apierror.New(apierror.WebhookNotFound, "Webhook Not Found")
+	ErrDeliveryNotFound       = apierror.New(apierror.DeliveryNotFound, "Delivery Not Found")
+	ErrUsernameTaken          = apierror.New(apierror.UsernameTaken, "Username Already Taken")
+	ErrEmailTaken             = apierror.New(apierror.EmailTaken, "Email Already Taken")
+	ErrProductNameTaken       = apierror.New(apierror.ProductNameTaken, "Product Name Already Taken")
+	ErrSellerDeleted          = apierror.New(apierror.SellerDeleted, "Seller Is Deleted")
+	ErrVariantsExist          = apierror.New(apierror.VariantsExist, "Delete Variants Before Changing Options")
+	ErrVariantRequired        = apierror.New(apierror.VariantRequired, "Required Variant id")
+	ErrInsufficientStock      = apierror.New(apierror.InsufficientStock, "not enough qty on stock")
+	ErrInsufficientBalance    = apierror.New(apierror.InsufficientBalance, "there is not enough balance to buy")
+	ErrInvalidParentCategory  = apierror.Invalid("parent_id", "Invalid Parent Category")
+	ErrNoOptions              = apierror.New(apierror.InvalidRequest, "Product Has No Options")
+	ErrIncompleteVariant      = apierror.Invalid("options", "Variant Must Set Every Option")
+)
@@ -0,0 +1,54 @@
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+)
+
+// Mailer sends one plain text email.
+type Mailer interface {
+	Send(to, subject, body string) error
+}
+
+// EmailNotifier mails the notification to the user's address.
+type EmailNotifier struct {
+	Mailer Mailer
+}
+
+func (e *EmailNotifier) Notify(n Notification) error {
+	if n.Email == "" {
+		return nil
+	}
+	return e.Mailer.Send(n.Email, n.Title, n.Message)
+}
+
+// SMTPMailer sends through an SMTP relay, authenticating when a username is set.
+type SMTPMailer struct {
+	Addr     string
+	From     string
+	Username string
+	Password string
+}
+
+func (m *SMTPMailer) Send(to, subject, body string) error {
+	if m.Addr == "" {
+		return errors.New("SMTP_ADDR is not configured")
+	}
+	// refuse header injection through the subject or the address
+	if strings.ContainsAny(to+subject, "\r\n") {
+		return errors.New("invalid email header")
+	}
+	var auth smtp.Auth
+	if m.Username != "" {
+		host, _, err := net.SplitHostPort(m.Addr)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", m.Username, m.Password, host)
+	}
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n%s\r\n", m.From, to, subject, body)
+	return smtp.SendMail(m.Addr, auth, m.From, []string{to}, []byte(msg))
+}
@@ -0,0 +1,26 @@
+package notify
+
+import (
+	"github.com/jinzhu/gorm"
+	"github.com/task/api/models"
+)
+
+// InboxNotifier stores notifications for GET /notifications.
+type InboxNotifier struct {
+	DB *gorm.DB
+}
+
+func (i *InboxNotifier) Notify(n Notification) error {
+	notification := models.Notification{
+		UserID:    n.UserID,
+		Type:      n.Type,
+		ProductID: n.ProductID,
+		VariantID: n.VariantID,
+		Title:     n.Title,
+		Message:   n.Message,
+		CreatedAt: n.CreatedAt,
+		EventID:   n.EventID,
+	}
+	_, err := notification.SaveNotification(i.DB)
+	return err
+}
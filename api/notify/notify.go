@@ -0,0 +1,86 @@
+package notify
+
+import (
+	"errors"
+	"time"
+
+	"github.com/task/api/config"
+)
+
+// Notification types.
+const (
+	LowStock    = "low_stock"
+	OutOfStock  = "out_of_stock"
+	BackInStock = "back_in_stock"
+)
+
+// Notification is what every channel delivers. Email is only used to
+// address the message and never leaves through other channels. EventID is
+// the event the notification is for, when there is one.
+type Notification struct {
+	UserID    uint32    `json:"user_id"`
+	Email     string    `json:"-"`
+	Type      string    `json:"type"`
+	ProductID uint64    `json:"product_id"`
+	VariantID *uint64   `json:"variant_id,omitempty"`
+	Title     string    `json:"title"`
+	Message   string    `json:"message"`
+	CreatedAt time.Time `json:"created_at"`
+	EventID   *uint64   `json:"event_id,omitempty"`
+}
+
+// Notifier delivers notifications through one channel.
+type Notifier interface {
+	Notify(n Notification) error
+}
+
+// Multi fans a notification out to several channels. Every channel is tried
+// even if an earlier one fails; the first error is returned.
+type Multi []Notifier
+
+func (m Multi) Notify(n Notification) error {
+	var first error
+	for _, notifier := range m {
+		if err := notifier.Notify(n); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// Discard drops every notification.
+type Discard struct{}
+
+func (Discard) Notify(n Notification) error { return nil }
+
+// New builds the channels listed in NOTIFY_CHANNELS ("inbox", "email",
+// "webhook"). The inbox is created by the caller because it needs the
+// database.
+func New(cfg config.Notify, inbox Notifier) (Notifier, error) {
+	channels := cfg.Channels
+	if len(channels) == 0 {
+		channels = []string{"inbox"}
+	}
+	multi := Multi{}
+	for _, channel := range channels {
+		switch channel {
+		case "inbox":
+			multi = append(multi, inbox)
+		case "email":
+			multi = append(multi, &EmailNotifier{Mailer: &SMTPMailer{
+				Addr:     cfg.SMTPAddr,
+				From:     cfg.SMTPFrom,
+				Username: cfg.SMTPUsername,
+				Password: cfg.SMTPPassword.Value(),
+			}})
+		case "webhook":
+			if cfg.WebhookURL == "" {
+				return nil, errors.New("NOTIFY_WEBHOOK_URL is required for the webhook channel")
+			}
+			multi = append(multi, &WebhookNotifier{URL: cfg.WebhookURL})
+		default:
+			return nil, errors.New("unknown notification channel " + channel)
+		}
+	}
+	return multi, nil
+}
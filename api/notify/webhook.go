@@ -0,0 +1,35 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// WebhookNotifier posts the notification as JSON to a fixed URL.
+type WebhookNotifier struct {
+	URL    string
+	Client *http.Client
+}
+
+func (wh *WebhookNotifier) Notify(n Notification) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	client := wh.Client
+	if client == nil {
+		client = &http.Client{Timeout: 5 * time.Second}
+	}
+	resp, err := client.Post(wh.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("notification webhook answered %s", resp.Status)
+	}
+	return nil
+}
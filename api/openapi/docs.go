@@ -0,0 +1,15 @@
+package openapi
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+//go:embed docs.html
+var docs []byte
+
+// Docs answers the documentation page, which reads /openapi.json.
+func Docs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(docs)
+}
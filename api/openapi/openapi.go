@@ -0,0 +1,243 @@
+// Package openapi builds the OpenAPI 3 document of the API from its router
+// and checks requests and responses against it. The schemas are generated
+// from the Go types the handlers read and write, with the rules of their
+// validate tags, so they change when the code does.
+package openapi
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/gorilla/mux"
+	"github.com/task/api/responses"
+)
+
+// Version is the OpenAPI version of the documents.
+const Version = "3.0.3"
+
+// The security schemes of the routes with Auth: the token as a bearer token
+// or in the token query parameter.
+const (
+	BearerAuth = "bearerAuth"
+	QueryAuth  = "queryAuth"
+)
+
+// Operation documents a route.
+type Operation struct {
+	ID          string
+	Tag         string
+	Summary     string
+	Description string
+	Deprecated  bool
+	// Auth is set for the routes that need a token.
+	Auth    bool
+	Query   []Param
+	Headers []Param
+	// Request is a value of the type of the body, nil for no body.
+	// RequestType is its media type, application/json when empty.
+	Request      interface{}
+	RequestType  string
+	OptionalBody bool
+	// Response is a value of the type of the body answered with Status, nil
+	// for no body. ResponseType is its media type, application/json when
+	// empty.
+	Status       int
+	Response     interface{}
+	ResponseType string
+	// Others are the bodies of the other statuses answered with something
+	// else than a problem, in ResponseType.
+	Others map[int]interface{}
+}
+
+// Param is a query parameter.
+type Param struct {
+	Name        string
+	Description string
+	// Value is a value of the type of the parameter, a slice for the ones
+	// that may be repeated.
+	Value interface{}
+}
+
+// Describe returns the operation of a route by its method and path
+// template, false for a route it does not know.
+type Describe func(method, path string) (Operation, bool)
+
+// pathParam matches the parameters of a path template, with their pattern.
+var pathParam = regexp.MustCompile(`\{([^}:]+)(:[^}]*)?\}`)
+
+// Build documents every route of router with the operation describe returns
+// for it. A route describe does not know is an error, so the document can
+// not miss a route. The problems with their codes are answered by every
+// operation, as the default response.
+func Build(info openapi3.Info, router *mux.Router, describe Describe) (*openapi3.T, error) {
+
+	doc := &openapi3.T{
+		OpenAPI: Version,
+		Info:    &info,
+		Paths:   openapi3.Paths{},
+		Servers: openapi3.Servers{{URL: "/"}},
+		Components: openapi3.Components{
+			SecuritySchemes: openapi3.SecuritySchemes{
+				BearerAuth: &openapi3.SecuritySchemeRef{Value: openapi3.NewJWTSecurityScheme()},
+				QueryAuth: &openapi3.SecuritySchemeRef{Value: &openapi3.SecurityScheme{
+					Type: "apiKey",
+					In:   "query",
+					Name: "token",
+				}},
+			},
+		},
+	}
+	schemas := newSchemas()
+	problem, err := schemas.of(responses.Problem{}, false)
+	if err != nil {
+		return nil, err
+	}
+
+	tags := map[string]bool{}
+	err = router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		template, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			// a prefix of other routes
+			return nil
+		}
+		for _, method := range methods {
+			operation, ok := describe(method, template)
+			if !ok {
+				return fmt.Errorf("%s %s is not documented", method, template)
+			}
+			path := pathParam.ReplaceAllString(template, "{$1}")
+			item := doc.Paths[path]
+			if item == nil {
+				item = &openapi3.PathItem{}
+				doc.Paths[path] = item
+			}
+			if item.GetOperation(method) != nil {
+				return fmt.Errorf("%s %s is documented twice", method, path)
+			}
+			op, err := operation.build(schemas, path, problem)
+			if err != nil {
+				return fmt.Errorf("%s %s: %v", method, path, err)
+			}
+			item.SetOperation(method, op)
+			tags[operation.Tag] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	doc.Components.Schemas = schemas.components
+
+	names := []string{}
+	for tag := range tags {
+		if tag != "" {
+			names = append(names, tag)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		doc.Tags = append(doc.Tags, &openapi3.Tag{Name: name})
+	}
+
+	if err := doc.Validate(context.Background()); err != nil {
+		return nil, fmt.Errorf("invalid document: %v", err)
+	}
+	return doc, nil
+}
+
+// build is the operation of o on path.
+func (o Operation) build(schemas *schemas, path string, problem *openapi3.SchemaRef) (*openapi3.Operation, error) {
+
+	op := &openapi3.Operation{
+		OperationID: o.ID,
+		Summary:     o.Summary,
+		Description: o.Description,
+		Deprecated:  o.Deprecated,
+		Responses:   openapi3.Responses{},
+	}
+	if o.Tag != "" {
+		op.Tags = []string{o.Tag}
+	}
+	if o.Auth {
+		op.Security = openapi3.NewSecurityRequirements().
+			With(openapi3.NewSecurityRequirement().Authenticate(BearerAuth)).
+			With(openapi3.NewSecurityRequirement().Authenticate(QueryAuth))
+	}
+
+	for _, match := range pathParam.FindAllStringSubmatch(path, -1) {
+		name := match[1]
+		schema := openapi3.NewStringSchema()
+		// ids are numbers, the other parameters like image keys are not
+		if name == "id" || strings.HasSuffix(name, "_id") {
+			schema = openapi3.NewInt64Schema().WithMin(1)
+		}
+		op.Parameters = append(op.Parameters, &openapi3.ParameterRef{Value: openapi3.NewPathParameter(name).WithSchema(schema)})
+	}
+	for _, param := range o.Query {
+		schema, err := schemas.of(param.Value, true)
+		if err != nil {
+			return nil, err
+		}
+		schema.Value.Nullable = false
+		parameter := openapi3.NewQueryParameter(param.Name).WithDescription(param.Description)
+		parameter.Schema = schema
+		op.Parameters = append(op.Parameters, &openapi3.ParameterRef{Value: parameter})
+	}
+	for _, param := range o.Headers {
+		schema, err := schemas.of(param.Value, true)
+		if err != nil {
+			return nil, err
+		}
+		schema.Value.Nullable = false
+		parameter := openapi3.NewHeaderParameter(param.Name).WithDescription(param.Description)
+		parameter.Schema = schema
+		op.Parameters = append(op.Parameters, &openapi3.ParameterRef{Value: parameter})
+	}
+
+	if o.Request != nil {
+		schema, err := schemas.of(o.Request, true)
+		if err != nil {
+			return nil, err
+		}
+		body := openapi3.NewRequestBody().
+			WithRequired(!o.OptionalBody).
+			WithContent(openapi3.NewContentWithSchemaRef(schema, []string{mediaType(o.RequestType)}))
+		op.RequestBody = &openapi3.RequestBodyRef{Value: body}
+	}
+
+	bodies := map[int]interface{}{o.Status: o.Response}
+	for status, body := range o.Others {
+		bodies[status] = body
+	}
+	for status, body := range bodies {
+		response := openapi3.NewResponse().WithDescription(http.StatusText(status))
+		if body != nil {
+			schema, err := schemas.of(body, false)
+			if err != nil {
+				return nil, err
+			}
+			response.WithContent(openapi3.NewContentWithSchemaRef(schema, []string{mediaType(o.ResponseType)}))
+		}
+		op.Responses[fmt.Sprint(status)] = &openapi3.ResponseRef{Value: response}
+	}
+	op.Responses["default"] = &openapi3.ResponseRef{Value: openapi3.NewResponse().
+		WithDescription("A problem, see /problems for the codes").
+		WithContent(openapi3.NewContentWithSchemaRef(problem, []string{"application/problem+json"}))}
+	return op, nil
+}
+
+func mediaType(t string) string {
+	if t == "" {
+		return "application/json"
+	}
+	return t
+}
@@ -0,0 +1,275 @@
+package openapi
+
+import (
+	"fmt"
+	"go/token"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// File is a file sent in a multipart form or answered as it is.
+type File []byte
+
+// suffixes tell apart the types of the same name in different packages, a
+// requests.Category is a CategoryRequest and a resources.Product a ProductV2.
+var suffixes = map[string]string{
+	"github.com/task/api/requests":  "Request",
+	"github.com/task/api/resources": "V2",
+}
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+	fileType = reflect.TypeOf(File{})
+)
+
+// schemas turns Go types into schemas the way encoding/json writes them.
+// Named structs become components, anonymous and unexported ones are
+// inlined.
+type schemas struct {
+	components openapi3.Schemas
+	types      map[string]reflect.Type
+}
+
+func newSchemas() *schemas {
+	return &schemas{components: openapi3.Schemas{}, types: map[string]reflect.Type{}}
+}
+
+// of returns the schema of the type of v, nil for a nil v. The rules of the
+// validate tags apply to requests; every field a response always has is
+// required.
+func (s *schemas) of(v interface{}, request bool) (*openapi3.SchemaRef, error) {
+	if v == nil {
+		return nil, nil
+	}
+	return s.ref(reflect.TypeOf(v), request)
+}
+
+func (s *schemas) ref(t reflect.Type, request bool) (*openapi3.SchemaRef, error) {
+	switch {
+	case t == timeType:
+		return openapi3.NewSchemaRef("", openapi3.NewDateTimeSchema()), nil
+	case t == fileType:
+		return openapi3.NewSchemaRef("", openapi3.NewStringSchema().WithFormat("binary")), nil
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		ref, err := s.ref(t.Elem(), request)
+		if err != nil {
+			return nil, err
+		}
+		return nullable(ref), nil
+	case reflect.Struct:
+		name := s.name(t)
+		if name == "" {
+			schema, err := s.object(t, request)
+			if err != nil {
+				return nil, err
+			}
+			return openapi3.NewSchemaRef("", schema), nil
+		}
+		if other, ok := s.types[name]; ok {
+			if other != t {
+				return nil, fmt.Errorf("%s and %s are both named %s", other, t, name)
+			}
+			return openapi3.NewSchemaRef("#/components/schemas/"+name, s.components[name].Value), nil
+		}
+		// the component is there before its fields, for the types that
+		// refer to themselves
+		s.types[name] = t
+		s.components[name] = openapi3.NewSchemaRef("", openapi3.NewObjectSchema())
+		schema, err := s.object(t, request)
+		if err != nil {
+			return nil, err
+		}
+		*s.components[name].Value = *schema
+		return openapi3.NewSchemaRef("#/components/schemas/"+name, s.components[name].Value), nil
+	case reflect.Slice, reflect.Array:
+		items, err := s.ref(t.Elem(), request)
+		if err != nil {
+			return nil, err
+		}
+		schema := openapi3.NewArraySchema()
+		schema.Items = items
+		// encoding/json writes a nil slice as null
+		schema.Nullable = t.Kind() == reflect.Slice
+		return openapi3.NewSchemaRef("", schema), nil
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("%s has keys that are not strings", t)
+		}
+		values, err := s.ref(t.Elem(), request)
+		if err != nil {
+			return nil, err
+		}
+		schema := openapi3.NewObjectSchema()
+		schema.AdditionalProperties = values
+		schema.Nullable = true
+		return openapi3.NewSchemaRef("", schema), nil
+	case reflect.Interface:
+		return openapi3.NewSchemaRef("", openapi3.NewSchema()), nil
+	case reflect.String:
+		return openapi3.NewSchemaRef("", openapi3.NewStringSchema()), nil
+	case reflect.Bool:
+		return openapi3.NewSchemaRef("", openapi3.NewBoolSchema()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32:
+		return openapi3.NewSchemaRef("", openapi3.NewIntegerSchema()), nil
+	case reflect.Int64:
+		return openapi3.NewSchemaRef("", openapi3.NewInt64Schema()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return openapi3.NewSchemaRef("", openapi3.NewIntegerSchema().WithMin(0)), nil
+	case reflect.Uint64:
+		return openapi3.NewSchemaRef("", openapi3.NewInt64Schema().WithMin(0)), nil
+	case reflect.Float32:
+		return openapi3.NewSchemaRef("", openapi3.NewFloat64Schema().WithFormat("float")), nil
+	case reflect.Float64:
+		return openapi3.NewSchemaRef("", openapi3.NewFloat64Schema()), nil
+	}
+	return nil, fmt.Errorf("%s has no schema", t)
+}
+
+// name is the component name of t, empty for the types that are inlined.
+func (s *schemas) name(t reflect.Type) string {
+	if t.Name() == "" || !token.IsExported(t.Name()) {
+		return ""
+	}
+	return t.Name() + suffixes[t.PkgPath()]
+}
+
+// object is the schema of the struct t, with the fields encoding/json
+// writes.
+func (s *schemas) object(t reflect.Type, request bool) (*openapi3.Schema, error) {
+	schema := openapi3.NewObjectSchema()
+	schema.Properties = openapi3.Schemas{}
+	if request {
+		// validation.Decode rejects the fields a payload does not have
+		no := false
+		schema.AdditionalPropertiesAllowed = &no
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		name, options := f.Name, ""
+		if tag, ok := f.Tag.Lookup("json"); ok {
+			if tag == "-" {
+				continue
+			}
+			name, options = tag, ""
+			if i := strings.Index(tag, ","); i >= 0 {
+				name, options = tag[:i], tag[i+1:]
+			}
+			if name == "" {
+				name = f.Name
+			}
+		}
+		property, err := s.ref(f.Type, request)
+		if err != nil {
+			return nil, fmt.Errorf("%s.%s: %v", t, f.Name, err)
+		}
+		required := !request && !strings.Contains(options, "omitempty")
+		if request {
+			property, required, err = rules(property, f.Tag.Get("validate"))
+			if err != nil {
+				return nil, fmt.Errorf("%s.%s: %v", t, f.Name, err)
+			}
+		}
+		schema.Properties[name] = property
+		if required {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+	return schema, nil
+}
+
+// nullable is ref accepting null too. A $ref cannot have siblings, so a
+// component is wrapped in allOf.
+func nullable(ref *openapi3.SchemaRef) *openapi3.SchemaRef {
+	if ref.Ref == "" {
+		ref.Value.Nullable = true
+		return ref
+	}
+	schema := openapi3.NewAllOfSchema()
+	schema.AllOf = openapi3.SchemaRefs{ref}
+	schema.Nullable = true
+	return openapi3.NewSchemaRef("", schema)
+}
+
+// rules adds the rules of a validate tag to property and reports whether
+// the field is required. The rules after dive are the rules of the items.
+func rules(property *openapi3.SchemaRef, tag string) (*openapi3.SchemaRef, bool, error) {
+	if tag == "" || property.Ref != "" {
+		return property, strings.Contains(","+tag+",", ",required,"), nil
+	}
+	required := false
+	schema := property.Value
+	for _, rule := range strings.Split(tag, ",") {
+		name, param := rule, ""
+		if i := strings.Index(rule, "="); i >= 0 {
+			name, param = rule[:i], rule[i+1:]
+		}
+		switch name {
+		case "dive":
+			if schema.Items == nil || schema.Items.Ref != "" {
+				return property, required, nil
+			}
+			schema = schema.Items.Value
+			continue
+		case "required":
+			if schema == property.Value {
+				required = true
+			}
+			if schema.Type == openapi3.TypeString && schema.MinLength == 0 {
+				schema.MinLength = 1
+			}
+		case "min", "max":
+			n, err := strconv.ParseFloat(param, 64)
+			if err != nil {
+				return nil, false, fmt.Errorf("invalid rule %s", rule)
+			}
+			limit(schema, name, n)
+		case "oneof":
+			for _, value := range strings.Fields(param) {
+				schema.Enum = append(schema.Enum, value)
+			}
+		case "email":
+			schema.Format = "email"
+		case "url":
+			schema.Format = "uri"
+		default:
+			return nil, false, fmt.Errorf("unknown rule %s", rule)
+		}
+	}
+	return property, required, nil
+}
+
+// limit sets the bound min or max of schema to n: the value of numbers, the
+// length of strings and the items of arrays.
+func limit(schema *openapi3.Schema, bound string, n float64) {
+	switch schema.Type {
+	case openapi3.TypeString:
+		if bound == "min" {
+			schema.MinLength = uint64(n)
+		} else {
+			max := uint64(n)
+			schema.MaxLength = &max
+		}
+	case openapi3.TypeArray:
+		if bound == "min" {
+			schema.MinItems = uint64(n)
+		} else {
+			max := uint64(n)
+			schema.MaxItems = &max
+		}
+	default:
+		if bound == "min" {
+			schema.Min = &n
+		} else {
+			schema.Max = &n
+		}
+	}
+}
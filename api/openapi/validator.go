@@ -0,0 +1,302 @@
+package openapi
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"github.com/task/api/apierror"
+	"github.com/task/api/logging"
+	"github.com/task/api/responses"
+	"github.com/task/api/validation"
+)
+
+// Options are what Validate checks.
+type Options struct {
+	// Requests are answered with a problem when they do not match the
+	// document, before their handler runs.
+	Requests bool
+	// Responses that do not match the document are logged and replaced by
+	// an internal_error problem. They are buffered to be checked, which is
+	// meant for tests.
+	Responses bool
+	// BodyMaxBytes is the largest JSON body checked, 1MB when zero. The
+	// handlers refuse the larger ones themselves.
+	BodyMaxBytes int64
+	// Log logs the responses that do not match, when the request has no
+	// logger of its own.
+	Log logrus.FieldLogger
+}
+
+// Validate checks the requests and responses of the routes of doc. It must
+// run on the router doc was built from, after the route is matched; routes
+// doc does not have are let through. Only JSON bodies are checked, the
+// images, streams and WebSockets are not.
+func Validate(doc *openapi3.T, options Options) func(http.Handler) http.Handler {
+	if options.BodyMaxBytes <= 0 {
+		options.BodyMaxBytes = validation.DefaultMaxBytes
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route := findRoute(doc, r)
+			if route == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			input := &openapi3filter.RequestValidationInput{
+				Request:    r,
+				PathParams: mux.Vars(r),
+				Route:      route,
+				Options: &openapi3filter.Options{
+					MultiError:            true,
+					IncludeResponseStatus: true,
+					// the handlers check the tokens
+					AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+				},
+			}
+			if options.Requests {
+				if err := validateRequest(r, input, options.BodyMaxBytes); err != nil {
+					responses.ERROR(w, http.StatusBadRequest, err)
+					return
+				}
+			}
+			if !options.Responses || !answersJSON(route.Operation) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			buffer := &buffer{ResponseWriter: w}
+			next.ServeHTTP(buffer, r)
+			if buffer.status == 0 {
+				buffer.status = http.StatusOK
+			}
+			err := openapi3filter.ValidateResponse(r.Context(), &openapi3filter.ResponseValidationInput{
+				RequestValidationInput: input,
+				Status:                 buffer.status,
+				Header:                 w.Header(),
+				Body:                   ioutil.NopCloser(bytes.NewReader(buffer.body.Bytes())),
+				Options:                input.Options,
+			})
+			if err != nil {
+				logger(r, options.Log).WithError(err).Errorf("%s %s answered %d, which does not match the OpenAPI document", r.Method, route.Path, buffer.status)
+				w.Header().Del("Location")
+				responses.ERROR(w, http.StatusInternalServerError, apierror.New(apierror.Internal, "Response Does Not Match The OpenAPI Document: "+err.Error()))
+				return
+			}
+			w.WriteHeader(buffer.status)
+			w.Write(buffer.body.Bytes())
+		})
+	}
+}
+
+// findRoute returns the route of doc the router matched r with, nil when
+// doc does not have it.
+func findRoute(doc *openapi3.T, r *http.Request) *routers.Route {
+	current := mux.CurrentRoute(r)
+	if current == nil {
+		return nil
+	}
+	template, err := current.GetPathTemplate()
+	if err != nil {
+		return nil
+	}
+	path := pathParam.ReplaceAllString(template, "{$1}")
+	item := doc.Paths[path]
+	if item == nil || item.GetOperation(r.Method) == nil {
+		return nil
+	}
+	return &routers.Route{Spec: doc, Path: path, PathItem: item, Method: r.Method, Operation: item.GetOperation(r.Method)}
+}
+
+// validateRequest checks the parameters of r and its body when it is JSON,
+// which is read and put back for the handler. A body without a
+// Content-Type is JSON, as it is to validation.Decode.
+func validateRequest(r *http.Request, input *openapi3filter.RequestValidationInput, limit int64) error {
+
+	options := *input.Options
+	check := *input
+	check.Options = &options
+
+	contentType := r.Header.Get("Content-Type")
+	if r.Body == nil || contentType != "" && !isJSON(contentType) {
+		options.ExcludeRequestBody = true
+		return problem(openapi3filter.ValidateRequest(r.Context(), &check))
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, limit+1))
+	if err != nil {
+		return apierror.New(apierror.BadRequest, "Cannot Read Body")
+	}
+	r.Body = ioutil.NopCloser(io.MultiReader(bytes.NewReader(body), r.Body))
+	// an empty body is an empty object to the handlers, which tell what it
+	// misses better
+	if int64(len(body)) > limit || len(bytes.TrimSpace(body)) == 0 {
+		options.ExcludeRequestBody = true
+		return problem(openapi3filter.ValidateRequest(r.Context(), &check))
+	}
+	check.Request = r.Clone(r.Context())
+	check.Request.Header.Set("Content-Type", "application/json")
+	check.Request.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return problem(openapi3filter.ValidateRequest(r.Context(), &check))
+}
+
+func isJSON(contentType string) bool {
+	media, _, err := mime.ParseMediaType(contentType)
+	return err == nil && (media == "application/json" || strings.HasSuffix(media, "+json"))
+}
+
+// answersJSON reports whether op answers a JSON body when it succeeds.
+func answersJSON(op *openapi3.Operation) bool {
+	for status, response := range op.Responses {
+		if !strings.HasPrefix(status, "2") || response.Value == nil {
+			continue
+		}
+		for media := range response.Value.Content {
+			if isJSON(media) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// unsupported is the reason of a property a schema does not have.
+var unsupported = regexp.MustCompile(`^property "(.*)" is unsupported$`)
+
+// problem is the error answered for the validation errors of a request: the
+// fields of the body that do not match, or the first parameter that does
+// not.
+func problem(err error) error {
+	if err == nil {
+		return nil
+	}
+	fields := []apierror.FieldError{}
+	var first error
+	fail := func(err error) {
+		if first == nil {
+			first = err
+		}
+	}
+	var visit func(err error)
+	visit = func(err error) {
+		switch e := err.(type) {
+		case openapi3.MultiError:
+			for _, err := range e {
+				visit(err)
+			}
+		case *openapi3filter.RequestError:
+			switch e.Err.(type) {
+			case *openapi3.SchemaError, openapi3.MultiError:
+				if e.RequestBody != nil {
+					visit(e.Err)
+					return
+				}
+			}
+			switch {
+			case e.Parameter != nil:
+				fail(apierror.New(apierror.BadRequest, "Invalid "+e.Parameter.Name))
+			case e.RequestBody != nil:
+				fail(apierror.New(apierror.BadRequest, "Malformed JSON"))
+			default:
+				fail(apierror.New(apierror.BadRequest, e.Error()))
+			}
+		case *openapi3.SchemaError:
+			fields = append(fields, fieldError(e))
+		default:
+			fail(apierror.New(apierror.BadRequest, err.Error()))
+		}
+	}
+	visit(err)
+	if len(fields) > 0 {
+		sort.SliceStable(fields, func(i, j int) bool { return fields[i].Field < fields[j].Field })
+		return apierror.Validation(fields...)
+	}
+	if first == nil {
+		first = apierror.New(apierror.BadRequest, err.Error())
+	}
+	return first
+}
+
+// fieldError is a field of the body that does not match its schema, in the
+// words of validation.Struct.
+func fieldError(e *openapi3.SchemaError) apierror.FieldError {
+	field := ""
+	for _, key := range e.JSONPointer() {
+		field = join(field, key)
+	}
+	switch e.SchemaField {
+	case "required":
+		return apierror.FieldError{Field: field, Code: "required", Message: "Required " + field}
+	case "properties":
+		if match := unsupported.FindStringSubmatch(e.Reason); match != nil {
+			return apierror.FieldError{Field: join(field, match[1]), Code: "unknown", Message: "Unknown Field " + match[1]}
+		}
+	case "type":
+		return apierror.FieldError{Field: field, Code: "type", Message: "Invalid " + field + ", Expected " + e.Schema.Type}
+	}
+	code := e.SchemaField
+	switch code {
+	case "minimum", "minLength", "minItems":
+		code = "min"
+	case "maximum", "maxLength", "maxItems":
+		code = "max"
+	case "format":
+		code = e.Schema.Format
+		if code == "uri" {
+			code = "url"
+		}
+	}
+	return apierror.FieldError{Field: field, Code: code, Message: "Invalid " + field + ", " + e.Reason}
+}
+
+// join adds key to the path of a field, indexes in brackets.
+func join(field, key string) string {
+	if _, err := strconv.Atoi(key); err == nil {
+		return field + "[" + key + "]"
+	}
+	if field == "" {
+		return key
+	}
+	return field + "." + key
+}
+
+func logger(r *http.Request, log logrus.FieldLogger) logrus.FieldLogger {
+	if requestLog, ok := logging.FromContext(r.Context()); ok {
+		return requestLog
+	}
+	if log != nil {
+		return log
+	}
+	return logrus.StandardLogger()
+}
+
+// buffer holds a response back until it is checked. The headers are the
+// ones of the ResponseWriter.
+type buffer struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (b *buffer) WriteHeader(status int) {
+	if b.status == 0 {
+		b.status = status
+	}
+}
+
+func (b *buffer) Write(p []byte) (int, error) {
+	if b.status == 0 {
+		b.status = http.StatusOK
+	}
+	return b.body.Write(p)
+}
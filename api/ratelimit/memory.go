@@ -0,0 +1,62 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	// full is when the bucket has refilled, it can be forgotten from then on.
+	full time.Time
+}
+
+// Memory keeps the buckets in the process. Buckets that have refilled are
+// dropped once a minute, a full bucket is the same as none.
+type Memory struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	sweep   time.Time
+}
+
+func NewMemory() *Memory {
+	return &Memory{buckets: map[string]*bucket{}}
+}
+
+func (m *Memory) Take(key string, limit Limit, now time.Time) (Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if now.After(m.sweep) {
+		for k, b := range m.buckets {
+			if !now.Before(b.full) {
+				delete(m.buckets, k)
+			}
+		}
+		m.sweep = now.Add(time.Minute)
+	}
+
+	capacity := float64(limit.Requests)
+	perToken := limit.Period / time.Duration(limit.Requests)
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: capacity, last: now}
+		m.buckets[key] = b
+	}
+	b.tokens = math.Min(capacity, b.tokens+float64(now.Sub(b.last))/float64(perToken))
+	b.last = now
+
+	result := Result{Limit: limit.Requests}
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = time.Duration((1 - b.tokens) * float64(perToken))
+	}
+	result.Remaining = int(b.tokens)
+	result.Reset = time.Duration((capacity - b.tokens) * float64(perToken))
+	b.full = now.Add(result.Reset)
+	return result, nil
+}
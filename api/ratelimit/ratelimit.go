@@ -0,0 +1,171 @@
+// Package ratelimit limits how often a client calls the API with token
+// buckets: a limit of N/period lets a client make N requests at once, then
+// one more every period/N. Clients are told apart by user id when they send a
+// valid token and by IP address otherwise.
+package ratelimit
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/task/api/auth"
+	"github.com/task/api/config"
+)
+
+// The route groups, each with buckets of its own.
+const (
+	Default = "default"
+	Login   = "login"
+	Signup  = "signup"
+	Buy     = "buy"
+)
+
+// Limit is a number of requests per period, no limit when Requests is 0.
+type Limit struct {
+	Requests int
+	Period   time.Duration
+}
+
+// Parse reads a limit written N/period, e.g. 5/1m, or off.
+func Parse(s string) (Limit, error) {
+	if s == "" || s == "off" {
+		return Limit{}, nil
+	}
+	parts := strings.SplitN(s, "/", 2)
+	if len(parts) != 2 {
+		return Limit{}, fmt.Errorf("invalid rate limit %q, use requests/period like 5/1m", s)
+	}
+	requests, err := strconv.Atoi(parts[0])
+	if err != nil || requests < 1 {
+		return Limit{}, fmt.Errorf("invalid rate limit %q, the requests must be a positive number", s)
+	}
+	period, err := time.ParseDuration(parts[1])
+	if err != nil || period <= 0 {
+		return Limit{}, fmt.Errorf("invalid rate limit %q, the period must be a positive duration", s)
+	}
+	return Limit{Requests: requests, Period: period}, nil
+}
+
+func (l Limit) Off() bool { return l.Requests == 0 }
+
+// Result is the state of a bucket after taking a token from it.
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is when the bucket is full again, RetryAfter when the next
+	// request is allowed.
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+// Store keeps the buckets. Memory is enough for one instance of the server;
+// instances behind a load balancer need a shared Store, e.g. on Redis, or
+// every instance allows the full limit.
+type Store interface {
+	// Take takes a token from the bucket of key if it has one.
+	Take(key string, limit Limit, now time.Time) (Result, error)
+}
+
+// Limiter applies the limit of a route group to the requests of a client.
+type Limiter struct {
+	Store  Store
+	Limits map[string]Limit
+	// Trusted are the proxies whose X-Forwarded-For and X-Real-IP headers
+	// tell the client address.
+	Trusted []*net.IPNet
+}
+
+// New builds the limiter configured by cfg on store.
+func New(cfg config.RateLimit, store Store) (*Limiter, error) {
+	limiter := &Limiter{Store: store, Limits: map[string]Limit{}}
+	for group, raw := range map[string]string{Default: cfg.Default, Login: cfg.Login, Signup: cfg.Signup, Buy: cfg.Buy} {
+		limit, err := Parse(raw)
+		if err != nil {
+			return nil, err
+		}
+		limiter.Limits[group] = limit
+	}
+	for _, proxy := range cfg.TrustedProxies {
+		if !strings.Contains(proxy, "/") {
+			if strings.Contains(proxy, ":") {
+				proxy += "/128"
+			} else {
+				proxy += "/32"
+			}
+		}
+		_, network, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q", proxy)
+		}
+		limiter.Trusted = append(limiter.Trusted, network)
+	}
+	return limiter, nil
+}
+
+// Allow takes a token of the client of r from the buckets of group. Requests
+// of a group without a limit are allowed with a zero Result.Limit.
+func (l *Limiter) Allow(group string, r *http.Request) (Result, error) {
+	limit := l.Limits[group]
+	if limit.Off() {
+		return Result{Allowed: true}, nil
+	}
+	return l.Store.Take(group+":"+l.Client(r), limit, time.Now())
+}
+
+// Client is the key of the client of r, user:<id> for a valid token and
+// ip:<address> otherwise.
+func (l *Limiter) Client(r *http.Request) string {
+	if auth.ExtractToken(r) != "" {
+		if uid, err := auth.ExtractTokenID(r); err == nil && uid != 0 {
+			return "user:" + strconv.FormatUint(uint64(uid), 10)
+		}
+	}
+	return "ip:" + l.ClientIP(r)
+}
+
+// ClientIP is the address of the client of r. Forwarded headers are only
+// believed from trusted proxies, and X-Forwarded-For is read from the right,
+// skipping the trusted proxies, since a client can put anything on its left.
+func (l *Limiter) ClientIP(r *http.Request) string {
+	remote, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		remote = r.RemoteAddr
+	}
+	if !l.trusted(remote) {
+		return remote
+	}
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		hops := strings.Split(forwarded, ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			if net.ParseIP(hop) == nil {
+				break
+			}
+			if !l.trusted(hop) {
+				return hop
+			}
+		}
+	}
+	if real := strings.TrimSpace(r.Header.Get("X-Real-IP")); net.ParseIP(real) != nil {
+		return real
+	}
+	return remote
+}
+
+func (l *Limiter) trusted(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, network := range l.Trusted {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
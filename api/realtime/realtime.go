@@ -0,0 +1,195 @@
+// Package realtime fans product changes out to streaming clients (SSE and
+// WebSocket). The Hub subscribes to the domain event bus; updates carry the
+// outbox event id so clients can resume after a reconnect, see Replay.
+package realtime
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/jinzhu/gorm"
+	"github.com/task/api/events"
+	"github.com/task/api/models"
+	"github.com/task/api/resources"
+)
+
+// Types are the domain events streamed to clients.
+var Types = []string{models.EventProductCreated, models.EventProductUpdated, models.EventProductDeleted, models.EventStockChanged}
+
+// Update is one change of one product as sent to clients.
+type Update struct {
+	ID        uint64          `json:"id"`
+	Type      string          `json:"type"`
+	ProductID uint64          `json:"product_id"`
+	SellerID  uint32          `json:"seller_id"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// FromEvent turns a domain event into an update, false for events that are
+// not about a product. Created and updated products are sent as their public
+// resource, the recorded payload has the seller's email and deposit.
+func FromEvent(e events.Event) (Update, bool) {
+	var ref struct {
+		ID        uint64 `json:"id"`
+		ProductID uint64 `json:"product_id"`
+	}
+	data := e.Payload
+	switch e.Type {
+	case models.EventProductCreated, models.EventProductUpdated:
+		product := models.Product{}
+		if e.Decode(&product) != nil {
+			return Update{}, false
+		}
+		public, err := json.Marshal(resources.NewProduct(&product))
+		if err != nil {
+			return Update{}, false
+		}
+		ref.ProductID, data = product.ID, public
+	case models.EventProductDeleted:
+		if e.Decode(&ref) != nil {
+			return Update{}, false
+		}
+		ref.ProductID = ref.ID
+	case models.EventStockChanged:
+		if e.Decode(&ref) != nil {
+			return Update{}, false
+		}
+	default:
+		return Update{}, false
+	}
+	return Update{ID: e.ID, Type: e.Type, ProductID: ref.ProductID, SellerID: e.SellerID, Data: data}, true
+}
+
+// Filter selects the products a client follows: the listed products and
+// every product of the listed sellers.
+type Filter struct {
+	ProductIDs []uint64 `json:"product_ids"`
+	SellerIDs  []uint32 `json:"seller_ids"`
+}
+
+func (f Filter) Empty() bool {
+	return len(f.ProductIDs) == 0 && len(f.SellerIDs) == 0
+}
+
+func (f Filter) Match(u Update) bool {
+	for _, pid := range f.ProductIDs {
+		if pid == u.ProductID {
+			return true
+		}
+	}
+	for _, sid := range f.SellerIDs {
+		if sid == u.SellerID {
+			return true
+		}
+	}
+	return false
+}
+
+// Subscription receives the updates matching its filter on C. A client too
+// slow to keep up is dropped: C is closed and it has to reconnect, resuming
+// from the last update it saw.
+type Subscription struct {
+	C      chan Update
+	filter Filter
+}
+
+type Hub struct {
+	mu     sync.Mutex
+	subs   map[*Subscription]struct{}
+	closed bool
+}
+
+func NewHub() *Hub {
+	return &Hub{subs: map[*Subscription]struct{}{}}
+}
+
+func (h *Hub) Subscribe(f Filter) *Subscription {
+	s := &Subscription{C: make(chan Update, 64), filter: f}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		close(s.C)
+		return s
+	}
+	h.subs[s] = struct{}{}
+	return s
+}
+
+// Close ends every subscription, and the ones made afterwards, so the
+// streams return and their clients reconnect elsewhere.
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for s := range h.subs {
+		delete(h.subs, s)
+		close(s.C)
+	}
+}
+
+// Unsubscribe stops and closes the subscription, it is safe to call twice.
+func (h *Hub) Unsubscribe(s *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.subs[s]; ok {
+		delete(h.subs, s)
+		close(s.C)
+	}
+}
+
+// Handle is the event bus handler, subscribe it to Types.
+func (h *Hub) Handle(e events.Event) error {
+	u, ok := FromEvent(e)
+	if !ok {
+		return nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for s := range h.subs {
+		if !s.filter.Match(u) {
+			continue
+		}
+		select {
+		case s.C <- u:
+		default:
+			delete(h.subs, s)
+			close(s.C)
+		}
+	}
+	return nil
+}
+
+// Replay returns up to limit updates matching f that were recorded after
+// the event afterID, from the outbox. Published events are kept there until
+// they are purged. Events that failed maxAttempts times are never published
+// and are skipped; the replay stops at the first one still pending.
+func Replay(db *gorm.DB, afterID uint64, f Filter, limit, maxAttempts int) ([]Update, error) {
+	updates := []Update{}
+	for {
+		recorded, err := models.FindEventsAfter(db, afterID, Types, 500)
+		if err != nil {
+			return nil, err
+		}
+		for i := range *recorded {
+			o := &(*recorded)[i]
+			afterID = o.ID
+			if o.PublishedAt == nil {
+				if o.Attempts >= maxAttempts {
+					continue
+				}
+				// not live yet, it will come through the hub
+				return updates, nil
+			}
+			u, ok := FromEvent(events.Event{ID: o.ID, Type: o.Type, SellerID: o.SellerID, Payload: json.RawMessage(o.Payload)})
+			if ok && f.Match(u) {
+				updates = append(updates, u)
+				if len(updates) == limit {
+					return updates, nil
+				}
+			}
+		}
+		if len(*recorded) < 500 {
+			return updates, nil
+		}
+	}
+}
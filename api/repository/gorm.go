@@ -0,0 +1,157 @@
+package repository
+
+import (
+	"github.com/jinzhu/gorm"
+	"github.com/task/api/models"
+)
+
+// translate turns what the model methods return into the errors of this
+// package, gorm's record not found becoming notFound.
+func translate(err error, notFound error) error {
+	if gorm.IsRecordNotFoundError(err) {
+		return notFound
+	}
+	return conflict(err)
+}
+
+type GormUsers struct {
+	DB *gorm.DB
+}
+
+func (r *GormUsers) Create(user *models.User) (*models.User, error) {
+	created, err := user.SaveUser(r.DB)
+	if err != nil {
+		return nil, translate(err, ErrUserNotFound)
+	}
+	return created, nil
+}
+
+func (r *GormUsers) FindByID(id uint32) (*models.User, error) {
+	user := models.User{}
+	found, err := user.FindUserByID(r.DB, id)
+	if err != nil {
+		return nil, translate(err, ErrUserNotFound)
+	}
+	return found, nil
+}
+
+func (r *GormUsers) FindByEmail(email string) (*models.User, error) {
+	user := models.User{}
+	found, err := user.FindUserByEmail(r.DB, email)
+	if err != nil {
+		return nil, translate(err, ErrUserNotFound)
+	}
+	return found, nil
+}
+
+func (r *GormUsers) List(includeDeleted bool) ([]models.User, error) {
+	db := r.DB
+	if includeDeleted {
+		db = db.Unscoped()
+	}
+	user := models.User{}
+	users, err := user.FindAllUsers(db)
+	if err != nil {
+		return nil, err
+	}
+	return *users, nil
+}
+
+func (r *GormUsers) Update(id uint32, user *models.User) (*models.User, error) {
+	updated, err := user.UpdateAUser(r.DB, id)
+	if err != nil {
+		return nil, translate(err, ErrUserNotFound)
+	}
+	return updated, nil
+}
+
+func (r *GormUsers) Delete(id uint32) error {
+	user := models.User{}
+	_, err := user.DeleteAUser(r.DB, id)
+	if err != nil {
+		return translate(err, ErrUserNotFound)
+	}
+	return nil
+}
+
+func (r *GormUsers) Restore(id uint32) (*models.User, error) {
+	user := models.User{}
+	restored, err := user.RestoreAUser(r.DB, id)
+	if err != nil {
+		return nil, translate(err, ErrUserNotFound)
+	}
+	return restored, nil
+}
+
+type GormProducts struct {
+	DB *gorm.DB
+}
+
+func (r *GormProducts) Create(product *models.Product) (*models.Product, error) {
+	err := r.DB.Model(&models.User{}).Where("id = ?", product.SellerID).Take(&models.User{}).Error
+	if err != nil {
+		return nil, translate(err, ErrSellerNotFound)
+	}
+	created, err := product.SaveProduct(r.DB)
+	if err != nil {
+		return nil, translate(err, ErrProductNotFound)
+	}
+	return created, nil
+}
+
+func (r *GormProducts) FindByID(id uint64) (*models.Product, error) {
+	product := models.Product{}
+	found, err := product.FindProductByID(r.DB, id)
+	if err != nil {
+		return nil, translate(err, ErrProductNotFound)
+	}
+	return found, nil
+}
+
+func (r *GormProducts) List(includeDeleted bool) ([]models.Product, error) {
+	return r.ListPage(models.FirstPage, includeDeleted)
+}
+
+func (r *GormProducts) ListPage(page models.Page, includeDeleted bool) ([]models.Product, error) {
+	db := r.DB
+	if includeDeleted {
+		db = db.Unscoped()
+	}
+	product := models.Product{}
+	products, err := product.FindProductsPage(db, page)
+	if err != nil {
+		return nil, err
+	}
+	return *products, nil
+}
+
+func (r *GormProducts) Update(product *models.Product) (*models.Product, error) {
+	current, err := r.FindByID(product.ID)
+	if err != nil {
+		return nil, err
+	}
+	product.SellerID = current.SellerID
+	_, err = product.UpdateAProduct(r.DB)
+	if err != nil {
+		return nil, translate(err, ErrProductNotFound)
+	}
+	return r.FindByID(product.ID)
+}
+
+func (r *GormProducts) Delete(id uint64, sellerID uint32) error {
+	product := models.Product{}
+	_, err := product.DeleteAProduct(r.DB, id, sellerID)
+	if err != nil {
+		return translate(err, ErrProductNotFound)
+	}
+	return nil
+}
+
+func (r *GormProducts) Restore(id uint64, sellerID uint32) (*models.Product, error) {
+	product := models.Product{}
+	restored, err := product.RestoreAProduct(r.DB, id, sellerID)
+	if err != nil {
+		return nil, translate(err, ErrProductNotFound)
+	}
+	return restored, nil
+}
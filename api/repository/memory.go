@@ -0,0 +1,339 @@
+package repository
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/task/api/models"
+)
+
+// Memory keeps users and products in maps. It has no categories, so products
+// naming any get ErrCategoryNotFound.
+type Memory struct {
+	mu          sync.Mutex
+	users       map[uint32]*models.User
+	products    map[uint64]*models.Product
+	tags        map[string]models.Tag
+	nextUser    uint32
+	nextProduct uint64
+	nextTag     uint32
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		users:    map[uint32]*models.User{},
+		products: map[uint64]*models.Product{},
+		tags:     map[string]models.Tag{},
+	}
+}
+
+func (m *Memory) Users() UserRepository { return memoryUsers{m} }
+
+func (m *Memory) Products() ProductRepository { return memoryProducts{m} }
+
+type memoryUsers struct{ m *Memory }
+
+// liveUser returns the user unless it is missing or soft deleted.
+func (m *Memory) liveUser(id uint32) (*models.User, bool) {
+	user, ok := m.users[id]
+	if !ok || user.DeletedAt != nil {
+		return nil, false
+	}
+	return user, true
+}
+
+// taken checks the unique columns against every other user, the soft
+// deleted ones included as in the database.
+func (m *Memory) taken(id uint32, username, email string) error {
+	for _, other := range m.users {
+		if other.ID == id {
+			continue
+		}
+		if other.Username == username {
+			return ErrUsernameTaken
+		}
+		if other.Email == email {
+			return ErrEmailTaken
+		}
+	}
+	return nil
+}
+
+func (r memoryUsers) Create(user *models.User) (*models.User, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if err := r.m.taken(0, user.Username, user.Email); err != nil {
+		return nil, err
+	}
+	if err := user.BeforeSave(); err != nil {
+		return nil, err
+	}
+	r.m.nextUser++
+	user.ID = r.m.nextUser
+	now := time.Now()
+	user.CreatedAt, user.UpdatedAt, user.DeletedAt = now, now, nil
+	stored := *user
+	r.m.users[user.ID] = &stored
+	return user, nil
+}
+
+func (r memoryUsers) FindByID(id uint32) (*models.User, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	user, ok := r.m.liveUser(id)
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	found := *user
+	return &found, nil
+}
+
+func (r memoryUsers) FindByEmail(email string) (*models.User, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	for _, user := range r.m.users {
+		if user.Email == email && user.DeletedAt == nil {
+			found := *user
+			return &found, nil
+		}
+	}
+	return nil, ErrUserNotFound
+}
+
+func (r memoryUsers) List(includeDeleted bool) ([]models.User, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	users := []models.User{}
+	for _, user := range r.m.users {
+		if user.DeletedAt == nil || includeDeleted {
+			users = append(users, *user)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	if len(users) > 100 {
+		users = users[:100]
+	}
+	return users, nil
+}
+
+func (r memoryUsers) Update(id uint32, user *models.User) (*models.User, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	stored, ok := r.m.liveUser(id)
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	for _, other := range r.m.users {
+		if other.ID != id && other.Username == user.Username {
+			return nil, ErrUsernameTaken
+		}
+	}
+	stored.Username = user.Username
+	stored.Deposit = user.Deposit
+	stored.UpdatedAt = time.Now()
+	updated := *stored
+	return &updated, nil
+}
+
+func (r memoryUsers) Delete(id uint32) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	user, ok := r.m.liveUser(id)
+	if !ok {
+		return ErrUserNotFound
+	}
+	now := time.Now().Truncate(time.Second)
+	user.DeletedAt = &now
+	for _, product := range r.m.products {
+		if product.SellerID == id && product.DeletedAt == nil {
+			deletedAt := now
+			product.DeletedAt = &deletedAt
+		}
+	}
+	return nil
+}
+
+func (r memoryUsers) Restore(id uint32) (*models.User, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	user, ok := r.m.users[id]
+	if !ok || user.DeletedAt == nil {
+		return nil, ErrUserNotFound
+	}
+	// only the products that went away with the user come back
+	for _, product := range r.m.products {
+		if product.SellerID == id && product.DeletedAt != nil && product.DeletedAt.Equal(*user.DeletedAt) {
+			product.DeletedAt = nil
+		}
+	}
+	user.DeletedAt = nil
+	restored := *user
+	return &restored, nil
+}
+
+type memoryProducts struct{ m *Memory }
+
+// resolve applies the categories and tags of a product the way
+// Product.SaveProduct does, a nil slice leaving them unchanged.
+func (m *Memory) resolve(product *models.Product, stored *models.Product) error {
+	if len(product.CategoryIDs) > 0 {
+		return ErrCategoryNotFound
+	}
+	if product.CategoryIDs != nil {
+		stored.Categories = []models.Category{}
+	}
+	if product.TagNames != nil {
+		tags := []models.Tag{}
+		seen := map[string]bool{}
+		for _, name := range product.TagNames {
+			name = models.NormalizeTagName(name)
+			if name == "" || seen[name] {
+				continue
+			}
+			seen[name] = true
+			tag, ok := m.tags[name]
+			if !ok {
+				m.nextTag++
+				tag = models.Tag{ID: m.nextTag, Name: name}
+				m.tags[name] = tag
+			}
+			tags = append(tags, tag)
+		}
+		sort.Slice(tags, func(i, j int) bool { return tags[i].ID < tags[j].ID })
+		stored.Tags = tags
+	}
+	return nil
+}
+
+// view copies a stored product and fills in its seller.
+func (m *Memory) view(product *models.Product) *models.Product {
+	found := *product
+	found.Categories = append([]models.Category{}, product.Categories...)
+	found.Tags = append([]models.Tag{}, product.Tags...)
+	found.Images = []models.ProductImage{}
+	found.Options = []models.ProductOption{}
+	found.Variants = []models.ProductVariant{}
+	found.CategoryIDs, found.TagNames = nil, nil
+	if seller, ok := m.users[product.SellerID]; ok {
+		found.Seller = *seller
+	}
+	return &found
+}
+
+func (m *Memory) productNameTaken(id uint64, name string) bool {
+	for _, other := range m.products {
+		if other.ID != id && other.ProductName == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (r memoryProducts) Create(product *models.Product) (*models.Product, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if _, ok := r.m.liveUser(product.SellerID); !ok {
+		return nil, ErrSellerNotFound
+	}
+	if r.m.productNameTaken(0, product.ProductName) {
+		return nil, ErrProductNameTaken
+	}
+	stored := models.Product{
+		ProductName:       product.ProductName,
+		AmountAvailable:   product.AmountAvailable,
+		SellerID:          product.SellerID,
+		Price:             product.Price,
+		LowStockThreshold: product.LowStockThreshold,
+		Categories:        []models.Category{},
+		Tags:              []models.Tag{},
+	}
+	if err := r.m.resolve(product, &stored); err != nil {
+		return nil, err
+	}
+	r.m.nextProduct++
+	stored.ID = r.m.nextProduct
+	now := time.Now()
+	stored.CreatedAt, stored.UpdatedAt = now, now
+	r.m.products[stored.ID] = &stored
+	return r.m.view(&stored), nil
+}
+
+func (r memoryProducts) FindByID(id uint64) (*models.Product, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	product, ok := r.m.products[id]
+	if !ok || product.DeletedAt != nil {
+		return nil, ErrProductNotFound
+	}
+	return r.m.view(product), nil
+}
+
+func (r memoryProducts) List(includeDeleted bool) ([]models.Product, error) {
+	return r.ListPage(models.FirstPage, includeDeleted)
+}
+
+func (r memoryProducts) ListPage(page models.Page, includeDeleted bool) ([]models.Product, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	products := []models.Product{}
+	for _, product := range r.m.products {
+		if product.ID > page.After && (product.DeletedAt == nil || includeDeleted) {
+			products = append(products, *r.m.view(product))
+		}
+	}
+	sort.Slice(products, func(i, j int) bool { return products[i].ID < products[j].ID })
+	if len(products) > page.Limit {
+		products = products[:page.Limit]
+	}
+	return products, nil
+}
+
+func (r memoryProducts) Update(product *models.Product) (*models.Product, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	stored, ok := r.m.products[product.ID]
+	if !ok || stored.DeletedAt != nil {
+		return nil, ErrProductNotFound
+	}
+	if r.m.productNameTaken(product.ID, product.ProductName) {
+		return nil, ErrProductNameTaken
+	}
+	updated := *stored
+	if err := r.m.resolve(product, &updated); err != nil {
+		return nil, err
+	}
+	updated.ProductName = product.ProductName
+	updated.AmountAvailable = product.AmountAvailable
+	updated.LowStockThreshold = product.LowStockThreshold
+	updated.UpdatedAt = time.Now()
+	*stored = updated
+	return r.m.view(stored), nil
+}
+
+func (r memoryProducts) Delete(id uint64, sellerID uint32) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	product, ok := r.m.products[id]
+	if !ok || product.DeletedAt != nil || product.SellerID != sellerID {
+		return ErrProductNotFound
+	}
+	now := time.Now()
+	product.DeletedAt = &now
+	return nil
+}
+
+func (r memoryProducts) Restore(id uint64, sellerID uint32) (*models.Product, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	product, ok := r.m.products[id]
+	if !ok || product.DeletedAt == nil || product.SellerID != sellerID {
+		return nil, ErrProductNotFound
+	}
+	// a product can not come back while its seller is deleted
+	if _, ok := r.m.liveUser(sellerID); !ok {
+		return nil, ErrSellerDeleted
+	}
+	product.DeletedAt = nil
+	return r.m.view(product), nil
+}
@@ -0,0 +1,76 @@
+// Package repository puts the user and product storage behind interfaces so
+// handlers and tests do not need a database. The GORM implementations wrap
+// the model methods; Memory keeps everything in maps with the same
+// semantics: unique usernames, emails and product names, soft deletes, and
+// the errors below for missing rows.
+//
+// Writes that have to commit together with an outbox event still run on the
+// *gorm.DB transaction, see models.Transaction, so a server on the memory
+// store only serves the handlers that read users and products.
+package repository
+
+import (
+	"github.com/task/api/dberror"
+	"github.com/task/api/models"
+)
+
+// The errors of the repositories are the ones of the models, so callers
+// match either with errors.Is.
+var (
+	ErrUserNotFound     = models.ErrUserNotFound
+	ErrProductNotFound  = models.ErrProductNotFound
+	ErrSellerNotFound   = models.ErrSellerNotFound
+	ErrSellerDeleted    = models.ErrSellerDeleted
+	ErrCategoryNotFound = models.ErrCategoryNotFound
+	ErrUsernameTaken    = models.ErrUsernameTaken
+	ErrEmailTaken       = models.ErrEmailTaken
+	ErrProductNameTaken = models.ErrProductNameTaken
+)
+
+type UserRepository interface {
+	// Create stores a new user, hashing the password.
+	Create(user *models.User) (*models.User, error)
+	FindByID(id uint32) (*models.User, error)
+	FindByEmail(email string) (*models.User, error)
+	// List returns up to 100 users, the soft deleted ones too when asked.
+	List(includeDeleted bool) ([]models.User, error)
+	// Update changes the username and the deposit.
+	Update(id uint32, user *models.User) (*models.User, error)
+	// Delete soft deletes the user together with the products they sell.
+	Delete(id uint32) error
+	Restore(id uint32) (*models.User, error)
+}
+
+type ProductRepository interface {
+	// Create stores a new product of an existing seller.
+	Create(product *models.Product) (*models.Product, error)
+	FindByID(id uint64) (*models.Product, error)
+	// List returns up to 100 products, the soft deleted ones too when asked.
+	List(includeDeleted bool) ([]models.Product, error)
+	// ListPage returns the products of page in the order of their ids.
+	ListPage(page models.Page, includeDeleted bool) ([]models.Product, error)
+	// Update changes the name, stock and low stock threshold of a product,
+	// and its categories and tags when CategoryIDs or TagNames are set.
+	Update(product *models.Product) (*models.Product, error)
+	// Delete soft deletes a product of the seller.
+	Delete(id uint64, sellerID uint32) error
+	Restore(id uint64, sellerID uint32) (*models.Product, error)
+}
+
+// conflict turns a unique constraint violation of any driver into the
+// matching error.
+func conflict(err error) error {
+	violation, ok := dberror.Classify(err)
+	if !ok || violation.Kind != dberror.Unique || len(violation.Columns) != 1 {
+		return err
+	}
+	switch violation.Columns[0] {
+	case "username":
+		return ErrUsernameTaken
+	case "email":
+		return ErrEmailTaken
+	case "product_name":
+		return ErrProductNameTaken
+	}
+	return err
+}
@@ -0,0 +1,163 @@
+// Package requests has the payloads the API accepts, with the rules
+// validation.Decode checks them against. Fields a payload does not list are
+// rejected, so a misspelt field is an error instead of a missing value.
+package requests
+
+import "github.com/task/api/apierror"
+
+// Login is the body of POST /login.
+type Login struct {
+	Email    string `json:"email" validate:"required,email"`
+	Password string `json:"password" validate:"required"`
+}
+
+// NewUser is the body of POST /users.
+type NewUser struct {
+	Username string `json:"username" validate:"required,max=255"`
+	Email    string `json:"email" validate:"required,max=100,email"`
+	// bcrypt ignores everything after 72 bytes
+	Password string  `json:"password" validate:"required,min=6,max=72"`
+	Role     string  `json:"role" validate:"required,oneof=buyer seller"`
+	Deposit  float32 `json:"deposit" validate:"min=0"`
+}
+
+// UserUpdate is the body of PUT /users/{id}.
+type UserUpdate struct {
+	Username string  `json:"username" validate:"required,max=255"`
+	Deposit  float32 `json:"deposit" validate:"required,min=1"`
+}
+
+// NewProduct is the body of POST /products. SellerID must be the seller
+// signed in.
+type NewProduct struct {
+	ProductName       string   `json:"proudct_name" validate:"required,max=255"`
+	AmountAvailable   float32  `json:"amount_available" validate:"required,min=1"`
+	SellerID          uint32   `json:"seller_id" validate:"required"`
+	Price             float32  `json:"price" validate:"required,min=1"`
+	LowStockThreshold float32  `json:"low_stock_threshold" validate:"min=0"`
+	CategoryIDs       []uint32 `json:"category_ids" validate:"dive,required"`
+	TagNames          []string `json:"tag_names" validate:"max=20,dive,required,max=100"`
+}
+
+// ProductUpdate is the body of PUT /products/{id}. The seller and price of a
+// product do not change, SellerID and Price are accepted for the clients
+// that send the product back as they got it.
+type ProductUpdate struct {
+	ProductName       string   `json:"proudct_name" validate:"required,max=255"`
+	AmountAvailable   float32  `json:"amount_available" validate:"required,min=1"`
+	SellerID          uint32   `json:"seller_id"`
+	Price             float32  `json:"price"`
+	LowStockThreshold float32  `json:"low_stock_threshold" validate:"min=0"`
+	CategoryIDs       []uint32 `json:"category_ids" validate:"dive,required"`
+	TagNames          []string `json:"tag_names" validate:"max=20,dive,required,max=100"`
+}
+
+// Buy is the body of POST /buy. A product with variants is bought through
+// VariantID or SKU, ID alone is only enough for products without variants.
+type Buy struct {
+	ID        uint64  `json:"id"`
+	VariantID uint64  `json:"variant_id"`
+	SKU       string  `json:"sku" validate:"max=100"`
+	Qty       float32 `json:"qty" validate:"required,min=1"`
+}
+
+// Check requires one of id, variant_id and sku.
+func (b *Buy) Check() []apierror.FieldError {
+	if b.ID < 1 && b.VariantID < 1 && b.SKU == "" {
+		return []apierror.FieldError{{Field: "id", Code: "required", Message: "Required Product id"}}
+	}
+	return nil
+}
+
+// NewProductV2 is the body of POST /v2/products, whose seller is the one
+// signed in.
+type NewProductV2 struct {
+	ProductName       string   `json:"product_name" validate:"required,max=255"`
+	AmountAvailable   float32  `json:"amount_available" validate:"required,min=1"`
+	Price             float32  `json:"price" validate:"required,min=1"`
+	LowStockThreshold float32  `json:"low_stock_threshold" validate:"min=0"`
+	CategoryIDs       []uint32 `json:"category_ids" validate:"dive,required"`
+	TagNames          []string `json:"tag_names" validate:"max=20,dive,required,max=100"`
+}
+
+// ProductUpdateV2 is the body of PUT /v2/products/{id}.
+type ProductUpdateV2 struct {
+	ProductName       string   `json:"product_name" validate:"required,max=255"`
+	AmountAvailable   float32  `json:"amount_available" validate:"required,min=1"`
+	LowStockThreshold float32  `json:"low_stock_threshold" validate:"min=0"`
+	CategoryIDs       []uint32 `json:"category_ids" validate:"dive,required"`
+	TagNames          []string `json:"tag_names" validate:"max=20,dive,required,max=100"`
+}
+
+// BuyV2 is the body of POST /v2/buy, Buy with the product in product_id.
+type BuyV2 struct {
+	ProductID uint64  `json:"product_id"`
+	VariantID uint64  `json:"variant_id"`
+	SKU       string  `json:"sku" validate:"max=100"`
+	Qty       float32 `json:"qty" validate:"required,min=1"`
+}
+
+// Check requires one of product_id, variant_id and sku.
+func (b *BuyV2) Check() []apierror.FieldError {
+	if b.ProductID < 1 && b.VariantID < 1 && b.SKU == "" {
+		return []apierror.FieldError{{Field: "product_id", Code: "required", Message: "Required Product id"}}
+	}
+	return nil
+}
+
+// Category is the body of POST and PUT /categories.
+type Category struct {
+	Name     string  `json:"name" validate:"required,max=255"`
+	ParentID *uint32 `json:"parent_id"`
+}
+
+// StockAdjustment is the body of POST /products/{id}/stock-adjustments.
+type StockAdjustment struct {
+	VariantID *uint64 `json:"variant_id"`
+	Reason    string  `json:"reason" validate:"required,oneof=restock correction refund_restock reservation"`
+	Quantity  float32 `json:"quantity" validate:"required"`
+	Note      string  `json:"note" validate:"max=255"`
+}
+
+// ProductOption is an axis of PUT /products/{id}/options, whose body is a
+// list of them.
+type ProductOption struct {
+	Name   string   `json:"name" validate:"required,max=100"`
+	Values []string `json:"values" validate:"required,dive,required,max=100"`
+}
+
+// Variant is the body of POST and PUT /products/{id}/variants.
+type Variant struct {
+	SKU             string            `json:"sku" validate:"required,max=100"`
+	Options         map[string]string `json:"options"`
+	AmountAvailable float32           `json:"amount_available" validate:"min=0"`
+	Price           *float32          `json:"price" validate:"min=1"`
+}
+
+// ImageOrder is the body of PUT /products/{id}/images.
+type ImageOrder struct {
+	ImageIDs []uint64 `json:"image_ids" validate:"required,dive,required"`
+}
+
+// RestockSubscription is the optional body of POST and DELETE
+// /products/{id}/restock-subscriptions.
+type RestockSubscription struct {
+	VariantID *uint64 `json:"variant_id"`
+}
+
+// NewWebhook is the body of POST /webhooks, the secret is generated when
+// left out.
+type NewWebhook struct {
+	URL    string   `json:"url" validate:"required,max=2000,url"`
+	Events []string `json:"events" validate:"required,dive,oneof=user.created deposit.changed product.created product.updated product.deleted purchase.completed stock.changed"`
+	Secret string   `json:"secret" validate:"max=100"`
+	Active *bool    `json:"active"`
+}
+
+// WebhookUpdate is the body of PUT /webhooks/{id}, the fields left out keep
+// their value.
+type WebhookUpdate struct {
+	URL    *string  `json:"url" validate:"max=2000,url"`
+	Events []string `json:"events" validate:"dive,oneof=user.created deposit.changed product.created product.updated product.deleted purchase.completed stock.changed"`
+	Active *bool    `json:"active"`
+}
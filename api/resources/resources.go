@@ -0,0 +1,141 @@
+// Package resources has the bodies of the /v2 responses. They are built from
+// the models instead of serialising them, so the schema can change without
+// the API changing with it.
+package resources
+
+import (
+	"time"
+
+	"github.com/task/api/models"
+)
+
+// Seller is the user selling a product, without their email and deposit.
+type Seller struct {
+	ID       uint32 `json:"id"`
+	Username string `json:"username"`
+}
+
+// Category is a category a product is listed in.
+type Category struct {
+	ID       uint32  `json:"id"`
+	Name     string  `json:"name"`
+	ParentID *uint32 `json:"parent_id"`
+}
+
+// Image is a picture of a product.
+type Image struct {
+	ID           uint64 `json:"id"`
+	Position     int    `json:"position"`
+	URL          string `json:"url"`
+	ThumbnailURL string `json:"thumbnail_url"`
+	ContentType  string `json:"content_type"`
+	Size         int64  `json:"size"`
+	Width        int    `json:"width"`
+	Height       int    `json:"height"`
+}
+
+// Option is an axis the variants of a product differ in, like size.
+type Option struct {
+	Name     string   `json:"name"`
+	Position int      `json:"position"`
+	Values   []string `json:"values"`
+}
+
+// Variant is a combination of option values with its own stock. Price is
+// what a unit costs, the price of the product unless the variant has one.
+type Variant struct {
+	ID              uint64            `json:"id"`
+	SKU             string            `json:"sku"`
+	Options         map[string]string `json:"options"`
+	AmountAvailable float32           `json:"amount_available"`
+	Price           float32           `json:"price"`
+}
+
+// Product is a product with everything shown alongside it.
+type Product struct {
+	ID                uint64     `json:"id"`
+	ProductName       string     `json:"product_name"`
+	AmountAvailable   float32    `json:"amount_available"`
+	Price             float32    `json:"price"`
+	LowStockThreshold float32    `json:"low_stock_threshold"`
+	Seller            Seller     `json:"seller"`
+	Categories        []Category `json:"categories"`
+	Tags              []string   `json:"tags"`
+	Images            []Image    `json:"images"`
+	Options           []Option   `json:"options"`
+	Variants          []Variant  `json:"variants"`
+	CreatedAt         time.Time  `json:"created_at"`
+	UpdatedAt         time.Time  `json:"updated_at"`
+	DeletedAt         *time.Time `json:"deleted_at,omitempty"`
+}
+
+// NewProduct is the resource of p.
+func NewProduct(p *models.Product) Product {
+	product := Product{
+		ID:                p.ID,
+		ProductName:       p.ProductName,
+		AmountAvailable:   p.AmountAvailable,
+		Price:             p.Price,
+		LowStockThreshold: p.LowStockThreshold,
+		Seller:            Seller{ID: p.SellerID, Username: p.Seller.Username},
+		Categories:        make([]Category, 0, len(p.Categories)),
+		Tags:              make([]string, 0, len(p.Tags)),
+		Images:            make([]Image, 0, len(p.Images)),
+		Options:           make([]Option, 0, len(p.Options)),
+		Variants:          make([]Variant, 0, len(p.Variants)),
+		CreatedAt:         p.CreatedAt,
+		UpdatedAt:         p.UpdatedAt,
+		DeletedAt:         p.DeletedAt,
+	}
+	for _, c := range p.Categories {
+		product.Categories = append(product.Categories, Category{ID: c.ID, Name: c.Name, ParentID: c.ParentID})
+	}
+	for _, t := range p.Tags {
+		product.Tags = append(product.Tags, t.Name)
+	}
+	for _, i := range p.Images {
+		product.Images = append(product.Images, Image{
+			ID:           i.ID,
+			Position:     i.Position,
+			URL:          i.URL,
+			ThumbnailURL: i.ThumbnailURL,
+			ContentType:  i.ContentType,
+			Size:         i.Size,
+			Width:        i.Width,
+			Height:       i.Height,
+		})
+	}
+	for _, o := range p.Options {
+		product.Options = append(product.Options, Option{Name: o.Name, Position: o.Position, Values: o.Values})
+	}
+	for _, v := range p.Variants {
+		product.Variants = append(product.Variants, Variant{
+			ID:              v.ID,
+			SKU:             v.SKU,
+			Options:         v.Options,
+			AmountAvailable: v.AmountAvailable,
+			Price:           v.UnitPrice(p),
+		})
+	}
+	return product
+}
+
+// NewProducts is the resource of every product of ps.
+func NewProducts(ps []models.Product) []Product {
+	products := make([]Product, 0, len(ps))
+	for i := range ps {
+		products = append(products, NewProduct(&ps[i]))
+	}
+	return products
+}
+
+// Purchase is the outcome of POST /v2/buy. Deposit is what the buyer has
+// left.
+type Purchase struct {
+	ProductID uint64  `json:"product_id"`
+	VariantID *uint64 `json:"variant_id"`
+	Qty       float32 `json:"qty"`
+	UnitPrice float32 `json:"unit_price"`
+	Total     float32 `json:"total"`
+	Deposit   float32 `json:"deposit"`
+}
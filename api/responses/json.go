@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+
+	"github.com/task/api/apierror"
 )
 
 func JSON(w http.ResponseWriter, statusCode int, data interface{}) {
@@ -14,14 +16,28 @@ func JSON(w http.ResponseWriter, statusCode int, data interface{}) {
 	}
 }
 
+// Problem is the RFC 7807 body of an error response.
+type Problem struct {
+	Type   string                `json:"type"`
+	Title  string                `json:"title"`
+	Status int                   `json:"status"`
+	Detail string                `json:"detail,omitempty"`
+	Code   string                `json:"code"`
+	Errors []apierror.FieldError `json:"errors,omitempty"`
+}
+
+// ERROR answers with err as an application/problem+json problem. statusCode
+// is the status of errors without a code of their own, see apierror.From.
 func ERROR(w http.ResponseWriter, statusCode int, err error) {
-	if err != nil {
-		JSON(w, statusCode, struct {
-			Error string `json:"error"`
-		}{
-			Error: err.Error(),
-		})
-		return
-	}
-	JSON(w, http.StatusBadRequest, nil)
+	e := apierror.From(statusCode, err)
+	entry, _ := apierror.Lookup(e.Code)
+	w.Header().Set("Content-Type", "application/problem+json")
+	JSON(w, e.Status, Problem{
+		Type:   "/problems/" + e.Code,
+		Title:  entry.Title,
+		Status: e.Status,
+		Detail: e.Detail,
+		Code:   e.Code,
+		Errors: e.Fields,
+	})
 }
@@ -0,0 +1,104 @@
+package seed
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/jinzhu/gorm"
+	"github.com/task/api/models"
+)
+
+// Fixture is the JSON document LoadFixture reads. Products name their seller
+// by email and their categories and tags by name, so a fixture does not
+// depend on the ids the database hands out.
+type Fixture struct {
+	Users []struct {
+		Username string  `json:"username"`
+		Email    string  `json:"email"`
+		Password string  `json:"password"`
+		Role     string  `json:"role"`
+		Deposit  float32 `json:"deposit"`
+	} `json:"users"`
+	Categories []struct {
+		Name   string `json:"name"`
+		Parent string `json:"parent"`
+	} `json:"categories"`
+	Products []struct {
+		ProductName       string   `json:"product_name"`
+		AmountAvailable   float32  `json:"amount_available"`
+		Price             float32  `json:"price"`
+		LowStockThreshold float32  `json:"low_stock_threshold"`
+		Seller            string   `json:"seller"`
+		Categories        []string `json:"categories"`
+		Tags              []string `json:"tags"`
+	} `json:"products"`
+}
+
+// LoadFixture inserts the users, categories and products of a fixture file
+// in one transaction. Categories must come after their parent.
+func LoadFixture(db *gorm.DB, path string) error {
+
+	body, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	fixture := Fixture{}
+	err = json.Unmarshal(body, &fixture)
+	if err != nil {
+		return fmt.Errorf("cannot parse fixture %s: %v", path, err)
+	}
+	return models.Transaction(db, func(tx *gorm.DB) error {
+		sellers := map[string]uint32{}
+		for _, u := range fixture.Users {
+			user := models.User{Username: u.Username, Email: u.Email, Password: u.Password, Role: u.Role, Deposit: u.Deposit}
+			err := tx.Model(&models.User{}).Create(&user).Error
+			if err != nil {
+				return fmt.Errorf("cannot seed user %s: %v", u.Email, err)
+			}
+			sellers[u.Email] = user.ID
+		}
+		categories := map[string]uint32{}
+		for _, c := range fixture.Categories {
+			category := models.Category{Name: c.Name}
+			if c.Parent != "" {
+				parent, ok := categories[c.Parent]
+				if !ok {
+					return fmt.Errorf("category %s comes before its parent %s", c.Name, c.Parent)
+				}
+				category.ParentID = &parent
+			}
+			_, err := category.SaveCategory(tx)
+			if err != nil {
+				return fmt.Errorf("cannot seed category %s: %v", c.Name, err)
+			}
+			categories[c.Name] = category.ID
+		}
+		for _, p := range fixture.Products {
+			seller, ok := sellers[p.Seller]
+			if !ok {
+				return fmt.Errorf("product %s has unknown seller %s", p.ProductName, p.Seller)
+			}
+			product := models.Product{
+				ProductName:       p.ProductName,
+				AmountAvailable:   p.AmountAvailable,
+				Price:             p.Price,
+				LowStockThreshold: p.LowStockThreshold,
+				SellerID:          seller,
+				TagNames:          p.Tags,
+			}
+			for _, name := range p.Categories {
+				cid, ok := categories[name]
+				if !ok {
+					return fmt.Errorf("product %s has unknown category %s", p.ProductName, name)
+				}
+				product.CategoryIDs = append(product.CategoryIDs, cid)
+			}
+			_, err := product.SaveProduct(tx)
+			if err != nil {
+				return fmt.Errorf("cannot seed product %s: %v", p.ProductName, err)
+			}
+		}
+		return nil
+	})
+}
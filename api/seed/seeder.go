@@ -24,6 +24,23 @@ var users = []models.User{
 	},
 }
 
+var admin = models.User{
+	Username: "admin",
+	Email:    "admin@gmail.com",
+	Password: "password",
+	Role:     "admin",
+	Deposit:  0,
+}
+
+var categories = []models.Category{
+	models.Category{
+		Name: "Electronics",
+	},
+	models.Category{
+		Name: "Phones",
+	},
+}
+
 var Products = []models.Product{
 	models.Product{
 		ProductName:     "ProductName 1",
@@ -39,32 +56,45 @@ var Products = []models.Product{
 	},
 }
 
+// Load fills a freshly migrated database with sample users, products and
+// categories. It does nothing when the database already has users.
 func Load(db *gorm.DB) {
 
-	err := db.Debug().DropTableIfExists(&models.Product{}, &models.User{}).Error
-	if err != nil {
-		log.Fatalf("cannot drop table: %v", err)
-	}
-	err = db.Debug().AutoMigrate(&models.User{}, &models.Product{}).Error
+	var count int
+	err := db.Unscoped().Model(&models.User{}).Count(&count).Error
 	if err != nil {
-		log.Fatalf("cannot migrate table: %v", err)
+		log.Fatalf("cannot count users: %v", err)
 	}
-
-	err = db.Debug().Model(&models.Product{}).AddForeignKey("seller_id", "users(id)", "cascade", "cascade").Error
-	if err != nil {
-		log.Fatalf("attaching foreign key error: %v", err)
+	if count > 0 {
+		log.Println("database already has users, not seeding")
+		return
 	}
 
 	for i, _ := range users {
-		err = db.Debug().Model(&models.User{}).Create(&users[i]).Error
+		err = db.Model(&models.User{}).Create(&users[i]).Error
 		if err != nil {
 			log.Fatalf("cannot seed users table: %v", err)
 		}
 		Products[i].SellerID = users[i].ID
 
-		err = db.Debug().Model(&models.Product{}).Create(&Products[i]).Error
+		err = db.Model(&models.Product{}).Create(&Products[i]).Error
 		if err != nil {
 			log.Fatalf("cannot seed Products table: %v", err)
 		}
 	}
+
+	err = db.Model(&models.User{}).Create(&admin).Error
+	if err != nil {
+		log.Fatalf("cannot seed admin user: %v", err)
+	}
+
+	for i, _ := range categories {
+		if i > 0 {
+			categories[i].ParentID = &categories[0].ID
+		}
+		err = db.Model(&models.Category{}).Create(&categories[i]).Error
+		if err != nil {
+			log.Fatalf("cannot seed categories table: %v", err)
+		}
+	}
 }
@@ -1,31 +1,88 @@
 package api
 
 import (
+	"context"
 	"fmt"
-	"log"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 
-	"github.com/joho/godotenv"
+	"github.com/sirupsen/logrus"
+	"github.com/task/api/config"
 	"github.com/task/api/controllers"
-	"github.com/task/api/seed"
+	"github.com/task/api/logging"
+	"github.com/task/api/tracing"
+	"github.com/task/api/webhooks"
 )
 
 var server = controllers.Server{}
 
-func Run() {
+// Run serves the API until SIGINT or SIGTERM, then drains the requests in
+// flight, stops the background workers and closes the database.
+func Run(cfg *config.Config) error {
 
-	var err error
-	err = godotenv.Load()
+	logger, err := logging.New(cfg.Log, os.Stdout)
 	if err != nil {
-		log.Fatalf("Error getting env, not comming through %v", err)
-	} else {
-		fmt.Println("We are getting the env values")
+		return err
 	}
+	server.Log = logger
+	settings := logrus.Fields{}
+	for _, line := range strings.Split(cfg.String(), "\n") {
+		if kv := strings.SplitN(line, "=", 2); len(kv) == 2 {
+			settings[kv[0]] = kv[1]
+		}
+	}
+	logger.WithFields(settings).Info("configuration, secrets redacted")
+
+	provider, shutdownTracing, err := tracing.New(cfg.Tracing, os.Stdout)
+	if err != nil {
+		return fmt.Errorf("cannot initialize tracing: %v", err)
+	}
+	// flush the spans of the last requests
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			logger.Errorf("cannot export traces: %v", err)
+		}
+	}()
+	server.Tracing = provider
+
+	if err := server.Initialize(cfg); err != nil {
+		return err
+	}
+	defer server.DB.Close()
 
-	server.Initialize(os.Getenv("DB_DRIVER"), os.Getenv("DB_USER"), os.Getenv("DB_PASSWORD"), os.Getenv("DB_PORT"), os.Getenv("DB_HOST"), os.Getenv("DB_NAME"))
+	stops := []func(){}
+	if cfg.SoftDeleteRetention > 0 {
+		stops = append(stops, server.StartPurger(cfg.SoftDeleteRetention, cfg.PurgeInterval))
+	}
+	if cfg.Events.Retention > 0 {
+		stops = append(stops, server.StartOutboxPurger(cfg.Events.Retention, cfg.Events.PurgeInterval))
+	}
+	stops = append(stops, server.StartIdempotencyKeyPurger(cfg.IdempotencyKeyPurgeInterval))
+
+	stops = append(stops, server.Outbox.Start(cfg.Events.PollInterval))
 
-	seed.Load(server.DB)
+	dispatcher := webhooks.Dispatcher{
+		DB:           server.DB,
+		MaxAttempts:  cfg.Webhooks.MaxAttempts,
+		Backoff:      cfg.Webhooks.Backoff,
+		AllowPrivate: cfg.Webhooks.AllowPrivate,
+		Log:          logger,
+		Tracing:      provider,
+	}
+	stops = append(stops, dispatcher.Start(cfg.Webhooks.PollInterval))
 
-	server.Run(":8080")
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	err = server.Serve(ctx, cfg.Addr, cfg.HTTP)
 
+	for _, stopWorker := range stops {
+		stopWorker()
+	}
+	// publish what the last requests recorded, the outbox keeps the rest
+	if _, dispatchErr := server.Outbox.DispatchPending(); dispatchErr != nil {
+		logger.Errorf("cannot dispatch events: %v", dispatchErr)
+	}
+	return err
 }
@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LocalStore keeps blobs as plain files below Root.
+type LocalStore struct {
+	Root    string
+	BaseURL string
+}
+
+func NewLocalStore(root, baseURL string) (*LocalStore, error) {
+	err := os.MkdirAll(root, 0755)
+	if err != nil {
+		return nil, err
+	}
+	return &LocalStore{Root: root, BaseURL: strings.TrimSuffix(baseURL, "/")}, nil
+}
+
+func (s *LocalStore) path(key string) (string, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(s.Root, filepath.FromSlash(key)), nil
+}
+
+// Put writes to a temporary file first so readers never see a partial blob.
+func (s *LocalStore) Put(key string, r io.Reader, contentType string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(p), 0755)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(p), ".upload-*")
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(tmp, r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), p)
+}
+
+func (s *LocalStore) Get(key string) (io.ReadCloser, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(p)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+func (s *LocalStore) Delete(key string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(p)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (s *LocalStore) URL(key string) string {
+	return s.BaseURL + "/" + key
+}
@@ -0,0 +1,162 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// S3Store talks to any S3-compatible object store (AWS, MinIO, ...) using
+// path-style requests signed with AWS Signature Version 4.
+type S3Store struct {
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	// PublicURL is the prefix used by URL, defaults to Endpoint/Bucket.
+	PublicURL string
+	Client    *http.Client
+}
+
+func (s *S3Store) client() *http.Client {
+	if s.Client != nil {
+		return s.Client
+	}
+	return http.DefaultClient
+}
+
+func (s *S3Store) objectURL(key string) string {
+	segments := strings.Split(key, "/")
+	for i := range segments {
+		segments[i] = url.PathEscape(segments[i])
+	}
+	return strings.TrimSuffix(s.Endpoint, "/") + "/" + url.PathEscape(s.Bucket) + "/" + strings.Join(segments, "/")
+}
+
+func (s *S3Store) do(method, key string, body []byte, contentType string) (*http.Response, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(method, s.objectURL(key), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	s.sign(req, body)
+	return s.client().Do(req)
+}
+
+func (s *S3Store) Put(key string, r io.Reader, contentType string) error {
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	resp, err := s.do(http.MethodPut, key, body, contentType)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return s3Error(resp)
+	}
+	return nil
+}
+
+func (s *S3Store) Get(key string) (io.ReadCloser, error) {
+	resp, err := s.do(http.MethodGet, key, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, ErrNotFound
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		return nil, s3Error(resp)
+	}
+	return resp.Body, nil
+}
+
+func (s *S3Store) Delete(key string) error {
+	resp, err := s.do(http.MethodDelete, key, nil, "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 && resp.StatusCode != http.StatusNotFound {
+		return s3Error(resp)
+	}
+	return nil
+}
+
+func (s *S3Store) URL(key string) string {
+	if s.PublicURL != "" {
+		return strings.TrimSuffix(s.PublicURL, "/") + "/" + key
+	}
+	return s.objectURL(key)
+}
+
+func s3Error(resp *http.Response) error {
+	msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("s3: %s %s: %s", resp.Request.Method, resp.Status, strings.TrimSpace(string(msg)))
+}
+
+// sign adds the Authorization header described in
+// https://docs.aws.amazon.com/general/latest/gr/sigv4_signing.html
+func (s *S3Store) sign(req *http.Request, body []byte) {
+	t := time.Now().UTC()
+	amzDate := t.Format("20060102T150405Z")
+	date := t.Format("20060102")
+	payloadHash := sha256Hex(body)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalHeaders := "host:" + req.URL.Host + "\n" +
+		"x-amz-content-sha256:" + payloadHash + "\n" +
+		"x-amz-date:" + amzDate + "\n"
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + s.Region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+s.SecretKey), date)
+	key = hmacSHA256(key, s.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", s.AccessKey, scope, signedHeaders, signature))
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
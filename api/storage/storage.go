@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/task/api/config"
+)
+
+// ErrNotFound is returned by Get when no blob exists under the key.
+var ErrNotFound = errors.New("Blob Not Found")
+
+// ErrInvalidKey is returned for keys that are empty or try to escape the store.
+var ErrInvalidKey = errors.New("Invalid Blob Key")
+
+// BlobStore keeps uploaded files such as product images.
+type BlobStore interface {
+	Put(key string, r io.Reader, contentType string) error
+	Get(key string) (io.ReadCloser, error)
+	Delete(key string) error
+	URL(key string) string
+}
+
+// New builds the store selected by STORAGE_DRIVER, "local" or "s3".
+func New(cfg config.Storage) (BlobStore, error) {
+	switch cfg.Driver {
+	case "", "local":
+		root := cfg.LocalRoot
+		if root == "" {
+			root = "uploads"
+		}
+		baseURL := cfg.BaseURL
+		if baseURL == "" {
+			baseURL = "/images"
+		}
+		return NewLocalStore(root, baseURL)
+	case "s3":
+		region := cfg.S3Region
+		if region == "" {
+			region = "us-east-1"
+		}
+		return &S3Store{
+			Endpoint:  cfg.S3Endpoint,
+			Region:    region,
+			Bucket:    cfg.S3Bucket,
+			AccessKey: cfg.S3AccessKey,
+			SecretKey: cfg.S3SecretKey.Value(),
+			PublicURL: cfg.BaseURL,
+		}, nil
+	}
+	return nil, errors.New("unknown STORAGE_DRIVER " + cfg.Driver)
+}
+
+func cleanKey(key string) (string, error) {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return "", ErrInvalidKey
+	}
+	cleaned := path.Clean(key)
+	if cleaned != key || cleaned == "." || strings.HasPrefix(cleaned, "../") || cleaned == ".." {
+		return "", ErrInvalidKey
+	}
+	return cleaned, nil
+}
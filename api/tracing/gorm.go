@@ -0,0 +1,93 @@
+package tracing
+
+import (
+	"context"
+
+	"github.com/jinzhu/gorm"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	contextKey = "tracing:context"
+	spanKey    = "tracing:span"
+)
+
+// WithContext returns db carrying ctx, the queries made through it are
+// traced as children of the span of ctx.
+func WithContext(db *gorm.DB, ctx context.Context) *gorm.DB {
+	return db.Set(contextKey, ctx)
+}
+
+// RegisterCallbacks traces the creates, queries, updates and deletes of db
+// with a span each. Queries without a span in their context, those of the
+// background workers, and raw db.Exec statements are not traced.
+func RegisterCallbacks(db *gorm.DB, tracer trace.Tracer) {
+	callbacks := db.Callback()
+	// a processor is registered once, Before and After change it in place
+	for _, c := range []struct {
+		processor func() *gorm.CallbackProcessor
+		name      string
+		operation string
+	}{
+		{callbacks.Create, "create", "INSERT"},
+		{callbacks.Query, "query", "SELECT"},
+		{callbacks.RowQuery, "row_query", "SELECT"},
+		{callbacks.Update, "update", "UPDATE"},
+		{callbacks.Delete, "delete", "DELETE"},
+	} {
+		c.processor().Before("gorm:"+c.name).Register("tracing:before_"+c.name, start(tracer, c.operation))
+		c.processor().After("gorm:"+c.name).Register("tracing:after_"+c.name, end)
+	}
+}
+
+func start(tracer trace.Tracer, operation string) func(*gorm.Scope) {
+	return func(scope *gorm.Scope) {
+		value, ok := scope.Get(contextKey)
+		if !ok {
+			return
+		}
+		ctx, ok := value.(context.Context)
+		if !ok || !trace.SpanContextFromContext(ctx).IsValid() {
+			return
+		}
+		table := scope.TableName()
+		_, span := tracer.Start(ctx, operation+" "+table,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(
+				system(scope.Dialect().GetName()),
+				semconv.DBOperationName(operation),
+				semconv.DBCollectionName(table),
+			))
+		scope.InstanceSet(spanKey, span)
+	}
+}
+
+func end(scope *gorm.Scope) {
+	value, ok := scope.InstanceGet(spanKey)
+	if !ok {
+		return
+	}
+	span := value.(trace.Span)
+	// the statement without its bound values, they carry personal data
+	span.SetAttributes(semconv.DBQueryText(scope.SQL), attribute.Int64("db.rows_affected", scope.DB().RowsAffected))
+	if err := scope.DB().Error; err != nil && !gorm.IsRecordNotFoundError(err) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func system(dialect string) attribute.KeyValue {
+	switch dialect {
+	case "postgres":
+		return semconv.DBSystemPostgreSQL
+	case "mysql":
+		return semconv.DBSystemMySQL
+	case "sqlite3":
+		return semconv.DBSystemSqlite
+	}
+	return semconv.DBSystemKey.String(dialect)
+}
@@ -0,0 +1,76 @@
+// Package tracing sets up OpenTelemetry tracing: a span per request, a child
+// span per database query, and the W3C traceparent header on the way in and
+// on the webhooks going out.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/task/api/config"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// Name is the instrumentation name of the spans of the server.
+const Name = "github.com/task"
+
+// Propagator reads and writes the W3C traceparent and tracestate headers.
+var Propagator propagation.TextMapPropagator = propagation.TraceContext{}
+
+// New builds the tracer provider described by cfg, printing the spans to out
+// for the stdout exporter. shutdown flushes the spans not exported yet.
+func New(cfg config.Tracing, out io.Writer) (provider trace.TracerProvider, shutdown func(context.Context) error, err error) {
+	var exporter sdktrace.SpanExporter
+	switch cfg.Exporter {
+	case "", "none":
+		return noop.NewTracerProvider(), func(context.Context) error { return nil }, nil
+	case "otlp":
+		exporter, err = otlptracehttp.New(context.Background(), otlptracehttp.WithEndpointURL(cfg.Endpoint))
+	case "stdout":
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(out))
+	default:
+		return nil, nil, fmt.Errorf("unknown tracing exporter %q", cfg.Exporter)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	name := cfg.ServiceName
+	if name == "" {
+		name = "task"
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(name)))
+	if err != nil {
+		return nil, nil, err
+	}
+	tp := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	return tp, tp.Shutdown, nil
+}
+
+// Tracer is the tracer of the server from provider, which traces nothing
+// when nil.
+func Tracer(provider trace.TracerProvider) trace.Tracer {
+	if provider == nil {
+		provider = noop.NewTracerProvider()
+	}
+	return provider.Tracer(Name)
+}
+
+// Extract returns ctx with the remote span of the traceparent header of r.
+func Extract(ctx context.Context, r *http.Request) context.Context {
+	return Propagator.Extract(ctx, propagation.HeaderCarrier(r.Header))
+}
+
+// Inject sets the traceparent header of an outgoing request to the span of
+// ctx.
+func Inject(ctx context.Context, r *http.Request) {
+	Propagator.Inject(ctx, propagation.HeaderCarrier(r.Header))
+}
@@ -0,0 +1,125 @@
+package imageutil
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/draw"
+	_ "image/gif" // registers the gif decoder
+	"image/jpeg"
+	"image/png"
+	"net/http"
+)
+
+// MaxPixels guards against decompression bombs: a few kilobytes of PNG can
+// describe an image that needs gigabytes of memory once decoded.
+const MaxPixels = 40 * 1000 * 1000
+
+var ErrUnsupportedType = errors.New("Unsupported Image Type")
+var ErrTooLarge = errors.New("Image Dimensions Too Large")
+
+var extensions = map[string]string{
+	"image/jpeg": "jpg",
+	"image/png":  "png",
+	"image/gif":  "gif",
+}
+
+// Sniff detects the content type from the data itself rather than trusting
+// the client supplied header, and returns the matching file extension.
+func Sniff(data []byte) (contentType string, ext string, err error) {
+	contentType = http.DetectContentType(data)
+	ext, ok := extensions[contentType]
+	if !ok {
+		return "", "", ErrUnsupportedType
+	}
+	return contentType, ext, nil
+}
+
+// Dimensions reads the image header only.
+func Dimensions(data []byte) (int, int, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return 0, 0, err
+	}
+	if cfg.Width*cfg.Height > MaxPixels {
+		return 0, 0, ErrTooLarge
+	}
+	return cfg.Width, cfg.Height, nil
+}
+
+// Thumbnail scales the image so that it fits in a size x size box, keeping the
+// aspect ratio. JPEG input gives JPEG output, everything else becomes PNG.
+func Thumbnail(data []byte, size int) ([]byte, string, error) {
+	if _, _, err := Dimensions(data); err != nil {
+		return nil, "", err
+	}
+	src, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", err
+	}
+	dst := scale(src, size)
+	buf := new(bytes.Buffer)
+	if format == "jpeg" {
+		err = jpeg.Encode(buf, dst, &jpeg.Options{Quality: 80})
+		return buf.Bytes(), "image/jpeg", err
+	}
+	err = png.Encode(buf, dst)
+	return buf.Bytes(), "image/png", err
+}
+
+// scale is a box filter: every destination pixel is the average of the
+// source pixels it covers. Good enough for thumbnails and dependency free.
+func scale(src image.Image, size int) image.Image {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= size && h <= size {
+		return src
+	}
+	dw, dh := size, size
+	if w > h {
+		dh = h * size / w
+	} else {
+		dw = w * size / h
+	}
+	if dw < 1 {
+		dw = 1
+	}
+	if dh < 1 {
+		dh = 1
+	}
+
+	in := image.NewNRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(in, in.Bounds(), src, b.Min, draw.Src)
+	out := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < dh; y++ {
+		y0, y1 := y*h/dh, (y+1)*h/dh
+		if y1 == y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < dw; x++ {
+			x0, x1 := x*w/dw, (x+1)*w/dw
+			if x1 == x0 {
+				x1 = x0 + 1
+			}
+			var r, g, bl, a, n int
+			for sy := y0; sy < y1; sy++ {
+				i := in.PixOffset(x0, sy)
+				for sx := x0; sx < x1; sx++ {
+					r += int(in.Pix[i])
+					g += int(in.Pix[i+1])
+					bl += int(in.Pix[i+2])
+					a += int(in.Pix[i+3])
+					n++
+					i += 4
+				}
+			}
+			o := out.PixOffset(x, y)
+			out.Pix[o] = uint8(r / n)
+			out.Pix[o+1] = uint8(g / n)
+			out.Pix[o+2] = uint8(bl / n)
+			out.Pix[o+3] = uint8(a / n)
+		}
+	}
+	return out
+}
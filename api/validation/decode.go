@@ -0,0 +1,154 @@
+package validation
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/task/api/apierror"
+)
+
+// DefaultMaxBytes is the body limit of Decode when none is given.
+const DefaultMaxBytes = 1 << 20
+
+// Decode reads the JSON body of r into v and checks it with Struct. Bodies
+// over limit bytes, malformed JSON, fields v does not have and values of the
+// wrong type are rejected, the unknown fields all at once. An empty body is
+// an empty object.
+func Decode(r *http.Request, limit int64, v interface{}) error {
+	if limit <= 0 {
+		limit = DefaultMaxBytes
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, limit+1))
+	if err != nil {
+		return apierror.New(apierror.BadRequest, "Cannot Read Body")
+	}
+	if int64(len(body)) > limit {
+		return apierror.New(apierror.PayloadTooLarge, fmt.Sprintf("Body Larger Than %d Bytes", limit))
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		if reflect.Indirect(reflect.ValueOf(v)).Kind() != reflect.Struct {
+			return apierror.New(apierror.BadRequest, "Required Body")
+		}
+		return Struct(v)
+	}
+
+	var raw interface{}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&raw); err != nil {
+		return malformed(err)
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return apierror.New(apierror.BadRequest, "Body Must Be One JSON Value")
+	}
+	fields := []apierror.FieldError{}
+	unknown(raw, reflect.TypeOf(v), "", &fields)
+	if len(fields) > 0 {
+		return apierror.Validation(fields...)
+	}
+
+	decoder = json.NewDecoder(bytes.NewReader(body))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			name := typeErr.Field
+			if name == "" {
+				name = "body"
+			}
+			return apierror.Validation(apierror.FieldError{
+				Field:   typeErr.Field,
+				Code:    "type",
+				Message: fmt.Sprintf("Invalid %s, Expected %s", name, kind(typeErr.Type)),
+			})
+		}
+		return malformed(err)
+	}
+	return Struct(v)
+}
+
+func malformed(err error) error {
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		return apierror.New(apierror.BadRequest, fmt.Sprintf("Malformed JSON At Byte %d", syntaxErr.Offset))
+	}
+	return apierror.New(apierror.BadRequest, "Malformed JSON")
+}
+
+// unknown collects the paths of the values in raw that t has no field for.
+// Field names match case insensitively, as they do in encoding/json.
+func unknown(raw interface{}, t reflect.Type, path string, fields *[]apierror.FieldError) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		object, ok := raw.(map[string]interface{})
+		if !ok {
+			return
+		}
+		known := map[string]reflect.Type{}
+		for i := 0; i < t.NumField(); i++ {
+			if name := jsonName(t.Field(i)); name != "" {
+				known[strings.ToLower(name)] = t.Field(i).Type
+			}
+		}
+		keys := make([]string, 0, len(object))
+		for key := range object {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fieldType, ok := known[strings.ToLower(key)]
+			if !ok {
+				*fields = append(*fields, apierror.FieldError{Field: join(path, key), Code: "unknown", Message: "Unknown Field " + key})
+				continue
+			}
+			unknown(object[key], fieldType, join(path, key), fields)
+		}
+	case reflect.Slice, reflect.Array:
+		list, ok := raw.([]interface{})
+		if !ok {
+			return
+		}
+		for i, item := range list {
+			unknown(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i), fields)
+		}
+	case reflect.Map:
+		object, ok := raw.(map[string]interface{})
+		if !ok {
+			return
+		}
+		keys := make([]string, 0, len(object))
+		for key := range object {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			unknown(object[key], t.Elem(), join(path, key), fields)
+		}
+	}
+}
+
+// kind is the JSON type of values of t.
+func kind(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	case reflect.Map, reflect.Struct:
+		return "object"
+	}
+	return "number"
+}
@@ -0,0 +1,217 @@
+// Package validation checks request payloads against the rules in their
+// validate struct tags and reports every violation at once, each with the
+// JSON path of its field:
+//
+//	type Buy struct {
+//		Qty  float32 `json:"qty" validate:"required,min=1"`
+//		Tags []string `json:"tags" validate:"max=10,dive,required,max=100"`
+//	}
+//
+// The rules are required, min=n and max=n (the value of numbers, the length
+// of strings, slices and maps), oneof=a b c, email and url. Rules after dive
+// apply to every element of a slice. Fields without a value are only
+// checked by required, and a nil pointer has no value while a pointer to
+// zero has one. Structs, and slices of them, are checked field by field.
+// Rules across fields, which tags cannot express, go in a Check method.
+package validation
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/badoux/checkmail"
+	"github.com/task/api/apierror"
+)
+
+// Checker is a payload with rules across its fields.
+type Checker interface {
+	Check() []apierror.FieldError
+}
+
+// Struct checks v, a struct, a slice of structs or a pointer to either, and
+// returns the violations as a validation_failed *apierror.Error, or nil.
+func Struct(v interface{}) error {
+	fields := []apierror.FieldError{}
+	walk(reflect.ValueOf(v), "", &fields)
+	if checker, ok := v.(Checker); ok {
+		fields = append(fields, checker.Check()...)
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+	return apierror.Validation(fields...)
+}
+
+func walk(v reflect.Value, path string, fields *[]apierror.FieldError) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			sf := v.Type().Field(i)
+			name := jsonName(sf)
+			if name == "" {
+				continue
+			}
+			fieldPath := join(path, name)
+			check(v.Field(i), sf.Name, fieldPath, sf.Tag.Get("validate"), fields)
+			walk(v.Field(i), fieldPath, fields)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			walk(v.Index(i), fmt.Sprintf("%s[%d]", path, i), fields)
+		}
+	}
+}
+
+// jsonName is the name of the field in JSON, empty for unexported and
+// skipped fields.
+func jsonName(sf reflect.StructField) string {
+	if sf.PkgPath != "" {
+		return ""
+	}
+	tag := sf.Tag.Get("json")
+	if tag == "-" {
+		return ""
+	}
+	if name := strings.Split(tag, ",")[0]; name != "" {
+		return name
+	}
+	return sf.Name
+}
+
+func join(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// check applies the rules of tag to the field, named name in messages.
+func check(v reflect.Value, name, path, tag string, fields *[]apierror.FieldError) {
+	if tag == "" {
+		return
+	}
+	rules, dive := strings.Split(tag, ","), []string(nil)
+	for i, rule := range rules {
+		if rule == "dive" {
+			rules, dive = rules[:i], rules[i+1:]
+			break
+		}
+	}
+	if !present(v) {
+		for _, rule := range rules {
+			if rule == "required" {
+				*fields = append(*fields, apierror.FieldError{Field: path, Code: "required", Message: "Required " + name})
+			}
+		}
+		return
+	}
+	for v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	for _, rule := range rules {
+		if field, ok := violates(v, name, path, rule); ok {
+			*fields = append(*fields, field)
+			// the other rules of the field say the same thing again
+			break
+		}
+	}
+	if dive != nil && (v.Kind() == reflect.Slice || v.Kind() == reflect.Array) {
+		for i := 0; i < v.Len(); i++ {
+			check(v.Index(i), name, fmt.Sprintf("%s[%d]", path, i), strings.Join(dive, ","), fields)
+		}
+	}
+}
+
+// present reports whether the field has a value. Blank strings have none,
+// they are trimmed before they are stored.
+func present(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		return !v.IsNil()
+	case reflect.String:
+		return strings.TrimSpace(v.String()) != ""
+	case reflect.Slice, reflect.Map:
+		return v.Len() > 0
+	}
+	return !v.IsZero()
+}
+
+func violates(v reflect.Value, name, path, rule string) (apierror.FieldError, bool) {
+	key, arg := rule, ""
+	if i := strings.Index(rule, "="); i >= 0 {
+		key, arg = rule[:i], rule[i+1:]
+	}
+	field := apierror.FieldError{Field: path, Code: key}
+	switch key {
+	case "required":
+		return field, false
+	case "min", "max":
+		limit, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			panic(fmt.Sprintf("validation: invalid rule %q of %s", rule, path))
+		}
+		size, unit := measure(v)
+		if (key == "min" && size >= limit) || (key == "max" && size <= limit) {
+			return field, false
+		}
+		bound := "At Least"
+		if key == "max" {
+			bound = "At Most"
+		}
+		if unit == "" {
+			field.Message = fmt.Sprintf("%s Must Be %s %s", name, bound, arg)
+		} else {
+			field.Message = fmt.Sprintf("%s Must Have %s %s %s", name, bound, arg, unit)
+		}
+	case "oneof":
+		options := strings.Fields(arg)
+		for _, option := range options {
+			if fmt.Sprint(v.Interface()) == option {
+				return field, false
+			}
+		}
+		field.Code = "enum"
+		field.Message = fmt.Sprintf("Invalid %s, Use %s", name, strings.Join(options, ", "))
+	case "email":
+		if checkmail.ValidateFormat(v.String()) == nil {
+			return field, false
+		}
+		field.Message = "Invalid " + name
+	case "url":
+		u, err := url.Parse(v.String())
+		if err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" {
+			return field, false
+		}
+		field.Message = "Invalid " + name
+	default:
+		panic(fmt.Sprintf("validation: unknown rule %q of %s", rule, path))
+	}
+	return field, true
+}
+
+// measure is what min and max compare, with the unit of messages.
+func measure(v reflect.Value) (float64, string) {
+	switch v.Kind() {
+	case reflect.String:
+		return float64(utf8.RuneCountInString(v.String())), "Characters"
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return float64(v.Len()), "Items"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), ""
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), ""
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), ""
+	}
+	panic(fmt.Sprintf("validation: cannot measure %s", v.Type()))
+}
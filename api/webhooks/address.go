@@ -0,0 +1,76 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// ErrPrivateAddress is the error of a webhook URL that points into the
+// network of the API: loopback, private, link-local or unspecified addresses.
+var ErrPrivateAddress = errors.New("webhook address is not public")
+
+// Public reports whether webhooks may be delivered to ip.
+func Public(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsUnspecified())
+}
+
+// CheckURL resolves the host of rawURL and returns ErrPrivateAddress when one
+// of its addresses is not public. A host that does not resolve passes, the
+// dialer of the deliveries checks it again.
+func CheckURL(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	host := u.Hostname()
+	if ip := net.ParseIP(host); ip != nil {
+		if !Public(ip) {
+			return ErrPrivateAddress
+		}
+		return nil
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil
+	}
+	for _, addr := range addrs {
+		if !Public(addr.IP) {
+			return ErrPrivateAddress
+		}
+	}
+	return nil
+}
+
+// publicOnly is the dialer control that refuses to connect to addresses that
+// are not public, whatever the host resolved to when the webhook was saved.
+func publicOnly(network, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !Public(ip) {
+		return ErrPrivateAddress
+	}
+	return nil
+}
+
+// PublicClient is an http.Client that only connects to public addresses,
+// redirects included. It does not use a proxy, whose address would be the
+// one checked.
+func PublicClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout, Control: publicOnly}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: timeout,
+		},
+	}
+}
@@ -0,0 +1,243 @@
+// Package webhooks signs and delivers the queued webhook deliveries.
+//
+// Every request is a POST of the event envelope with the headers
+//
+//	X-Webhook-Event:     the event type, e.g. product.created
+//	X-Webhook-Delivery:  the delivery id, stable across retries
+//	X-Webhook-Timestamp: unix seconds of the attempt
+//	X-Webhook-Signature: sha256=hex(HMAC-SHA256(secret, timestamp + "." + body))
+//
+// Receivers should recompute the signature and reject old timestamps. A
+// traceparent header ties the request to the trace of the delivery.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/sirupsen/logrus"
+	"github.com/task/api/events"
+	"github.com/task/api/models"
+	"github.com/task/api/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// Sign returns the X-Webhook-Signature value of body sent at timestamp.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks a signature and that timestamp is within tolerance of now.
+func Verify(secret, signature string, timestamp int64, body []byte, tolerance time.Duration, now time.Time) bool {
+	age := now.Sub(time.Unix(timestamp, 0))
+	if age < 0 {
+		age = -age
+	}
+	if tolerance > 0 && age > tolerance {
+		return false
+	}
+	return hmac.Equal([]byte(signature), []byte(Sign(secret, timestamp, body)))
+}
+
+// Enqueue returns the event bus handler that queues every event for the
+// webhooks subscribed to it. The body receivers get is
+//
+//	{"id": 12, "event": "product.created", "created_at": "...", "data": {...}}
+//
+// where id is the event id, the same for redeliveries and duplicates.
+func Enqueue(db *gorm.DB) events.Handler {
+	return func(e events.Event) error {
+		payload, err := json.Marshal(map[string]interface{}{
+			"id":         e.ID,
+			"event":      e.Type,
+			"created_at": e.OccurredAt.UTC(),
+			"data":       e.Payload,
+		})
+		if err != nil {
+			return err
+		}
+		_, err = models.EnqueueDeliveries(db, e.Type, e.SellerID, payload)
+		return err
+	}
+}
+
+// Dispatcher delivers due deliveries, retrying failures with exponential
+// backoff: Backoff, 2*Backoff, 4*Backoff... up to MaxAttempts attempts.
+type Dispatcher struct {
+	DB          *gorm.DB
+	Client      *http.Client
+	MaxAttempts int
+	Backoff     time.Duration
+	// BatchSize is the number of deliveries attempted per DeliverDue call.
+	BatchSize int
+	// Log is where delivery failures go, the standard logger when nil.
+	Log logrus.FieldLogger
+	// Tracing traces every attempt, nothing is traced when nil.
+	Tracing trace.TracerProvider
+	// AllowPrivate lets the default client deliver to private addresses,
+	// for receivers on the same host or network.
+	AllowPrivate bool
+}
+
+func (d *Dispatcher) logger() logrus.FieldLogger {
+	if d.Log != nil {
+		return d.Log
+	}
+	return logrus.StandardLogger()
+}
+
+func (d *Dispatcher) client() *http.Client {
+	if d.Client != nil {
+		return d.Client
+	}
+	if d.AllowPrivate {
+		return &http.Client{Timeout: 10 * time.Second}
+	}
+	return PublicClient(10 * time.Second)
+}
+
+// NextAttempt returns when to retry after the given number of failed
+// attempts, or the zero time when the delivery should be given up.
+func (d *Dispatcher) NextAttempt(attempts int, now time.Time) time.Time {
+	max := d.MaxAttempts
+	if max <= 0 {
+		max = 8
+	}
+	if attempts >= max {
+		return time.Time{}
+	}
+	backoff := d.Backoff
+	if backoff <= 0 {
+		backoff = 30 * time.Second
+	}
+	for i := 1; i < attempts && backoff < 24*time.Hour; i++ {
+		backoff *= 2
+	}
+	return now.Add(backoff)
+}
+
+// DeliverDue claims the due deliveries and attempts each once, returning how
+// many were attempted.
+func (d *Dispatcher) DeliverDue() (int, error) {
+	limit := d.BatchSize
+	if limit <= 0 {
+		limit = 100
+	}
+	deliveries, err := models.ClaimDueDeliveries(d.DB, time.Now(), limit)
+	if err != nil {
+		return 0, err
+	}
+	for i := range *deliveries {
+		if err = d.Deliver(&(*deliveries)[i]); err != nil {
+			return i, err
+		}
+	}
+	return len(*deliveries), nil
+}
+
+// Deliver makes one attempt and records its outcome. The returned error is
+// about recording, a failed attempt is not an error.
+func (d *Dispatcher) Deliver(delivery *models.WebhookDelivery) error {
+	ctx, span := tracing.Tracer(d.Tracing).Start(context.Background(), "webhook "+delivery.Event,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("webhook.event", delivery.Event),
+			attribute.Int64("webhook.delivery_id", int64(delivery.ID)),
+			attribute.Int("webhook.attempt", delivery.Attempts+1),
+		))
+	defer span.End()
+	db := tracing.WithContext(d.DB, ctx)
+
+	webhook := models.Webhook{}
+	_, err := webhook.FindWebhookByID(db, delivery.WebhookID)
+	if err != nil {
+		return delivery.RecordAttempt(db, 0, err, time.Time{})
+	}
+	if !webhook.Active {
+		return delivery.RecordAttempt(db, 0, fmt.Errorf("webhook is disabled"), time.Time{})
+	}
+	code, attemptErr := d.post(ctx, &webhook, delivery)
+	next := time.Time{}
+	if attemptErr != nil {
+		next = d.NextAttempt(delivery.Attempts+1, time.Now())
+		d.logger().Warnf("webhook delivery %d to %s failed: %v", delivery.ID, webhook.URL, attemptErr)
+		span.SetStatus(codes.Error, attemptErr.Error())
+	}
+	if code != 0 {
+		span.SetAttributes(semconv.HTTPResponseStatusCode(code))
+	}
+	return delivery.RecordAttempt(db, code, attemptErr, next)
+}
+
+func (d *Dispatcher) post(ctx context.Context, webhook *models.Webhook, delivery *models.WebhookDelivery) (int, error) {
+	body := []byte(delivery.Payload)
+	timestamp := time.Now().Unix()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	tracing.Inject(ctx, req)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "task-webhooks/1.0")
+	req.Header.Set(HeaderEvent, delivery.Event)
+	req.Header.Set(HeaderDelivery, strconv.FormatUint(delivery.ID, 10))
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(webhook.Secret, timestamp, body))
+	resp, err := d.client().Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode/100 != 2 {
+		return resp.StatusCode, fmt.Errorf("endpoint answered %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// Start runs DeliverDue every interval until the returned function is called,
+// which waits for a delivery in progress.
+func (d *Dispatcher) Start(interval time.Duration) (stop func()) {
+	done, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if _, err := d.DeliverDue(); err != nil {
+				d.logger().Errorf("cannot deliver webhooks: %v", err)
+			}
+			select {
+			case <-ticker.C:
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() { close(done); <-stopped }
+}
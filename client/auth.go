@@ -0,0 +1,113 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+type loginResponse struct {
+	Jwt string `json:"jwt"`
+}
+
+type credentials struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// Login signs in and keeps the token. The email and password are kept in
+// memory too, to sign in again when the token expired before it could be
+// refreshed.
+func (c *Client) Login(ctx context.Context, email, password string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	err := c.login(ctx, email, password)
+	if err != nil {
+		return err
+	}
+	c.email, c.password = email, password
+	return nil
+}
+
+func (c *Client) login(ctx context.Context, email, password string) error {
+	login := loginResponse{}
+	_, err := c.do(ctx, call{method: http.MethodPost, path: "/v2/login", body: credentials{email, password}, out: &login})
+	if err != nil {
+		return err
+	}
+	return c.tokens.Save(login.Jwt)
+}
+
+// RefreshToken replaces the token with a new one. Requests refresh it on
+// their own when it is about to expire.
+func (c *Client) RefreshToken(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	token, err := c.tokens.Load()
+	if err != nil {
+		return err
+	}
+	return c.refresh(ctx, token)
+}
+
+func (c *Client) refresh(ctx context.Context, token string) error {
+	login := loginResponse{}
+	_, err := c.do(ctx, call{method: http.MethodPost, path: "/v2/login/refresh", token: token, out: &login})
+	if err != nil {
+		return err
+	}
+	return c.tokens.Save(login.Jwt)
+}
+
+// token is the token to sign a request with. One about to expire is
+// refreshed first, or replaced by signing in again once it expired.
+func (c *Client) token(ctx context.Context) (string, error) {
+	token, err := c.tokens.Load()
+	if err != nil || token == "" {
+		return token, err
+	}
+	expires := expiry(token)
+	if expires.IsZero() || time.Until(expires) > refreshBefore {
+		return token, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// another request may have refreshed it meanwhile
+	current, err := c.tokens.Load()
+	if err != nil || current != token {
+		return current, err
+	}
+	if time.Now().Before(expires) && c.refresh(ctx, token) == nil {
+		return c.tokens.Load()
+	}
+	if c.email != "" {
+		err := c.login(ctx, c.email, c.password)
+		if err == nil {
+			return c.tokens.Load()
+		}
+		if !time.Now().Before(expires) {
+			return "", err
+		}
+	}
+	// the token is sent as it is, the API tells whether it is still valid
+	return token, nil
+}
+
+// signInAgain signs in with the credentials of Login after the API refused
+// token, unless another request did already.
+func (c *Client) signInAgain(ctx context.Context, token string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	current, err := c.tokens.Load()
+	if err != nil || current != token {
+		return err
+	}
+	return c.login(ctx, c.email, c.password)
+}
+
+func (c *Client) hasCredentials() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.email != ""
+}
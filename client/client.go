@@ -0,0 +1,246 @@
+// Package client is a Go client of the API under /v2. It keeps the token
+// it signed in with and refreshes it before it expires, answers the
+// problems of the API as *Error, and retries what is safe to retry: reads,
+// updates and deletes, and purchases, which carry an Idempotency-Key.
+//
+//	c := client.New("http://localhost:8080")
+//	if err := c.Login(ctx, "ada@example.com", "password"); err != nil {
+//		return err
+//	}
+//	products := c.ListProducts(ctx, client.ListOptions{Tags: []string{"tea"}})
+//	for products.Next() {
+//		fmt.Println(products.Product().ProductName)
+//	}
+//	if err := products.Err(); err != nil {
+//		return err
+//	}
+//	_, err := c.Buy(ctx, client.Buy{ProductID: 3, Qty: 1})
+//	if client.IsCode(err, client.InsufficientBalance) {
+//		...
+//	}
+//
+// The package only depends on the standard library.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// refreshBefore is how long before it expires a token is refreshed.
+const refreshBefore = 5 * time.Minute
+
+// Client calls the API. It is safe for concurrent use.
+type Client struct {
+	baseURL string
+	http    *http.Client
+	tokens  TokenStore
+	retries int
+	backoff time.Duration
+
+	// mu serialises signing in and refreshing the token.
+	mu              sync.Mutex
+	email, password string
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithHTTPClient sends the requests with h instead of http.DefaultClient.
+func WithHTTPClient(h *http.Client) Option {
+	return func(c *Client) { c.http = h }
+}
+
+// WithTokenStore keeps the token in store instead of in memory.
+func WithTokenStore(store TokenStore) Option {
+	return func(c *Client) { c.tokens = store }
+}
+
+// WithRetries retries a request that is safe to retry up to n times when it
+// fails to reach the API or the API is unavailable, waiting backoff before
+// the first retry and twice as long before every next one, or what
+// Retry-After asks for. The default is 3 retries from 200ms, 0 disables
+// them.
+func WithRetries(n int, backoff time.Duration) Option {
+	return func(c *Client) { c.retries, c.backoff = n, backoff }
+}
+
+// New returns a client of the API at baseURL, like http://localhost:8080.
+func New(baseURL string, options ...Option) *Client {
+	c := &Client{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		http:    http.DefaultClient,
+		tokens:  &MemoryTokens{},
+		retries: 3,
+		backoff: 200 * time.Millisecond,
+	}
+	for _, option := range options {
+		option(c)
+	}
+	return c
+}
+
+// SetToken makes the client use token, like one made by the token command
+// of the server. Without credentials from Login it cannot sign in again
+// once token expires.
+func (c *Client) SetToken(token string) error {
+	return c.tokens.Save(token)
+}
+
+// Token is the token the client signs its requests with.
+func (c *Client) Token() (string, error) {
+	return c.tokens.Load()
+}
+
+// call is a request to the API.
+type call struct {
+	method, path string
+	body         interface{}
+	// out receives the body of a successful response.
+	out interface{}
+	// auth signs the request with the token of the client, refreshed when
+	// about to expire. token signs it with another one.
+	auth  bool
+	token string
+	// idempotencyKey makes a POST safe to retry.
+	idempotencyKey string
+}
+
+// do sends req, retrying it when it is safe to, and decodes the response
+// into req.out. It answers the headers of the response.
+func (c *Client) do(ctx context.Context, req call) (http.Header, error) {
+
+	var body []byte
+	if req.body != nil {
+		var err error
+		body, err = json.Marshal(req.body)
+		if err != nil {
+			return nil, err
+		}
+	}
+	retryable := req.method != http.MethodPost || req.idempotencyKey != ""
+	signedInAgain := false
+	for attempt := 0; ; attempt++ {
+		token := req.token
+		if req.auth {
+			var err error
+			token, err = c.token(ctx)
+			if err != nil {
+				return nil, err
+			}
+		}
+		res, err := c.send(ctx, req, body, token)
+		if err != nil {
+			if retryable && attempt < c.retries && ctx.Err() == nil {
+				if err := c.wait(ctx, attempt, ""); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			return nil, err
+		}
+		apiErr := decode(res, req.out)
+		if apiErr == nil {
+			return res.Header, nil
+		}
+		// an expired token is signed in again once, without counting as a
+		// retry
+		if apiErr.Status == http.StatusUnauthorized && req.auth && !signedInAgain && c.hasCredentials() {
+			signedInAgain = true
+			if err := c.signInAgain(ctx, token); err != nil {
+				return nil, err
+			}
+			attempt--
+			continue
+		}
+		if attempt < c.retries && (apiErr.Status == http.StatusTooManyRequests || retryable && retryStatus(apiErr)) {
+			if err := c.wait(ctx, attempt, res.Header.Get("Retry-After")); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		return res.Header, apiErr
+	}
+}
+
+// retryStatus reports whether a request that is safe to retry should be
+// retried after apiErr. A rate limited request never ran, so it is retried
+// whatever it is.
+func retryStatus(apiErr *Error) bool {
+	switch apiErr.Status {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	// the first attempt is still running
+	return apiErr.Code == IdempotencyKeyInUse
+}
+
+func (c *Client) send(ctx context.Context, req call, body []byte, token string) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	r, err := http.NewRequestWithContext(ctx, req.method, c.baseURL+req.path, reader)
+	if err != nil {
+		return nil, err
+	}
+	r.Header.Set("Accept", "application/json")
+	if body != nil {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	if req.idempotencyKey != "" {
+		r.Header.Set("Idempotency-Key", req.idempotencyKey)
+	}
+	return c.http.Do(r)
+}
+
+// decode reads a successful response into out, or the problem of a failed
+// one.
+func decode(res *http.Response, out interface{}) *Error {
+	defer res.Body.Close()
+	if res.StatusCode >= http.StatusBadRequest {
+		body, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1<<20))
+		apiErr := &Error{}
+		if json.Unmarshal(body, apiErr) != nil || apiErr.Code == "" {
+			apiErr.Title = http.StatusText(res.StatusCode)
+			apiErr.Detail = strings.TrimSpace(string(body))
+		}
+		apiErr.Status = res.StatusCode
+		return apiErr
+	}
+	if out == nil || res.StatusCode == http.StatusNoContent {
+		io.Copy(ioutil.Discard, res.Body)
+		return nil
+	}
+	if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+		return &Error{Status: res.StatusCode, Code: Internal, Detail: "cannot decode the response: " + err.Error()}
+	}
+	return nil
+}
+
+// wait sleeps before retry attempt+1, for retryAfter seconds when set.
+func (c *Client) wait(ctx context.Context, attempt int, retryAfter string) error {
+	delay := c.backoff << uint(attempt)
+	if seconds, err := strconv.Atoi(retryAfter); err == nil && seconds >= 0 {
+		delay = time.Duration(seconds) * time.Second
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,94 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Code is the stable code of an API error, see GET /problems.
+type Code string
+
+// The codes the API answers with.
+const (
+	BadRequest           Code = "bad_request"
+	InvalidRequest       Code = "invalid_request"
+	ValidationFailed     Code = "validation_failed"
+	Unauthorized         Code = "unauthorized"
+	InvalidCredentials   Code = "invalid_credentials"
+	Forbidden            Code = "forbidden"
+	NotFound             Code = "not_found"
+	UserNotFound         Code = "user_not_found"
+	SellerNotFound       Code = "seller_not_found"
+	ProductNotFound      Code = "product_not_found"
+	VariantNotFound      Code = "variant_not_found"
+	CategoryNotFound     Code = "category_not_found"
+	ImageNotFound        Code = "image_not_found"
+	NotificationNotFound Code = "notification_not_found"
+	SubscriptionNotFound Code = "subscription_not_found"
+	WebhookNotFound      Code = "webhook_not_found"
+	DeliveryNotFound     Code = "delivery_not_found"
+	MethodNotAllowed     Code = "method_not_allowed"
+	Conflict             Code = "conflict"
+	UsernameTaken        Code = "username_taken"
+	EmailTaken           Code = "email_taken"
+	ProductNameTaken     Code = "product_name_taken"
+	CategoryNameTaken    Code = "category_name_taken"
+	SKUTaken             Code = "sku_taken"
+	VariantExists        Code = "variant_exists"
+	VariantsExist        Code = "variants_exist"
+	InvalidReference     Code = "invalid_reference"
+	SellerDeleted        Code = "seller_deleted"
+	InsufficientStock    Code = "insufficient_stock"
+	InsufficientBalance  Code = "insufficient_balance"
+	VariantRequired      Code = "variant_required"
+	IdempotencyKeyReused Code = "idempotency_key_reused"
+	IdempotencyKeyInUse  Code = "idempotency_key_in_use"
+	PayloadTooLarge      Code = "payload_too_large"
+	UnsupportedMediaType Code = "unsupported_media_type"
+	RateLimited          Code = "rate_limited"
+	Internal             Code = "internal_error"
+	Unavailable          Code = "unavailable"
+)
+
+// Codes lists every code above.
+var Codes = []Code{
+	BadRequest, InvalidRequest, ValidationFailed, Unauthorized, InvalidCredentials,
+	Forbidden, NotFound, UserNotFound, SellerNotFound, ProductNotFound,
+	VariantNotFound, CategoryNotFound, ImageNotFound, NotificationNotFound,
+	SubscriptionNotFound, WebhookNotFound, DeliveryNotFound, MethodNotAllowed,
+	Conflict, UsernameTaken, EmailTaken, ProductNameTaken, CategoryNameTaken,
+	SKUTaken, VariantExists, VariantsExist, InvalidReference, SellerDeleted,
+	InsufficientStock, InsufficientBalance, VariantRequired, IdempotencyKeyReused,
+	IdempotencyKeyInUse, PayloadTooLarge, UnsupportedMediaType, RateLimited,
+	Internal, Unavailable,
+}
+
+// FieldError is a field of the request that is not valid.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Error is an error the API answered with, decoded from its problem body.
+// Switch on Code, Detail is written for people and may change.
+type Error struct {
+	Status int          `json:"status"`
+	Code   Code         `json:"code"`
+	Title  string       `json:"title"`
+	Detail string       `json:"detail"`
+	Fields []FieldError `json:"errors"`
+}
+
+func (e *Error) Error() string {
+	if e.Detail == "" {
+		return fmt.Sprintf("%d %s", e.Status, e.Code)
+	}
+	return fmt.Sprintf("%d %s: %s", e.Status, e.Code, e.Detail)
+}
+
+// IsCode reports whether err is an error the API answered with code.
+func IsCode(err error, code Code) bool {
+	var apiErr *Error
+	return errors.As(err, &apiErr) && apiErr.Code == code
+}
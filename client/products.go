@@ -0,0 +1,164 @@
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// ListOptions filter the products of ListProducts.
+type ListOptions struct {
+	// Tags lists only the products carrying every one of them.
+	Tags []string
+	// IncludeDeleted lists the deleted products too, for admins.
+	IncludeDeleted bool
+	// PageSize is how many products a request fetches, 1 to 100. The API
+	// decides when 0.
+	PageSize int
+}
+
+// ListProducts goes through the products in the order of their ids, a page
+// at a time.
+func (c *Client) ListProducts(ctx context.Context, options ListOptions) *ProductIterator {
+	query := url.Values{}
+	for _, tag := range options.Tags {
+		query.Add("tag", tag)
+	}
+	if options.IncludeDeleted {
+		query.Set("include_deleted", "true")
+	}
+	if options.PageSize > 0 {
+		query.Set("limit", strconv.Itoa(options.PageSize))
+	}
+	path := "/v2/products"
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	return &ProductIterator{c: c, ctx: ctx, next: path}
+}
+
+// ProductIterator fetches the next page of products once it went through
+// the ones it has.
+//
+//	for products.Next() {
+//		product := products.Product()
+//	}
+//	if err := products.Err(); err != nil {
+//		return err
+//	}
+type ProductIterator struct {
+	c   *Client
+	ctx context.Context
+	// next is the page after page, "" after the last one.
+	next    string
+	page    []Product
+	product Product
+	err     error
+}
+
+// Next moves to the next product, false once there are no more or fetching
+// them failed.
+func (it *ProductIterator) Next() bool {
+	for len(it.page) == 0 {
+		if it.err != nil || it.next == "" {
+			return false
+		}
+		page := []Product{}
+		header, err := it.c.do(it.ctx, call{method: http.MethodGet, path: it.next, out: &page, auth: true})
+		if err != nil {
+			it.err = err
+			return false
+		}
+		it.page, it.next = page, nextPage(header)
+	}
+	it.product, it.page = it.page[0], it.page[1:]
+	return true
+}
+
+// Product is the product Next moved to.
+func (it *ProductIterator) Product() Product {
+	return it.product
+}
+
+// Err is the error that ended the iteration, nil when it went through
+// every product.
+func (it *ProductIterator) Err() error {
+	return it.err
+}
+
+// nextPage is the path of the Link with rel="next", "" without one.
+func nextPage(header http.Header) string {
+	for _, value := range header.Values("Link") {
+		for _, link := range strings.Split(value, ",") {
+			parts := strings.Split(link, ";")
+			target := strings.Trim(strings.TrimSpace(parts[0]), "<>")
+			for _, param := range parts[1:] {
+				if strings.TrimSpace(param) != `rel="next"` {
+					continue
+				}
+				if u, err := url.Parse(target); err == nil {
+					return u.RequestURI()
+				}
+			}
+		}
+	}
+	return ""
+}
+
+func (c *Client) GetProduct(ctx context.Context, id uint64) (*Product, error) {
+	product := &Product{}
+	_, err := c.do(ctx, call{method: http.MethodGet, path: fmt.Sprintf("/v2/products/%d", id), out: product, auth: true})
+	if err != nil {
+		return nil, err
+	}
+	return product, nil
+}
+
+// CreateProduct creates a product sold by the seller signed in.
+func (c *Client) CreateProduct(ctx context.Context, product NewProduct) (*Product, error) {
+	created := &Product{}
+	_, err := c.do(ctx, call{method: http.MethodPost, path: "/v2/products", body: product, out: created, auth: true})
+	if err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+func (c *Client) UpdateProduct(ctx context.Context, id uint64, update ProductUpdate) (*Product, error) {
+	product := &Product{}
+	_, err := c.do(ctx, call{method: http.MethodPut, path: fmt.Sprintf("/v2/products/%d", id), body: update, out: product, auth: true})
+	if err != nil {
+		return nil, err
+	}
+	return product, nil
+}
+
+func (c *Client) DeleteProduct(ctx context.Context, id uint64) error {
+	_, err := c.do(ctx, call{method: http.MethodDelete, path: fmt.Sprintf("/v2/products/%d", id), auth: true})
+	return err
+}
+
+// Buy buys a product for the buyer signed in. It is retried with the same
+// Idempotency-Key, so the purchase happens once however many attempts it
+// takes.
+func (c *Client) Buy(ctx context.Context, buy Buy) (*Purchase, error) {
+	key := buy.IdempotencyKey
+	if key == "" {
+		random := make([]byte, 16)
+		if _, err := rand.Read(random); err != nil {
+			return nil, err
+		}
+		key = hex.EncodeToString(random)
+	}
+	purchase := &Purchase{}
+	_, err := c.do(ctx, call{method: http.MethodPost, path: "/v2/buy", body: buy, out: purchase, auth: true, idempotencyKey: key})
+	if err != nil {
+		return nil, err
+	}
+	return purchase, nil
+}
@@ -0,0 +1,56 @@
+package client
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TokenStore keeps the token of a Client, so it can be shared by clients or
+// outlive the process. Load answers "" when there is no token.
+type TokenStore interface {
+	Load() (string, error)
+	Save(token string) error
+}
+
+// MemoryTokens keeps the token in memory, the TokenStore of a Client by
+// default.
+type MemoryTokens struct {
+	mu    sync.Mutex
+	token string
+}
+
+func (m *MemoryTokens) Load() (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.token, nil
+}
+
+func (m *MemoryTokens) Save(token string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.token = token
+	return nil
+}
+
+// expiry is when token expires, the zero time when it cannot tell. The
+// signature is not checked, the API does.
+func expiry(token string) time.Time {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return time.Time{}
+	}
+	claims := struct {
+		Exp int64 `json:"exp"`
+	}{}
+	if json.Unmarshal(payload, &claims) != nil || claims.Exp == 0 {
+		return time.Time{}
+	}
+	return time.Unix(claims.Exp, 0)
+}
@@ -0,0 +1,130 @@
+package client
+
+import "time"
+
+// User is an account of the API.
+type User struct {
+	ID        uint32     `json:"id"`
+	Username  string     `json:"username"`
+	Email     string     `json:"email"`
+	Role      string     `json:"role"`
+	Deposit   float32    `json:"deposit"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+// NewUser signs a user up. Role is buyer or seller.
+type NewUser struct {
+	Username string  `json:"username"`
+	Email    string  `json:"email"`
+	Password string  `json:"password"`
+	Role     string  `json:"role"`
+	Deposit  float32 `json:"deposit"`
+}
+
+// UserUpdate changes the username and the deposit of a user.
+type UserUpdate struct {
+	Username string  `json:"username"`
+	Deposit  float32 `json:"deposit"`
+}
+
+// Seller is the user selling a product.
+type Seller struct {
+	ID       uint32 `json:"id"`
+	Username string `json:"username"`
+}
+
+// Category is a category a product is listed in.
+type Category struct {
+	ID       uint32  `json:"id"`
+	Name     string  `json:"name"`
+	ParentID *uint32 `json:"parent_id"`
+}
+
+// Image is a picture of a product.
+type Image struct {
+	ID           uint64 `json:"id"`
+	Position     int    `json:"position"`
+	URL          string `json:"url"`
+	ThumbnailURL string `json:"thumbnail_url"`
+	ContentType  string `json:"content_type"`
+	Size         int64  `json:"size"`
+	Width        int    `json:"width"`
+	Height       int    `json:"height"`
+}
+
+// ProductOption is an axis the variants of a product differ in, like size.
+type ProductOption struct {
+	Name     string   `json:"name"`
+	Position int      `json:"position"`
+	Values   []string `json:"values"`
+}
+
+// Variant is a combination of option values with its own stock and price.
+type Variant struct {
+	ID              uint64            `json:"id"`
+	SKU             string            `json:"sku"`
+	Options         map[string]string `json:"options"`
+	AmountAvailable float32           `json:"amount_available"`
+	Price           float32           `json:"price"`
+}
+
+// Product is a product with everything shown alongside it.
+type Product struct {
+	ID                uint64          `json:"id"`
+	ProductName       string          `json:"product_name"`
+	AmountAvailable   float32         `json:"amount_available"`
+	Price             float32         `json:"price"`
+	LowStockThreshold float32         `json:"low_stock_threshold"`
+	Seller            Seller          `json:"seller"`
+	Categories        []Category      `json:"categories"`
+	Tags              []string        `json:"tags"`
+	Images            []Image         `json:"images"`
+	Options           []ProductOption `json:"options"`
+	Variants          []Variant       `json:"variants"`
+	CreatedAt         time.Time       `json:"created_at"`
+	UpdatedAt         time.Time       `json:"updated_at"`
+	DeletedAt         *time.Time      `json:"deleted_at,omitempty"`
+}
+
+// NewProduct creates a product of the seller signed in.
+type NewProduct struct {
+	ProductName       string   `json:"product_name"`
+	AmountAvailable   float32  `json:"amount_available"`
+	Price             float32  `json:"price"`
+	LowStockThreshold float32  `json:"low_stock_threshold"`
+	CategoryIDs       []uint32 `json:"category_ids"`
+	TagNames          []string `json:"tag_names"`
+}
+
+// ProductUpdate changes a product. Nil CategoryIDs and TagNames leave the
+// categories and tags as they are.
+type ProductUpdate struct {
+	ProductName       string   `json:"product_name"`
+	AmountAvailable   float32  `json:"amount_available"`
+	LowStockThreshold float32  `json:"low_stock_threshold"`
+	CategoryIDs       []uint32 `json:"category_ids"`
+	TagNames          []string `json:"tag_names"`
+}
+
+// Buy buys Qty of a product, through VariantID or SKU for the products with
+// variants. IdempotencyKey is sent with every attempt so a retried purchase
+// happens once, a random one is used when empty.
+type Buy struct {
+	ProductID      uint64  `json:"product_id,omitempty"`
+	VariantID      uint64  `json:"variant_id,omitempty"`
+	SKU            string  `json:"sku,omitempty"`
+	Qty            float32 `json:"qty"`
+	IdempotencyKey string  `json:"-"`
+}
+
+// Purchase is the outcome of a Buy. Deposit is what the buyer has left.
+type Purchase struct {
+	ProductID uint64  `json:"product_id"`
+	VariantID *uint64 `json:"variant_id"`
+	Qty       float32 `json:"qty"`
+	UnitPrice float32 `json:"unit_price"`
+	Total     float32 `json:"total"`
+	Deposit   float32 `json:"deposit"`
+}
@@ -0,0 +1,41 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// CreateUser signs a user up, it does not sign them in.
+func (c *Client) CreateUser(ctx context.Context, user NewUser) (*User, error) {
+	created := &User{}
+	_, err := c.do(ctx, call{method: http.MethodPost, path: "/v2/users", body: user, out: created})
+	if err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+func (c *Client) GetUser(ctx context.Context, id uint32) (*User, error) {
+	user := &User{}
+	_, err := c.do(ctx, call{method: http.MethodGet, path: fmt.Sprintf("/v2/users/%d", id), out: user, auth: true})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// UpdateUser changes the username and deposit of the user signed in.
+func (c *Client) UpdateUser(ctx context.Context, id uint32, update UserUpdate) (*User, error) {
+	user := &User{}
+	_, err := c.do(ctx, call{method: http.MethodPut, path: fmt.Sprintf("/v2/users/%d", id), body: update, out: user, auth: true})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (c *Client) DeleteUser(ctx context.Context, id uint32) error {
+	_, err := c.do(ctx, call{method: http.MethodDelete, path: fmt.Sprintf("/v2/users/%d", id), auth: true})
+	return err
+}
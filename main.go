@@ -1,7 +1,11 @@
 package main
 
-import "github.com/task/api"
+import (
+	"os"
+
+	"github.com/task/api"
+)
 
 func main() {
-	api.Run()
+	api.Main(os.Args[1:])
 }
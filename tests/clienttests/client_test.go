@@ -0,0 +1,414 @@
+package clienttests
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/task/api/apierror"
+	"github.com/task/api/auth"
+	"github.com/task/api/config"
+	"github.com/task/api/controllers"
+	"github.com/task/api/models"
+	"github.com/task/client"
+	"github.com/task/tests/testserver"
+	"gopkg.in/go-playground/assert.v1"
+)
+
+// initialize starts the API on a fresh SQLite database. wrap, when set, sits
+// in front of the router.
+func initialize(t *testing.T, validation config.OpenAPI, wrap func(http.Handler) http.Handler) (*controllers.Server, *httptest.Server) {
+	server := testserver.New(t, func(cfg *config.Config) { cfg.OpenAPI = validation })
+	var handler http.Handler = server.Router
+	if wrap != nil {
+		handler = wrap(handler)
+	}
+	ts := httptest.NewServer(handler)
+	t.Cleanup(ts.Close)
+	return server, ts
+}
+
+// signUp creates a user and a client signed in as them.
+func signUp(t *testing.T, ts *httptest.Server, user client.NewUser, options ...client.Option) (*client.Client, *client.User) {
+	c := client.New(ts.URL, options...)
+	created, err := c.CreateUser(context.Background(), user)
+	if err != nil {
+		t.Fatalf("cannot create %s: %v", user.Username, err)
+	}
+	if err := c.Login(context.Background(), user.Email, user.Password); err != nil {
+		t.Fatalf("cannot sign in %s: %v", user.Username, err)
+	}
+	return c, created
+}
+
+var (
+	pet = client.NewUser{Username: "pet", Email: "pet@gmail.com", Password: "password", Role: "seller"}
+	kan = client.NewUser{Username: "kan", Email: "kan@gmail.com", Password: "password", Role: "buyer", Deposit: 100}
+)
+
+// counter counts the requests a client sends.
+type counter struct {
+	mu       sync.Mutex
+	requests []string
+}
+
+func (c *counter) RoundTrip(r *http.Request) (*http.Response, error) {
+	c.mu.Lock()
+	c.requests = append(c.requests, r.Method+" "+r.URL.RequestURI())
+	c.mu.Unlock()
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func TestClient(t *testing.T) {
+
+	ctx := context.Background()
+	// the requests and responses of the client match the OpenAPI document
+	_, ts := initialize(t, config.OpenAPI{ValidateRequests: true, ValidateResponses: true}, nil)
+	sent := &counter{}
+	seller, _ := signUp(t, ts, pet, client.WithHTTPClient(&http.Client{Transport: sent}))
+
+	for _, product := range []client.NewProduct{
+		{ProductName: "kettle", AmountAvailable: 5, Price: 20, TagNames: []string{"tea"}},
+		{ProductName: "teapot", AmountAvailable: 5, Price: 30, TagNames: []string{"tea"}},
+		{ProductName: "grill", AmountAvailable: 5, Price: 40},
+		{ProductName: "pan", AmountAvailable: 5, Price: 15},
+		{ProductName: "wok", AmountAvailable: 5, Price: 25},
+	} {
+		created, err := seller.CreateProduct(ctx, product)
+		if err != nil {
+			t.Fatalf("cannot create %s: %v", product.ProductName, err)
+		}
+		assert.Equal(t, created.ProductName, product.ProductName)
+		assert.Equal(t, created.Seller.Username, "pet")
+	}
+
+	// the iterator follows the pages until one is not full
+	sent.requests = nil
+	names := []string{}
+	products := seller.ListProducts(ctx, client.ListOptions{PageSize: 2})
+	for products.Next() {
+		names = append(names, products.Product().ProductName)
+	}
+	assert.Equal(t, products.Err(), nil)
+	assert.Equal(t, names, []string{"kettle", "teapot", "grill", "pan", "wok"})
+	assert.Equal(t, sent.requests, []string{
+		"GET /v2/products?limit=2",
+		"GET /v2/products?after=2&limit=2",
+		"GET /v2/products?after=4&limit=2",
+	})
+
+	names = []string{}
+	products = seller.ListProducts(ctx, client.ListOptions{Tags: []string{"tea"}, PageSize: 1})
+	for products.Next() {
+		names = append(names, products.Product().ProductName)
+	}
+	assert.Equal(t, products.Err(), nil)
+	assert.Equal(t, names, []string{"kettle", "teapot"})
+
+	updated, err := seller.UpdateProduct(ctx, 3, client.ProductUpdate{ProductName: "grill pro", AmountAvailable: 7})
+	assert.Equal(t, err, nil)
+	assert.Equal(t, updated.ProductName, "grill pro")
+	product, err := seller.GetProduct(ctx, 3)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, product.AmountAvailable, float32(7))
+	assert.Equal(t, seller.DeleteProduct(ctx, 4), nil)
+
+	buyer, user := signUp(t, ts, kan)
+	purchase, err := buyer.Buy(ctx, client.Buy{ProductID: 1, Qty: 2})
+	assert.Equal(t, err, nil)
+	assert.Equal(t, *purchase, client.Purchase{ProductID: 1, Qty: 2, UnitPrice: 20, Total: 40, Deposit: 60})
+	user, err = buyer.GetUser(ctx, user.ID)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, user.Deposit, float32(60))
+
+	// the problems of the API are typed errors
+	_, err = buyer.Buy(ctx, client.Buy{ProductID: 1, Qty: 4})
+	assert.Equal(t, client.IsCode(err, client.InsufficientStock), true)
+	_, err = buyer.Buy(ctx, client.Buy{ProductID: 2, Qty: 3})
+	assert.Equal(t, client.IsCode(err, client.InsufficientBalance), true)
+	_, err = buyer.GetProduct(ctx, 4)
+	assert.Equal(t, client.IsCode(err, client.ProductNotFound), true)
+	_, err = seller.Buy(ctx, client.Buy{ProductID: 1, Qty: 1})
+	assert.Equal(t, client.IsCode(err, client.Forbidden), true)
+	_, err = seller.CreateProduct(ctx, client.NewProduct{AmountAvailable: 1, Price: 1})
+	apiErr, ok := err.(*client.Error)
+	assert.Equal(t, ok, true)
+	assert.Equal(t, apiErr.Status, http.StatusUnprocessableEntity)
+	assert.Equal(t, apiErr.Code, client.ValidationFailed)
+	assert.Equal(t, len(apiErr.Fields), 1)
+	assert.Equal(t, apiErr.Fields[0].Field, "product_name")
+	_, err = client.New(ts.URL).CreateUser(ctx, client.NewUser{Username: "other", Email: pet.Email, Password: "password", Role: "buyer"})
+	assert.Equal(t, client.IsCode(err, client.EmailTaken), true)
+	err = client.New(ts.URL).Login(ctx, pet.Email, "wrong-password")
+	assert.Equal(t, client.IsCode(err, client.InvalidCredentials), true)
+}
+
+func TestCodes(t *testing.T) {
+
+	// the client knows every code of the API
+	codes := []string{}
+	for _, code := range client.Codes {
+		codes = append(codes, string(code))
+	}
+	catalogue := []string{}
+	for _, entry := range apierror.Catalogue {
+		catalogue = append(catalogue, entry.Code)
+	}
+	sort.Strings(codes)
+	sort.Strings(catalogue)
+	assert.Equal(t, codes, catalogue)
+}
+
+func TestTokens(t *testing.T) {
+
+	ctx := context.Background()
+	_, ts := initialize(t, config.OpenAPI{}, nil)
+	c, user := signUp(t, ts, pet)
+
+	// a token about to expire is refreshed before it is sent
+	expiring, err := auth.CreateTokenTTL(user.ID, user.Role, time.Minute)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, c.SetToken(expiring), nil)
+	_, err = c.GetUser(ctx, user.ID)
+	assert.Equal(t, err, nil)
+	token, _ := c.Token()
+	assert.NotEqual(t, token, expiring)
+	assert.Equal(t, validFor(t, token) > 50*time.Minute, true)
+
+	// an expired one is replaced by signing in again
+	expired, err := auth.CreateTokenTTL(user.ID, user.Role, -time.Minute)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, c.SetToken(expired), nil)
+	_, err = c.GetUser(ctx, user.ID)
+	assert.Equal(t, err, nil)
+	token, _ = c.Token()
+	assert.NotEqual(t, token, expired)
+
+	// and so is one the API refuses
+	assert.Equal(t, c.SetToken("refused"), nil)
+	_, err = c.GetUser(ctx, user.ID)
+	assert.Equal(t, err, nil)
+
+	// without credentials there is nothing to sign in with
+	other := client.New(ts.URL)
+	assert.Equal(t, other.SetToken(expired), nil)
+	_, err = other.GetUser(ctx, user.ID)
+	assert.Equal(t, client.IsCode(err, client.Unauthorized), true)
+
+	// the store can be shared
+	store := &client.MemoryTokens{}
+	shared := client.New(ts.URL, client.WithTokenStore(store))
+	assert.Equal(t, shared.Login(ctx, pet.Email, pet.Password), nil)
+	_, err = client.New(ts.URL, client.WithTokenStore(store)).GetUser(ctx, user.ID)
+	assert.Equal(t, err, nil)
+}
+
+// validFor is how long token is valid for, read from its claims.
+func validFor(t *testing.T, token string) time.Duration {
+	claims := struct {
+		Exp int64 `json:"exp"`
+	}{}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		t.Fatalf("cannot read the token %q", token)
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || json.Unmarshal(payload, &claims) != nil {
+		t.Fatalf("cannot read the token %q", token)
+	}
+	return time.Until(time.Unix(claims.Exp, 0))
+}
+
+func TestRetries(t *testing.T) {
+
+	ctx := context.Background()
+	var mu sync.Mutex
+	keys := []string{}
+	dropped, unavailable := false, false
+	_, ts := initialize(t, config.OpenAPI{}, func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case r.URL.Path == "/v2/buy":
+				keys = append(keys, r.Header.Get("Idempotency-Key"))
+				if !dropped {
+					// the purchase happens, its response is lost
+					dropped = true
+					next.ServeHTTP(httptest.NewRecorder(), r)
+					conn, _, err := w.(http.Hijacker).Hijack()
+					if err == nil {
+						conn.Close()
+					}
+					return
+				}
+			case r.URL.Path == "/v2/products/1" && r.Method == http.MethodGet && !unavailable:
+				unavailable = true
+				w.Header().Set("Retry-After", "0")
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+	options := []client.Option{client.WithRetries(2, time.Millisecond)}
+	seller, _ := signUp(t, ts, pet, options...)
+	_, err := seller.CreateProduct(ctx, client.NewProduct{ProductName: "kettle", AmountAvailable: 5, Price: 20})
+	assert.Equal(t, err, nil)
+
+	// reads are retried
+	product, err := seller.GetProduct(ctx, 1)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, product.ProductName, "kettle")
+	assert.Equal(t, unavailable, true)
+
+	// a purchase is retried with its key, and happens once
+	buyer, user := signUp(t, ts, kan, options...)
+	purchase, err := buyer.Buy(ctx, client.Buy{ProductID: 1, Qty: 2})
+	assert.Equal(t, err, nil)
+	assert.Equal(t, purchase.Deposit, float32(60))
+	assert.Equal(t, len(keys), 2)
+	assert.Equal(t, keys[0] != "" && keys[0] == keys[1], true)
+	user, err = buyer.GetUser(ctx, user.ID)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, user.Deposit, float32(60))
+	product, err = buyer.GetProduct(ctx, 1)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, product.AmountAvailable, float32(3))
+
+	// another purchase gets another key
+	_, err = buyer.Buy(ctx, client.Buy{ProductID: 1, Qty: 1})
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(keys), 3)
+	assert.NotEqual(t, keys[2], keys[0])
+}
+
+func TestIdempotencyKeys(t *testing.T) {
+
+	ctx := context.Background()
+	server, ts := initialize(t, config.OpenAPI{}, nil)
+	seller, _ := signUp(t, ts, pet)
+	_, err := seller.CreateProduct(ctx, client.NewProduct{ProductName: "kettle", AmountAvailable: 5, Price: 20})
+	assert.Equal(t, err, nil)
+	buyer, user := signUp(t, ts, kan)
+	token, _ := buyer.Token()
+
+	buy := func(key, body string) *http.Response {
+		req, _ := http.NewRequest("POST", ts.URL+"/v2/buy", bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Idempotency-Key", key)
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+	read := func(res *http.Response) string {
+		defer res.Body.Close()
+		body, _ := ioutil.ReadAll(res.Body)
+		return string(body)
+	}
+
+	first := buy("key-1", `{"product_id":1,"qty":1}`)
+	assert.Equal(t, first.StatusCode, http.StatusOK)
+	assert.Equal(t, first.Header.Get("Idempotent-Replayed"), "")
+	body := read(first)
+	again := buy("key-1", `{"product_id":1,"qty":1}`)
+	assert.Equal(t, again.StatusCode, http.StatusOK)
+	assert.Equal(t, again.Header.Get("Idempotent-Replayed"), "true")
+	assert.Equal(t, again.Header.Get("Content-Type"), "application/json")
+	assert.Equal(t, read(again), body)
+
+	// a key is for one request
+	other := buy("key-1", `{"product_id":1,"qty":2}`)
+	assert.Equal(t, other.StatusCode, http.StatusUnprocessableEntity)
+	assert.Equal(t, strings.Contains(read(other), `"code":"idempotency_key_reused"`), true)
+
+	// errors are kept too, other than 5xx
+	failed := buy("key-2", `{"product_id":1,"qty":50}`)
+	assert.Equal(t, failed.StatusCode, http.StatusConflict)
+	body = read(failed)
+	failed = buy("key-2", `{"product_id":1,"qty":50}`)
+	assert.Equal(t, failed.Header.Get("Idempotent-Replayed"), "true")
+	assert.Equal(t, read(failed), body)
+
+	user, err = buyer.GetUser(ctx, user.ID)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, user.Deposit, float32(80))
+
+	other = buy(strings.Repeat("k", 256), `{"product_id":1,"qty":1}`)
+	assert.Equal(t, other.StatusCode, http.StatusUnprocessableEntity)
+	read(other)
+
+	// a request whose server stopped holds its key until the lease runs out
+	hash := sha256.Sum256([]byte("POST /v2/buy\n" + `{"product_id":1,"qty":1}`))
+	record, reserved, err := models.ReserveIdempotencyKey(server.DB, uint32(user.ID), "key-3", hex.EncodeToString(hash[:]))
+	assert.Equal(t, err, nil)
+	assert.Equal(t, reserved, true)
+	running := buy("key-3", `{"product_id":1,"qty":1}`)
+	assert.Equal(t, running.StatusCode, http.StatusConflict)
+	assert.Equal(t, strings.Contains(read(running), `"code":"idempotency_key_in_use"`), true)
+	expire := func() {
+		err := server.DB.Model(&models.IdempotencyKey{}).Where("idempotency_key = ?", "key-3").UpdateColumn("locked_until", time.Now().Add(-time.Second)).Error
+		assert.Equal(t, err, nil)
+	}
+	// a slow request still running renews its lease
+	expire()
+	err = record.Renew(server.DB, time.Now().Add(models.IdempotencyKeyLease))
+	assert.Equal(t, err, nil)
+	running = buy("key-3", `{"product_id":1,"qty":1}`)
+	assert.Equal(t, running.StatusCode, http.StatusConflict)
+	read(running)
+	expire()
+	retried := buy("key-3", `{"product_id":1,"qty":1}`)
+	assert.Equal(t, retried.StatusCode, http.StatusOK)
+	assert.Equal(t, retried.Header.Get("Idempotent-Replayed"), "")
+	read(retried)
+}
+
+func TestPages(t *testing.T) {
+
+	ctx := context.Background()
+	_, ts := initialize(t, config.OpenAPI{}, nil)
+	seller, _ := signUp(t, ts, pet)
+	for _, name := range []string{"kettle", "teapot"} {
+		_, err := seller.CreateProduct(ctx, client.NewProduct{ProductName: name, AmountAvailable: 5, Price: 20})
+		assert.Equal(t, err, nil)
+	}
+	token, _ := seller.Token()
+	get := func(path string) *http.Response {
+		req, _ := http.NewRequest("GET", ts.URL+path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		return res
+	}
+
+	res := get("/v1/products?limit=1&token=" + token)
+	assert.Equal(t, res.StatusCode, http.StatusOK)
+	assert.Equal(t, res.Header.Get("Link"), `</v1/products?after=1&limit=1>; rel="next"`)
+	res = get("/v2/products?after=1&limit=1")
+	assert.Equal(t, res.Header.Get("Link"), `</v2/products?after=2&limit=1>; rel="next"`)
+	res = get("/v2/products?after=2&limit=1")
+	assert.Equal(t, res.Header.Get("Link"), "")
+	// without a limit the pages have 100 products
+	res = get("/v2/products")
+	assert.Equal(t, res.Header.Get("Link"), "")
+	for _, path := range []string{"/v2/products?limit=0", "/v2/products?limit=101", "/v2/products?after=first"} {
+		assert.Equal(t, get(path).StatusCode, http.StatusUnprocessableEntity)
+	}
+}
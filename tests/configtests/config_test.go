@@ -0,0 +1,96 @@
+package configtests
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/task/api/config"
+	"gopkg.in/go-playground/assert.v1"
+)
+
+// writeFile writes a file into a temporary directory removed after the test.
+func writeFile(t *testing.T, name, content string) string {
+	dir, err := ioutil.TempDir("", "configtests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, name)
+	err = ioutil.WriteFile(path, []byte(content), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func setenv(t *testing.T, name, value string) {
+	os.Setenv(name, value)
+	t.Cleanup(func() { os.Unsetenv(name) })
+}
+
+func TestLoadPrecedence(t *testing.T) {
+
+	file := writeFile(t, "app.env", "API_SECRET=from-file\nDB_DRIVER=postgres\nDB_NAME=task\nDB_HOST=file-host\nDB_PORT=5432\n")
+	setenv(t, "DB_HOST", "env-host")
+	setenv(t, "DB_PORT", "6432")
+
+	cfg, args, err := config.Load([]string{"--config=" + file, "--db-port=7432", "migrate", "up"})
+	if err != nil {
+		t.Errorf("this is the error loading the config: %v\n", err)
+		return
+	}
+	assert.Equal(t, args, []string{"migrate", "up"})
+	assert.Equal(t, cfg.APISecret.Value(), "from-file")
+	assert.Equal(t, cfg.DB.Host, "env-host")
+	assert.Equal(t, cfg.DB.Port, "7432")
+	assert.Equal(t, cfg.Addr, ":8080")
+	assert.Equal(t, cfg.Webhooks.Backoff, 30*time.Second)
+	assert.Equal(t, cfg.Notify.Channels, []string{"inbox"})
+
+	// an empty variable is unset, it keeps the value of the file
+	setenv(t, "DB_HOST", "")
+	setenv(t, "API_SECRET", "")
+	cfg, _, err = config.Load([]string{"--config=" + file})
+	assert.Equal(t, err, nil)
+	assert.Equal(t, cfg.DB.Host, "file-host")
+	assert.Equal(t, cfg.APISecret.Value(), "from-file")
+}
+
+func TestSecretsFromFilesAreRedacted(t *testing.T) {
+
+	password := writeFile(t, "db_password", "s3cret\n")
+	file := writeFile(t, "app.env", "API_SECRET=key\nDB_DRIVER=postgres\nDB_NAME=task\nDB_PASSWORD_FILE="+password+"\n")
+
+	cfg, _, err := config.Load([]string{"--config=" + file})
+	if err != nil {
+		t.Errorf("this is the error loading the config: %v\n", err)
+		return
+	}
+	assert.Equal(t, cfg.DB.Password.Value(), "s3cret")
+	assert.Equal(t, strings.Contains(cfg.DB.URL(), "password=s3cret"), true)
+	assert.Equal(t, strings.Contains(cfg.String(), "s3cret"), false)
+	assert.Equal(t, strings.Contains(cfg.String(), "DB_PASSWORD=[redacted]"), true)
+
+	b, err := json.Marshal(cfg)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, strings.Contains(string(b), "s3cret"), false)
+}
+
+func TestValidate(t *testing.T) {
+
+	file := writeFile(t, "app.env", "DB_DRIVER=oracle\nSTORAGE_DRIVER=s3\nNOTIFY_CHANNELS=inbox,webhook\n")
+
+	_, _, err := config.Load([]string{"--config=" + file})
+	assert.Equal(t, err.Error(), `invalid configuration: API_SECRET is required; DB_NAME is required; DB_DRIVER "oracle" is not supported, use postgres, mysql or sqlite; S3_BUCKET is required for the s3 storage driver; NOTIFY_WEBHOOK_URL is required for the webhook channel`)
+
+	_, _, err = config.Load([]string{"--config=" + file, "--stream-heartbeat=often"})
+	assert.Equal(t, err.Error(), `invalid STREAM_HEARTBEAT "often": time: invalid duration "often"`)
+
+	_, _, err = config.Load([]string{"--config=/does/not/exist.env"})
+	assert.Equal(t, strings.HasPrefix(err.Error(), "cannot read config file /does/not/exist.env"), true)
+}
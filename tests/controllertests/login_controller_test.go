@@ -42,7 +42,7 @@ func TestSignIn(t *testing.T) {
 		{
 			email:        "Wrong email",
 			password:     "password",
-			errorMessage: "record not found",
+			errorMessage: "User Not Found",
 		},
 	}
 
@@ -79,12 +79,12 @@ func TestLogin(t *testing.T) {
 		},
 		{
 			inputJSON:    `{"email": "pet@gmail.com", "password": "wrong password"}`,
-			statusCode:   422,
+			statusCode:   401,
 			errorMessage: "Incorrect Password",
 		},
 		{
 			inputJSON:    `{"email": "frank@gmail.com", "password": "password"}`,
-			statusCode:   422,
+			statusCode:   401,
 			errorMessage: "Incorrect Details",
 		},
 		{
@@ -124,13 +124,13 @@ func TestLogin(t *testing.T) {
 			assert.NotEqual(t, rr.Body.String(), "")
 		}
 
-		if v.statusCode == 422 && v.errorMessage != "" {
+		if v.statusCode != 200 && v.errorMessage != "" {
 			responseMap := make(map[string]interface{})
 			err = json.Unmarshal([]byte(rr.Body.String()), &responseMap)
 			if err != nil {
 				t.Errorf("Cannot convert to json: %v", err)
 			}
-			assert.Equal(t, responseMap["error"], v.errorMessage)
+			assert.Equal(t, responseMap["detail"], v.errorMessage)
 		}
 	}
 }
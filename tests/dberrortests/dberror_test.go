@@ -0,0 +1,94 @@
+package dberrortests
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	"github.com/task/api/apierror"
+	"github.com/task/api/dberror"
+	"github.com/task/api/models"
+	"github.com/task/tests/testserver"
+	"gopkg.in/go-playground/assert.v1"
+)
+
+func TestClassify(t *testing.T) {
+
+	samples := []struct {
+		err     error
+		kind    dberror.Kind
+		table   string
+		columns []string
+		code    string
+	}{
+		{&pq.Error{Code: "23505", Table: "users", Constraint: "users_email_key", Detail: "Key (email)=(pet@gmail.com) already exists."}, dberror.Unique, "users", []string{"email"}, apierror.EmailTaken},
+		{&pq.Error{Code: "23505", Table: "product_variants", Constraint: "idx_product_variant_options", Detail: "Key (product_id, option_key)=(1, color=red) already exists."}, dberror.Unique, "product_variants", []string{"product_id", "option_key"}, apierror.VariantExists},
+		{&pq.Error{Code: "23503", Table: "products", Constraint: "products_seller_id_fkey", Detail: `Key (seller_id)=(9) is not present in table "users".`}, dberror.ForeignKey, "products", []string{"seller_id"}, apierror.InvalidReference},
+		{&pq.Error{Code: "23502", Table: "users", Column: "email"}, dberror.NotNull, "users", []string{"email"}, apierror.ValidationFailed},
+		{&mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'pet' for key 'username'"}, dberror.Unique, "", []string{"username"}, apierror.UsernameTaken},
+		{&mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'kettle' for key 'products.product_name'"}, dberror.Unique, "products", []string{"product_name"}, apierror.ProductNameTaken},
+		{&mysql.MySQLError{Number: 1062, Message: "Duplicate entry '1-color=red' for key 'idx_product_variant_options'"}, dberror.Unique, "", []string{"product_id", "option_key"}, apierror.VariantExists},
+		{&mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'tools' for key 'name'"}, dberror.Unique, "", []string{"name"}, apierror.CategoryNameTaken},
+		{&mysql.MySQLError{Number: 1452, Message: "Cannot add or update a child row: a foreign key constraint fails (`task`.`products`, CONSTRAINT `products_ibfk_1` FOREIGN KEY (`seller_id`) REFERENCES `users` (`id`) ON DELETE CASCADE ON UPDATE CASCADE)"}, dberror.ForeignKey, "products", []string{"seller_id"}, apierror.InvalidReference},
+		{&mysql.MySQLError{Number: 1048, Message: "Column 'email' cannot be null"}, dberror.NotNull, "", []string{"email"}, apierror.ValidationFailed},
+		// wrapped errors are classified too
+		{fmt.Errorf("cannot save user: %w", &pq.Error{Code: "23505", Table: "users", Detail: "Key (username)=(pet) already exists."}), dberror.Unique, "users", []string{"username"}, apierror.UsernameTaken},
+	}
+	for _, v := range samples {
+		violation, ok := dberror.Classify(v.err)
+		assert.Equal(t, ok, true)
+		assert.Equal(t, violation.Kind, v.kind)
+		assert.Equal(t, violation.Table, v.table)
+		assert.Equal(t, violation.Columns, v.columns)
+		e := apierror.From(http.StatusInternalServerError, v.err)
+		assert.Equal(t, e.Code, v.code)
+	}
+
+	// other errors are not guessed from their text
+	for _, err := range []error{
+		errors.New("UNIQUE constraint failed: users.email"),
+		errors.New("cannot send email"),
+		&pq.Error{Code: "40001", Message: "could not serialize access"},
+		&mysql.MySQLError{Number: 1213, Message: "Deadlock found when trying to get lock"},
+	} {
+		_, ok := dberror.Classify(err)
+		assert.Equal(t, ok, false)
+		assert.Equal(t, apierror.From(http.StatusInternalServerError, err).Code, apierror.Internal)
+	}
+}
+
+func TestSQLiteViolations(t *testing.T) {
+
+	server := testserver.New(t, nil)
+	seller := models.User{Username: "pet", Email: "pet@gmail.com", Password: "password", Role: "seller"}
+	if _, err := seller.SaveUser(server.DB); err != nil {
+		t.Fatalf("cannot seed seller: %v", err)
+	}
+	kettle := models.Product{ProductName: "kettle", AmountAvailable: 5, Price: 20, SellerID: seller.ID}
+	if _, err := kettle.SaveProduct(server.DB); err != nil {
+		t.Fatalf("cannot seed product: %v", err)
+	}
+
+	again := models.Product{ProductName: "kettle", AmountAvailable: 1, Price: 20, SellerID: seller.ID}
+	_, err := again.SaveProduct(server.DB)
+	violation, ok := dberror.Classify(err)
+	assert.Equal(t, ok, true)
+	assert.Equal(t, violation.Kind, dberror.Unique)
+	assert.Equal(t, violation.Table, "products")
+	assert.Equal(t, violation.Columns, []string{"product_name"})
+	assert.Equal(t, apierror.From(http.StatusInternalServerError, err).Code, apierror.ProductNameTaken)
+
+	// the handlers answer violations with the code of the constraint
+	req := httptest.NewRequest("POST", "/users", bytes.NewBufferString(`{"username":"pet","email":"email@gmail.com","password":"password","role":"buyer"}`))
+	rr := httptest.NewRecorder()
+	server.Router.ServeHTTP(rr, req)
+	assert.Equal(t, rr.Code, http.StatusConflict)
+	assert.Equal(t, strings.Contains(rr.Body.String(), `"code":"username_taken"`), true)
+	assert.Equal(t, strings.Contains(rr.Body.String(), `"field":"username"`), true)
+}
@@ -0,0 +1,141 @@
+package loggingtests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+	"github.com/sirupsen/logrus"
+	"github.com/task/api/auth"
+	"github.com/task/api/config"
+	"github.com/task/api/logging"
+	"github.com/task/api/middlewares"
+	"gopkg.in/go-playground/assert.v1"
+)
+
+// newLogger returns a JSON logger writing to out.
+func newLogger(t *testing.T, level string, out *bytes.Buffer) *logrus.Logger {
+	logger, err := logging.New(config.Log{Level: level, Format: "json"}, out)
+	if err != nil {
+		t.Fatalf("cannot create the logger: %v", err)
+	}
+	return logger
+}
+
+func entries(t *testing.T, out *bytes.Buffer) []map[string]interface{} {
+	all := []map[string]interface{}{}
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		entry := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("cannot parse log line %q: %v", line, err)
+		}
+		all = append(all, entry)
+	}
+	return all
+}
+
+func TestRedaction(t *testing.T) {
+
+	out := &bytes.Buffer{}
+	logger := newLogger(t, "info", out)
+	logger.WithFields(logrus.Fields{
+		"password":   "password",
+		"API_SECRET": "98hbun98h",
+		"email":      "pet@gmail.com",
+		"user_id":    1,
+	}).Info("user created")
+
+	entry := entries(t, out)[0]
+	assert.Equal(t, entry["password"], "[redacted]")
+	assert.Equal(t, entry["API_SECRET"], "[redacted]")
+	assert.Equal(t, entry["email"], "p***@gmail.com")
+	assert.Equal(t, entry["user_id"], float64(1))
+	assert.Equal(t, entry["msg"], "user created")
+
+	_, err := logging.New(config.Log{Level: "loud", Format: "json"}, out)
+	assert.NotEqual(t, err, nil)
+}
+
+func TestRequestLog(t *testing.T) {
+
+	out := &bytes.Buffer{}
+	logger := newLogger(t, "info", out)
+	auth.SetSecret("secret")
+	token, err := auth.CreateToken(7, "buyer")
+	if err != nil {
+		t.Fatalf("cannot create token: %v", err)
+	}
+
+	router := mux.NewRouter()
+	router.Use(middlewares.SetMiddlewareRequestLog(logger))
+	router.HandleFunc("/products/{id}", func(w http.ResponseWriter, r *http.Request) {
+		log, ok := logging.FromContext(r.Context())
+		assert.Equal(t, ok, true)
+		log.Info("inside the handler")
+		w.WriteHeader(http.StatusCreated)
+	})
+	router.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {})
+
+	req := httptest.NewRequest("GET", "/products/3?token="+token, nil)
+	req.Header.Set("X-Request-ID", "abc-123")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, rr.Code, http.StatusCreated)
+	assert.Equal(t, rr.Header().Get("X-Request-ID"), "abc-123")
+
+	logged := entries(t, out)
+	assert.Equal(t, len(logged), 2)
+	assert.Equal(t, logged[0]["request_id"], "abc-123")
+	assert.Equal(t, logged[0]["msg"], "inside the handler")
+	access := logged[1]
+	assert.Equal(t, access["request_id"], "abc-123")
+	assert.Equal(t, access["method"], "GET")
+	assert.Equal(t, access["route"], "/products/{id}")
+	assert.Equal(t, access["path"], "/products/3")
+	assert.Equal(t, access["status"], float64(http.StatusCreated))
+	assert.Equal(t, access["user_id"], float64(7))
+	assert.Equal(t, strings.Contains(out.String(), token), false)
+
+	// an id that could forge log lines is replaced, probes are not logged at info
+	out.Reset()
+	req = httptest.NewRequest("GET", "/healthz", nil)
+	req.Header.Set("X-Request-ID", "bad id\n")
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, len(rr.Header().Get("X-Request-ID")), 32)
+	assert.Equal(t, out.Len(), 0)
+}
+
+func TestGormLogsSQLOnlyAtDebug(t *testing.T) {
+
+	db, err := gorm.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("cannot open sqlite: %v", err)
+	}
+	defer db.Close()
+
+	out := &bytes.Buffer{}
+	db.SetLogger(logging.Gorm{Log: newLogger(t, "info", out)})
+	db.LogMode(true)
+	err = db.Exec("CREATE TABLE users (email varchar(100))").Error
+	assert.Equal(t, err, nil)
+	assert.Equal(t, out.Len(), 0)
+
+	db.SetLogger(logging.Gorm{Log: newLogger(t, "debug", out)})
+	err = db.Exec("INSERT INTO users (email) VALUES (?)", "pet@gmail.com").Error
+	assert.Equal(t, err, nil)
+	logged := entries(t, out)
+	assert.Equal(t, len(logged), 1)
+	assert.Equal(t, logged[0]["level"], "debug")
+	assert.Equal(t, logged[0]["msg"], "INSERT INTO users (email) VALUES (?)")
+	assert.Equal(t, strings.Contains(out.String(), "pet@gmail.com"), false)
+}
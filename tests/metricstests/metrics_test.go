@@ -0,0 +1,86 @@
+package metricstests
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/task/api/auth"
+	"github.com/task/api/config"
+	"github.com/task/api/models"
+	"github.com/task/tests/testserver"
+	"gopkg.in/go-playground/assert.v1"
+)
+
+func TestMetrics(t *testing.T) {
+
+	server := testserver.New(t, nil)
+	seller := models.User{Username: "pet", Email: "pet@gmail.com", Password: "password", Role: "seller"}
+	if _, err := seller.SaveUser(server.DB); err != nil {
+		t.Fatalf("cannot seed seller: %v", err)
+	}
+	buyer := models.User{Username: "steven", Email: "steven@gmail.com", Password: "password", Role: "buyer", Deposit: 50}
+	if _, err := buyer.SaveUser(server.DB); err != nil {
+		t.Fatalf("cannot seed buyer: %v", err)
+	}
+	kettle := models.Product{ProductName: "kettle", AmountAvailable: 5, Price: 20, SellerID: seller.ID}
+	if _, err := kettle.SaveProduct(server.DB); err != nil {
+		t.Fatalf("cannot seed product: %v", err)
+	}
+
+	rr := testserver.Request(server, "POST", "/login", `{"email":"steven@gmail.com","password":"password"}`, "")
+	assert.Equal(t, rr.Code, http.StatusOK)
+	rr = testserver.Request(server, "POST", "/login", `{"email":"steven@gmail.com","password":"wrong"}`, "")
+	assert.Equal(t, rr.Code, http.StatusUnauthorized)
+	rr = testserver.Request(server, "POST", "/login", `{"email":"nobody@gmail.com","password":"password"}`, "")
+	assert.Equal(t, rr.Code, http.StatusUnauthorized)
+
+	token, err := auth.CreateToken(buyer.ID, buyer.Role)
+	if err != nil {
+		t.Fatalf("cannot create token: %v", err)
+	}
+	rr = testserver.Request(server, "POST", "/buy", `{"id":1,"qty":2}`, token)
+	assert.Equal(t, rr.Code, http.StatusCreated)
+	rr = testserver.Request(server, "POST", "/buy", `{"id":1,"qty":4}`, token)
+	assert.Equal(t, rr.Code, http.StatusConflict)
+	assert.Equal(t, strings.Contains(rr.Body.String(), "not enough qty on stock"), true)
+	rr = testserver.Request(server, "POST", "/buy", `{"id":1,"qty":1}`, token)
+	assert.Equal(t, rr.Code, http.StatusConflict)
+	assert.Equal(t, strings.Contains(rr.Body.String(), "there is not enough balance to buy"), true)
+	rr = testserver.Request(server, "GET", "/products/1", "", token)
+	assert.Equal(t, rr.Code, http.StatusOK)
+
+	rr = testserver.Request(server, "GET", "/metrics", "", "")
+	assert.Equal(t, rr.Code, http.StatusOK)
+	exposed := rr.Body.String()
+	for _, line := range []string{
+		`task_logins_total{outcome="success"} 1`,
+		`task_logins_total{outcome="wrong_password"} 1`,
+		`task_logins_total{outcome="unknown_user"} 1`,
+		`task_purchases_total 1`,
+		`task_units_sold_total 2`,
+		`task_revenue_total 40`,
+		`task_failed_purchases_total{reason="insufficient_stock"} 1`,
+		`task_failed_purchases_total{reason="insufficient_balance"} 1`,
+		`task_http_requests_total{method="POST",route="/buy",status="201"} 1`,
+		`task_http_requests_total{method="GET",route="/products/{id}",status="200"} 1`,
+		`task_http_request_duration_seconds_count{method="POST",route="/login"} 3`,
+		`task_db_max_open_connections 1`,
+	} {
+		if !strings.Contains(exposed, line+"\n") {
+			t.Errorf("metrics do not have %s", line)
+		}
+	}
+}
+
+func TestMetricsToken(t *testing.T) {
+
+	server := testserver.New(t, func(cfg *config.Config) { cfg.MetricsToken = "scrape" })
+
+	rr := testserver.Request(server, "GET", "/metrics", "", "")
+	assert.Equal(t, rr.Code, http.StatusUnauthorized)
+	rr = testserver.Request(server, "GET", "/metrics", "", "wrong")
+	assert.Equal(t, rr.Code, http.StatusUnauthorized)
+	rr = testserver.Request(server, "GET", "/metrics", "", "scrape")
+	assert.Equal(t, rr.Code, http.StatusOK)
+}
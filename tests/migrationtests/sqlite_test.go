@@ -0,0 +1,158 @@
+package migrationtests
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/task/api/config"
+	"github.com/task/api/controllers"
+	"github.com/task/api/models"
+	"gopkg.in/go-playground/assert.v1"
+)
+
+// connect opens a fresh SQLite database file the way the server does.
+func connect(t *testing.T) *controllers.Server {
+	dir, err := ioutil.TempDir("", "migrationtests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	server := &controllers.Server{}
+	err = server.Connect(config.DB{Driver: "sqlite", Name: filepath.Join(dir, "task.db")})
+	if err != nil {
+		t.Fatalf("cannot connect to sqlite: %v", err)
+	}
+	t.Cleanup(func() { server.DB.Close() })
+	return server
+}
+
+func TestSQLiteMigrations(t *testing.T) {
+
+	server := connect(t)
+	migrator, err := server.Migrator()
+	if err != nil {
+		t.Fatalf("cannot create the migrator: %v", err)
+	}
+	ctx := context.Background()
+
+	// counting the pending migrations does not create the table
+	pending, err := migrator.Pending(ctx)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, pending, 2)
+	assert.Equal(t, server.DB.HasTable("schema_migrations"), false)
+
+	applied, err := migrator.Up(ctx)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(applied), 2)
+	pending, err = migrator.Pending(ctx)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, pending, 0)
+
+	// the schema keeps the constraints the seeder and the handlers rely on
+	seller := models.User{Username: "pet", Email: "pet@gmail.com", Password: "password", Role: "seller"}
+	err = server.DB.Create(&seller).Error
+	assert.Equal(t, err, nil)
+	err = server.DB.Create(&models.User{Username: "pet", Email: "other@gmail.com", Password: "password", Role: "buyer"}).Error
+	assert.Equal(t, strings.Contains(err.Error(), "users.username"), true)
+	err = server.DB.Create(&models.Product{ProductName: "orphan", AmountAvailable: 1, Price: 1, SellerID: seller.ID + 100}).Error
+	assert.Equal(t, strings.Contains(err.Error(), "FOREIGN KEY"), true)
+
+	// a migration edited after it was applied is refused
+	err = server.DB.Exec("UPDATE schema_migrations SET checksum = 'edited'").Error
+	assert.Equal(t, err, nil)
+	_, err = migrator.Status(ctx)
+	assert.Equal(t, strings.Contains(err.Error(), "changed after it was applied"), true)
+	err = server.DB.Exec("DELETE FROM schema_migrations").Error
+	assert.Equal(t, err, nil)
+
+	// the schema uses IF NOT EXISTS, so applying it again adopts the tables
+	applied, err = migrator.Up(ctx)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(applied), 2)
+
+	reverted, err := migrator.Down(ctx, 1)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(reverted), 1)
+	assert.Equal(t, server.DB.HasTable(&models.IdempotencyKey{}), false)
+	assert.Equal(t, server.DB.HasTable(&models.User{}), true)
+	reverted, err = migrator.Down(ctx, 1)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(reverted), 1)
+	assert.Equal(t, server.DB.HasTable(&models.User{}), false)
+}
+
+func TestForeignKeysRestrictDeletes(t *testing.T) {
+
+	server := connect(t)
+	migrator, err := server.Migrator()
+	if err != nil {
+		t.Fatalf("cannot create the migrator: %v", err)
+	}
+	_, err = migrator.Up(context.Background())
+	assert.Equal(t, err, nil)
+
+	seller := models.User{Username: "pet", Email: "pet@gmail.com", Password: "password", Role: "seller"}
+	buyer := models.User{Username: "kan", Email: "kan@gmail.com", Password: "password", Role: "buyer"}
+	for _, user := range []*models.User{&seller, &buyer} {
+		assert.Equal(t, server.DB.Create(user).Error, nil)
+	}
+	product := models.Product{ProductName: "kettle", AmountAvailable: 1, Price: 1, SellerID: seller.ID}
+	assert.Equal(t, server.DB.Create(&product).Error, nil)
+	variant := models.ProductVariant{ProductID: product.ID, SKU: "kettle-red", OptionKey: `{"color":"red"}`, AmountAvailable: 1}
+	assert.Equal(t, server.DB.Create(&variant).Error, nil)
+	for _, row := range []interface{}{
+		&models.ProductImage{ProductID: product.ID, Key: "a.png", ThumbnailKey: "a_thumb.png", URL: "/a.png", ThumbnailURL: "/a_thumb.png", ContentType: "image/png"},
+		&models.InventoryMovement{ProductID: product.ID, VariantID: &variant.ID, Reason: models.MovementRestock, Quantity: 1, Balance: 1, ActorID: seller.ID},
+		&models.Notification{UserID: buyer.ID, Type: "restocked", ProductID: product.ID, VariantID: &variant.ID, Title: "back", Message: "back in stock"},
+		&models.RestockSubscription{UserID: buyer.ID, ProductID: product.ID, VariantID: &variant.ID},
+	} {
+		assert.Equal(t, server.DB.Create(row).Error, nil)
+	}
+
+	// the database no longer deletes the products and images of a user
+	err = server.DB.Unscoped().Delete(&seller).Error
+	assert.Equal(t, strings.Contains(err.Error(), "FOREIGN KEY"), true)
+	err = server.DB.Unscoped().Delete(&product).Error
+	assert.Equal(t, strings.Contains(err.Error(), "FOREIGN KEY"), true)
+
+	// a variant goes with its subscriptions and notifications, its movements
+	// stay in the log without it
+	blue := models.ProductVariant{ProductID: product.ID, SKU: "kettle-blue", OptionKey: `{"color":"blue"}`, AmountAvailable: 1}
+	assert.Equal(t, server.DB.Create(&blue).Error, nil)
+	movement := models.InventoryMovement{ProductID: product.ID, VariantID: &blue.ID, Reason: models.MovementRestock, Quantity: 1, Balance: 1, ActorID: seller.ID}
+	assert.Equal(t, server.DB.Create(&movement).Error, nil)
+	deleted, err := blue.DeleteAVariant(server.DB, product.ID, blue.ID)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, deleted, int64(1))
+	kept := models.InventoryMovement{}
+	assert.Equal(t, server.DB.First(&kept, movement.ID).Error, nil)
+	assert.Equal(t, kept.VariantID, (*uint64)(nil))
+
+	// the purgers remove the children first
+	_, err = (&models.User{}).DeleteAUser(server.DB, seller.ID)
+	assert.Equal(t, err, nil)
+	images, products, err := models.PurgeDeletedProducts(server.DB, time.Now().Add(time.Minute))
+	assert.Equal(t, err, nil)
+	assert.Equal(t, products, int64(1))
+	assert.Equal(t, len(images), 1)
+	users, err := models.PurgeDeletedUsers(server.DB, time.Now().Add(time.Minute))
+	assert.Equal(t, err, nil)
+	assert.Equal(t, users, int64(1))
+	for _, table := range []interface{}{&models.InventoryMovement{}, &models.Notification{}, &models.RestockSubscription{}, &models.ProductVariant{}} {
+		count := -1
+		server.DB.Model(table).Count(&count)
+		assert.Equal(t, count, 0)
+	}
+}
+
+func TestConnectRejectsUnknownDrivers(t *testing.T) {
+
+	server := controllers.Server{}
+	err := server.Connect(config.DB{Driver: "oracle", Name: "task"})
+	assert.Equal(t, err.Error(), `unsupported database driver "oracle", use postgres, mysql or sqlite`)
+}
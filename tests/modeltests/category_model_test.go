@@ -0,0 +1,124 @@
+package modeltests
+
+import (
+	"log"
+	"testing"
+
+	"github.com/task/api/models"
+	"gopkg.in/go-playground/assert.v1"
+)
+
+func TestSaveProductWithCategoriesAndTags(t *testing.T) {
+
+	err := refreshCategoryTables()
+	if err != nil {
+		log.Fatalf("Error refreshing tables %v\n", err)
+	}
+	categories, err := seedCategoryTree()
+	if err != nil {
+		log.Fatalf("Cannot seed categories %v\n", err)
+	}
+	user, err := seedOneUser()
+	if err != nil {
+		log.Fatalf("Cannot seed user %v\n", err)
+	}
+	newProduct := models.Product{
+		ProductName:     "T-shirt",
+		AmountAvailable: 10,
+		Price:           5,
+		SellerID:        user.ID,
+		CategoryIDs:     []uint32{categories[1].ID},
+		TagNames:        []string{"Summer", "cotton", "summer "},
+	}
+	savedProduct, err := newProduct.SaveProduct(server.DB)
+	if err != nil {
+		t.Errorf("this is the error saving the product: %v\n", err)
+		return
+	}
+	assert.Equal(t, len(savedProduct.Categories), 1)
+	assert.Equal(t, savedProduct.Categories[0].ID, categories[1].ID)
+	assert.Equal(t, len(savedProduct.Tags), 2)
+}
+
+func TestFindProductsByCategoryIncludesChildren(t *testing.T) {
+
+	err := refreshCategoryTables()
+	if err != nil {
+		log.Fatalf("Error refreshing tables %v\n", err)
+	}
+	categories, err := seedCategoryTree()
+	if err != nil {
+		log.Fatalf("Cannot seed categories %v\n", err)
+	}
+	user, err := seedOneUser()
+	if err != nil {
+		log.Fatalf("Cannot seed user %v\n", err)
+	}
+	product := models.Product{
+		ProductName:     "T-shirt",
+		AmountAvailable: 10,
+		Price:           5,
+		SellerID:        user.ID,
+		CategoryIDs:     []uint32{categories[1].ID},
+	}
+	_, err = product.SaveProduct(server.DB)
+	if err != nil {
+		log.Fatalf("Cannot seed product %v\n", err)
+	}
+	products, err := productInstance.FindProductsByCategory(server.DB, categories[0].ID)
+	if err != nil {
+		t.Errorf("this is the error getting the products: %v\n", err)
+		return
+	}
+	assert.Equal(t, len(*products), 1)
+}
+
+func TestFindProductsByTags(t *testing.T) {
+
+	err := refreshCategoryTables()
+	if err != nil {
+		log.Fatalf("Error refreshing tables %v\n", err)
+	}
+	user, err := seedOneUser()
+	if err != nil {
+		log.Fatalf("Cannot seed user %v\n", err)
+	}
+	products := []models.Product{
+		models.Product{ProductName: "Red shirt", AmountAvailable: 1, Price: 1, SellerID: user.ID, TagNames: []string{"red", "shirt"}},
+		models.Product{ProductName: "Red hat", AmountAvailable: 1, Price: 1, SellerID: user.ID, TagNames: []string{"red"}},
+	}
+	for i := range products {
+		_, err = products[i].SaveProduct(server.DB)
+		if err != nil {
+			log.Fatalf("Cannot seed product %v\n", err)
+		}
+	}
+	found, err := productInstance.FindProductsByTags(server.DB, []string{"red"})
+	if err != nil {
+		t.Errorf("this is the error getting the products: %v\n", err)
+		return
+	}
+	assert.Equal(t, len(*found), 2)
+
+	found, err = productInstance.FindProductsByTags(server.DB, []string{"red", "shirt"})
+	if err != nil {
+		t.Errorf("this is the error getting the products: %v\n", err)
+		return
+	}
+	assert.Equal(t, len(*found), 1)
+}
+
+func TestCategoryCannotBeMovedUnderItsChild(t *testing.T) {
+
+	err := refreshCategoryTables()
+	if err != nil {
+		log.Fatalf("Error refreshing tables %v\n", err)
+	}
+	categories, err := seedCategoryTree()
+	if err != nil {
+		log.Fatalf("Cannot seed categories %v\n", err)
+	}
+	update := models.Category{Name: "Clothing", ParentID: &categories[1].ID}
+	_, err = update.UpdateACategory(server.DB, categories[0].ID)
+	assert.Equal(t, err.Error(), "Invalid Parent Category")
+}
@@ -0,0 +1,65 @@
+package modeltests
+
+import (
+	"log"
+	"testing"
+
+	"github.com/task/api/models"
+	"gopkg.in/go-playground/assert.v1"
+)
+
+func TestAdjustStockRecordsMovement(t *testing.T) {
+
+	err := refreshUserAndProductTable()
+	if err != nil {
+		log.Fatalf("Error refreshing user and product table: %v\n", err)
+	}
+	product, err := seedOneUserAndOneProduct()
+	if err != nil {
+		log.Fatalf("Error Seeding tables")
+	}
+	movement := models.InventoryMovement{
+		ProductID: product.ID,
+		Reason:    models.MovementSale,
+		Quantity:  -10,
+		ActorID:   product.SellerID,
+	}
+	recorded, err := movement.AdjustStock(server.DB)
+	if err != nil {
+		t.Errorf("this is the error adjusting the stock: %v\n", err)
+		return
+	}
+	assert.Equal(t, recorded.Balance, product.AmountAvailable-10)
+
+	history, err := movement.FindStockHistory(server.DB, product.ID, nil)
+	if err != nil {
+		t.Errorf("this is the error getting the history: %v\n", err)
+		return
+	}
+	assert.Equal(t, len(*history), 1)
+	assert.Equal(t, (*history)[0].Reason, models.MovementSale)
+}
+
+func TestAdjustStockNeverGoesNegative(t *testing.T) {
+
+	err := refreshUserAndProductTable()
+	if err != nil {
+		log.Fatalf("Error refreshing user and product table: %v\n", err)
+	}
+	product, err := seedOneUserAndOneProduct()
+	if err != nil {
+		log.Fatalf("Error Seeding tables")
+	}
+	movement := models.InventoryMovement{
+		ProductID: product.ID,
+		Reason:    models.MovementCorrection,
+		Quantity:  -(product.AmountAvailable + 1),
+		ActorID:   product.SellerID,
+	}
+	_, err = movement.AdjustStock(server.DB)
+	assert.Equal(t, err.Error(), "not enough qty on stock")
+
+	found, err := productInstance.FindProductByID(server.DB, product.ID)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, found.AmountAvailable, product.AmountAvailable)
+}
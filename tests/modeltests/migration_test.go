@@ -0,0 +1,76 @@
+package modeltests
+
+import (
+	"context"
+	"log"
+	"testing"
+
+	"github.com/task/api/migrations"
+	"github.com/task/api/models"
+	"gopkg.in/go-playground/assert.v1"
+)
+
+func TestLoadMigrations(t *testing.T) {
+
+	for _, driver := range []string{"postgres", "mysql"} {
+		loaded, err := migrations.Load(driver)
+		if err != nil {
+			t.Errorf("this is the error loading the %s migrations: %v\n", driver, err)
+			return
+		}
+		assert.Equal(t, loaded[0].Version, int64(1))
+		assert.Equal(t, loaded[0].Name, "initial_schema")
+		assert.Equal(t, len(loaded[0].Checksum), 64)
+		assert.Equal(t, loaded[0].Down != "", true)
+	}
+	_, err := migrations.Load("oracle")
+	assert.Equal(t, err.Error(), `no migrations for driver "oracle"`)
+}
+
+func TestMigrateUpAndDown(t *testing.T) {
+
+	err := server.DB.DropTableIfExists("schema_migrations", "product_categories", &models.IdempotencyKey{}, "product_tags", &models.OutboxEvent{}, &models.WebhookDelivery{}, &models.Webhook{}, &models.RestockSubscription{}, &models.Notification{}, &models.InventoryMovement{}, &models.ProductVariant{}, &models.ProductOption{}, &models.ProductImage{}, &models.Tag{}, &models.Category{}, &models.Product{}, &models.User{}).Error
+	if err != nil {
+		log.Fatalf("cannot drop tables: %v", err)
+	}
+	migrator, err := migrations.New(server.DB.DB(), "postgres")
+	if err != nil {
+		log.Fatalf("cannot create the migrator: %v", err)
+	}
+	ctx := context.Background()
+
+	applied, err := migrator.Up(ctx)
+	if err != nil {
+		t.Errorf("this is the error migrating up: %v\n", err)
+		return
+	}
+	assert.Equal(t, len(applied), 2)
+	assert.Equal(t, server.DB.HasTable(&models.OutboxEvent{}), true)
+	assert.Equal(t, server.DB.HasTable(&models.IdempotencyKey{}), true)
+
+	applied, err = migrator.Up(ctx)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(applied), 0)
+
+	pending, err := migrator.Pending(ctx)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, pending, 0)
+
+	user := models.User{Username: "Sam Phil", Email: "sam@gmail.com", Password: "password", Role: "seller"}
+	err = server.DB.Create(&user).Error
+	if err != nil {
+		log.Fatalf("cannot seed users table: %v", err)
+	}
+
+	reverted, err := migrator.Down(ctx, 2)
+	if err != nil {
+		t.Errorf("this is the error migrating down: %v\n", err)
+		return
+	}
+	assert.Equal(t, len(reverted), 2)
+	assert.Equal(t, server.DB.HasTable(&models.User{}), false)
+
+	pending, err = migrator.Pending(ctx)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, pending, 2)
+}
@@ -83,11 +83,11 @@ func seedUsers() error {
 
 func refreshUserAndProductTable() error {
 
-	err := server.DB.DropTableIfExists(&models.User{}, &models.Product{}).Error
+	err := server.DB.DropTableIfExists(&models.User{}, &models.Product{}, &models.Notification{}, &models.RestockSubscription{}, &models.Webhook{}, &models.WebhookDelivery{}, &models.OutboxEvent{}).Error
 	if err != nil {
 		return err
 	}
-	err = server.DB.AutoMigrate(&models.User{}, &models.Product{}).Error
+	err = server.DB.AutoMigrate(&models.User{}, &models.Product{}, &models.Category{}, &models.Tag{}, &models.ProductImage{}, &models.ProductOption{}, &models.ProductVariant{}, &models.InventoryMovement{}, &models.Notification{}, &models.RestockSubscription{}, &models.Webhook{}, &models.WebhookDelivery{}, &models.OutboxEvent{}).Error
 	if err != nil {
 		return err
 	}
@@ -166,3 +166,56 @@ func seedUsersAndProducts() ([]models.User, []models.Product, error) {
 	}
 	return users, products, nil
 }
+
+func refreshCategoryTables() error {
+
+	err := server.DB.DropTableIfExists("product_categories", "product_tags", &models.Tag{}, &models.Category{}, &models.User{}, &models.Product{}).Error
+	if err != nil {
+		return err
+	}
+	err = server.DB.AutoMigrate(&models.User{}, &models.Product{}, &models.Category{}, &models.Tag{}).Error
+	if err != nil {
+		return err
+	}
+	log.Printf("Successfully refreshed tables")
+	return nil
+}
+
+func seedCategoryTree() ([]models.Category, error) {
+
+	root := models.Category{Name: "Clothing"}
+	err := server.DB.Model(&models.Category{}).Create(&root).Error
+	if err != nil {
+		return []models.Category{}, err
+	}
+	child := models.Category{Name: "Shirts", ParentID: &root.ID}
+	err = server.DB.Model(&models.Category{}).Create(&child).Error
+	if err != nil {
+		return []models.Category{}, err
+	}
+	return []models.Category{root, child}, nil
+}
+
+func seedProductWithOptions() (models.Product, error) {
+
+	err := server.DB.DropTableIfExists(&models.ProductVariant{}, &models.ProductOption{}).Error
+	if err != nil {
+		return models.Product{}, err
+	}
+	err = server.DB.AutoMigrate(&models.ProductOption{}, &models.ProductVariant{}, &models.InventoryMovement{}).Error
+	if err != nil {
+		return models.Product{}, err
+	}
+	product, err := seedOneUserAndOneProduct()
+	if err != nil {
+		return models.Product{}, err
+	}
+	_, err = models.SetProductOptions(server.DB, product.ID, []models.ProductOption{
+		models.ProductOption{Name: "size", Values: []string{"S", "M", "L"}},
+		models.ProductOption{Name: "color", Values: []string{"red", "blue"}},
+	})
+	if err != nil {
+		return models.Product{}, err
+	}
+	return product, nil
+}
@@ -0,0 +1,88 @@
+package modeltests
+
+import (
+	"log"
+	"testing"
+
+	"github.com/task/api/models"
+	"gopkg.in/go-playground/assert.v1"
+)
+
+func TestSaveSubscriptionIsIdempotent(t *testing.T) {
+
+	err := refreshUserAndProductTable()
+	if err != nil {
+		log.Fatalf("Error refreshing user and product table: %v\n", err)
+	}
+	product, err := seedOneUserAndOneProduct()
+	if err != nil {
+		log.Fatalf("Error Seeding tables")
+	}
+	subscription := models.RestockSubscription{UserID: product.SellerID, ProductID: product.ID}
+	first, err := subscription.SaveSubscription(server.DB)
+	if err != nil {
+		t.Errorf("this is the error saving the subscription: %v\n", err)
+		return
+	}
+	again := models.RestockSubscription{UserID: product.SellerID, ProductID: product.ID}
+	second, err := again.SaveSubscription(server.DB)
+	if err != nil {
+		t.Errorf("this is the error saving the subscription: %v\n", err)
+		return
+	}
+	assert.Equal(t, first.ID, second.ID)
+
+	pending, err := subscription.FindPendingSubscriptions(server.DB, product.ID, nil)
+	if err != nil {
+		t.Errorf("this is the error getting the subscriptions: %v\n", err)
+		return
+	}
+	assert.Equal(t, len(*pending), 1)
+
+	err = (*pending)[0].MarkNotified(server.DB)
+	if err != nil {
+		t.Errorf("this is the error marking the subscription: %v\n", err)
+		return
+	}
+	pending, _ = subscription.FindPendingSubscriptions(server.DB, product.ID, nil)
+	assert.Equal(t, len(*pending), 0)
+}
+
+func TestMarkNotificationRead(t *testing.T) {
+
+	err := refreshUserAndProductTable()
+	if err != nil {
+		log.Fatalf("Error refreshing user and product table: %v\n", err)
+	}
+	product, err := seedOneUserAndOneProduct()
+	if err != nil {
+		log.Fatalf("Error Seeding tables")
+	}
+	notification := models.Notification{
+		UserID:    product.SellerID,
+		Type:      "low_stock",
+		ProductID: product.ID,
+		Title:     "running low",
+	}
+	saved, err := notification.SaveNotification(server.DB)
+	if err != nil {
+		t.Errorf("this is the error saving the notification: %v\n", err)
+		return
+	}
+	_, err = notification.MarkRead(server.DB, saved.ID, product.SellerID+1)
+	assert.Equal(t, err.Error(), "Notification Not Found")
+
+	read, err := notification.MarkRead(server.DB, saved.ID, product.SellerID)
+	if err != nil {
+		t.Errorf("this is the error reading the notification: %v\n", err)
+		return
+	}
+	assert.Equal(t, read.ReadAt != nil, true)
+
+	unread, err := notification.FindUserNotifications(server.DB, product.SellerID, true)
+	if err != nil {
+		t.Errorf("this is the error getting the notifications: %v\n", err)
+		return
+	}
+	assert.Equal(t, len(*unread), 0)
+}
@@ -0,0 +1,92 @@
+package modeltests
+
+import (
+	"errors"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/task/api/events"
+	"github.com/task/api/models"
+	"gopkg.in/go-playground/assert.v1"
+)
+
+func TestRecordEventFollowsTheTransaction(t *testing.T) {
+
+	err := refreshUserAndProductTable()
+	if err != nil {
+		log.Fatalf("Error refreshing user and product table: %v\n", err)
+	}
+	product, err := seedOneUserAndOneProduct()
+	if err != nil {
+		log.Fatalf("Error Seeding tables")
+	}
+	err = models.Transaction(server.DB, func(tx *gorm.DB) error {
+		_, err := models.RecordEvent(tx, models.EventProductUpdated, product.SellerID, product)
+		if err != nil {
+			return err
+		}
+		return errors.New("rollback")
+	})
+	assert.Equal(t, err.Error(), "rollback")
+
+	movement := models.InventoryMovement{ProductID: product.ID, Reason: models.MovementSale, Quantity: -5, ActorID: product.SellerID}
+	err = models.Transaction(server.DB, func(tx *gorm.DB) error {
+		_, err := movement.AdjustStock(tx)
+		return err
+	})
+	if err != nil {
+		t.Errorf("this is the error adjusting the stock: %v\n", err)
+		return
+	}
+
+	pending, err := models.ClaimUnpublishedEvents(server.DB, time.Now(), 10, 100)
+	if err != nil {
+		t.Errorf("this is the error getting the events: %v\n", err)
+		return
+	}
+	assert.Equal(t, len(*pending), 1)
+	assert.Equal(t, (*pending)[0].Type, models.EventStockChanged)
+	assert.Equal(t, (*pending)[0].SellerID, product.SellerID)
+}
+
+func TestDispatcherPublishesAndRetries(t *testing.T) {
+
+	err := refreshUserAndProductTable()
+	if err != nil {
+		log.Fatalf("Error refreshing user and product table: %v\n", err)
+	}
+	_, err = models.RecordEvent(server.DB, models.EventUserCreated, 0, map[string]interface{}{"id": 1})
+	if err != nil {
+		t.Errorf("this is the error recording the event: %v\n", err)
+		return
+	}
+
+	received := []events.Event{}
+	fail := true
+	bus := events.NewBus()
+	bus.Subscribe(models.EventUserCreated, func(e events.Event) error {
+		received = append(received, e)
+		if fail {
+			return errors.New("subscriber down")
+		}
+		return nil
+	})
+	dispatcher := events.Dispatcher{DB: server.DB, Bus: bus}
+
+	published, err := dispatcher.DispatchPending()
+	assert.Equal(t, err, nil)
+	assert.Equal(t, published, 0)
+
+	fail = false
+	published, err = dispatcher.DispatchPending()
+	assert.Equal(t, err, nil)
+	assert.Equal(t, published, 1)
+	assert.Equal(t, len(received), 2)
+	assert.Equal(t, received[0].ID, received[1].ID)
+	assert.Equal(t, string(received[1].Payload), `{"id":1}`)
+
+	pending, _ := models.ClaimUnpublishedEvents(server.DB, time.Now(), 10, 100)
+	assert.Equal(t, len(*pending), 0)
+}
@@ -0,0 +1,58 @@
+package modeltests
+
+import (
+	"log"
+	"testing"
+
+	"github.com/task/api/events"
+	"github.com/task/api/models"
+	"github.com/task/api/realtime"
+	"gopkg.in/go-playground/assert.v1"
+)
+
+func TestReplayAndHubFollowTheFilter(t *testing.T) {
+
+	err := refreshUserAndProductTable()
+	if err != nil {
+		log.Fatalf("Error refreshing user and product table: %v\n", err)
+	}
+	recorded := []*models.OutboxEvent{}
+	for _, e := range []struct {
+		eventType string
+		sellerID  uint32
+		payload   map[string]interface{}
+	}{
+		{models.EventProductUpdated, 1, map[string]interface{}{"id": 10}},
+		{models.EventStockChanged, 2, map[string]interface{}{"product_id": 20}},
+		{models.EventUserCreated, 0, map[string]interface{}{"id": 3}},
+		{models.EventProductDeleted, 1, map[string]interface{}{"id": 11}},
+	} {
+		event, err := models.RecordEvent(server.DB, e.eventType, e.sellerID, e.payload)
+		if err != nil {
+			t.Errorf("this is the error recording the event: %v\n", err)
+			return
+		}
+		recorded = append(recorded, event)
+	}
+
+	hub := realtime.NewHub()
+	sub := hub.Subscribe(realtime.Filter{SellerIDs: []uint32{1}})
+	bus := events.NewBus()
+	for _, eventType := range realtime.Types {
+		bus.Subscribe(eventType, hub.Handle)
+	}
+	_, err = (&events.Dispatcher{DB: server.DB, Bus: bus}).DispatchPending()
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(sub.C), 2)
+	assert.Equal(t, (<-sub.C).ProductID, uint64(10))
+	assert.Equal(t, (<-sub.C).ProductID, uint64(11))
+
+	updates, err := realtime.Replay(server.DB, recorded[0].ID, realtime.Filter{ProductIDs: []uint64{11, 20}}, 100, 10)
+	if err != nil {
+		t.Errorf("this is the error replaying the updates: %v\n", err)
+		return
+	}
+	assert.Equal(t, len(updates), 2)
+	assert.Equal(t, updates[0].Type, models.EventStockChanged)
+	assert.Equal(t, updates[1].ID, recorded[3].ID)
+}
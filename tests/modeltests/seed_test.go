@@ -0,0 +1,44 @@
+package modeltests
+
+import (
+	"log"
+	"testing"
+
+	"github.com/task/api/models"
+	"github.com/task/api/seed"
+	"gopkg.in/go-playground/assert.v1"
+)
+
+func TestLoadFixture(t *testing.T) {
+
+	err := refreshUserAndProductTable()
+	if err != nil {
+		log.Fatalf("Error refreshing user and product table: %v\n", err)
+	}
+	err = refreshCategoryTables()
+	if err != nil {
+		log.Fatalf("Error refreshing category tables: %v\n", err)
+	}
+	err = seed.LoadFixture(server.DB, "../../api/seed/fixtures/sample.json")
+	if err != nil {
+		t.Errorf("this is the error loading the fixture: %v\n", err)
+		return
+	}
+	user := models.User{}
+	admin, err := user.FindUserByEmail(server.DB, "admin@gmail.com")
+	if err != nil {
+		t.Errorf("this is the error finding the admin: %v\n", err)
+		return
+	}
+	assert.Equal(t, admin.Role, "admin")
+
+	product := models.Product{}
+	found, err := product.FindProductByID(server.DB, 1)
+	if err != nil {
+		t.Errorf("this is the error getting the product: %v\n", err)
+		return
+	}
+	assert.Equal(t, found.Seller.Email, "haitham@gmail.com")
+	assert.Equal(t, found.Categories[0].Name, "Phones")
+	assert.Equal(t, found.Tags[0].Name, "sample")
+}
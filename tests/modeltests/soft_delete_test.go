@@ -0,0 +1,93 @@
+package modeltests
+
+import (
+	"log"
+	"testing"
+	"time"
+
+	"github.com/task/api/models"
+	"gopkg.in/go-playground/assert.v1"
+)
+
+func TestDeleteAUserKeepsProductsRestorable(t *testing.T) {
+
+	err := refreshUserAndProductTable()
+	if err != nil {
+		log.Fatalf("Error refreshing user and product table: %v\n", err)
+	}
+	product, err := seedOneUserAndOneProduct()
+	if err != nil {
+		log.Fatalf("Error Seeding tables")
+	}
+	_, err = userInstance.DeleteAUser(server.DB, product.SellerID)
+	if err != nil {
+		t.Errorf("this is the error deleting the user: %v\n", err)
+		return
+	}
+	products, err := productInstance.FindAllProducts(server.DB)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(*products), 0)
+
+	products, err = productInstance.FindAllProducts(server.DB.Unscoped())
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(*products), 1)
+
+	_, err = userInstance.RestoreAUser(server.DB, product.SellerID)
+	if err != nil {
+		t.Errorf("this is the error restoring the user: %v\n", err)
+		return
+	}
+	products, err = productInstance.FindAllProducts(server.DB)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(*products), 1)
+}
+
+func TestRestoreAProduct(t *testing.T) {
+
+	err := refreshUserAndProductTable()
+	if err != nil {
+		log.Fatalf("Error refreshing user and product table: %v\n", err)
+	}
+	product, err := seedOneUserAndOneProduct()
+	if err != nil {
+		log.Fatalf("Error Seeding tables")
+	}
+	_, err = productInstance.DeleteAProduct(server.DB, product.ID, product.SellerID)
+	if err != nil {
+		t.Errorf("this is the error deleting the product: %v\n", err)
+		return
+	}
+	_, err = productInstance.FindProductByID(server.DB, product.ID)
+	assert.NotEqual(t, err, nil)
+
+	restored, err := productInstance.RestoreAProduct(server.DB, product.ID, product.SellerID)
+	if err != nil {
+		t.Errorf("this is the error restoring the product: %v\n", err)
+		return
+	}
+	assert.Equal(t, restored.ID, product.ID)
+}
+
+func TestPurgeDeletedProducts(t *testing.T) {
+
+	err := refreshUserAndProductTable()
+	if err != nil {
+		log.Fatalf("Error refreshing user and product table: %v\n", err)
+	}
+	product, err := seedOneUserAndOneProduct()
+	if err != nil {
+		log.Fatalf("Error Seeding tables")
+	}
+	_, err = productInstance.DeleteAProduct(server.DB, product.ID, product.SellerID)
+	if err != nil {
+		t.Errorf("this is the error deleting the product: %v\n", err)
+		return
+	}
+	_, purged, err := models.PurgeDeletedProducts(server.DB, time.Now().Add(-time.Hour))
+	assert.Equal(t, err, nil)
+	assert.Equal(t, purged, int64(0))
+
+	_, purged, err = models.PurgeDeletedProducts(server.DB, time.Now().Add(time.Minute))
+	assert.Equal(t, err, nil)
+	assert.Equal(t, purged, int64(1))
+}
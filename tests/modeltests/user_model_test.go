@@ -100,3 +100,79 @@ func TestUpdateAUser(t *testing.T) {
 	assert.Equal(t, updatedUser.Email, userUpdate.Email)
 	assert.Equal(t, updatedUser.Username, userUpdate.Username)
 }
+
+func TestUpdateAUserRoleAndPassword(t *testing.T) {
+
+	err := refreshUserTable()
+	if err != nil {
+		log.Fatal(err)
+	}
+	user, err := seedOneUser()
+	if err != nil {
+		log.Fatalf("Cannot seed user: %v\n", err)
+	}
+	userInstance := models.User{}
+	_, err = userInstance.UpdateAUserRole(server.DB, user.ID, "root")
+	assert.Equal(t, err.Error(), "Not Vaild Role Please Set To seller, buyer or admin")
+
+	updatedUser, err := userInstance.UpdateAUserRole(server.DB, user.ID, "admin")
+	if err != nil {
+		t.Errorf("this is the error setting the role: %v\n", err)
+		return
+	}
+	assert.Equal(t, updatedUser.Role, "admin")
+
+	updatedUser, err = userInstance.UpdateAUserPassword(server.DB, user.ID, "new password")
+	if err != nil {
+		t.Errorf("this is the error resetting the password: %v\n", err)
+		return
+	}
+	assert.Equal(t, models.VerifyPassword(updatedUser.Password, "new password"), nil)
+}
+
+func TestValidateRoles(t *testing.T) {
+
+	admin := models.User{Username: "root", Email: "root@example.com", Password: "secret", Role: "admin"}
+	err := admin.Validate("")
+	assert.Equal(t, err.Error(), "Not Vaild Role Please Set To seller or buyer")
+	assert.Equal(t, admin.Validate("manage"), nil)
+
+	admin.Role = "root"
+	err = admin.Validate("manage")
+	assert.Equal(t, err.Error(), "Not Vaild Role Please Set To seller, buyer or admin")
+}
+
+func TestWithdrawDeposit(t *testing.T) {
+
+	err := refreshUserTable()
+	if err != nil {
+		log.Fatal(err)
+	}
+	user, err := seedOneUser()
+	if err != nil {
+		log.Fatalf("Cannot seed user: %v\n", err)
+	}
+	err = server.DB.Model(&models.User{}).Where("id = ?", user.ID).UpdateColumn("deposit", 100).Error
+	assert.Equal(t, err, nil)
+
+	// only one of two withdrawals of 60 fits in the deposit
+	results := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := models.WithdrawDeposit(server.DB, user.ID, 60)
+			results <- err
+		}()
+	}
+	failed := 0
+	for i := 0; i < 2; i++ {
+		if err := <-results; err != nil {
+			assert.Equal(t, err.Error(), "there is not enough balance to buy")
+			failed++
+		}
+	}
+	assert.Equal(t, failed, 1)
+
+	left, err := models.WithdrawDeposit(server.DB, user.ID, 40)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, left.Deposit, float32(0))
+}
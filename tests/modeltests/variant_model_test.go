@@ -0,0 +1,62 @@
+package modeltests
+
+import (
+	"log"
+	"testing"
+
+	"github.com/task/api/models"
+	"gopkg.in/go-playground/assert.v1"
+)
+
+func TestSaveVariantSyncsProductStock(t *testing.T) {
+
+	product, err := seedProductWithOptions()
+	if err != nil {
+		log.Fatalf("Error seeding product with options: %v\n", err)
+	}
+	variants := []models.ProductVariant{
+		models.ProductVariant{ProductID: product.ID, SKU: "TS-S-RED", Options: map[string]string{"size": "S", "color": "red"}, AmountAvailable: 3},
+		models.ProductVariant{ProductID: product.ID, SKU: "TS-M-BLUE", Options: map[string]string{"size": "M", "color": "blue"}, AmountAvailable: 4},
+	}
+	for i := range variants {
+		_, err = variants[i].SaveVariant(server.DB)
+		if err != nil {
+			t.Errorf("this is the error saving the variant: %v\n", err)
+			return
+		}
+	}
+	foundProduct, err := productInstance.FindProductByID(server.DB, product.ID)
+	if err != nil {
+		t.Errorf("this is the error getting the product: %v\n", err)
+		return
+	}
+	assert.Equal(t, foundProduct.AmountAvailable, float32(7))
+	assert.Equal(t, len(foundProduct.Variants), 2)
+	assert.Equal(t, foundProduct.Variants[1].Options["color"], "blue")
+}
+
+func TestSaveVariantRejectsUnknownOptionValue(t *testing.T) {
+
+	product, err := seedProductWithOptions()
+	if err != nil {
+		log.Fatalf("Error seeding product with options: %v\n", err)
+	}
+	variant := models.ProductVariant{ProductID: product.ID, SKU: "TS-XL", Options: map[string]string{"size": "XL", "color": "red"}, AmountAvailable: 1}
+	_, err = variant.SaveVariant(server.DB)
+	assert.Equal(t, err.Error(), "Invalid Option Value For size")
+
+	variant = models.ProductVariant{ProductID: product.ID, SKU: "TS-S", Options: map[string]string{"size": "S"}, AmountAvailable: 1}
+	_, err = variant.SaveVariant(server.DB)
+	assert.Equal(t, err.Error(), "Variant Must Set Every Option")
+}
+
+func TestVariantUnitPrice(t *testing.T) {
+
+	product := models.Product{Price: 10}
+	variant := models.ProductVariant{}
+	assert.Equal(t, variant.UnitPrice(&product), float32(10))
+
+	price := float32(12)
+	variant.Price = &price
+	assert.Equal(t, variant.UnitPrice(&product), float32(12))
+}
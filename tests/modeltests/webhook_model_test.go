@@ -0,0 +1,84 @@
+package modeltests
+
+import (
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/task/api/models"
+	"github.com/task/api/webhooks"
+	"gopkg.in/go-playground/assert.v1"
+)
+
+func TestWebhookDeliveryIsSignedAndRetried(t *testing.T) {
+
+	err := refreshUserAndProductTable()
+	if err != nil {
+		log.Fatalf("Error refreshing user and product table: %v\n", err)
+	}
+	product, err := seedOneUserAndOneProduct()
+	if err != nil {
+		log.Fatalf("Error Seeding tables")
+	}
+
+	calls := 0
+	verified := false
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		body, _ := ioutil.ReadAll(r.Body)
+		timestamp, _ := strconv.ParseInt(r.Header.Get(webhooks.HeaderTimestamp), 10, 64)
+		verified = webhooks.Verify("s3cret", r.Header.Get(webhooks.HeaderSignature), timestamp, body, time.Minute, time.Now())
+		if calls == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	webhook := models.Webhook{
+		OwnerID: product.SellerID,
+		URL:     receiver.URL,
+		Secret:  "s3cret",
+		Events:  []string{models.EventStockChanged},
+		Active:  true,
+	}
+	_, err = webhook.SaveWebhook(server.DB)
+	if err != nil {
+		t.Errorf("this is the error saving the webhook: %v\n", err)
+		return
+	}
+	queued, err := models.EnqueueDeliveries(server.DB, models.EventProductCreated, product.SellerID, []byte(`{}`))
+	assert.Equal(t, err, nil)
+	assert.Equal(t, queued, 0)
+	queued, err = models.EnqueueDeliveries(server.DB, models.EventStockChanged, product.SellerID, []byte(`{"event":"stock.changed"}`))
+	assert.Equal(t, err, nil)
+	assert.Equal(t, queued, 1)
+
+	dispatcher := webhooks.Dispatcher{DB: server.DB, Backoff: time.Millisecond, AllowPrivate: true}
+	attempted, err := dispatcher.DeliverDue()
+	assert.Equal(t, err, nil)
+	assert.Equal(t, attempted, 1)
+	assert.Equal(t, verified, true)
+
+	delivery := models.WebhookDelivery{}
+	deliveries, err := delivery.FindWebhookDeliveries(server.DB, webhook.ID)
+	if err != nil {
+		t.Errorf("this is the error getting the deliveries: %v\n", err)
+		return
+	}
+	assert.Equal(t, (*deliveries)[0].Status, models.DeliveryPending)
+	assert.Equal(t, (*deliveries)[0].LastStatusCode, http.StatusInternalServerError)
+
+	time.Sleep(10 * time.Millisecond)
+	_, err = dispatcher.DeliverDue()
+	assert.Equal(t, err, nil)
+	deliveries, _ = delivery.FindWebhookDeliveries(server.DB, webhook.ID)
+	assert.Equal(t, (*deliveries)[0].Status, models.DeliverySucceeded)
+	assert.Equal(t, (*deliveries)[0].Attempts, 2)
+	assert.Equal(t, (*deliveries)[0].LastStatusCode, http.StatusNoContent)
+}
@@ -0,0 +1,246 @@
+package openapitests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/gorilla/mux"
+	"github.com/task/api/apierror"
+	"github.com/task/api/config"
+	"github.com/task/api/models"
+	"github.com/task/api/openapi"
+	"github.com/task/api/responses"
+	"github.com/task/tests/testserver"
+	"gopkg.in/go-playground/assert.v1"
+)
+
+func TestDocument(t *testing.T) {
+
+	server := testserver.New(t, func(cfg *config.Config) { cfg.OpenAPI = config.OpenAPI{} })
+	rr := testserver.Request(server, "GET", "/openapi.json", "", "")
+	assert.Equal(t, rr.Code, http.StatusOK)
+	doc, err := openapi3.NewLoader().LoadFromData(rr.Body.Bytes())
+	if err != nil {
+		t.Fatalf("cannot load the document: %v", err)
+	}
+	assert.Equal(t, doc.Validate(context.Background()), nil)
+
+	// every route is documented
+	routes := 0
+	server.Router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		template, err := route.GetPathTemplate()
+		methods, merr := route.GetMethods()
+		if err != nil || merr != nil {
+			return nil
+		}
+		path := strings.Replace(template, "{key:.+}", "{key}", 1)
+		for _, method := range methods {
+			routes++
+			if doc.Paths.Find(path) == nil || doc.Paths.Find(path).GetOperation(method) == nil {
+				t.Errorf("%s %s is not documented", method, template)
+			}
+		}
+		return nil
+	})
+	operations := 0
+	for _, item := range doc.Paths {
+		operations += len(item.Operations())
+	}
+	assert.Equal(t, operations, routes)
+
+	for _, name := range []string{"User", "Product", "ProductV2", "Problem", "FieldError", "NewProductV2Request"} {
+		assert.Equal(t, doc.Components.Schemas[name] != nil, true)
+	}
+	assert.Equal(t, doc.Components.SecuritySchemes["bearerAuth"].Value.Scheme, "bearer")
+	assert.Equal(t, doc.Components.SecuritySchemes["queryAuth"].Value.Name, "token")
+
+	// the routes without a prefix are deprecated, v2 has its own payloads
+	assert.Equal(t, doc.Paths["/products"].Post.Deprecated, true)
+	assert.Equal(t, doc.Paths["/v1/products"].Post.Deprecated, false)
+	assert.Equal(t, doc.Paths["/v1/products"].Post.OperationID, "createProductV1")
+	assert.Equal(t, doc.Paths["/v1/products"].Post.RequestBody.Value.Content["application/json"].Schema.Ref, "#/components/schemas/NewProductRequest")
+	assert.Equal(t, doc.Paths["/v2/products"].Post.RequestBody.Value.Content["application/json"].Schema.Ref, "#/components/schemas/NewProductV2Request")
+	assert.Equal(t, doc.Paths["/v2/buy"].Post.Responses.Get(http.StatusOK).Value.Content["application/json"].Schema.Ref, "#/components/schemas/PurchaseV2")
+	assert.Equal(t, doc.Paths["/v1/users"].Get.Security != nil, true)
+	assert.Equal(t, doc.Paths["/v1/login"].Post.Security == nil, true)
+	problem := doc.Paths["/v1/users/{id}"].Get.Responses.Default().Value.Content["application/problem+json"]
+	assert.Equal(t, problem.Schema.Ref, "#/components/schemas/Problem")
+
+	// the rules of the payloads are in their schemas
+	newUser := doc.Components.Schemas["NewUserRequest"].Value
+	assert.Equal(t, newUser.Required, []string{"username", "email", "password", "role"})
+	assert.Equal(t, newUser.Properties["role"].Value.Enum, []interface{}{"buyer", "seller"})
+	assert.Equal(t, *newUser.Properties["password"].Value.MaxLength, uint64(72))
+	assert.Equal(t, *newUser.AdditionalPropertiesAllowed, false)
+	// the password is never answered
+	assert.Equal(t, doc.Components.Schemas["User"].Value.Properties["password"] == nil, true)
+
+	rr = testserver.Request(server, "GET", "/docs", "", "")
+	assert.Equal(t, rr.Code, http.StatusOK)
+	assert.Equal(t, strings.HasPrefix(rr.Header().Get("Content-Type"), "text/html"), true)
+	assert.Equal(t, strings.Contains(rr.Body.String(), "/openapi.json"), true)
+}
+
+// TestResponses goes through the API with the responses checked, any that
+// does not match the document is answered as a 500.
+func TestResponses(t *testing.T) {
+
+	server := testserver.New(t, func(cfg *config.Config) {
+		cfg.OpenAPI = config.OpenAPI{ValidateRequests: true, ValidateResponses: true}
+	})
+	admin := testserver.Seed(t, server, models.User{Username: "ada", Email: "ada@gmail.com", Password: "password", Role: "admin"})
+	seller := testserver.Seed(t, server, models.User{Username: "pet", Email: "pet@gmail.com", Password: "password", Role: "seller"})
+	buyer := testserver.Seed(t, server, models.User{Username: "kan", Email: "kan@gmail.com", Password: "password", Role: "buyer", Deposit: 500})
+
+	steps := []struct {
+		method, path, body, token string
+		status                    int
+	}{
+		{"GET", "/", "", "", http.StatusOK},
+		{"GET", "/healthz", "", "", http.StatusOK},
+		{"GET", "/readyz", "", "", http.StatusOK},
+		{"GET", "/problems", "", "", http.StatusOK},
+		{"GET", "/problems/not_found", "", "", http.StatusOK},
+		{"GET", "/problems/nope", "", "", http.StatusNotFound},
+		{"POST", "/v1/users", `{"username":"joe","email":"joe@gmail.com","password":"password","role":"buyer"}`, "", http.StatusCreated},
+		{"POST", "/v1/login", `{"email":"joe@gmail.com","password":"password"}`, "", http.StatusOK},
+		{"POST", "/v1/login", `{"email":"joe@gmail.com","password":"wrong-password"}`, "", http.StatusUnauthorized},
+		{"GET", "/v1/users", "", admin, http.StatusOK},
+		{"GET", "/v1/users/2", "", seller, http.StatusOK},
+		{"POST", "/v1/categories", `{"name":"Kitchen"}`, admin, http.StatusCreated},
+		{"POST", "/v1/categories", `{"name":"Kettles","parent_id":1}`, admin, http.StatusCreated},
+		{"GET", "/v1/categories", "", seller, http.StatusOK},
+		{"PUT", "/v1/categories/2", `{"name":"Tea kettles","parent_id":1}`, admin, http.StatusOK},
+		{"POST", "/v1/products", `{"proudct_name":"kettle","amount_available":5,"seller_id":2,"price":20,"category_ids":[2],"tag_names":["tea"]}`, seller, http.StatusCreated},
+		{"POST", "/v2/products", `{"product_name":"grill","amount_available":5,"price":40}`, seller, http.StatusCreated},
+		{"GET", "/v1/products", "", seller, http.StatusOK},
+		{"GET", "/v2/products?tag=tea", "", seller, http.StatusOK},
+		{"GET", "/products/1", "", seller, http.StatusOK},
+		{"GET", "/v2/products/1", "", seller, http.StatusOK},
+		{"PUT", "/v2/products/2", `{"product_name":"grill pro","amount_available":7}`, seller, http.StatusOK},
+		{"GET", "/v1/categories/1/products", "", seller, http.StatusOK},
+		{"GET", "/v1/tags", "", seller, http.StatusOK},
+		{"PUT", "/v1/products/2/options", `[{"name":"size","values":["s","m"]}]`, seller, http.StatusOK},
+		{"POST", "/v1/products/2/variants", `{"sku":"GR-S","options":{"size":"s"},"amount_available":3}`, seller, http.StatusCreated},
+		{"PUT", "/v1/products/2/variants/1", `{"sku":"GR-S","options":{"size":"s"},"amount_available":4,"price":45}`, seller, http.StatusOK},
+		{"GET", "/v2/products/2/variants", "", seller, http.StatusOK},
+		{"POST", "/v1/products/1/stock-adjustments", `{"reason":"restock","quantity":5}`, seller, http.StatusCreated},
+		{"GET", "/v1/products/1/stock-history", "", seller, http.StatusOK},
+		{"GET", "/v1/products/1/images", "", seller, http.StatusOK},
+		{"POST", "/v1/buy", `{"id":1,"qty":1}`, buyer, http.StatusCreated},
+		{"POST", "/v2/buy", `{"sku":"GR-S","qty":1}`, buyer, http.StatusOK},
+		{"POST", "/v2/buy", `{"product_id":1,"qty":100}`, buyer, http.StatusConflict},
+		{"POST", "/v1/products/1/restock-subscriptions", "", buyer, http.StatusCreated},
+		{"GET", "/v1/notifications?unread=true", "", buyer, http.StatusOK},
+		{"POST", "/v1/webhooks", `{"url":"https://example.com/hook","events":["product.created"]}`, seller, http.StatusCreated},
+		{"GET", "/v1/webhooks", "", seller, http.StatusOK},
+		{"PUT", "/v1/webhooks/1", `{"active":false}`, seller, http.StatusOK},
+		{"GET", "/v1/webhooks/1/deliveries", "", seller, http.StatusOK},
+		{"DELETE", "/v1/products/2/variants/1", "", seller, http.StatusNoContent},
+		{"DELETE", "/v1/products/1", "", seller, http.StatusNoContent},
+		{"GET", "/v1/products?include_deleted=true", "", admin, http.StatusOK},
+		{"POST", "/v2/products/1/restore", "", seller, http.StatusOK},
+		{"GET", "/v1/products/404", "", seller, http.StatusNotFound},
+		{"GET", "/v2/users", "", "", http.StatusUnauthorized},
+		{"GET", "/openapi.json", "", "", http.StatusOK},
+	}
+	for _, step := range steps {
+		rr := testserver.Request(server, step.method, step.path, step.body, step.token)
+		if rr.Code != step.status {
+			t.Errorf("%s %s answered %d instead of %d: %s", step.method, step.path, rr.Code, step.status, rr.Body.String())
+		}
+		if rr.Code == http.StatusInternalServerError && strings.Contains(rr.Body.String(), "OpenAPI") {
+			t.Errorf("%s %s does not match the document: %s", step.method, step.path, rr.Body.String())
+		}
+	}
+}
+
+func TestRequests(t *testing.T) {
+
+	server := testserver.New(t, func(cfg *config.Config) { cfg.OpenAPI = config.OpenAPI{ValidateRequests: true} })
+	seller := testserver.Seed(t, server, models.User{Username: "pet", Email: "pet@gmail.com", Password: "password", Role: "seller"})
+
+	samples := []struct {
+		method, path, body string
+		status             int
+		code               string
+		fields             []apierror.FieldError
+	}{
+		{"POST", "/v2/products", `{"product_name":"kettle","amount_available":"5","price":0,"colour":"red"}`, http.StatusUnprocessableEntity, apierror.ValidationFailed, []apierror.FieldError{
+			{Field: "amount_available", Code: "type", Message: "Invalid amount_available, Expected number"},
+			{Field: "colour", Code: "unknown", Message: "Unknown Field colour"},
+			{Field: "price", Code: "min", Message: "Invalid price, number must be at least 1"},
+		}},
+		{"PUT", "/v1/products/1/options", `[{"name":"size","values":["s",""]}]`, http.StatusUnprocessableEntity, apierror.ValidationFailed, []apierror.FieldError{
+			{Field: "[0].values[1]", Code: "min", Message: "Invalid [0].values[1], minimum string length is 1"},
+		}},
+		{"POST", "/v1/webhooks", `{"url":"https://example.com","events":["product.sold"]}`, http.StatusUnprocessableEntity, apierror.ValidationFailed, []apierror.FieldError{
+			{Field: "events[0]", Code: "enum", Message: "Invalid events[0], value is not one of the allowed values"},
+		}},
+		{"POST", "/v1/login", `{"password":"password"}`, http.StatusUnprocessableEntity, apierror.ValidationFailed, []apierror.FieldError{
+			{Field: "email", Code: "required", Message: "Required email"},
+		}},
+		{"GET", "/v1/products/abc", "", http.StatusBadRequest, apierror.BadRequest, nil},
+		{"GET", "/v1/notifications?unread=maybe", "", http.StatusBadRequest, apierror.BadRequest, nil},
+		{"POST", "/v1/login", `{"email":`, http.StatusBadRequest, apierror.BadRequest, nil},
+	}
+	for _, v := range samples {
+		rr := testserver.Request(server, v.method, v.path, v.body, seller)
+		problem := responses.Problem{}
+		json.Unmarshal(rr.Body.Bytes(), &problem)
+		assert.Equal(t, rr.Code, v.status)
+		assert.Equal(t, problem.Code, v.code)
+		assert.Equal(t, problem.Errors, v.fields)
+	}
+
+	// the handlers still get the body
+	rr := testserver.Request(server, "POST", "/v2/products", `{"product_name":"kettle","amount_available":5,"price":20}`, seller)
+	assert.Equal(t, rr.Code, http.StatusCreated)
+	// an empty body is left to the handler, which tells what it misses
+	rr = testserver.Request(server, "POST", "/v1/login", "", "")
+	assert.Equal(t, rr.Code, http.StatusUnprocessableEntity)
+	assert.Equal(t, strings.Contains(rr.Body.String(), "Required Email"), true)
+}
+
+type thing struct {
+	ID   uint64 `json:"id"`
+	Name string `json:"name"`
+}
+
+// TestDrift checks a handler answering something else than its document
+// says is caught.
+func TestDrift(t *testing.T) {
+
+	router := mux.NewRouter()
+	router.HandleFunc("/things/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		responses.JSON(w, http.StatusOK, map[string]interface{}{"id": mux.Vars(r)["id"]})
+	}).Methods("GET")
+	doc, err := openapi.Build(openapi3.Info{Title: "things", Version: "1"}, router, func(method, path string) (openapi.Operation, bool) {
+		return openapi.Operation{ID: "getThing", Status: http.StatusOK, Response: thing{}}, path == "/things/{id}"
+	})
+	if err != nil {
+		t.Fatalf("cannot build the document: %v", err)
+	}
+	router.Use(openapi.Validate(doc, openapi.Options{Responses: true}))
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/things/1", nil))
+	assert.Equal(t, rr.Code, http.StatusInternalServerError)
+	problem := responses.Problem{}
+	json.Unmarshal(rr.Body.Bytes(), &problem)
+	assert.Equal(t, problem.Code, apierror.Internal)
+	assert.Equal(t, strings.Contains(problem.Detail, "Does Not Match The OpenAPI Document"), true)
+
+	// a route the document misses is an error
+	router.HandleFunc("/others", func(w http.ResponseWriter, r *http.Request) {}).Methods("GET")
+	_, err = openapi.Build(openapi3.Info{Title: "things", Version: "1"}, router, func(method, path string) (openapi.Operation, bool) {
+		return openapi.Operation{ID: "getThing", Status: http.StatusOK, Response: thing{}}, path == "/things/{id}"
+	})
+	assert.Equal(t, err.Error(), "GET /others is not documented")
+}
@@ -0,0 +1,125 @@
+package problemtests
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/task/api/apierror"
+	"github.com/task/api/auth"
+	"github.com/task/api/models"
+	"github.com/task/tests/testserver"
+	"gopkg.in/go-playground/assert.v1"
+)
+
+func TestFrom(t *testing.T) {
+
+	samples := []struct {
+		status   int
+		err      error
+		code     string
+		answered int
+		field    string
+	}{
+		{http.StatusBadRequest, models.ErrUserNotFound, apierror.UserNotFound, http.StatusNotFound, ""},
+		{http.StatusInternalServerError, models.ErrProductNotFound, apierror.ProductNotFound, http.StatusNotFound, ""},
+		{http.StatusInternalServerError, fmt.Errorf("cannot buy: %w", models.ErrInsufficientStock), apierror.InsufficientStock, http.StatusConflict, ""},
+		{http.StatusInternalServerError, models.ErrEmailTaken, apierror.EmailTaken, http.StatusConflict, ""},
+		{http.StatusInternalServerError, (&models.Product{}).Validate(), apierror.ValidationFailed, http.StatusUnprocessableEntity, "product_name"},
+		{http.StatusInternalServerError, (&models.User{Username: "pet", Password: "password", Role: "buyer", Email: "pet"}).Validate(""), apierror.ValidationFailed, http.StatusUnprocessableEntity, "email"},
+		{http.StatusInternalServerError, (&models.User{Username: "pet", Password: "password", Role: "root"}).Validate(""), apierror.ValidationFailed, http.StatusUnprocessableEntity, "role"},
+		// messages are not classified, only coded errors
+		{http.StatusBadRequest, errors.New("User Not Found"), apierror.BadRequest, http.StatusBadRequest, ""},
+		{http.StatusUnprocessableEntity, errors.New("Required AmountAvailable"), apierror.InvalidRequest, http.StatusUnprocessableEntity, ""},
+		{http.StatusUnauthorized, errors.New("Unauthorized"), apierror.Unauthorized, http.StatusUnauthorized, ""},
+		{http.StatusConflict, apierror.New(apierror.SellerDeleted, "Seller Is Deleted"), apierror.SellerDeleted, http.StatusConflict, ""},
+		{http.StatusInternalServerError, errors.New("pq: connection refused"), apierror.Internal, http.StatusInternalServerError, ""},
+	}
+	for _, v := range samples {
+		e := apierror.From(v.status, v.err)
+		assert.Equal(t, e.Code, v.code)
+		assert.Equal(t, e.Status, v.answered)
+		if v.field != "" {
+			assert.Equal(t, len(e.Fields), 1)
+			assert.Equal(t, e.Fields[0].Field, v.field)
+		}
+	}
+	// the errors of the models are shared, what is answered is a copy
+	e := apierror.From(http.StatusInternalServerError, models.ErrUserNotFound)
+	e.Detail = "changed"
+	assert.Equal(t, models.ErrUserNotFound.Detail, "User Not Found")
+	// the cause of internal errors stays on the server
+	assert.Equal(t, apierror.From(http.StatusInternalServerError, errors.New("pq: connection refused")).Detail != "pq: connection refused", true)
+}
+
+func TestCatalogue(t *testing.T) {
+
+	seen := map[string]bool{}
+	for _, entry := range apierror.Catalogue {
+		if seen[entry.Code] {
+			t.Errorf("%s is listed twice", entry.Code)
+		}
+		seen[entry.Code] = true
+		if entry.Status < 400 || entry.Title == "" {
+			t.Errorf("%s has no status or title", entry.Code)
+		}
+	}
+}
+
+func TestProblems(t *testing.T) {
+
+	server := testserver.New(t, nil)
+	seller := models.User{Username: "pet", Email: "pet@gmail.com", Password: "password", Role: "seller"}
+	if _, err := seller.SaveUser(server.DB); err != nil {
+		t.Fatalf("cannot seed seller: %v", err)
+	}
+	token, err := auth.CreateToken(uint32(seller.ID), seller.Role)
+	if err != nil {
+		t.Fatalf("cannot create token: %v", err)
+	}
+
+	samples := []struct {
+		method, path, body, token string
+		status                    int
+		code                      string
+	}{
+		{"GET", "/products/42", "", token, http.StatusNotFound, apierror.ProductNotFound},
+		{"GET", "/products", "", "", http.StatusUnauthorized, apierror.Unauthorized},
+		{"POST", "/buy", `{"product_id":1,"qty":1}`, token, http.StatusForbidden, apierror.Forbidden},
+		{"POST", "/users", `{"username":"kan","email":"pet@gmail.com","password":"password","role":"buyer"}`, "", http.StatusConflict, apierror.EmailTaken},
+		{"POST", "/login", `{"email":"pet@gmail.com","password":"wrong"}`, "", http.StatusUnauthorized, apierror.InvalidCredentials},
+		{"GET", "/nowhere", "", "", http.StatusNotFound, apierror.NotFound},
+		{"DELETE", "/problems", "", "", http.StatusMethodNotAllowed, apierror.MethodNotAllowed},
+		{"GET", "/problems/nothing", "", "", http.StatusNotFound, apierror.NotFound},
+	}
+	for _, v := range samples {
+		rr := testserver.Request(server, v.method, v.path, v.body, v.token)
+		problem := testserver.Problem(rr)
+		assert.Equal(t, rr.Code, v.status)
+		assert.Equal(t, rr.Header().Get("Content-Type"), "application/problem+json")
+		assert.Equal(t, problem.Code, v.code)
+		assert.Equal(t, problem.Status, v.status)
+		assert.Equal(t, problem.Type, "/problems/"+v.code)
+	}
+
+	rr := testserver.Request(server, "POST", "/users", `{"username":"steven","password":"password","role":"buyer"}`, "")
+	problem := testserver.Problem(rr)
+	assert.Equal(t, rr.Code, http.StatusUnprocessableEntity)
+	assert.Equal(t, problem.Code, apierror.ValidationFailed)
+	assert.Equal(t, len(problem.Errors), 1)
+	assert.Equal(t, problem.Errors[0], apierror.FieldError{Field: "email", Code: "required", Message: "Required Email"})
+
+	rr = testserver.Request(server, "GET", "/problems/"+apierror.InsufficientStock, "", "")
+	assert.Equal(t, rr.Code, http.StatusOK)
+	entry := apierror.Entry{}
+	json.Unmarshal(rr.Body.Bytes(), &entry)
+	assert.Equal(t, entry.Status, http.StatusConflict)
+
+	rr = testserver.Request(server, "GET", "/problems", "", "")
+	assert.Equal(t, rr.Code, http.StatusOK)
+	catalogue := []apierror.Entry{}
+	json.Unmarshal(rr.Body.Bytes(), &catalogue)
+	assert.Equal(t, len(catalogue), len(apierror.Catalogue))
+}
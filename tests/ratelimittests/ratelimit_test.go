@@ -0,0 +1,151 @@
+package ratelimittests
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/task/api/auth"
+	"github.com/task/api/config"
+	"github.com/task/api/controllers"
+	"github.com/task/api/ratelimit"
+	"github.com/task/tests/testserver"
+	"gopkg.in/go-playground/assert.v1"
+)
+
+func TestMemoryStore(t *testing.T) {
+
+	store := ratelimit.NewMemory()
+	limit := ratelimit.Limit{Requests: 2, Period: time.Second}
+	now := time.Now()
+
+	result, _ := store.Take("login:ip:10.0.0.1", limit, now)
+	assert.Equal(t, result.Allowed, true)
+	assert.Equal(t, result.Remaining, 1)
+	assert.Equal(t, result.Reset, 500*time.Millisecond)
+	result, _ = store.Take("login:ip:10.0.0.1", limit, now)
+	assert.Equal(t, result.Allowed, true)
+	assert.Equal(t, result.Remaining, 0)
+	result, _ = store.Take("login:ip:10.0.0.1", limit, now.Add(100*time.Millisecond))
+	assert.Equal(t, result.Allowed, false)
+	assert.Equal(t, result.RetryAfter, 400*time.Millisecond)
+
+	// other clients have buckets of their own
+	result, _ = store.Take("login:ip:10.0.0.2", limit, now)
+	assert.Equal(t, result.Allowed, true)
+
+	result, _ = store.Take("login:ip:10.0.0.1", limit, now.Add(500*time.Millisecond))
+	assert.Equal(t, result.Allowed, true)
+	result, _ = store.Take("login:ip:10.0.0.1", limit, now.Add(10*time.Second))
+	assert.Equal(t, result.Allowed, true)
+	assert.Equal(t, result.Remaining, 1)
+}
+
+func TestParse(t *testing.T) {
+
+	limit, err := ratelimit.Parse("5/1m")
+	assert.Equal(t, err, nil)
+	assert.Equal(t, limit, ratelimit.Limit{Requests: 5, Period: time.Minute})
+	limit, err = ratelimit.Parse("off")
+	assert.Equal(t, err, nil)
+	assert.Equal(t, limit.Off(), true)
+	for _, invalid := range []string{"5", "0/1m", "x/1m", "5/soon", "5/-1s"} {
+		_, err = ratelimit.Parse(invalid)
+		if err == nil {
+			t.Errorf("%q parsed", invalid)
+		}
+	}
+	_, err = ratelimit.New(config.RateLimit{TrustedProxies: []string{"proxy"}}, ratelimit.NewMemory())
+	if err == nil {
+		t.Errorf("an invalid trusted proxy was accepted")
+	}
+}
+
+func TestClientIP(t *testing.T) {
+
+	limiter, err := ratelimit.New(config.RateLimit{TrustedProxies: []string{"10.0.0.0/8", "192.168.1.1"}}, ratelimit.NewMemory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	samples := []struct {
+		remote, forwarded, real, client string
+	}{
+		{"203.0.113.7:4000", "", "", "203.0.113.7"},
+		// headers of untrusted clients are ignored
+		{"203.0.113.7:4000", "1.2.3.4", "1.2.3.4", "203.0.113.7"},
+		{"10.0.0.5:4000", "198.51.100.9", "", "198.51.100.9"},
+		// the client can only forge the hops left of the last proxy
+		{"10.0.0.5:4000", "1.2.3.4, 198.51.100.9, 192.168.1.1", "", "198.51.100.9"},
+		{"192.168.1.1:4000", "", "198.51.100.9", "198.51.100.9"},
+		{"10.0.0.5:4000", "", "", "10.0.0.5"},
+	}
+	for _, sample := range samples {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = sample.remote
+		if sample.forwarded != "" {
+			req.Header.Set("X-Forwarded-For", sample.forwarded)
+		}
+		if sample.real != "" {
+			req.Header.Set("X-Real-IP", sample.real)
+		}
+		assert.Equal(t, limiter.ClientIP(req), sample.client)
+	}
+}
+
+func request(server *controllers.Server, method, path, remote, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, bytes.NewBufferString(`{"email":"nobody@gmail.com","password":"password"}`))
+	req.RemoteAddr = remote
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rr := httptest.NewRecorder()
+	server.Router.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestRateLimitedRoutes(t *testing.T) {
+
+	server := testserver.New(t, func(cfg *config.Config) { cfg.RateLimit = config.RateLimit{Default: "3/1m", Login: "2/1m"} })
+
+	rr := request(server, "POST", "/login", "203.0.113.7:4000", "")
+	assert.Equal(t, rr.Code, http.StatusUnauthorized)
+	assert.Equal(t, rr.Header().Get("RateLimit-Limit"), "2")
+	assert.Equal(t, rr.Header().Get("RateLimit-Remaining"), "1")
+	assert.Equal(t, rr.Header().Get("RateLimit-Reset"), "30")
+	request(server, "POST", "/login", "203.0.113.7:4000", "")
+	rr = request(server, "POST", "/login", "203.0.113.7:4000", "")
+	assert.Equal(t, rr.Code, http.StatusTooManyRequests)
+	assert.Equal(t, rr.Header().Get("Retry-After"), "30")
+	assert.Equal(t, rr.Header().Get("RateLimit-Remaining"), "0")
+	assert.Equal(t, strings.Contains(rr.Body.String(), `"code":"rate_limited"`), true)
+
+	// another address has its own bucket
+	rr = request(server, "POST", "/login", "203.0.113.8:4000", "")
+	assert.Equal(t, rr.Code, http.StatusUnauthorized)
+
+	// the default limit took a token for every request of the address
+	rr = request(server, "GET", "/", "203.0.113.7:4000", "")
+	assert.Equal(t, rr.Code, http.StatusTooManyRequests)
+	assert.Equal(t, rr.Header().Get("RateLimit-Limit"), "3")
+
+	// signed in users are limited by user id, wherever they come from
+	token, err := auth.CreateToken(7, "buyer")
+	if err != nil {
+		t.Fatalf("cannot create token: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		rr = request(server, "GET", "/", "203.0.113.7:4000", token)
+		assert.Equal(t, rr.Code, http.StatusOK)
+	}
+	rr = request(server, "GET", "/", "198.51.100.9:4000", token)
+	assert.Equal(t, rr.Code, http.StatusTooManyRequests)
+
+	// probes are never limited
+	for i := 0; i < 5; i++ {
+		rr = request(server, "GET", "/healthz", "203.0.113.7:4000", "")
+		assert.Equal(t, rr.Code, http.StatusOK)
+	}
+}
@@ -0,0 +1,73 @@
+package repositorytests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/task/api/controllers"
+	"github.com/task/api/models"
+	"github.com/task/api/repository"
+	"gopkg.in/go-playground/assert.v1"
+)
+
+// The handlers that only need users and products run on the memory store.
+func TestHandlersOnMemory(t *testing.T) {
+
+	store := repository.NewMemory()
+	server := controllers.Server{Users: store.Users(), Products: store.Products()}
+	pet := seller(t, server.Users, "pet")
+	kettle, err := server.Products.Create(&models.Product{ProductName: "kettle", AmountAvailable: 5, Price: 20, SellerID: pet.ID})
+	if err != nil {
+		t.Fatalf("cannot seed product: %v", err)
+	}
+
+	token, err := server.SignIn("pet@gmail.com", "password")
+	assert.Equal(t, err, nil)
+	assert.NotEqual(t, token, "")
+	_, err = server.SignIn("nobody@gmail.com", "password")
+	assert.Equal(t, err, repository.ErrUserNotFound)
+
+	req := httptest.NewRequest("GET", "/products/"+strconv.FormatUint(kettle.ID, 10), nil)
+	req = mux.SetURLVars(req, map[string]string{"id": strconv.FormatUint(kettle.ID, 10)})
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(server.GetProduct).ServeHTTP(rr, req)
+	assert.Equal(t, rr.Code, http.StatusOK)
+
+	product := models.Product{}
+	err = json.Unmarshal(rr.Body.Bytes(), &product)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, product.ProductName, "kettle")
+	assert.Equal(t, product.Seller.Username, "pet")
+
+	req = httptest.NewRequest("GET", "/users/42", nil)
+	req = mux.SetURLVars(req, map[string]string{"id": "42"})
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(server.GetUser).ServeHTTP(rr, req)
+	assert.Equal(t, rr.Code, http.StatusNotFound)
+
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(server.GetProducts).ServeHTTP(rr, httptest.NewRequest("GET", "/products", nil))
+	assert.Equal(t, rr.Code, http.StatusOK)
+
+	// the writes that record an event need the database
+	for _, tt := range []struct {
+		handler http.HandlerFunc
+		req     *http.Request
+	}{
+		{server.CreateUser, httptest.NewRequest("POST", "/users", strings.NewReader(`{"username":"kan","email":"kan@gmail.com","password":"password","role":"buyer"}`))},
+		{server.UpdateUser, mux.SetURLVars(httptest.NewRequest("PUT", "/users/1", strings.NewReader(`{"username":"pet","deposit":5}`)), map[string]string{"id": "1"})},
+		{server.CreateProduct, httptest.NewRequest("POST", "/products", strings.NewReader(`{"proudct_name":"toaster","amount_available":5,"seller_id":1,"price":20}`))},
+		{server.DeleteProduct, mux.SetURLVars(httptest.NewRequest("DELETE", "/products/1", nil), map[string]string{"id": "1"})},
+		{server.GetProducts, httptest.NewRequest("GET", "/products?tag=summer", nil)},
+	} {
+		tt.req.Header.Set("Authorization", "Bearer "+token)
+		rr = httptest.NewRecorder()
+		tt.handler.ServeHTTP(rr, tt.req)
+		assert.Equal(t, rr.Code, http.StatusServiceUnavailable)
+	}
+}
@@ -0,0 +1,42 @@
+package repositorytests
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/sqlite" //sqlite database driver
+	"github.com/task/api/config"
+	"github.com/task/api/migrations"
+	"github.com/task/api/repository"
+)
+
+func TestMemory(t *testing.T) {
+	runSuite(t, func(t *testing.T) (repository.UserRepository, repository.ProductRepository) {
+		store := repository.NewMemory()
+		return store.Users(), store.Products()
+	})
+}
+
+// TestGorm runs the suite on an in-memory SQLite database, so it needs no
+// database server either.
+func TestGorm(t *testing.T) {
+	runSuite(t, func(t *testing.T) (repository.UserRepository, repository.ProductRepository) {
+		db, err := gorm.Open("sqlite3", config.DB{Driver: "sqlite", Name: ":memory:"}.URL())
+		if err != nil {
+			t.Fatalf("cannot open sqlite: %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+		// every connection to :memory: is a database of its own
+		db.DB().SetMaxOpenConns(1)
+		// the schema of the migrations, with its constraints, not the models'
+		migrator, err := migrations.New(db.DB(), "sqlite3")
+		if err == nil {
+			_, err = migrator.Up(context.Background())
+		}
+		if err != nil {
+			t.Fatalf("cannot migrate: %v", err)
+		}
+		return &repository.GormUsers{DB: db}, &repository.GormProducts{DB: db}
+	})
+}
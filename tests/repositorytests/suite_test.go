@@ -0,0 +1,185 @@
+package repositorytests
+
+import (
+	"testing"
+
+	"github.com/task/api/models"
+	"github.com/task/api/repository"
+	"gopkg.in/go-playground/assert.v1"
+)
+
+// The conformance suite: every implementation runs the same tests against a
+// fresh, empty store.
+type newStore func(t *testing.T) (repository.UserRepository, repository.ProductRepository)
+
+func runSuite(t *testing.T, store newStore) {
+	t.Run("Users", func(t *testing.T) { testUsers(t, store) })
+	t.Run("UserDeleteAndRestore", func(t *testing.T) { testUserDeleteAndRestore(t, store) })
+	t.Run("Products", func(t *testing.T) { testProducts(t, store) })
+	t.Run("ProductDeleteAndRestore", func(t *testing.T) { testProductDeleteAndRestore(t, store) })
+}
+
+func seller(t *testing.T, users repository.UserRepository, name string) *models.User {
+	user, err := users.Create(&models.User{Username: name, Email: name + "@gmail.com", Password: "password", Role: "seller", Deposit: 10})
+	if err != nil {
+		t.Fatalf("cannot seed user %s: %v", name, err)
+	}
+	return user
+}
+
+func testUsers(t *testing.T, store newStore) {
+
+	users, _ := store(t)
+	pet := seller(t, users, "pet")
+	assert.Equal(t, pet.ID != 0, true)
+	assert.Equal(t, models.VerifyPassword(pet.Password, "password"), nil)
+
+	_, err := users.Create(&models.User{Username: "pet", Email: "other@gmail.com", Password: "password", Role: "buyer"})
+	assert.Equal(t, err, repository.ErrUsernameTaken)
+	_, err = users.Create(&models.User{Username: "other", Email: "pet@gmail.com", Password: "password", Role: "buyer"})
+	assert.Equal(t, err, repository.ErrEmailTaken)
+
+	found, err := users.FindByID(pet.ID)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, found.Email, "pet@gmail.com")
+	found, err = users.FindByEmail("pet@gmail.com")
+	assert.Equal(t, err, nil)
+	assert.Equal(t, found.ID, pet.ID)
+	_, err = users.FindByID(pet.ID + 100)
+	assert.Equal(t, err, repository.ErrUserNotFound)
+	_, err = users.FindByEmail("nobody@gmail.com")
+	assert.Equal(t, err, repository.ErrUserNotFound)
+
+	sam := seller(t, users, "sam")
+	updated, err := users.Update(pet.ID, &models.User{Username: "peter", Deposit: 50})
+	assert.Equal(t, err, nil)
+	assert.Equal(t, updated.Username, "peter")
+	assert.Equal(t, updated.Deposit, float32(50))
+	_, err = users.Update(pet.ID, &models.User{Username: sam.Username, Deposit: 50})
+	assert.Equal(t, err, repository.ErrUsernameTaken)
+	_, err = users.Update(sam.ID+100, &models.User{Username: "ghost", Deposit: 50})
+	assert.Equal(t, err, repository.ErrUserNotFound)
+
+	all, err := users.List(false)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(all), 2)
+}
+
+func testUserDeleteAndRestore(t *testing.T, store newStore) {
+
+	users, products := store(t)
+	pet := seller(t, users, "pet")
+	product, err := products.Create(&models.Product{ProductName: "kettle", AmountAvailable: 5, Price: 20, SellerID: pet.ID})
+	if err != nil {
+		t.Fatalf("cannot seed product: %v", err)
+	}
+
+	err = users.Delete(pet.ID)
+	assert.Equal(t, err, nil)
+	_, err = users.FindByID(pet.ID)
+	assert.Equal(t, err, repository.ErrUserNotFound)
+	_, err = products.FindByID(product.ID)
+	assert.Equal(t, err, repository.ErrProductNotFound)
+	err = users.Delete(pet.ID)
+	assert.Equal(t, err, repository.ErrUserNotFound)
+
+	// deleted users keep their username and email until purged
+	_, err = users.Create(&models.User{Username: "pet", Email: "new@gmail.com", Password: "password", Role: "buyer"})
+	assert.Equal(t, err, repository.ErrUsernameTaken)
+
+	live, err := users.List(false)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(live), 0)
+	all, err := users.List(true)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(all), 1)
+
+	_, err = products.Restore(product.ID, pet.ID)
+	assert.Equal(t, err, repository.ErrSellerDeleted)
+
+	restored, err := users.Restore(pet.ID)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, restored.DeletedAt == nil, true)
+	_, err = products.FindByID(product.ID)
+	assert.Equal(t, err, nil)
+	_, err = users.Restore(pet.ID)
+	assert.Equal(t, err, repository.ErrUserNotFound)
+}
+
+func testProducts(t *testing.T, store newStore) {
+
+	users, products := store(t)
+	pet := seller(t, users, "pet")
+
+	_, err := products.Create(&models.Product{ProductName: "kettle", AmountAvailable: 5, Price: 20, SellerID: pet.ID + 100})
+	assert.Equal(t, err, repository.ErrSellerNotFound)
+
+	kettle, err := products.Create(&models.Product{ProductName: "kettle", AmountAvailable: 5, Price: 20, SellerID: pet.ID, TagNames: []string{" Kitchen", "kitchen"}})
+	assert.Equal(t, err, nil)
+	assert.Equal(t, kettle.Seller.ID, pet.ID)
+	assert.Equal(t, len(kettle.Tags), 1)
+	assert.Equal(t, kettle.Tags[0].Name, "kitchen")
+
+	_, err = products.Create(&models.Product{ProductName: "kettle", AmountAvailable: 1, Price: 1, SellerID: pet.ID})
+	assert.Equal(t, err, repository.ErrProductNameTaken)
+	_, err = products.Create(&models.Product{ProductName: "toaster", AmountAvailable: 1, Price: 1, SellerID: pet.ID, CategoryIDs: []uint32{999}})
+	assert.Equal(t, err, repository.ErrCategoryNotFound)
+
+	found, err := products.FindByID(kettle.ID)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, found.ProductName, "kettle")
+	assert.Equal(t, found.Price, float32(20))
+	_, err = products.FindByID(kettle.ID + 100)
+	assert.Equal(t, err, repository.ErrProductNotFound)
+
+	toaster, err := products.Create(&models.Product{ProductName: "toaster", AmountAvailable: 2, Price: 30, SellerID: pet.ID})
+	assert.Equal(t, err, nil)
+	updated, err := products.Update(&models.Product{ID: kettle.ID, ProductName: "big kettle", AmountAvailable: 9, LowStockThreshold: 2})
+	assert.Equal(t, err, nil)
+	assert.Equal(t, updated.ProductName, "big kettle")
+	assert.Equal(t, updated.AmountAvailable, float32(9))
+	assert.Equal(t, updated.LowStockThreshold, float32(2))
+	assert.Equal(t, updated.Price, float32(20))
+	assert.Equal(t, len(updated.Tags), 1)
+	_, err = products.Update(&models.Product{ID: kettle.ID, ProductName: toaster.ProductName, AmountAvailable: 9})
+	assert.Equal(t, err, repository.ErrProductNameTaken)
+	_, err = products.Update(&models.Product{ID: toaster.ID + 100, ProductName: "ghost", AmountAvailable: 1})
+	assert.Equal(t, err, repository.ErrProductNotFound)
+
+	all, err := products.List(false)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(all), 2)
+}
+
+func testProductDeleteAndRestore(t *testing.T, store newStore) {
+
+	users, products := store(t)
+	pet := seller(t, users, "pet")
+	sam := seller(t, users, "sam")
+	kettle, err := products.Create(&models.Product{ProductName: "kettle", AmountAvailable: 5, Price: 20, SellerID: pet.ID})
+	if err != nil {
+		t.Fatalf("cannot seed product: %v", err)
+	}
+
+	err = products.Delete(kettle.ID, sam.ID)
+	assert.Equal(t, err, repository.ErrProductNotFound)
+	err = products.Delete(kettle.ID, pet.ID)
+	assert.Equal(t, err, nil)
+	_, err = products.FindByID(kettle.ID)
+	assert.Equal(t, err, repository.ErrProductNotFound)
+
+	live, err := products.List(false)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(live), 0)
+	all, err := products.List(true)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(all), 1)
+
+	_, err = products.Restore(kettle.ID, sam.ID)
+	assert.Equal(t, err, repository.ErrProductNotFound)
+	restored, err := products.Restore(kettle.ID, pet.ID)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, restored.ID, kettle.ID)
+	_, err = products.Restore(kettle.ID, pet.ID)
+	assert.Equal(t, err, repository.ErrProductNotFound)
+}
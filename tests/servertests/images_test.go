@@ -0,0 +1,52 @@
+package servertests
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/task/api/apierror"
+	"github.com/task/api/config"
+	"github.com/task/api/models"
+	"github.com/task/tests/testserver"
+	"gopkg.in/go-playground/assert.v1"
+)
+
+func TestImageUploadErrors(t *testing.T) {
+
+	server := testserver.New(t, func(cfg *config.Config) { cfg.ImageMaxBytes = 1024 })
+	seller := testserver.Seed(t, server, models.User{Username: "pet", Email: "pet@gmail.com", Password: "password", Role: "seller"})
+	rr := testserver.Request(server, "POST", "/products", `{"proudct_name":"kettle","amount_available":5,"seller_id":1,"price":20}`, seller)
+	assert.Equal(t, rr.Code, http.StatusCreated)
+
+	upload := func(contentType string, body []byte) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/products/1/images", bytes.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+seller)
+		req.Header.Set("Content-Type", contentType)
+		rr := httptest.NewRecorder()
+		server.Router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// only a body over the limit is too large
+	body := &bytes.Buffer{}
+	form := multipart.NewWriter(body)
+	part, err := form.CreateFormFile("image", "big.png")
+	assert.Equal(t, err, nil)
+	part.Write(bytes.Repeat([]byte{0}, 128<<10))
+	form.Close()
+	rr = upload(form.FormDataContentType(), body.Bytes())
+	assert.Equal(t, rr.Code, http.StatusRequestEntityTooLarge)
+	assert.Equal(t, testserver.Problem(rr).Code, apierror.PayloadTooLarge)
+
+	rr = upload("application/json", []byte(`{"image":"kettle.png"}`))
+	assert.Equal(t, rr.Code, http.StatusUnsupportedMediaType)
+	assert.Equal(t, testserver.Problem(rr).Code, apierror.UnsupportedMediaType)
+
+	rr = upload("multipart/form-data; boundary=xyz", []byte(strings.Repeat("not multipart", 3)))
+	assert.Equal(t, rr.Code, http.StatusBadRequest)
+	assert.Equal(t, testserver.Problem(rr).Code, apierror.BadRequest)
+}
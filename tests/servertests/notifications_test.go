@@ -0,0 +1,60 @@
+package servertests
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/task/api/controllers"
+	"github.com/task/api/events"
+	"github.com/task/api/models"
+	"github.com/task/api/notify"
+	"github.com/task/tests/testserver"
+	"gopkg.in/go-playground/assert.v1"
+)
+
+func TestStockNotificationsFollowTheMovements(t *testing.T) {
+
+	server := testserver.New(t, nil)
+	seller := testserver.Seed(t, server, models.User{Username: "pet", Email: "pet@gmail.com", Password: "password", Role: "seller"})
+	buyer := testserver.Seed(t, server, models.User{Username: "kan", Email: "kan@gmail.com", Password: "password", Role: "buyer"})
+
+	rr := testserver.Request(server, "POST", "/products", `{"proudct_name":"kettle","amount_available":1,"seller_id":1,"price":20}`, seller)
+	assert.Equal(t, rr.Code, http.StatusCreated)
+	rr = testserver.Request(server, "POST", "/products/1/stock-adjustments", `{"reason":"correction","quantity":-1}`, seller)
+	assert.Equal(t, rr.Code, http.StatusCreated)
+	_, err := server.Outbox.DispatchPending()
+	assert.Equal(t, err, nil)
+	assert.Equal(t, notifications(t, server, 1, notify.OutOfStock), 1)
+	rr = testserver.Request(server, "POST", "/products/1/restock-subscriptions", `{}`, buyer)
+	assert.Equal(t, rr.Code, http.StatusCreated)
+
+	// both restocks are dispatched together, after the product has all 10
+	for i := 0; i < 2; i++ {
+		rr = testserver.Request(server, "POST", "/products/1/stock-adjustments", `{"reason":"restock","quantity":5}`, seller)
+		assert.Equal(t, rr.Code, http.StatusCreated)
+	}
+	_, err = server.Outbox.DispatchPending()
+	assert.Equal(t, err, nil)
+	assert.Equal(t, notifications(t, server, 2, notify.BackInStock), 1)
+
+	// a redelivered event does not notify again
+	outbox := []models.OutboxEvent{}
+	err = server.DB.Where("type = ?", models.EventStockChanged).Order("id").Find(&outbox).Error
+	assert.Equal(t, err, nil)
+	for _, o := range outbox {
+		err = server.Bus.Publish(events.Event{ID: o.ID, Type: o.Type, SellerID: o.SellerID, Payload: json.RawMessage(o.Payload)})
+		assert.Equal(t, err, nil)
+	}
+	assert.Equal(t, notifications(t, server, 1, notify.OutOfStock), 1)
+}
+
+// notifications counts the notifications of kind in the inbox of the user.
+func notifications(t *testing.T, server *controllers.Server, uid uint32, kind string) int {
+	count := 0
+	err := server.DB.Model(&models.Notification{}).Where("user_id = ? AND type = ?", uid, kind).Count(&count).Error
+	if err != nil {
+		t.Fatalf("cannot count notifications: %v", err)
+	}
+	return count
+}
@@ -0,0 +1,44 @@
+package servertests
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/task/api/models"
+	"github.com/task/tests/testserver"
+	"gopkg.in/go-playground/assert.v1"
+)
+
+func TestUnpublishedEventsAreClaimedOnce(t *testing.T) {
+
+	server := testserver.New(t, nil)
+	_, err := models.RecordEvent(server.DB, models.EventUserCreated, 0, map[string]interface{}{"id": 1})
+	assert.Equal(t, err, nil)
+
+	now := time.Now()
+	claimed, err := models.ClaimUnpublishedEvents(server.DB, now, 10, 100)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(*claimed), 1)
+	// another instance polling at the same time gets nothing
+	others, err := models.ClaimUnpublishedEvents(server.DB, now, 10, 100)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(*others), 0)
+
+	// a failed event is given up and tried again at the next dispatch
+	err = (*claimed)[0].RecordFailure(server.DB, errors.New("broker down"))
+	assert.Equal(t, err, nil)
+	claimed, err = models.ClaimUnpublishedEvents(server.DB, now, 10, 100)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(*claimed), 1)
+
+	// the event of an instance that stopped is published after the lease
+	claimed, err = models.ClaimUnpublishedEvents(server.DB, now.Add(models.EventLease+time.Second), 10, 100)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(*claimed), 1)
+	err = (*claimed)[0].MarkPublished(server.DB)
+	assert.Equal(t, err, nil)
+	claimed, err = models.ClaimUnpublishedEvents(server.DB, now.Add(2*models.EventLease), 10, 100)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(*claimed), 0)
+}
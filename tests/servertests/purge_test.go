@@ -0,0 +1,42 @@
+package servertests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/task/api/models"
+	"github.com/task/tests/testserver"
+	"gopkg.in/go-playground/assert.v1"
+)
+
+func TestPurgesRunOnTheirOwn(t *testing.T) {
+
+	server := testserver.New(t, nil)
+	user := models.User{Username: "kan", Email: "kan@gmail.com", Password: "password", Role: "buyer"}
+	err := server.DB.Create(&user).Error
+	assert.Equal(t, err, nil)
+	old := time.Now().Add(-48 * time.Hour)
+	err = server.DB.Create(&models.IdempotencyKey{UserID: user.ID, Key: "key-1", RequestHash: "hash", Status: 200, CreatedAt: old}).Error
+	assert.Equal(t, err, nil)
+	err = server.DB.Create(&models.OutboxEvent{Type: models.EventUserCreated, Payload: "{}", PublishedAt: &old, CreatedAt: old}).Error
+	assert.Equal(t, err, nil)
+
+	count := func(model interface{}) (n int) {
+		server.DB.Model(model).Count(&n)
+		return n
+	}
+
+	// purging deleted rows leaves the keys and the events alone
+	assert.Equal(t, server.PurgeDeleted(time.Hour), nil)
+	assert.Equal(t, count(&models.IdempotencyKey{}), 1)
+	assert.Equal(t, count(&models.OutboxEvent{}), 1)
+
+	assert.Equal(t, server.PurgeIdempotencyKeys(), nil)
+	assert.Equal(t, count(&models.IdempotencyKey{}), 0)
+	assert.Equal(t, count(&models.OutboxEvent{}), 1)
+
+	assert.Equal(t, server.PurgeOutbox(72*time.Hour), nil)
+	assert.Equal(t, count(&models.OutboxEvent{}), 1)
+	assert.Equal(t, server.PurgeOutbox(24*time.Hour), nil)
+	assert.Equal(t, count(&models.OutboxEvent{}), 0)
+}
@@ -0,0 +1,125 @@
+package servertests
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/task/api/config"
+	"github.com/task/api/controllers"
+	"github.com/task/tests/testserver"
+	"gopkg.in/go-playground/assert.v1"
+)
+
+func get(server *controllers.Server, path string) (int, map[string]interface{}) {
+	req, _ := http.NewRequest("GET", path, nil)
+	rr := httptest.NewRecorder()
+	server.Router.ServeHTTP(rr, req)
+	body := map[string]interface{}{}
+	json.Unmarshal(rr.Body.Bytes(), &body)
+	return rr.Code, body
+}
+
+func TestHealthAndReadiness(t *testing.T) {
+
+	server := testserver.New(t, func(cfg *config.Config) { cfg.MigrateOnStart = false })
+
+	code, body := get(server, "/healthz")
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, body["status"], "ok")
+
+	code, body = get(server, "/readyz")
+	assert.Equal(t, code, http.StatusServiceUnavailable)
+	checks := body["checks"].(map[string]interface{})
+	assert.Equal(t, checks["database"], "ok")
+	assert.Equal(t, checks["migrations"], "2 pending")
+
+	migrator, err := server.Migrator()
+	if err != nil {
+		t.Fatalf("cannot create the migrator: %v", err)
+	}
+	_, err = migrator.Up(context.Background())
+	assert.Equal(t, err, nil)
+	code, body = get(server, "/readyz")
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, body["status"], "ready")
+
+	server.DB.Close()
+	code, body = get(server, "/readyz")
+	assert.Equal(t, code, http.StatusServiceUnavailable)
+	assert.Equal(t, body["status"], "not ready")
+}
+
+func TestInitializeReportsErrors(t *testing.T) {
+
+	server := controllers.Server{}
+	err := server.Initialize(&config.Config{DB: config.DB{Driver: "oracle", Name: "task"}})
+	assert.Equal(t, err.Error(), `cannot connect to oracle database: unsupported database driver "oracle", use postgres, mysql or sqlite`)
+}
+
+func TestServeDrainsRequestsInFlight(t *testing.T) {
+
+	server := testserver.New(t, nil)
+	entered, release := make(chan struct{}), make(chan struct{})
+	server.Router.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		close(entered)
+		<-release
+		w.WriteHeader(http.StatusOK)
+	})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- server.Serve(ctx, addr, config.HTTP{ShutdownTimeout: 5 * time.Second})
+	}()
+
+	var resp *http.Response
+	for i := 0; i < 50; i++ {
+		resp, err = http.Get("http://" + addr + "/healthz")
+		if err == nil {
+			resp.Body.Close()
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("the server did not start: %v", err)
+	}
+
+	codes := make(chan int, 1)
+	go func() {
+		resp, err := http.Get("http://" + addr + "/slow")
+		if err != nil {
+			codes <- 0
+			return
+		}
+		resp.Body.Close()
+		codes <- resp.StatusCode
+	}()
+	<-entered
+	cancel()
+
+	// the request in flight finishes, new ones are turned away
+	select {
+	case err := <-served:
+		t.Fatalf("Serve returned before the request finished: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	_, err = http.Get("http://" + addr + "/healthz")
+	assert.NotEqual(t, err, nil)
+
+	close(release)
+	assert.Equal(t, <-codes, http.StatusOK)
+	assert.Equal(t, <-served, nil)
+}
@@ -0,0 +1,38 @@
+package servertests
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/task/api/apierror"
+	"github.com/task/api/models"
+	"github.com/task/tests/testserver"
+	"gopkg.in/go-playground/assert.v1"
+)
+
+func TestDeletingTheLastVariantEmptiesTheStock(t *testing.T) {
+
+	server := testserver.New(t, nil)
+	seller := testserver.Seed(t, server, models.User{Username: "pet", Email: "pet@gmail.com", Password: "password", Role: "seller"})
+	buyer := testserver.Seed(t, server, models.User{Username: "kan", Email: "kan@gmail.com", Password: "password", Role: "buyer", Deposit: 100})
+
+	rr := testserver.Request(server, "POST", "/products", `{"proudct_name":"shirt","amount_available":5,"seller_id":1,"price":20}`, seller)
+	assert.Equal(t, rr.Code, http.StatusCreated)
+	rr = testserver.Request(server, "PUT", "/products/1/options", `[{"name":"size","values":["m"]}]`, seller)
+	assert.Equal(t, rr.Code, http.StatusOK)
+	rr = testserver.Request(server, "POST", "/products/1/variants", `{"sku":"shirt-m","options":{"size":"m"},"amount_available":3}`, seller)
+	assert.Equal(t, rr.Code, http.StatusCreated)
+
+	rr = testserver.Request(server, "DELETE", "/products/1/variants/1", "", seller)
+	assert.Equal(t, rr.Code, http.StatusNoContent)
+
+	// the stock was the variant's, it is gone with it
+	product := models.Product{}
+	err := server.DB.First(&product, 1).Error
+	assert.Equal(t, err, nil)
+	assert.Equal(t, product.AmountAvailable, float32(0))
+
+	rr = testserver.Request(server, "POST", "/buy", `{"id":1,"qty":1}`, buyer)
+	assert.Equal(t, rr.Code, http.StatusConflict)
+	assert.Equal(t, testserver.Problem(rr).Code, apierror.InsufficientStock)
+}
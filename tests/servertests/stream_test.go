@@ -0,0 +1,104 @@
+package servertests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/task/api/auth"
+	"github.com/task/api/events"
+	"github.com/task/api/models"
+	"github.com/task/api/realtime"
+	"github.com/task/tests/testserver"
+	"gopkg.in/go-playground/assert.v1"
+)
+
+func TestStreamOrigins(t *testing.T) {
+
+	server := testserver.New(t, nil)
+	server.StreamOrigins = []string{"https://shop.example.com"}
+	ts := httptest.NewServer(server.Router)
+	defer ts.Close()
+	token, err := auth.CreateToken(1, "buyer")
+	assert.Equal(t, err, nil)
+	url := "ws" + strings.TrimPrefix(ts.URL, "http") + "/v2/products/ws?product_id=1&token=" + token
+
+	for _, tt := range []struct {
+		origin string
+		status int
+	}{
+		{"", http.StatusSwitchingProtocols},
+		{ts.URL, http.StatusSwitchingProtocols},
+		{"https://shop.example.com", http.StatusSwitchingProtocols},
+		{"https://evil.example.com", http.StatusForbidden},
+	} {
+		header := http.Header{}
+		if tt.origin != "" {
+			header.Set("Origin", tt.origin)
+		}
+		conn, res, _ := websocket.DefaultDialer.Dial(url, header)
+		if conn != nil {
+			conn.Close()
+		}
+		assert.Equal(t, res.StatusCode, tt.status)
+	}
+}
+
+func TestStreamHidesTheSeller(t *testing.T) {
+
+	product := models.Product{ID: 3, ProductName: "kettle", SellerID: 2, Seller: models.User{ID: 2, Username: "pet", Email: "pet@gmail.com", Deposit: 40}}
+	payload, err := json.Marshal(product)
+	assert.Equal(t, err, nil)
+	u, ok := realtime.FromEvent(events.Event{ID: 1, Type: models.EventProductUpdated, SellerID: 2, Payload: payload})
+	assert.Equal(t, ok, true)
+	assert.Equal(t, u.ProductID, uint64(3))
+	assert.Equal(t, strings.Contains(string(u.Data), "pet@gmail.com"), false)
+	assert.Equal(t, strings.Contains(string(u.Data), "deposit"), false)
+	assert.Equal(t, strings.Contains(string(u.Data), `"seller":{"id":2,"username":"pet"}`), true)
+}
+
+func TestReplaySkipsDeadLetteredEvents(t *testing.T) {
+
+	server := testserver.New(t, nil)
+	recorded := []*models.OutboxEvent{}
+	for _, id := range []int{10, 11, 12, 13} {
+		event, err := models.RecordEvent(server.DB, models.EventProductUpdated, 1, map[string]interface{}{"id": id})
+		assert.Equal(t, err, nil)
+		recorded = append(recorded, event)
+		switch id {
+		case 11:
+			// given up on, it is never published
+			err = server.DB.Model(event).UpdateColumn("attempts", server.Outbox.AttemptLimit()).Error
+			assert.Equal(t, err, nil)
+		case 12:
+			_, err = server.Outbox.DispatchPending()
+			assert.Equal(t, err, nil)
+		}
+	}
+
+	// the replay goes past the dead event and stops at the pending one
+	updates, err := realtime.Replay(server.DB, 0, realtime.Filter{SellerIDs: []uint32{1}}, 100, server.Outbox.AttemptLimit())
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(updates), 2)
+	assert.Equal(t, updates[0].ID, recorded[0].ID)
+	assert.Equal(t, updates[1].ID, recorded[2].ID)
+}
+
+func TestWebSocketRejectsAnInvalidLastEventID(t *testing.T) {
+
+	server := testserver.New(t, nil)
+	ts := httptest.NewServer(server.Router)
+	defer ts.Close()
+	token, err := auth.CreateToken(1, "buyer")
+	assert.Equal(t, err, nil)
+	url := "ws" + strings.TrimPrefix(ts.URL, "http") + "/v2/products/ws?product_id=1&last_event_id=abc&token=" + token
+
+	conn, res, _ := websocket.DefaultDialer.Dial(url, nil)
+	if conn != nil {
+		conn.Close()
+	}
+	assert.Equal(t, res.StatusCode, http.StatusUnprocessableEntity)
+}
@@ -0,0 +1,129 @@
+package servertests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/task/api/apierror"
+	"github.com/task/api/config"
+	"github.com/task/api/models"
+	"github.com/task/api/webhooks"
+	"github.com/task/tests/testserver"
+	"gopkg.in/go-playground/assert.v1"
+)
+
+func TestWebhooksOnlyReachPublicAddresses(t *testing.T) {
+
+	server := testserver.New(t, nil)
+	seller := testserver.Seed(t, server, models.User{Username: "pet", Email: "pet@gmail.com", Password: "password", Role: "seller"})
+
+	for _, url := range []string{
+		"http://127.0.0.1:8080/hook",
+		"http://localhost/hook",
+		"http://10.0.0.7/hook",
+		"http://169.254.169.254/latest/meta-data",
+		"http://[::1]/hook",
+		"http://0.0.0.0/hook",
+	} {
+		rr := testserver.Request(server, "POST", "/webhooks", `{"url":"`+url+`","events":["product.created"]}`, seller)
+		assert.Equal(t, rr.Code, http.StatusUnprocessableEntity)
+		assert.Equal(t, testserver.Problem(rr).Errors, []apierror.FieldError{{Field: "url", Code: "invalid", Message: "Webhook URL Must Be Public"}})
+	}
+	rr := testserver.Request(server, "POST", "/webhooks", `{"url":"https://203.0.113.10/hook","events":["product.created"]}`, seller)
+	assert.Equal(t, rr.Code, http.StatusCreated)
+	rr = testserver.Request(server, "PUT", "/webhooks/1", `{"url":"http://192.168.1.1/hook"}`, seller)
+	assert.Equal(t, rr.Code, http.StatusUnprocessableEntity)
+
+	// the dialer refuses what the host resolves to when delivering
+	calls := 0
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { calls++ }))
+	defer receiver.Close()
+	webhook := models.Webhook{OwnerID: 1, URL: receiver.URL, Events: []string{models.EventStockChanged}, Active: true}
+	_, err := webhook.SaveWebhook(server.DB)
+	assert.Equal(t, err, nil)
+	_, err = models.EnqueueDeliveries(server.DB, models.EventStockChanged, 1, []byte(`{}`))
+	assert.Equal(t, err, nil)
+	dispatcher := webhooks.Dispatcher{DB: server.DB}
+	attempted, err := dispatcher.DeliverDue()
+	assert.Equal(t, err, nil)
+	assert.Equal(t, attempted, 1)
+	assert.Equal(t, calls, 0)
+	delivery := models.WebhookDelivery{}
+	deliveries, err := delivery.FindWebhookDeliveries(server.DB, webhook.ID)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, strings.Contains((*deliveries)[0].LastError, webhooks.ErrPrivateAddress.Error()), true)
+}
+
+func TestWebhooksAllowPrivateAddresses(t *testing.T) {
+
+	server := testserver.New(t, func(cfg *config.Config) { cfg.Webhooks.AllowPrivate = true })
+	seller := testserver.Seed(t, server, models.User{Username: "pet", Email: "pet@gmail.com", Password: "password", Role: "seller"})
+
+	rr := testserver.Request(server, "POST", "/webhooks", `{"url":"http://127.0.0.1:8080/hook","events":["product.created"]}`, seller)
+	assert.Equal(t, rr.Code, http.StatusCreated)
+}
+
+func TestWebhookSecretIsOnlyShownOnCreate(t *testing.T) {
+
+	server := testserver.New(t, nil)
+	seller := testserver.Seed(t, server, models.User{Username: "pet", Email: "pet@gmail.com", Password: "password", Role: "seller"})
+
+	rr := testserver.Request(server, "POST", "/webhooks", `{"url":"https://203.0.113.10/hook","events":["product.created"],"secret":"s3cret"}`, seller)
+	assert.Equal(t, rr.Code, http.StatusCreated)
+	assert.Equal(t, strings.Contains(rr.Body.String(), `"secret":"s3cret"`), true)
+
+	for _, path := range []string{"/webhooks", "/webhooks/1"} {
+		rr = testserver.Request(server, "GET", path, "", seller)
+		assert.Equal(t, rr.Code, http.StatusOK)
+		assert.Equal(t, strings.Contains(rr.Body.String(), "secret"), false)
+	}
+	rr = testserver.Request(server, "PUT", "/webhooks/1", `{"active":false}`, seller)
+	assert.Equal(t, rr.Code, http.StatusOK)
+	assert.Equal(t, strings.Contains(rr.Body.String(), "secret"), false)
+}
+
+func TestDueDeliveriesAreClaimedOnce(t *testing.T) {
+
+	server := testserver.New(t, nil)
+	testserver.Seed(t, server, models.User{Username: "pet", Email: "pet@gmail.com", Password: "password", Role: "seller"})
+	webhook := models.Webhook{OwnerID: 1, URL: "https://203.0.113.10/hook", Events: []string{models.EventStockChanged}, Active: true}
+	_, err := webhook.SaveWebhook(server.DB)
+	assert.Equal(t, err, nil)
+	_, err = models.EnqueueDeliveries(server.DB, models.EventStockChanged, 1, []byte(`{}`))
+	assert.Equal(t, err, nil)
+
+	now := time.Now()
+	claimed, err := models.ClaimDueDeliveries(server.DB, now, 10)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(*claimed), 1)
+	// another instance polling at the same time gets nothing
+	claimed, err = models.ClaimDueDeliveries(server.DB, now, 10)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(*claimed), 0)
+	// the delivery of an instance that stopped is due again after the lease
+	claimed, err = models.ClaimDueDeliveries(server.DB, now.Add(models.DeliveryLease+time.Second), 10)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(*claimed), 1)
+}
+
+func TestWebhooksCanBeCreatedInactive(t *testing.T) {
+
+	server := testserver.New(t, nil)
+	seller := testserver.Seed(t, server, models.User{Username: "pet", Email: "pet@gmail.com", Password: "password", Role: "seller"})
+
+	rr := testserver.Request(server, "POST", "/webhooks", `{"url":"https://203.0.113.10/hook","events":["stock.changed"],"active":false}`, seller)
+	assert.Equal(t, rr.Code, http.StatusCreated)
+	assert.Equal(t, strings.Contains(rr.Body.String(), `"active":false`), true)
+	rr = testserver.Request(server, "GET", "/webhooks/1", "", seller)
+	assert.Equal(t, strings.Contains(rr.Body.String(), `"active":false`), true)
+	queued, err := models.EnqueueDeliveries(server.DB, models.EventStockChanged, 1, []byte(`{}`))
+	assert.Equal(t, err, nil)
+	assert.Equal(t, queued, 0)
+
+	rr = testserver.Request(server, "POST", "/webhooks", `{"url":"https://203.0.113.10/hook","events":["stock.changed"]}`, seller)
+	assert.Equal(t, rr.Code, http.StatusCreated)
+	assert.Equal(t, strings.Contains(rr.Body.String(), `"active":true`), true)
+}
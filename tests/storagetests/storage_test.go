@@ -0,0 +1,132 @@
+package storagetests
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/task/api/storage"
+	"github.com/task/api/utils/imageutil"
+	"gopkg.in/go-playground/assert.v1"
+)
+
+// fakeS3 is a tiny in-memory stand-in for an S3 compatible server.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	auth    []string
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.auth = append(f.auth, r.Header.Get("Authorization"))
+	if r.Header.Get("X-Amz-Date") == "" || r.Header.Get("X-Amz-Content-Sha256") == "" {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	switch r.Method {
+	case http.MethodPut:
+		body, _ := ioutil.ReadAll(r.Body)
+		f.objects[r.URL.Path] = body
+	case http.MethodGet:
+		body, ok := f.objects[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(body)
+	case http.MethodDelete:
+		delete(f.objects, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func testStore(t *testing.T, store storage.BlobStore) {
+	err := store.Put("products/1/a.png", strings.NewReader("hello"), "image/png")
+	if err != nil {
+		t.Fatalf("cannot put blob: %v", err)
+	}
+	blob, err := store.Get("products/1/a.png")
+	if err != nil {
+		t.Fatalf("cannot get blob: %v", err)
+	}
+	data, _ := ioutil.ReadAll(blob)
+	blob.Close()
+	assert.Equal(t, string(data), "hello")
+
+	err = store.Delete("products/1/a.png")
+	if err != nil {
+		t.Fatalf("cannot delete blob: %v", err)
+	}
+	_, err = store.Get("products/1/a.png")
+	assert.Equal(t, err, storage.ErrNotFound)
+
+	err = store.Put("../escape.png", strings.NewReader("x"), "image/png")
+	assert.Equal(t, err, storage.ErrInvalidKey)
+}
+
+func TestLocalStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := storage.NewLocalStore(dir, "/images/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStore(t, store)
+	assert.Equal(t, store.URL("products/1/a.png"), "/images/products/1/a.png")
+}
+
+func TestS3Store(t *testing.T) {
+	fake := &fakeS3{objects: map[string][]byte{}}
+	ts := httptest.NewServer(fake)
+	defer ts.Close()
+
+	store := &storage.S3Store{
+		Endpoint:  ts.URL,
+		Region:    "us-east-1",
+		Bucket:    "media",
+		AccessKey: "AKID",
+		SecretKey: "secret",
+	}
+	testStore(t, store)
+	assert.Equal(t, strings.HasPrefix(fake.auth[0], "AWS4-HMAC-SHA256 Credential=AKID/"), true)
+	assert.Equal(t, strings.Contains(fake.auth[0], "/us-east-1/s3/aws4_request"), true)
+	assert.Equal(t, store.URL("products/1/a.png"), ts.URL+"/media/products/1/a.png")
+}
+
+func TestThumbnail(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 800, 400))
+	for x := 0; x < 800; x++ {
+		img.Set(x, 0, color.RGBA{255, 0, 0, 255})
+	}
+	buf := new(bytes.Buffer)
+	png.Encode(buf, img)
+
+	contentType, ext, err := imageutil.Sniff(buf.Bytes())
+	assert.Equal(t, err, nil)
+	assert.Equal(t, contentType, "image/png")
+	assert.Equal(t, ext, "png")
+
+	thumb, thumbType, err := imageutil.Thumbnail(buf.Bytes(), 200)
+	if err != nil {
+		t.Fatalf("cannot make thumbnail: %v", err)
+	}
+	assert.Equal(t, thumbType, "image/png")
+	w, h, err := imageutil.Dimensions(thumb)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, w, 200)
+	assert.Equal(t, h, 100)
+
+	_, _, err = imageutil.Sniff([]byte("<html><script>alert(1)</script></html>"))
+	assert.Equal(t, err, imageutil.ErrUnsupportedType)
+}
@@ -0,0 +1,86 @@
+// Package testserver is the harness of the tests that run the API on SQLite:
+// a server on a fresh database removed after the test, requests to its
+// router and users to sign in with.
+package testserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/task/api/auth"
+	"github.com/task/api/config"
+	"github.com/task/api/controllers"
+	"github.com/task/api/models"
+	"github.com/task/api/responses"
+)
+
+// Config returns the configuration of a server on a fresh SQLite database,
+// migrated on start, in a directory removed after the test.
+func Config(t *testing.T) *config.Config {
+	dir, err := ioutil.TempDir("", "testserver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return &config.Config{
+		APISecret:      "secret",
+		DB:             config.DB{Driver: "sqlite", Name: filepath.Join(dir, "task.db")},
+		MigrateOnStart: true,
+		Storage:        config.Storage{Driver: "local", LocalRoot: filepath.Join(dir, "uploads")},
+		Notify:         config.Notify{Channels: []string{"inbox"}},
+	}
+}
+
+// Start initializes server with cfg and closes its database after the test.
+func Start(t *testing.T, server *controllers.Server, cfg *config.Config) *controllers.Server {
+	if err := server.Initialize(cfg); err != nil {
+		t.Fatalf("cannot initialize the server: %v", err)
+	}
+	t.Cleanup(func() { server.DB.Close() })
+	return server
+}
+
+// New starts a server with Config, changed by configure when it is set.
+func New(t *testing.T, configure func(cfg *config.Config)) *controllers.Server {
+	cfg := Config(t)
+	if configure != nil {
+		configure(cfg)
+	}
+	return Start(t, &controllers.Server{}, cfg)
+}
+
+// Request sends a request with body to the router of server, signed in with
+// token when it is set.
+func Request(server *controllers.Server, method, path, body, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rr := httptest.NewRecorder()
+	server.Router.ServeHTTP(rr, req)
+	return rr
+}
+
+// Problem decodes the problem a request was answered with.
+func Problem(rr *httptest.ResponseRecorder) responses.Problem {
+	problem := responses.Problem{}
+	json.Unmarshal(rr.Body.Bytes(), &problem)
+	return problem
+}
+
+// Seed saves user and returns a token of theirs.
+func Seed(t *testing.T, server *controllers.Server, user models.User) string {
+	if _, err := user.SaveUser(server.DB); err != nil {
+		t.Fatalf("cannot seed %s: %v", user.Username, err)
+	}
+	token, err := auth.CreateToken(user.ID, user.Role)
+	if err != nil {
+		t.Fatalf("cannot create token: %v", err)
+	}
+	return token
+}
@@ -0,0 +1,134 @@
+package tracingtests
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/task/api/auth"
+	"github.com/task/api/controllers"
+	"github.com/task/api/models"
+	"github.com/task/api/webhooks"
+	"github.com/task/tests/testserver"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"gopkg.in/go-playground/assert.v1"
+)
+
+const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func initialize(t *testing.T) (*controllers.Server, *tracetest.InMemoryExporter) {
+	exporter := tracetest.NewInMemoryExporter()
+	server := &controllers.Server{Tracing: sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))}
+	return testserver.Start(t, server, testserver.Config(t)), exporter
+}
+
+func attr(span tracetest.SpanStub, key attribute.Key) attribute.Value {
+	for _, kv := range span.Attributes {
+		if kv.Key == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestRequestAndQuerySpans(t *testing.T) {
+
+	server, exporter := initialize(t)
+	seller := models.User{Username: "pet", Email: "pet@gmail.com", Password: "password", Role: "seller"}
+	if _, err := seller.SaveUser(server.DB); err != nil {
+		t.Fatalf("cannot seed seller: %v", err)
+	}
+	buyer := models.User{Username: "steven", Email: "steven@gmail.com", Password: "password", Role: "buyer", Deposit: 50}
+	if _, err := buyer.SaveUser(server.DB); err != nil {
+		t.Fatalf("cannot seed buyer: %v", err)
+	}
+	kettle := models.Product{ProductName: "kettle", AmountAvailable: 5, Price: 20, SellerID: seller.ID}
+	if _, err := kettle.SaveProduct(server.DB); err != nil {
+		t.Fatalf("cannot seed product: %v", err)
+	}
+	// queries made outside of a request are not traced
+	assert.Equal(t, len(exporter.GetSpans()), 0)
+
+	token, err := auth.CreateToken(buyer.ID, buyer.Role)
+	if err != nil {
+		t.Fatalf("cannot create token: %v", err)
+	}
+	req := httptest.NewRequest("POST", "/buy", bytes.NewBufferString(`{"id":1,"qty":2}`))
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("traceparent", traceparent)
+	rr := httptest.NewRecorder()
+	server.Router.ServeHTTP(rr, req)
+	assert.Equal(t, rr.Code, http.StatusCreated)
+
+	spans := exporter.GetSpans()
+	var request tracetest.SpanStub
+	for _, span := range spans {
+		if span.SpanKind == trace.SpanKindServer {
+			request = span
+		}
+	}
+	assert.Equal(t, request.Name, "POST /buy")
+	assert.Equal(t, request.SpanContext.TraceID().String(), "4bf92f3577b34da6a3ce929d0e0e4736")
+	assert.Equal(t, request.Parent.SpanID().String(), "00f067aa0ba902b7")
+	assert.Equal(t, attr(request, "http.route").AsString(), "/buy")
+	assert.Equal(t, attr(request, "enduser.id").AsString(), "2")
+	assert.Equal(t, attr(request, "http.response.status_code").AsInt64(), int64(201))
+
+	queries := map[string]bool{}
+	for _, span := range spans {
+		if span.SpanKind != trace.SpanKindClient {
+			continue
+		}
+		queries[span.Name] = true
+		assert.Equal(t, span.Parent.SpanID(), request.SpanContext.SpanID())
+		assert.Equal(t, attr(span, "db.system").AsString(), "sqlite")
+		if strings.Contains(attr(span, "db.query.text").AsString(), "steven@gmail.com") {
+			t.Errorf("%s has the bound values", span.Name)
+		}
+	}
+	for _, name := range []string{"SELECT users", "SELECT products", "UPDATE products", "UPDATE users", "INSERT inventory_movements", "INSERT outbox_events"} {
+		assert.Equal(t, queries[name], true)
+	}
+}
+
+func TestWebhookPropagation(t *testing.T) {
+
+	server, exporter := initialize(t)
+	seller := models.User{Username: "pet", Email: "pet@gmail.com", Password: "password", Role: "seller"}
+	if _, err := seller.SaveUser(server.DB); err != nil {
+		t.Fatalf("cannot seed seller: %v", err)
+	}
+
+	received := ""
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Get("traceparent")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+	webhook := models.Webhook{OwnerID: seller.ID, URL: receiver.URL, Secret: "s3cret", Events: []string{models.EventStockChanged}, Active: true}
+	if _, err := webhook.SaveWebhook(server.DB); err != nil {
+		t.Fatalf("cannot save the webhook: %v", err)
+	}
+	if _, err := models.EnqueueDeliveries(server.DB, models.EventStockChanged, seller.ID, []byte(`{}`)); err != nil {
+		t.Fatalf("cannot enqueue the delivery: %v", err)
+	}
+
+	dispatcher := webhooks.Dispatcher{DB: server.DB, Tracing: server.Tracing, AllowPrivate: true}
+	attempted, err := dispatcher.DeliverDue()
+	assert.Equal(t, err, nil)
+	assert.Equal(t, attempted, 1)
+
+	var delivery tracetest.SpanStub
+	for _, span := range exporter.GetSpans() {
+		if span.Name == "webhook "+models.EventStockChanged {
+			delivery = span
+		}
+	}
+	assert.Equal(t, received, "00-"+delivery.SpanContext.TraceID().String()+"-"+delivery.SpanContext.SpanID().String()+"-01")
+	assert.Equal(t, attr(delivery, "http.response.status_code").AsInt64(), int64(http.StatusNoContent))
+}
@@ -0,0 +1,170 @@
+package validationtests
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/task/api/apierror"
+	"github.com/task/api/auth"
+	"github.com/task/api/config"
+	"github.com/task/api/models"
+	"github.com/task/api/requests"
+	"github.com/task/api/validation"
+	"github.com/task/tests/testserver"
+	"gopkg.in/go-playground/assert.v1"
+)
+
+// fields returns the violations of err, nil when it is not a validation error.
+func fields(err error) []apierror.FieldError {
+	e, ok := err.(*apierror.Error)
+	if !ok || e.Code != apierror.ValidationFailed {
+		return nil
+	}
+	return e.Fields
+}
+
+func TestStruct(t *testing.T) {
+
+	assert.Equal(t, validation.Struct(&requests.NewUser{Username: "pet", Email: "pet@gmail.com", Password: "password", Role: "buyer"}), nil)
+
+	// every violation is reported, not only the first
+	err := validation.Struct(&requests.NewUser{Email: "petgmail.com", Password: "pass", Role: "admin", Deposit: -1})
+	assert.Equal(t, fields(err), []apierror.FieldError{
+		{Field: "username", Code: "required", Message: "Required Username"},
+		{Field: "email", Code: "email", Message: "Invalid Email"},
+		{Field: "password", Code: "min", Message: "Password Must Have At Least 6 Characters"},
+		{Field: "role", Code: "enum", Message: "Invalid Role, Use buyer, seller"},
+		{Field: "deposit", Code: "min", Message: "Deposit Must Be At Least 0"},
+	})
+
+	// rules after dive apply to the elements, with their index in the path
+	err = validation.Struct(&requests.NewProduct{
+		ProductName:     "kettle",
+		AmountAvailable: 1,
+		SellerID:        1,
+		Price:           10,
+		TagNames:        []string{"kitchen", " ", strings.Repeat("a", 101)},
+	})
+	assert.Equal(t, fields(err), []apierror.FieldError{
+		{Field: "tag_names[1]", Code: "required", Message: "Required TagNames"},
+		{Field: "tag_names[2]", Code: "max", Message: "TagNames Must Have At Most 100 Characters"},
+	})
+
+	// slices of payloads are checked element by element
+	err = validation.Struct(&[]requests.ProductOption{{Name: "color", Values: []string{"red"}}, {Name: "size"}})
+	assert.Equal(t, fields(err), []apierror.FieldError{{Field: "[1].values", Code: "required", Message: "Required Values"}})
+
+	// a nil pointer has no value, a pointer to zero has one
+	assert.Equal(t, validation.Struct(&requests.Variant{SKU: "KT-1"}), nil)
+	zero := float32(0)
+	err = validation.Struct(&requests.Variant{SKU: "KT-1", Price: &zero})
+	assert.Equal(t, fields(err), []apierror.FieldError{{Field: "price", Code: "min", Message: "Price Must Be At Least 1"}})
+
+	// rules across fields come from Check
+	err = validation.Struct(&requests.Buy{Qty: 1})
+	assert.Equal(t, fields(err), []apierror.FieldError{{Field: "id", Code: "required", Message: "Required Product id"}})
+	assert.Equal(t, validation.Struct(&requests.Buy{SKU: "KT-1", Qty: 1}), nil)
+
+	webhookURL := "ftp://example.com"
+	err = validation.Struct(&requests.WebhookUpdate{URL: &webhookURL, Events: []string{"user.created", "user.deleted"}})
+	assert.Equal(t, fields(err), []apierror.FieldError{
+		{Field: "url", Code: "url", Message: "Invalid URL"},
+		{Field: "events[1]", Code: "enum", Message: "Invalid Events, Use user.created, deposit.changed, product.created, product.updated, product.deleted, purchase.completed, stock.changed"},
+	})
+}
+
+func decode(body string, limit int64, v interface{}) error {
+	req := httptest.NewRequest("POST", "/", bytes.NewBufferString(body))
+	return validation.Decode(req, limit, v)
+}
+
+func TestDecode(t *testing.T) {
+
+	login := requests.Login{}
+	assert.Equal(t, decode(`{"email":"pet@gmail.com","password":"password"}`, 0, &login), nil)
+	assert.Equal(t, login.Email, "pet@gmail.com")
+
+	samples := []struct {
+		body   string
+		limit  int64
+		code   string
+		detail string
+		fields []apierror.FieldError
+	}{
+		{`{"email":"pet@gmail.com","password":"password","remember":true,"Role":"admin"}`, 0, apierror.ValidationFailed, "Unknown Field Role", []apierror.FieldError{
+			{Field: "Role", Code: "unknown", Message: "Unknown Field Role"},
+			{Field: "remember", Code: "unknown", Message: "Unknown Field remember"},
+		}},
+		{`{"email":"pet@gmail.com","password":12}`, 0, apierror.ValidationFailed, "Invalid password, Expected string", []apierror.FieldError{
+			{Field: "password", Code: "type", Message: "Invalid password, Expected string"},
+		}},
+		{`{"email":`, 0, apierror.BadRequest, "Malformed JSON", nil},
+		{`{"email":"pet@gmail.com"}{}`, 0, apierror.BadRequest, "Body Must Be One JSON Value", nil},
+		{`{"email":"pet@gmail.com","password":"password"}`, 16, apierror.PayloadTooLarge, "Body Larger Than 16 Bytes", nil},
+		{``, 0, apierror.ValidationFailed, "Required Email", []apierror.FieldError{
+			{Field: "email", Code: "required", Message: "Required Email"},
+			{Field: "password", Code: "required", Message: "Required Password"},
+		}},
+	}
+	for _, v := range samples {
+		err := decode(v.body, v.limit, &requests.Login{})
+		e, ok := err.(*apierror.Error)
+		assert.Equal(t, ok, true)
+		assert.Equal(t, e.Code, v.code)
+		assert.Equal(t, strings.HasPrefix(e.Detail, v.detail), true)
+		assert.Equal(t, e.Fields, v.fields)
+	}
+
+	// unknown fields are found in nested payloads too
+	err := decode(`[{"name":"color","values":["red"],"position":1}]`, 0, &[]requests.ProductOption{})
+	assert.Equal(t, fields(err), []apierror.FieldError{{Field: "[0].position", Code: "unknown", Message: "Unknown Field position"}})
+
+	// a list has no empty value to check
+	err = decode(``, 0, &[]requests.ProductOption{})
+	assert.Equal(t, err.(*apierror.Error).Code, apierror.BadRequest)
+}
+
+func TestPayloads(t *testing.T) {
+
+	server := testserver.New(t, func(cfg *config.Config) { cfg.BodyMaxBytes = 256 })
+	seller := models.User{Username: "pet", Email: "pet@gmail.com", Password: "password", Role: "seller"}
+	if _, err := seller.SaveUser(server.DB); err != nil {
+		t.Fatalf("cannot seed seller: %v", err)
+	}
+	token, err := auth.CreateToken(uint32(seller.ID), seller.Role)
+	if err != nil {
+		t.Fatalf("cannot create token: %v", err)
+	}
+
+	// the field name that is not the API's is reported, not only the value it misses
+	rr := testserver.Request(server, "POST", "/products", `{"product_name":"kettle","amount_available":5,"seller_id":1,"price":0}`, token)
+	problem := testserver.Problem(rr)
+	assert.Equal(t, rr.Code, http.StatusUnprocessableEntity)
+	assert.Equal(t, problem.Code, apierror.ValidationFailed)
+	assert.Equal(t, problem.Errors, []apierror.FieldError{{Field: "product_name", Code: "unknown", Message: "Unknown Field product_name"}})
+
+	rr = testserver.Request(server, "POST", "/products", `{"proudct_name":"","amount_available":0,"seller_id":1,"price":0}`, token)
+	problem = testserver.Problem(rr)
+	assert.Equal(t, rr.Code, http.StatusUnprocessableEntity)
+	assert.Equal(t, len(problem.Errors), 3)
+	assert.Equal(t, problem.Errors[0].Field, "proudct_name")
+	assert.Equal(t, problem.Errors[1].Field, "amount_available")
+	assert.Equal(t, problem.Errors[2].Field, "price")
+
+	rr = testserver.Request(server, "POST", "/products", `{"proudct_name":"kettle","amount_available":5,"seller_id":1,"price":20}`, token)
+	assert.Equal(t, rr.Code, http.StatusCreated)
+
+	// the limit is BODY_MAX_BYTES
+	rr = testserver.Request(server, "POST", "/login", `{"email":"pet@gmail.com","password":"`+strings.Repeat("a", 300)+`"}`, "")
+	problem = testserver.Problem(rr)
+	assert.Equal(t, rr.Code, http.StatusRequestEntityTooLarge)
+	assert.Equal(t, problem.Code, apierror.PayloadTooLarge)
+
+	rr = testserver.Request(server, "POST", "/login", `{"email":"pet@gmail.com",`, "")
+	problem = testserver.Problem(rr)
+	assert.Equal(t, rr.Code, http.StatusBadRequest)
+	assert.Equal(t, problem.Code, apierror.BadRequest)
+}
@@ -0,0 +1,110 @@
+package versiontests
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/task/api/apierror"
+	"github.com/task/api/models"
+	"github.com/task/api/resources"
+	"github.com/task/api/responses"
+	"github.com/task/tests/testserver"
+	"gopkg.in/go-playground/assert.v1"
+)
+
+func TestVersions(t *testing.T) {
+
+	server := testserver.New(t, nil)
+	seller := testserver.Seed(t, server, models.User{Username: "pet", Email: "pet@gmail.com", Password: "password", Role: "seller"})
+
+	// the routes without a prefix are v1 and deprecated
+	rr := testserver.Request(server, "POST", "/products", `{"proudct_name":"kettle","amount_available":5,"seller_id":1,"price":20}`, seller)
+	assert.Equal(t, rr.Code, http.StatusCreated)
+	assert.Equal(t, rr.Header().Get("Lacation"), "example.com/products/1")
+	assert.Equal(t, strings.Contains(rr.Body.String(), `"proudct_name":"kettle"`), true)
+	assert.Equal(t, rr.Header().Get("Deprecation"), "@1792368000")
+	assert.Equal(t, rr.Header().Get("Link"), `</v1/products>; rel="successor-version"`)
+
+	rr = testserver.Request(server, "POST", "/v1/products", `{"proudct_name":"toaster","amount_available":5,"seller_id":1,"price":30}`, seller)
+	assert.Equal(t, rr.Code, http.StatusCreated)
+	assert.Equal(t, rr.Header().Get("Lacation"), "example.com/v1/products/2")
+	assert.Equal(t, rr.Header().Get("Deprecation"), "")
+	rr = testserver.Request(server, "GET", "/v1/products/2", "", seller)
+	assert.Equal(t, rr.Code, http.StatusOK)
+	assert.Equal(t, strings.Contains(rr.Body.String(), `"proudct_name":"toaster"`), true)
+
+	// v2 has the names fixed and rejects the old ones
+	rr = testserver.Request(server, "POST", "/v2/products", `{"proudct_name":"grill","amount_available":5,"price":40}`, seller)
+	assert.Equal(t, rr.Code, http.StatusUnprocessableEntity)
+	problem := responses.Problem{}
+	json.Unmarshal(rr.Body.Bytes(), &problem)
+	assert.Equal(t, problem.Errors[0].Field, "proudct_name")
+	assert.Equal(t, problem.Errors[0].Code, "unknown")
+
+	rr = testserver.Request(server, "POST", "/v2/products", `{"product_name":"grill","amount_available":5,"price":40,"tag_names":["Summer"]}`, seller)
+	assert.Equal(t, rr.Code, http.StatusCreated)
+	assert.Equal(t, rr.Header().Get("Location"), "/v2/products/3")
+	assert.Equal(t, rr.Header().Get("Lacation"), "")
+	product := resources.Product{}
+	json.Unmarshal(rr.Body.Bytes(), &product)
+	assert.Equal(t, product.ProductName, "grill")
+	assert.Equal(t, product.Seller, resources.Seller{ID: 1, Username: "pet"})
+	assert.Equal(t, product.Tags, []string{"summer"})
+	// the seller's email is not part of the product
+	assert.Equal(t, strings.Contains(rr.Body.String(), "pet@gmail.com"), false)
+
+	rr = testserver.Request(server, "PUT", "/v2/products/3", `{"product_name":"grill pro","amount_available":7}`, seller)
+	assert.Equal(t, rr.Code, http.StatusOK)
+	json.Unmarshal(rr.Body.Bytes(), &product)
+	assert.Equal(t, product.ProductName, "grill pro")
+	assert.Equal(t, product.Price, float32(40))
+
+	rr = testserver.Request(server, "GET", "/v2/products", "", seller)
+	assert.Equal(t, rr.Code, http.StatusOK)
+	products := []resources.Product{}
+	json.Unmarshal(rr.Body.Bytes(), &products)
+	assert.Equal(t, len(products), 3)
+	assert.Equal(t, strings.Contains(rr.Body.String(), "proudct_name"), false)
+
+	// the other routes are shared, with the Location of v2
+	rr = testserver.Request(server, "POST", "/v2/users", `{"username":"kan","email":"kan@gmail.com","password":"password","role":"buyer"}`, "")
+	assert.Equal(t, rr.Code, http.StatusCreated)
+	assert.Equal(t, rr.Header().Get("Location"), "/v2/users/2")
+
+	rr = testserver.Request(server, "GET", "/v3/products", "", seller)
+	assert.Equal(t, rr.Code, http.StatusNotFound)
+	rr = testserver.Request(server, "PATCH", "/v2/products/3", "", seller)
+	assert.Equal(t, rr.Code, http.StatusMethodNotAllowed)
+}
+
+func TestBuy(t *testing.T) {
+
+	server := testserver.New(t, nil)
+	seller := testserver.Seed(t, server, models.User{Username: "pet", Email: "pet@gmail.com", Password: "password", Role: "seller"})
+	buyer := testserver.Seed(t, server, models.User{Username: "kan", Email: "kan@gmail.com", Password: "password", Role: "buyer", Deposit: 100})
+	rr := testserver.Request(server, "POST", "/v2/products", `{"product_name":"kettle","amount_available":5,"price":20}`, seller)
+	assert.Equal(t, rr.Code, http.StatusCreated)
+
+	rr = testserver.Request(server, "POST", "/v1/buy", `{"id":1,"qty":1}`, buyer)
+	assert.Equal(t, rr.Code, http.StatusCreated)
+	assert.Equal(t, rr.Header().Get("Lacation"), "example.com/v1/buy/1")
+	assert.Equal(t, strings.Contains(rr.Body.String(), `"proudct_name":"kettle"`), true)
+
+	rr = testserver.Request(server, "POST", "/v2/buy", `{"id":1,"qty":1}`, buyer)
+	assert.Equal(t, rr.Code, http.StatusUnprocessableEntity)
+
+	rr = testserver.Request(server, "POST", "/v2/buy", `{"product_id":1,"qty":2}`, buyer)
+	assert.Equal(t, rr.Code, http.StatusOK)
+	assert.Equal(t, rr.Header().Get("Location"), "")
+	purchase := resources.Purchase{}
+	json.Unmarshal(rr.Body.Bytes(), &purchase)
+	assert.Equal(t, purchase, resources.Purchase{ProductID: 1, Qty: 2, UnitPrice: 20, Total: 40, Deposit: 40})
+
+	rr = testserver.Request(server, "POST", "/v2/buy", `{"product_id":1,"qty":5}`, buyer)
+	assert.Equal(t, rr.Code, http.StatusConflict)
+	problem := responses.Problem{}
+	json.Unmarshal(rr.Body.Bytes(), &problem)
+	assert.Equal(t, problem.Code, apierror.InsufficientStock)
+}